@@ -0,0 +1,59 @@
+package crypt
+
+import (
+	"context"
+	stdpath "path"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// appleDoublePrefix starts the names of the AppleDouble files macOS writes next to files on
+// filesystems without resource forks, ._name holds the metadata of name
+const appleDoublePrefix = "._"
+
+const appleDoubleHide = "hide"
+
+func isAppleDouble(name string) bool {
+	return len(name) > len(appleDoublePrefix) && strings.HasPrefix(name, appleDoublePrefix)
+}
+
+// hiddenAppleDouble reports whether the object called name is left out of listings
+func (d *Crypt) hiddenAppleDouble(name string, isDir bool) bool {
+	return d.AppleDouble == appleDoubleHide && !isDir && isAppleDouble(name)
+}
+
+// syncAppleDouble applies fn to the AppleDouble file of obj if there is one, with AppleDouble hide,
+// where the client can't see it to handle it itself. failures are only logged like for the meta sidecar
+func (d *Crypt) syncAppleDouble(ctx context.Context, obj model.Obj, fn func(sidecar model.Obj, remoteActualPath string) error) {
+	if d.AppleDouble != appleDoubleHide || isAppleDouble(obj.GetName()) {
+		return
+	}
+	sidecarPath := stdpath.Join(stdpath.Dir(obj.GetPath()), appleDoublePrefix+obj.GetName())
+	sidecar, err := d.get(ctx, sidecarPath)
+	if err != nil || sidecar.IsDir() {
+		return
+	}
+	remoteActualPath, err := d.getObjActualPathForRemote(sidecar)
+	if err == nil {
+		err = fn(sidecar, remoteActualPath)
+	}
+	if err != nil {
+		log.Warnf("failed to update the AppleDouble file %s: %s", sidecarPath, err)
+	}
+}
+
+// hideAppleDoubles drops the AppleDouble files from a listing and their remote names alongside
+func (d *Crypt) hideAppleDoubles(objs []model.Obj, remoteNames []string) ([]model.Obj, []string) {
+	var keptObjs []model.Obj
+	var keptNames []string
+	for i, obj := range objs {
+		if d.hiddenAppleDouble(obj.GetName(), obj.IsDir()) {
+			continue
+		}
+		keptObjs = append(keptObjs, obj)
+		keptNames = append(keptNames, remoteNames[i])
+	}
+	return keptObjs, keptNames
+}
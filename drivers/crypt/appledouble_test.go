@@ -0,0 +1,96 @@
+package crypt
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestAppleDouble(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"apple_double": "hide"})
+	for _, dir := range []string{"/docs", "/archive"} {
+		if err := op.MakeDir(ctx, d, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fork := testData(300)
+	putFile(t, d, "/docs", "a.txt", testData(1000))
+	putFile(t, d, "/docs", "._a.txt", fork)
+	putFile(t, d, "/docs", "._orphan", testData(10))
+
+	names := func(dir string) []string {
+		objs, err := op.List(ctx, d, dir, model.ListArgs{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, obj := range objs {
+			names = append(names, obj.GetName())
+		}
+		sort.Strings(names)
+		return names
+	}
+	if got := names("/docs"); len(got) != 1 || got[0] != "a.txt" {
+		t.Errorf("expect the AppleDouble files to be hidden, got %v", got)
+	}
+	// a hidden file is still there for a client asking for it
+	if got := readRange(t, d, "/docs/._a.txt", http_range.Range{Length: -1}); string(got) != string(fork) {
+		t.Errorf("read mismatch of the AppleDouble file")
+	}
+
+	if err := op.Rename(ctx, d, "/docs/a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := op.Get(ctx, d, "/docs/._b.txt"); err != nil {
+		t.Errorf("expect the AppleDouble file to follow the rename: %v", err)
+	}
+	if err := op.Copy(ctx, d, "/docs/b.txt", "/archive"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := op.Get(ctx, d, "/archive/._b.txt"); err != nil {
+		t.Errorf("expect the AppleDouble file to follow the copy: %v", err)
+	}
+	if err := op.Move(ctx, d, "/docs/b.txt", "/"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRange(t, d, "/._b.txt", http_range.Range{Length: -1}); string(got) != string(fork) {
+		t.Errorf("expect the AppleDouble file to follow the move")
+	}
+	if err := op.Remove(ctx, d, "/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := op.Get(ctx, d, "/._b.txt"); err == nil {
+		t.Errorf("expect the AppleDouble file to be removed with its file, got %v", m.paths())
+	}
+	// the AppleDouble file of no file stays where it is
+	if _, err := op.Get(ctx, d, "/docs/._orphan"); err != nil {
+		t.Errorf("expect the orphan AppleDouble file to be kept: %v", err)
+	}
+}
+
+func TestAppleDoubleShown(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	putFile(t, d, "/", "a.txt", testData(100))
+	putFile(t, d, "/", "._a.txt", testData(10))
+	if err := op.Rename(ctx, d, "/a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Errorf("expect the AppleDouble file to be listed, got %d objects", len(objs))
+	}
+	if _, err = op.Get(ctx, d, "/._a.txt"); err != nil {
+		t.Errorf("expect the AppleDouble file to be left alone: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package crypt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/driver"
+	"github.com/alist-org/alist/v3/internal/fs"
+	"github.com/alist-org/alist/v3/internal/model"
+)
+
+// batchRemover and modTimeSetter are the optional operations a remote may offer beyond the
+// interfaces of the driver package, Capabilities reports them for the tools that use them
+type batchRemover interface {
+	BatchRemove(ctx context.Context, objs []model.Obj) error
+}
+
+type modTimeSetter interface {
+	SetModTime(ctx context.Context, obj model.Obj, modified time.Time) error
+}
+
+// capabilitiesOf tells what remote supports from the interfaces it implements
+func capabilitiesOf(remote driver.Driver) Capabilities {
+	_, copier := remote.(driver.Copy)
+	_, copierResult := remote.(driver.CopyResult)
+	_, renamer := remote.(driver.Rename)
+	_, renamerResult := remote.(driver.RenameResult)
+	_, batch := remote.(batchRemover)
+	_, modTime := remote.(modTimeSetter)
+	return Capabilities{
+		Range:       true,
+		Copy:        copier || copierResult,
+		Rename:      renamer || renamerResult,
+		BatchDelete: batch,
+		SetModtime:  modTime,
+	}
+}
+
+// capabilityState is the Capabilities of the remote storage, computed again when the remote is reloaded
+type capabilityState struct {
+	mu     sync.Mutex
+	remote driver.Driver
+	caps   Capabilities
+}
+
+// set computes the capabilities of remote unless they are of it already
+func (s *capabilityState) set(remote driver.Driver) Capabilities {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.remote != remote {
+		s.remote, s.caps = remote, capabilitiesOf(remote)
+	}
+	return s.caps
+}
+
+// noRange records that the remote answered a ranged request with the whole file,
+// it tells whether the remote was thought to read ranges until then
+func (s *capabilityState) noRange() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ranged := s.caps.Range
+	s.caps.Range = false
+	return ranged
+}
+
+// Capabilities reports the operations the remote storage supports, so the UI and tools can adapt.
+// a reloaded remote is a new driver, its capabilities are computed again
+func (d *Crypt) Capabilities(ctx context.Context) (Capabilities, error) {
+	if err := d.resolve(ctx); err != nil {
+		return Capabilities{}, err
+	}
+	remote, err := fs.GetStorage(d.RemotePath, &fs.GetStoragesArgs{})
+	if err != nil {
+		return Capabilities{}, err
+	}
+	return d.caps.set(remote), nil
+}
@@ -0,0 +1,78 @@
+package crypt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/driver"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+// basicRemote only has the methods every driver has
+type basicRemote struct {
+	driver.Driver
+}
+
+// richRemote offers the optional operations on top of memRemote
+type richRemote struct {
+	*memRemote
+}
+
+func (d richRemote) BatchRemove(ctx context.Context, objs []model.Obj) error {
+	return nil
+}
+
+func (d richRemote) SetModTime(ctx context.Context, obj model.Obj, modified time.Time) error {
+	return nil
+}
+
+func TestCapabilitiesOf(t *testing.T) {
+	remotes := []struct {
+		name   string
+		remote driver.Driver
+		want   Capabilities
+	}{
+		{"basic", basicRemote{&memRemote{}}, Capabilities{Range: true}},
+		{"mem", &memRemote{}, Capabilities{Range: true, Copy: true, Rename: true}},
+		{"rich", richRemote{&memRemote{}}, Capabilities{Range: true, Copy: true, Rename: true, BatchDelete: true, SetModtime: true}},
+	}
+	for _, r := range remotes {
+		if got := capabilitiesOf(r.remote); got != r.want {
+			t.Errorf("%s: expect %+v, got %+v", r.name, r.want, got)
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	ctx := context.Background()
+	_, remotePath := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remotePath, nil)
+	caps, err := d.Capabilities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Capabilities{Range: true, Copy: true, Rename: true}); caps != want {
+		t.Errorf("expect %+v, got %+v", want, caps)
+	}
+
+	d.caps.noRange()
+	if caps, _ = d.Capabilities(ctx); caps.Range {
+		t.Errorf("expect a remote seen ignoring ranges to be reported")
+	}
+	remote, err := op.GetStorageByMountPath(remotePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := remote.GetStorage().ID
+	if err = op.DisableStorage(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err = op.EnableStorage(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if caps, _ = d.Capabilities(ctx); !caps.Range {
+		t.Errorf("expect the capabilities of a reloaded remote to be computed again")
+	}
+}
@@ -0,0 +1,99 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+// CaseCollision options
+const (
+	caseCollisionRefuse = "refuse"
+	caseCollisionSuffix = "suffix"
+)
+
+// caseCollisionTries is the most suffixes tried for a name with CaseCollision suffix
+const caseCollisionTries = 100
+
+// resolveCaseCollision returns the name to store the object called name under in the remote directory
+// dirActualPath, with its remote name given by remoteName. with CaseCollision, a remote name that only
+// differs in case from the one of another object is refused, or the name gets a suffix like " (1)".
+// self is the remote name of the object being renamed, if any
+func (d *Crypt) resolveCaseCollision(ctx context.Context, dirActualPath, name string, isDir bool, remoteName func(string) string, self string) (string, string, error) {
+	if d.CaseCollision != caseCollisionRefuse && d.CaseCollision != caseCollisionSuffix {
+		return name, remoteName(name), nil
+	}
+	objs, err := op.List(ctx, d.remoteStorage, dirActualPath, model.ListArgs{}, true)
+	if err != nil && !errs.IsObjectNotFound(err) {
+		return "", "", err
+	}
+	// collision returns the remote name the remote can't tell from rn, or ""
+	collision := func(name, rn string) string {
+		for _, obj := range objs {
+			if obj.GetName() == rn || obj.GetName() == self || !strings.EqualFold(obj.GetName(), rn) {
+				continue
+			}
+			if decrypted, ok := d.decryptRemoteName(obj.GetName(), obj.IsDir()); ok && decrypted == name {
+				// base32 names are decoded case insensitively, it is the same object
+				continue
+			}
+			return obj.GetName()
+		}
+		return ""
+	}
+	rn := remoteName(name)
+	other := collision(name, rn)
+	if other == "" {
+		return name, rn, nil
+	}
+	if d.CaseCollision == caseCollisionRefuse {
+		return "", "", fmt.Errorf("%w: %s would be stored as %s, like %s", ErrNameCollision, name, rn, other)
+	}
+	for i := 1; i <= caseCollisionTries; i++ {
+		candidate := suffixedName(name, i, isDir)
+		rn = remoteName(candidate)
+		if collision(candidate, rn) != "" {
+			continue
+		}
+		exists := false
+		for _, obj := range objs {
+			exists = exists || obj.GetName() == rn
+		}
+		if !exists {
+			return candidate, rn, nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: %s would be stored as %s, like %s, and no free suffix was found", ErrNameCollision, name, remoteName(name), other)
+}
+
+// suffixedName adds " (i)" to name, before the extension of a file
+func suffixedName(name string, i int, isDir bool) string {
+	ext := ""
+	if !isDir {
+		ext = stdpath.Ext(name)
+		if ext == name {
+			// a dot file has no extension
+			ext = ""
+		}
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+}
+
+// decryptRemoteName returns the name of the object stored as remoteName, the way List decrypts it
+func (d *Crypt) decryptRemoteName(remoteName string, isDir bool) (string, bool) {
+	if isDir {
+		name, err := d.cipher.DecryptDirName(remoteName)
+		return name, err == nil
+	}
+	if name, ok := strings.CutSuffix(remoteName, clearSuffix); ok {
+		return name, true
+	}
+	encryptedName, _ := contentSuffix(remoteName)
+	name, err := d.cipher.DecryptFileName(encryptedName)
+	return name, err == nil
+}
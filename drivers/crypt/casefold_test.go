@@ -0,0 +1,85 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+// swapCase changes the case of every letter of s
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r - 'A' + 'a'
+		}
+		return r
+	}, s)
+}
+
+func TestCaseCollision(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"filename_encoding": "base64", "case_collision": "refuse"})
+	// base64 names are case sensitive, these decrypt to nothing but fold to the names of b.txt and dir
+	m.putFile("/"+swapCase(d.cipher.EncryptFileName("b.txt")), testData(10))
+	m.putDir("/" + swapCase(d.cipher.EncryptDirName("dir")))
+	putFile(t, d, "/", "a.txt", testData(10))
+
+	if err := putStream(d, "/", "b.txt", testData(10)); !errors.Is(err, ErrNameCollision) {
+		t.Errorf("expect the upload to be refused, got %v", err)
+	}
+	if err := op.MakeDir(ctx, d, "/dir"); !errors.Is(err, ErrNameCollision) {
+		t.Errorf("expect the new directory to be refused, got %v", err)
+	}
+	if err := op.Rename(ctx, d, "/a.txt", "b.txt"); !errors.Is(err, ErrNameCollision) {
+		t.Errorf("expect the rename to be refused, got %v", err)
+	}
+	// an upload over a file of its own is not a collision
+	putFile(t, d, "/", "a.txt", testData(20))
+
+	d.CaseCollision = caseCollisionSuffix
+	putFile(t, d, "/", "b.txt", testData(10))
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/b (1).txt", "/dir (1)"} {
+		if _, err := op.Get(ctx, d, p); err != nil {
+			t.Errorf("expect %s to be stored with a suffix, got %v", p, err)
+		}
+	}
+	if _, err := op.Get(ctx, d, "/b.txt"); err == nil {
+		t.Errorf("expect b.txt to be stored under another name")
+	}
+}
+
+func TestCaseCollisionClear(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"case_collision": "refuse"})
+	clearCtx := WithClearUpload(ctx)
+	clearStream := func(name string) *model.FileStream {
+		return &model.FileStream{
+			Obj:        &model.Object{Name: name, Size: 10, Modified: time.Now()},
+			ReadCloser: io.NopCloser(bytes.NewReader(testData(10))),
+		}
+	}
+	if err := op.Put(clearCtx, d, "/", clearStream("README.md"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Put(clearCtx, d, "/", clearStream("Readme.md"), nil); !errors.Is(err, ErrNameCollision) {
+		t.Errorf("expect clear names differing in case to collide, got %v", err)
+	}
+	if err := op.Rename(ctx, d, "/README.md", "readme.md"); err != nil {
+		t.Errorf("expect a rename changing the case of the name to pass, got %v", err)
+	}
+}
@@ -0,0 +1,389 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+	"github.com/alist-org/alist/v3/pkg/utils"
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+	"github.com/rclone/rclone/fs/config/obscure"
+)
+
+// zeroReader is an endless source of zero bytes, used as nonce source
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// useDeterministicNonce replaces the random nonce source of c so the encrypted output is reproducible.
+// it only exists in tests, production builds always use crypto/rand
+func useDeterministicNonce(c *rcCrypt.Cipher) {
+	field := reflect.ValueOf(c).Elem().FieldByName("cryptoRand")
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(io.Reader(zeroReader{})))
+}
+
+func TestDeterministicCiphertext(t *testing.T) {
+	const golden = "e4757af2b12d1305a1ad0948a469b836c281a8c9b8135e476e38bc0bb63be7df"
+	data := []byte("hello crypt")
+	var stored [][]byte
+	for i := 0; i < 2; i++ {
+		m, remote := newTestRemote(t, linkModeRange)
+		d := newTestCrypt(t, remote, nil)
+		useDeterministicNonce(d.cipher)
+		putFile(t, d, "/", "a.txt", data)
+		raw, ok := m.read("/" + d.cipher.EncryptFileName("a.txt"))
+		if !ok {
+			t.Fatal("encrypted file not found on remote")
+		}
+		stored = append(stored, raw)
+		if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+			t.Errorf("round trip mismatch: %q", got)
+		}
+	}
+	if !bytes.Equal(stored[0], stored[1]) {
+		t.Fatal("expect identical ciphertext in deterministic mode")
+	}
+	sum := sha256.Sum256(stored[0])
+	if got := hex.EncodeToString(sum[:]); got != golden {
+		t.Errorf("ciphertext changed, sha256 %s, expect %s", got, golden)
+	}
+}
+
+func TestKdf(t *testing.T) {
+	ctx := context.Background()
+	data := testData(1000)
+	_, remote := newTestRemote(t, linkModeRange)
+	hardened := newTestCrypt(t, remote, map[string]interface{}{"kdf": kdfHardened})
+	putFile(t, hardened, "/", "a.txt", data)
+	if got := readRange(t, hardened, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("hardened round trip mismatch")
+	}
+	if hardened.KdfApplied != kdfHardened {
+		t.Errorf("expect hardened kdf to be recorded, got %s", hardened.KdfApplied)
+	}
+
+	standard := newTestCrypt(t, remote, nil)
+	objs, err := op.List(ctx, standard, "/", model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 0 {
+		t.Errorf("expect files written with hardened kdf to be unreadable with standard kdf")
+	}
+
+	_, remote = newTestRemote(t, linkModeRange)
+	standard = newTestCrypt(t, remote, nil)
+	putFile(t, standard, "/", "a.txt", data)
+	if _, err = createTestCrypt(t, remote, map[string]interface{}{"kdf": kdfHardened}); err == nil {
+		t.Errorf("expect changing the kdf of a non-empty store to be refused")
+	}
+
+	// a store that can't be listed isn't taken for empty
+	m, remote := newTestRemote(t, linkModeRange)
+	standard = newTestCrypt(t, remote, nil)
+	putFile(t, standard, "/", "a.txt", data)
+	m.listErr = errors.New("remote unavailable")
+	d, err := createTestCrypt(t, remote, map[string]interface{}{"kdf": kdfHardened, "self_test": false, "range_probe": "off", "foreign_check": "off"})
+	if err == nil || d.KdfApplied == kdfHardened {
+		t.Errorf("expect the kdf not to be changed when the store can't be listed, got %v", err)
+	}
+}
+
+func TestHardenPasswordCached(t *testing.T) {
+	keys := func() int {
+		hardenedKeys.mu.Lock()
+		defer hardenedKeys.mu.Unlock()
+		return len(hardenedKeys.keys)
+	}
+	before := keys()
+	results := make([]string, 4)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// the obscured forms differ, the password is the same
+			hardened, err := hardenPassword(obscure.MustObscure("cached password"), obscure.MustObscure("salt"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = obscure.MustReveal(hardened)
+		}(i)
+	}
+	wg.Wait()
+	if keys() != before+1 {
+		t.Errorf("expect the key to be derived once, %d keys derived", keys()-before)
+	}
+	for _, result := range results[1:] {
+		if result != results[0] {
+			t.Errorf("expect the same key, got %q and %q", result, results[0])
+		}
+	}
+	other, err := hardenPassword(obscure.MustObscure("cached password"), obscure.MustObscure("other salt"))
+	if err != nil || obscure.MustReveal(other) == results[0] || keys() != before+2 {
+		t.Errorf("expect another salt to derive another key, got %v", err)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"self_test": true})
+	putFile(t, d, "/", "a.txt", testData(10))
+	if err := op.MakeDir(context.Background(), d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := createTestCrypt(t, remote, map[string]interface{}{"self_test": true}); err != nil {
+		t.Errorf("expect the same config to pass, got %v", err)
+	}
+	_, err := createTestCrypt(t, remote, map[string]interface{}{"self_test": true, "password": "wrong"})
+	if err == nil || !strings.Contains(err.Error(), "none of the 2 objects") {
+		t.Errorf("expect a wrong password to fail the self test, got %v", err)
+	}
+	if _, err := createTestCrypt(t, remote, map[string]interface{}{"password": "wrong"}); err != nil {
+		t.Errorf("expect no self test when it's off, got %v", err)
+	}
+}
+
+func TestNameAPI(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	putFile(t, d, "/", "a.txt", testData(10))
+	if err := op.MakeDir(context.Background(), d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.read("/" + d.EncryptName("a.txt", false)); !ok {
+		t.Errorf("expect the encrypted file name to be the name on the remote")
+	}
+	if paths := m.paths(); !utils.SliceContains(paths, "/"+d.EncryptName("dir", true)) {
+		t.Errorf("expect the encrypted directory name to be the name on the remote")
+	}
+	for _, isDir := range []bool{false, true} {
+		if got, err := d.DecryptName(d.EncryptName("a b.txt", isDir), isDir); err != nil || got != "a b.txt" {
+			t.Errorf("isDir %v: expect the name to round trip, got %q, %v", isDir, got, err)
+		}
+		if _, err := d.DecryptName("not encrypted", isDir); err == nil {
+			t.Errorf("isDir %v: expect a name that isn't encrypted to fail", isDir)
+		}
+	}
+
+	lazy := newTestCrypt(t, "/no/such/remote", map[string]interface{}{"lazy_init": true})
+	if got := lazy.EncryptName("a.txt", false); got != d.EncryptName("a.txt", false) {
+		t.Errorf("expect an unresolved storage to encrypt names the same, got %q", got)
+	}
+	if lazy.remoteStorage != nil {
+		t.Errorf("expect the name API not to resolve the remote")
+	}
+}
+
+func TestDiagnoseName(t *testing.T) {
+	for _, kdf := range []string{kdfStandard, kdfHardened} {
+		_, remote := newTestRemote(t, linkModeRange)
+		d := newTestCrypt(t, remote, map[string]interface{}{"kdf": kdf})
+		for _, encoding := range []string{"base32", "base64"} {
+			writer := newTestCrypt(t, remote, map[string]interface{}{"kdf": kdf, "filename_encoding": encoding})
+			for _, isDir := range []bool{false, true} {
+				name := writer.EncryptName("holiday photo.jpg", isDir)
+				res, err := d.DiagnoseName(name, isDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var matched []string
+				for _, decoding := range res {
+					if decoding.Error == "" {
+						matched = append(matched, decoding.Encoding)
+						if decoding.Name != "holiday photo.jpg" {
+							t.Errorf("%s %s: expect the plaintext name, got %q", kdf, encoding, decoding.Name)
+						}
+					}
+				}
+				if len(matched) != 1 || matched[0] != encoding {
+					t.Errorf("%s: expect only %s to decrypt the name, got %v", kdf, encoding, matched)
+				}
+			}
+		}
+	}
+}
+
+func TestTryCredentials(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, d, "/", "a.txt", testData(10))
+	putFile(t, d, "/dir", "b.txt", testData(20))
+
+	// a storage set up with a slightly wrong salt finds the right one
+	wrong := newTestCrypt(t, remote, map[string]interface{}{"salt": "sal"})
+	results, err := wrong.TryCredentials(ctx, []Credentials{
+		{Password: "password", Salt: "sal"},
+		{Password: "password", Salt: "salt"},
+		{Password: "passwrd", Salt: "salt"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if res.Index != i || res.Total != 3 {
+			t.Errorf("expect candidate %d to try the 3 names, got %+v", i, res)
+		}
+		if res.Match != (i == 1) {
+			t.Errorf("expect only the right candidate to match, got %+v", res)
+		}
+	}
+	if results[0].Decrypted == 3 || results[2].Decrypted == 3 {
+		t.Errorf("expect wrong candidates not to decrypt the names, got %+v", results)
+	}
+	if salt := wrong.Salt; !strings.HasPrefix(salt, obfuscatedPrefix) {
+		t.Errorf("expect the storage to be left as it is")
+	}
+}
+
+func TestCheckCredentials(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, d, "/dir", "a.txt", testData(10))
+
+	storages := len(op.GetAllStorages())
+	a := Addition{RemotePath: remote, FileNameEnc: "standard", DirNameEnc: "true"}
+	res, err := CheckCredentials(ctx, a, Credentials{Password: "password", Salt: "salt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Match || res.Total != 2 {
+		t.Errorf("expect the right credentials to decrypt the 2 names, got %+v", res)
+	}
+	if res, err = CheckCredentials(ctx, a, Credentials{Password: "password", Salt: "pepper"}); err != nil || res.Match || res.Decrypted > 0 {
+		t.Errorf("expect wrong credentials not to decrypt the names, got %+v %v", res, err)
+	}
+	if n := len(op.GetAllStorages()); n != storages {
+		t.Errorf("expect no storage to be created, got %d storages instead of %d", n, storages)
+	}
+
+	a.RemotePath = "/nowhere"
+	if _, err = CheckCredentials(ctx, a, Credentials{Password: "password", Salt: "salt"}); err == nil {
+		t.Errorf("expect a missing remote to fail")
+	}
+}
+
+func TestRemoteActualPath(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	m.putDir("/secret")
+	d := newTestCrypt(t, remote+"/secret", nil)
+	if err := op.MakeDir(ctx, d, "/a/b/c"); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"/", "/a", "/a/b", "/a/b/c"} {
+		putFile(t, d, dir, "f.txt", testData(10))
+	}
+	paths := m.paths()
+	for _, path := range []string{"/a", "/a/b", "/a/b/c"} {
+		got, err := d.RemoteActualPath(path, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "/secret/") || !utils.SliceContains(paths, got) {
+			t.Errorf("expect %s to be a directory on the remote, got %q", path, got)
+		}
+	}
+	for _, path := range []string{"/f.txt", "/a/f.txt", "/a/b/f.txt", "/a/b/c/f.txt"} {
+		got, err := d.RemoteActualPath(path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m.read(got); !ok || !strings.HasPrefix(got, "/secret/") {
+			t.Errorf("expect %s to be a file on the remote, got %q", path, got)
+		}
+	}
+	if got, err := d.RemoteActualPath("/", true); err != nil || got != "/secret" {
+		t.Errorf("expect the root to be the remote path, got %q, %v", got, err)
+	}
+}
+
+func TestDecryptNames(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"directory_name_encryption": "true"})
+	const n = 3000
+	var names, want []string
+	var areDirs []bool
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("name %d", i)
+		isDir := i%3 == 1
+		switch {
+		case i%7 == 0:
+			names, want = append(names, "not encrypted"), append(want, "")
+		default:
+			names, want = append(names, d.EncryptName(name, isDir)), append(want, name)
+		}
+		// the last names are of files without saying so
+		if i < n-10 {
+			areDirs = append(areDirs, isDir)
+		}
+	}
+	got, errs := d.DecryptNames(names, areDirs)
+	if len(got) != n || len(errs) != n {
+		t.Fatalf("expect %d results, got %d and %d", n, len(got), len(errs))
+	}
+	for i := range names {
+		if (errs[i] != nil) != (want[i] == "") || got[i] != want[i] {
+			t.Errorf("name %d: expect %q, got %q, %v", i, want[i], got[i], errs[i])
+		}
+	}
+	if got, errs = d.DecryptNames(nil, nil); len(got) != 0 || len(errs) != 0 {
+		t.Errorf("expect no results for no names")
+	}
+}
+
+// TestKeysDerivedTogether guards what the layout of stores relies on: the content key depends on
+// the salt as much as the name keys, so new names need the content encrypted again
+func TestKeysDerivedTogether(t *testing.T) {
+	a := &Addition{FileNameEnc: "standard", DirNameEnc: "true", EncryptedSuffix: ".bin"}
+	before, err := newCipher(a, obscure.MustObscure("password"), obscure.MustObscure("old salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := newCipher(a, obscure.MustObscure("password"), obscure.MustObscure("new salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := before.EncryptData(bytes.NewReader(testData(100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := io.ReadAll(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := after.DecryptData(io.NopCloser(bytes.NewReader(ciphertext)))
+	if err == nil {
+		_, err = io.ReadAll(decrypted)
+	}
+	if err == nil {
+		t.Errorf("expect content encrypted with the old salt not to decrypt with the new one")
+	}
+}
@@ -0,0 +1,81 @@
+package crypt
+
+import (
+	stdpath "path"
+	"sort"
+
+	"github.com/alist-org/alist/v3/internal/model"
+)
+
+// rankNotResolved is the rank of a remote name that Get never resolves to
+const rankNotResolved = 6
+
+// resolveRank is the order in which Get tries remoteName for an object called name, lowest first
+func (d *Crypt) resolveRank(name, remoteName string, isDir bool) int {
+	if isReservedName(name) {
+		return 0
+	}
+	firstTryIsFolder, secondTry := guessPath("/" + name)
+	encryptedName := d.cipher.EncryptFileName(name)
+	if isDir {
+		encryptedName = d.cipher.EncryptDirName(name)
+	}
+	switch {
+	case remoteName == encryptedName && isDir == firstTryIsFolder:
+		return 0
+	case remoteName == encryptedName && secondTry:
+		return 1
+	case !isDir && remoteName == encryptedName+plainSuffix:
+		return 2
+	case !isDir && remoteName == name+clearSuffix:
+		return 3
+	}
+	if compressed, _, ok := parseCompressedName(remoteName); ok && !isDir && compressed == encryptedName {
+		return 4
+	}
+	if dedup, _, ok := parseDedupName(remoteName); ok && !isDir && dedup == encryptedName {
+		return 5
+	}
+	return rankNotResolved
+}
+
+// dropCollisions keeps one object of each name in objs, the one Get resolves the name to.
+// different remote names can decrypt to the same name, base32 names are decoded case insensitively,
+// and a file and a directory can have the same name. remoteNames are the remote names of objs
+func (d *Crypt) dropCollisions(remoteDir string, objs []model.Obj, remoteNames []string) []model.Obj {
+	byName := make(map[string][]int)
+	for i, obj := range objs {
+		byName[obj.GetName()] = append(byName[obj.GetName()], i)
+	}
+	if len(byName) == len(objs) {
+		return objs
+	}
+	dropped := make(map[int]bool)
+	for name, indexes := range byName {
+		if len(indexes) == 1 {
+			continue
+		}
+		sort.SliceStable(indexes, func(i, j int) bool {
+			a, b := indexes[i], indexes[j]
+			rankA := d.resolveRank(name, remoteNames[a], objs[a].IsDir())
+			rankB := d.resolveRank(name, remoteNames[b], objs[b].IsDir())
+			if rankA != rankB {
+				return rankA < rankB
+			}
+			return remoteNames[a] < remoteNames[b]
+		})
+		for _, i := range indexes[1:] {
+			dropped[i] = true
+			d.failures.collisions.Add(1)
+			d.warnDecrypt(stdpath.Join(remoteDir, remoteNames[i]), "%s decrypts to %s like %s, it is hidden",
+				remoteNames[i], name, remoteNames[indexes[0]])
+		}
+	}
+	result := make([]model.Obj, 0, len(objs)-len(dropped))
+	for i, obj := range objs {
+		if !dropped[i] {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
@@ -0,0 +1,206 @@
+package crypt
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	stdpath "path"
+	"strconv"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/conf"
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/fs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/pkg/utils"
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+	log "github.com/sirupsen/logrus"
+)
+
+// compressedSuffix ends the remote names of files whose content was compressed with gzip before
+// encryption. the name is <encrypted name>.<decompressed size in base 36>.alist_gz, so listings
+// tell the size without reading the file. the size is no more than the encrypted size tells of others
+const compressedSuffix = ".alist_gz"
+
+const compressionGzip = "gzip"
+
+// compressedObject is a file whose content is compressed before encryption, its size is the decompressed one
+type compressedObject struct {
+	model.Object
+}
+
+func isCompressedObj(obj model.Obj) bool {
+	_, ok := unwrapObj(obj).(*compressedObject)
+	return ok
+}
+
+// compressedName returns the remote name of a compressed file of size bytes called encryptedName once encrypted
+func compressedName(encryptedName string, size int64) string {
+	return encryptedName + "." + strconv.FormatInt(size, 36) + compressedSuffix
+}
+
+// parseCompressedName splits the remote name of a compressed file, ok is false for other names
+func parseCompressedName(name string) (encryptedName string, size int64, ok bool) {
+	name, ok = strings.CutSuffix(name, compressedSuffix)
+	if !ok {
+		return "", 0, false
+	}
+	i := strings.LastIndex(name, ".")
+	if i <= 0 {
+		return "", 0, false
+	}
+	size, err := strconv.ParseInt(name[i+1:], 36, 64)
+	if err != nil || size < 0 {
+		return "", 0, false
+	}
+	return name[:i], size, true
+}
+
+// contentSuffix splits the remote name of a file into its encrypted name and the suffix that tells
+// how the content is stored, plainSuffix or the one of a compressed file or a file named after its content
+func contentSuffix(name string) (encryptedName, suffix string) {
+	if base, ok := strings.CutSuffix(name, plainSuffix); ok {
+		return base, plainSuffix
+	}
+	if base, _, ok := parseCompressedName(name); ok {
+		return base, name[len(base):]
+	}
+	if base, _, ok := parseDedupName(name); ok {
+		return base, name[len(base):]
+	}
+	return name, ""
+}
+
+// compressedUpload is the upload of a file compressed into a temporary file
+type compressedUpload struct {
+	file *os.File
+	// size is the compressed size, plainSize the size of the plaintext
+	size, plainSize int64
+}
+
+// spoolCompressed compresses in into a temporary file, the compressed size must be known to upload it
+func spoolCompressed(in io.Reader) (*compressedUpload, error) {
+	f, err := os.CreateTemp(conf.Conf.TempDir, "crypt-gz-*")
+	if err != nil {
+		return nil, err
+	}
+	u := &compressedUpload{file: f}
+	gz := gzip.NewWriter(f)
+	u.plainSize, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		u.size, err = f.Seek(0, io.SeekCurrent)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		u.close()
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	return u, nil
+}
+
+// reader returns what to encrypt, the compressed file, or the plaintext when compression saved nothing
+func (u *compressedUpload) reader() (io.Reader, error) {
+	if u.worth() {
+		return u.file, nil
+	}
+	gz, err := gzip.NewReader(u.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	return gz, nil
+}
+
+// worth reports whether compression saved space, otherwise the plaintext is uploaded as usual
+func (u *compressedUpload) worth() bool {
+	return u.size < u.plainSize
+}
+
+func (u *compressedUpload) close() {
+	_ = u.file.Close()
+	if err := os.Remove(u.file.Name()); err != nil {
+		log.Warnf("failed to remove the temporary file %s: %s", u.file.Name(), err)
+	}
+}
+
+// openCompressed reads the range rng of the decompressed content of a compressed file, gzip has no
+// random access, the content is decrypted and decompressed from the start and skipped up to the range
+func openCompressed(ctx context.Context, c *rcCrypt.Cipher, open rcCrypt.OpenRangeSeek, start, length int64) (io.ReadCloser, error) {
+	rc, err := c.DecryptDataSeek(ctx, open, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	if _, err = io.CopyN(io.Discard, gz, start); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	var r io.Reader = gz
+	if length >= 0 {
+		r = io.LimitReader(gz, length)
+	}
+	return utils.ReadCloser{Reader: r, Closer: rc}, nil
+}
+
+// getCompressed gets the compressed file at path, or the file named after its content. its remote
+// name has the size or the hash in it so the remote directory is listed to find it
+func (d *Crypt) getCompressed(ctx context.Context, path string) (model.Obj, error) {
+	objs, err := fs.List(ctx, d.getPathForRemote(stdpath.Dir(path), true), d.remoteListArgs())
+	if err != nil {
+		return nil, err
+	}
+	encryptedName := d.cipher.EncryptFileName(stdpath.Base(path))
+	for _, obj := range objs {
+		if uploading(obj) {
+			continue
+		}
+		if name, size, ok := parseCompressedName(obj.GetName()); ok && name == encryptedName && !obj.IsDir() {
+			return d.compressedObj(ctx, path, obj, size), nil
+		}
+		if name, contentHash, ok := parseDedupName(obj.GetName()); ok && name == encryptedName && !obj.IsDir() {
+			return d.dedupObj(ctx, path, obj, contentHash), nil
+		}
+	}
+	return nil, errs.ObjectNotFound
+}
+
+// compressedObj returns the file at path stored compressed as remoteObj, plainSize is the size in its name
+func (d *Crypt) compressedObj(ctx context.Context, path string, remoteObj model.Obj, plainSize int64) model.Obj {
+	compressed := &compressedObject{Object: model.Object{
+		ID:       remoteObj.GetID(),
+		Path:     path,
+		Name:     stdpath.Base(path),
+		Size:     plainSize,
+		Modified: remoteObj.ModTime(),
+	}}
+	compressed.Hash, compressed.HashType = ciphertextHash(remoteObj)
+	d.setSidecarModTime(ctx, compressed)
+	return withMode(compressed, remoteObj)
+}
+
+// dedupObj returns the file at path stored as remoteObj under a name with the hash of its content
+func (d *Crypt) dedupObj(ctx context.Context, path string, remoteObj model.Obj, contentHash string) model.Obj {
+	dedup := &dedupObject{Object: model.Object{
+		ID:       remoteObj.GetID(),
+		Path:     path,
+		Name:     stdpath.Base(path),
+		Size:     remoteObj.GetSize(),
+		Modified: remoteObj.ModTime(),
+	}, contentHash: contentHash}
+	if size, err := d.cipher.DecryptedSize(remoteObj.GetSize()); err == nil {
+		dedup.Size = size
+	}
+	dedup.Hash, dedup.HashType = ciphertextHash(remoteObj)
+	d.setSidecarModTime(ctx, dedup)
+	return withMode(dedup, remoteObj)
+}
@@ -0,0 +1,86 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/conf"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestCompression(t *testing.T) {
+	ctx := context.Background()
+	tempDir := conf.Conf.TempDir
+	conf.Conf.TempDir = t.TempDir()
+	defer func() { conf.Conf.TempDir = tempDir }()
+	for _, linkMode := range []string{linkModeRange, linkModeURL} {
+		m, remote := newTestRemote(t, linkMode)
+		d := newTestCrypt(t, remote, map[string]interface{}{"compression": "gzip"})
+		text := []byte(strings.Repeat("the same line over and over again\n", 1000))
+		putFile(t, d, "/", "a.txt", text)
+		random := make([]byte, 1000)
+		rand.New(rand.NewSource(1)).Read(random)
+		putFile(t, d, "/", "b.bin", random)
+
+		stored := map[string]int{}
+		for _, path := range m.paths() {
+			data, _ := m.read(path)
+			name, _ := contentSuffix(path[1:])
+			plainName, err := d.cipher.DecryptFileName(name)
+			if err != nil {
+				continue
+			}
+			stored[plainName] = len(data)
+			if _, _, compressed := parseCompressedName(path[1:]); compressed != (plainName == "a.txt") {
+				t.Errorf("%s: expect only a.txt to be stored compressed, got %s", linkMode, path)
+			}
+		}
+		if stored["a.txt"] >= len(text) {
+			t.Errorf("%s: expect a.txt to be stored in less than %d bytes, got %d", linkMode, len(text), stored["a.txt"])
+		}
+		if stored["b.bin"] != int(d.cipher.EncryptedSize(1000)) {
+			t.Errorf("%s: expect incompressible data to be stored as usual, got %d bytes", linkMode, stored["b.bin"])
+		}
+
+		objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, obj := range objs {
+			if obj.GetName() == "a.txt" && obj.GetSize() != int64(len(text)) {
+				t.Errorf("%s: expect the listed size to be the decompressed one, got %d", linkMode, obj.GetSize())
+			}
+		}
+		op.ClearCache(d, "/")
+		obj, err := op.Get(ctx, d, "/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.GetSize() != int64(len(text)) {
+			t.Errorf("%s: expect Get to report the decompressed size, got %d", linkMode, obj.GetSize())
+		}
+		if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, text) {
+			t.Errorf("%s: expect a.txt to round trip", linkMode)
+		}
+		if got := readRange(t, d, "/a.txt", http_range.Range{Start: 20000, Length: 100}); !bytes.Equal(got, text[20000:20100]) {
+			t.Errorf("%s: expect a range of a.txt to round trip", linkMode)
+		}
+		if got := readRange(t, d, "/b.bin", http_range.Range{Length: -1}); !bytes.Equal(got, random) {
+			t.Errorf("%s: expect b.bin to round trip", linkMode)
+		}
+
+		// a new content replaces the compressed file, whose name carried the old size
+		putFile(t, d, "/", "a.txt", text[:3400])
+		if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, text[:3400]) {
+			t.Errorf("%s: expect the overwritten a.txt to round trip", linkMode)
+		}
+		if n := len(m.paths()); n != 3 {
+			t.Errorf("%s: expect the replaced file to be removed, got %v", linkMode, m.paths())
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package crypt
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+// contentCheckLength is how much of a file is decrypted to check it, the first block of rclone
+const contentCheckLength = 64 * 1024
+
+// contentCheck is whether the content of a file of that size and time decrypts
+type contentCheck struct {
+	size     int64
+	modified time.Time
+	valid    bool
+}
+
+// contentChecks are the results of ContentCheck, by remote actual path. a result is dropped when the
+// file it was got from changes
+type contentChecks struct {
+	mu     sync.Mutex
+	checks map[string]contentCheck
+}
+
+func (c *contentChecks) get(remoteActualPath string, file model.Obj) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	check, ok := c.checks[remoteActualPath]
+	if !ok || check.size != file.GetSize() || !check.modified.Equal(file.ModTime()) {
+		return false, false
+	}
+	return check.valid, true
+}
+
+func (c *contentChecks) put(remoteActualPath string, file model.Obj, valid bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checks == nil {
+		c.checks = make(map[string]contentCheck)
+	}
+	c.checks[remoteActualPath] = contentCheck{size: file.GetSize(), modified: file.ModTime(), valid: valid}
+}
+
+// contentValid tells whether the header and the first block of the file at path decrypt, checked on
+// the first call and kept until the file changes. it is nil for the files stored without encryption
+func (d *Crypt) contentValid(ctx context.Context, path string) (*bool, error) {
+	file, err := d.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDir() || isPlainObj(file) || isIncompleteObj(file) {
+		return nil, nil
+	}
+	remoteActualPath, err := d.getObjActualPathForRemote(file)
+	if err != nil {
+		return nil, err
+	}
+	if valid, ok := d.checks.get(remoteActualPath, file); ok {
+		return &valid, nil
+	}
+	link, err := d.Link(ctx, file, model.LinkArgs{})
+	if err != nil {
+		return nil, err
+	}
+	defer link.RangeReadCloser.Closers.Close()
+	rc, err := link.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+	if err == nil {
+		_, err = io.CopyN(io.Discard, rc, contentCheckLength)
+		_ = rc.Close()
+	}
+	valid := err == nil || err == io.EOF
+	if !valid && !isDecryptError(err) {
+		// the remote failed, the content is unknown
+		return nil, err
+	}
+	d.checks.put(remoteActualPath, file, valid)
+	return &valid, nil
+}
+
+// contentFailed records that file doesn't decrypt, found by a read of Link. the file of a snapshot
+// isn't the one at its path anymore
+func (d *Crypt) contentFailed(remoteActualPath string, file model.Obj) {
+	if d.ContentCheck && snapshotOf(file) == nil {
+		d.checks.put(remoteActualPath, file, false)
+	}
+}
@@ -0,0 +1,75 @@
+package crypt
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestContentCheck(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"content_check": true})
+	for _, name := range []string{"valid.bin", "corrupt.bin", "header.bin"} {
+		putFile(t, d, "/", name, testData(1000))
+	}
+	m.mu.Lock()
+	// the names still decrypt
+	m.nodes["/"+d.cipher.EncryptFileName("corrupt.bin")].data[100] ^= 1
+	m.nodes["/"+d.cipher.EncryptFileName("header.bin")].data[0] ^= 1
+	m.mu.Unlock()
+	objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+	if err != nil || len(objs) != 3 {
+		t.Fatalf("expect the 3 files listed, got %d, %v", len(objs), err)
+	}
+
+	contentValid := func(path string) *bool {
+		t.Helper()
+		meta, err := d.GetMeta(ctx, path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return meta.ContentValid
+	}
+	if valid := contentValid("/valid.bin"); valid == nil || !*valid {
+		t.Errorf("expect the valid file to be reported valid, got %v", valid)
+	}
+	links := atomic.LoadInt32(&m.links)
+	if valid := contentValid("/corrupt.bin"); valid == nil || *valid {
+		t.Errorf("expect the corrupt file to be reported invalid, got %v", valid)
+	}
+	if atomic.LoadInt32(&m.links) == links {
+		t.Error("expect the first access to read the file")
+	}
+	links = atomic.LoadInt32(&m.links)
+	if valid := contentValid("/corrupt.bin"); valid == nil || *valid {
+		t.Errorf("expect the result to be kept, got %v", valid)
+	}
+	if atomic.LoadInt32(&m.links) != links {
+		t.Error("expect the result to be kept without reading the file again")
+	}
+
+	// a read that fails records the result
+	header, err := op.Get(ctx, d, "/header.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.DecryptTo(ctx, header, io.Discard, http_range.Range{Length: -1}); err == nil {
+		t.Fatal("expect the read of the file with a bad header to fail")
+	}
+	links = atomic.LoadInt32(&m.links)
+	if valid := contentValid("/header.bin"); valid == nil || *valid || atomic.LoadInt32(&m.links) != links {
+		t.Errorf("expect the failed read to be recorded, got %v", valid)
+	}
+
+	// a new upload is checked again
+	putFile(t, d, "/", "corrupt.bin", testData(2000))
+	if valid := contentValid("/corrupt.bin"); valid == nil || !*valid {
+		t.Errorf("expect the replaced file to be reported valid, got %v", valid)
+	}
+}
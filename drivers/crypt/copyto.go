@@ -0,0 +1,163 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	stdpath "path"
+
+	"github.com/alist-org/alist/v3/internal/driver"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/utils"
+)
+
+// copyJob is a file to copy by CopyTo or Import
+type copyJob struct {
+	srcPath string
+	src     model.Obj
+	dstDir  string
+}
+
+// CopyTo copies srcPath of this storage into dstDir of dst, a Crypt storage with another cipher, e.g.
+// to move a store to a new password. the plaintext streams from the decryption of this storage to the
+// encryption of dst, nothing is buffered on disk. files dst already has as large and not older are
+// skipped, so an interrupted copy resumes where it stopped. like Import, the content of a directory
+// is copied into dstDir. up follows the bytes of the whole copy. when dst has the same CipherFingerprint,
+// the files stored encrypted are copied as they are on the remote, without decrypting them.
+// MigrationWorkers files are copied at once, a file that fails doesn't stop the others
+func (d *Crypt) CopyTo(ctx context.Context, srcPath string, dst *Crypt, dstDir string, up driver.UpdateProgress) (ImportResult, error) {
+	var res ImportResult
+	src, err := op.Get(ctx, d, srcPath)
+	if err != nil {
+		return res, fmt.Errorf("failed to get %s: %w", srcPath, err)
+	}
+	var jobs []copyJob
+	if src.IsDir() {
+		jobs, err = d.copyJobs(ctx, srcPath, dst, dstDir, jobs)
+		if err != nil {
+			return res, err
+		}
+	} else {
+		jobs = append(jobs, copyJob{srcPath: srcPath, src: src, dstDir: dstDir})
+	}
+	var total int64
+	for _, job := range jobs {
+		total += job.src.GetSize()
+	}
+	var progress *copyProgress
+	if up != nil && total > 0 {
+		progress = &copyProgress{p: driver.NewProgress(total, up)}
+	}
+	err = runCopyJobs(ctx, d.copyWorkers(), jobs, &res, func(ctx context.Context, job copyJob) (bool, error) {
+		return d.copyFileTo(ctx, job, dst, progress)
+	})
+	if err != nil {
+		return res, err
+	}
+	if up != nil {
+		up(100)
+	}
+	return res, nil
+}
+
+// copyJobs makes the directories of srcPath in dstDir of dst and adds its files to jobs
+func (d *Crypt) copyJobs(ctx context.Context, srcPath string, dst *Crypt, dstDir string, jobs []copyJob) ([]copyJob, error) {
+	if err := op.MakeDir(ctx, dst, dstDir); err != nil {
+		return nil, err
+	}
+	objs, err := op.List(ctx, d, srcPath, model.ListArgs{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", srcPath, err)
+	}
+	for _, obj := range objs {
+		srcObjPath := stdpath.Join(srcPath, obj.GetName())
+		if obj.IsDir() {
+			jobs, err = d.copyJobs(ctx, srcObjPath, dst, stdpath.Join(dstDir, obj.GetName()), jobs)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			jobs = append(jobs, copyJob{srcPath: srcObjPath, src: obj, dstDir: dstDir})
+		}
+	}
+	return jobs, nil
+}
+
+func (d *Crypt) copyFileTo(ctx context.Context, job copyJob, dst *Crypt, progress *copyProgress) (bool, error) {
+	old, err := op.Get(ctx, dst, stdpath.Join(job.dstDir, job.src.GetName()))
+	if err == nil && unchanged(job.src, old) {
+		if progress != nil {
+			progress.add(job.src.GetSize())
+		}
+		return true, nil
+	}
+	if storedEncrypted(job.src) && (err != nil || storedEncrypted(old)) && dst.storesEncrypted(job.src.GetName()) && d.sameCipher(dst) {
+		if err = d.copyCiphertext(ctx, job, dst); err != nil {
+			return false, fmt.Errorf("failed to copy %s: %w", job.srcPath, err)
+		}
+		if progress != nil {
+			progress.add(job.src.GetSize())
+		}
+		return false, nil
+	}
+	rc, err := d.openFile(ctx, d, job.srcPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", job.srcPath, err)
+	}
+	if progress != nil {
+		rc = utils.NewReadCloser(io.TeeReader(rc, progress), rc.Close)
+	}
+	err = op.Put(ctx, dst, job.dstDir, &model.FileStream{
+		Obj: &model.Object{
+			Name:     job.src.GetName(),
+			Size:     job.src.GetSize(),
+			Modified: job.src.ModTime(),
+		},
+		ReadCloser: rc,
+		Mimetype:   utils.GetMimeType(job.src.GetName()),
+	}, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to copy %s: %w", job.srcPath, err)
+	}
+	return false, nil
+}
+
+// storedEncrypted tells whether obj is stored under its encrypted name as the cipher writes it
+func storedEncrypted(obj model.Obj) bool {
+	_, dedup := dedupObjOf(obj)
+	return !isPlainObj(obj) && !isCompressedObj(obj) && !dedup && !isIncompleteObj(obj) && snapshotOf(obj) == nil
+}
+
+// storesEncrypted tells whether an upload called name would be stored under its encrypted name as the cipher writes it
+func (d *Crypt) storesEncrypted(name string) bool {
+	return !d.isPlainExt(name) && d.Compression != compressionGzip && !d.DedupNames
+}
+
+// copyCiphertext copies the remote file of job to the remote of dst as it is, dst has the same cipher
+func (d *Crypt) copyCiphertext(ctx context.Context, job copyJob, dst *Crypt) error {
+	if err := dst.resolve(ctx); err != nil {
+		return err
+	}
+	srcActualPath, err := d.getActualPathForRemote(job.srcPath, false)
+	if err != nil {
+		return err
+	}
+	dstDirActualPath, err := dst.getActualPathForRemote(job.dstDir, true)
+	if err != nil {
+		return err
+	}
+	rc, err := d.openFile(ctx, d.remoteStorage, srcActualPath)
+	if err != nil {
+		return err
+	}
+	return op.Put(ctx, dst.remoteStorage, dstDirActualPath, &model.FileStream{
+		Obj: &model.Object{
+			Name:     dst.cipher.EncryptFileName(job.src.GetName()),
+			Size:     d.cipher.EncryptedSize(job.src.GetSize()),
+			Modified: job.src.ModTime(),
+		},
+		ReadCloser: rc,
+		Mimetype:   "application/octet-stream",
+	}, nil)
+}
@@ -0,0 +1,49 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+
+	"github.com/alist-org/alist/v3/internal/fs"
+)
+
+// Count returns the number of files and directories in the storage, for dashboards. it walks
+// the remote without decrypting anything, unless accurate, where the objects List would leave out
+// because their name or size doesn't decrypt are not counted, nor what is under such directories.
+// the files the driver keeps for itself, like sidecars, the trash and versions, and the uploads in
+// progress are never counted
+func (d *Crypt) Count(ctx context.Context, accurate bool) (ObjectCount, error) {
+	if err := d.resolve(ctx); err != nil {
+		return ObjectCount{}, err
+	}
+	var count ObjectCount
+	err := d.count(ctx, d.remoteRoot, accurate, &count)
+	return count, err
+}
+
+func (d *Crypt) count(ctx context.Context, remoteDir string, accurate bool, count *ObjectCount) error {
+	objs, err := fs.List(ctx, remoteDir, d.remoteListArgs())
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", remoteDir, err)
+	}
+	for _, obj := range objs {
+		if isReservedName(obj.GetName()) || !obj.IsDir() && uploading(obj) {
+			continue
+		}
+		if !obj.IsDir() {
+			if !accurate || d.decryptable(obj) {
+				count.Files++
+			}
+			continue
+		}
+		if accurate && !d.dirDecryptable(obj.GetName()) {
+			continue
+		}
+		count.Dirs++
+		if err = d.count(ctx, stdpath.Join(remoteDir, obj.GetName()), accurate, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
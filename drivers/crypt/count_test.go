@@ -0,0 +1,40 @@
+package crypt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestCount(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	if err := op.MakeDir(ctx, d, "/dir/sub"); err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, d, "/", "a.txt", testData(10))
+	putFile(t, d, "/dir", "b.txt", testData(10))
+	putFile(t, d, "/dir/sub", "c.txt", testData(10))
+	m.putFile("/not encrypted.txt", testData(10))
+	m.putDir("/foreign dir")
+	m.putFile("/foreign dir/f.txt", testData(10))
+	m.putFile("/"+d.cipher.EncryptFileName("a.txt")+metaSidecarSuffix, testData(10))
+
+	for _, c := range []struct {
+		accurate bool
+		want     ObjectCount
+	}{
+		{false, ObjectCount{Files: 5, Dirs: 3}},
+		{true, ObjectCount{Files: 3, Dirs: 2}},
+	} {
+		got, err := d.Count(ctx, c.accurate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("accurate %v: expect %+v, got %+v", c.accurate, c.want, got)
+		}
+	}
+}
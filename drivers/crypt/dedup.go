@@ -0,0 +1,95 @@
+package crypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/conf"
+	"github.com/alist-org/alist/v3/internal/model"
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+	log "github.com/sirupsen/logrus"
+)
+
+// dedupSuffix ends the remote names of files named after their content with dedup_names. the name is
+// <encrypted name>.<content hash>.alist_dd, the hash is keyed with dedupKey: files of the same content
+// have the same hash in the storages of the same keys, and it tells nothing of the content to others
+const dedupSuffix = ".alist_dd"
+
+// dedupHashLen is the length of the content hash in hex
+const dedupHashLen = 32
+
+// dedupProbe is the name encrypted to derive dedupKey
+const dedupProbe = "alist crypt content hash"
+
+// dedupKey derives the key of the content hashes from the keys of std, a standard cipher
+func dedupKey(std *rcCrypt.Cipher) []byte {
+	return []byte(std.EncryptFileName(dedupProbe))
+}
+
+// dedupObject is a file whose remote name carries the hash of its content
+type dedupObject struct {
+	model.Object
+	contentHash string
+}
+
+func dedupObjOf(obj model.Obj) (*dedupObject, bool) {
+	dedup, ok := unwrapObj(obj).(*dedupObject)
+	return dedup, ok
+}
+
+// dedupName returns the remote name of a file called encryptedName once encrypted, of content hash contentHash
+func dedupName(encryptedName, contentHash string) string {
+	return encryptedName + "." + contentHash + dedupSuffix
+}
+
+// parseDedupName splits the remote name of a file named after its content, ok is false for other names
+func parseDedupName(name string) (encryptedName, contentHash string, ok bool) {
+	name, ok = strings.CutSuffix(name, dedupSuffix)
+	if !ok || len(name) < dedupHashLen+2 || name[len(name)-dedupHashLen-1] != '.' {
+		return "", "", false
+	}
+	contentHash = name[len(name)-dedupHashLen:]
+	if _, err := hex.DecodeString(contentHash); err != nil {
+		return "", "", false
+	}
+	return name[:len(name)-dedupHashLen-1], contentHash, true
+}
+
+// hashedUpload is the upload of a file spooled to a temporary file to hash its content before it is named
+type hashedUpload struct {
+	file        *os.File
+	size        int64
+	contentHash string
+}
+
+// spoolHashed copies in to a temporary file and hashes it with key
+func spoolHashed(in io.Reader, key []byte) (*hashedUpload, error) {
+	f, err := os.CreateTemp(conf.Conf.TempDir, "crypt-dd-*")
+	if err != nil {
+		return nil, err
+	}
+	u := &hashedUpload{file: f}
+	h := hmac.New(sha256.New, key)
+	u.size, err = io.Copy(io.MultiWriter(f, h), in)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		u.close()
+		return nil, fmt.Errorf("failed to hash the content: %w", err)
+	}
+	u.contentHash = hex.EncodeToString(h.Sum(nil))[:dedupHashLen]
+	return u, nil
+}
+
+func (u *hashedUpload) close() {
+	_ = u.file.Close()
+	if err := os.Remove(u.file.Name()); err != nil {
+		log.Warnf("failed to remove the temporary file %s: %s", u.file.Name(), err)
+	}
+}
@@ -0,0 +1,94 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/conf"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+// contentHashes returns the content hashes in the remote names of m, by plaintext name
+func contentHashes(t *testing.T, d *Crypt, m *memFS) map[string]string {
+	t.Helper()
+	hashes := map[string]string{}
+	for _, path := range m.paths() {
+		name, contentHash, ok := parseDedupName(path[1:])
+		if !ok {
+			continue
+		}
+		plainName, err := d.cipher.DecryptFileName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, dup := hashes[plainName]; dup {
+			t.Errorf("expect one remote file of %s, got %v", plainName, m.paths())
+		}
+		hashes[plainName] = contentHash
+	}
+	return hashes
+}
+
+func TestDedupNames(t *testing.T) {
+	ctx := context.Background()
+	tempDir := conf.Conf.TempDir
+	conf.Conf.TempDir = t.TempDir()
+	defer func() { conf.Conf.TempDir = tempDir }()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"dedup_names": true})
+	data, other := testData(100000), testData(1000)
+	putFile(t, d, "/", "a.txt", data)
+	putFile(t, d, "/", "b.txt", data)
+	putFile(t, d, "/", "c.txt", other)
+
+	hashes := contentHashes(t, d, m)
+	if len(hashes) != 3 || hashes["a.txt"] != hashes["b.txt"] || hashes["a.txt"] == hashes["c.txt"] {
+		t.Fatalf("expect the same content to have the same hash, got %v", hashes)
+	}
+	objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]int64{}
+	for _, obj := range objs {
+		sizes[obj.GetName()] = obj.GetSize()
+	}
+	if len(sizes) != 3 || sizes["a.txt"] != int64(len(data)) || sizes["c.txt"] != int64(len(other)) {
+		t.Errorf("expect the plaintext names and sizes, got %v", sizes)
+	}
+	op.ClearCache(d, "/")
+	obj, err := op.Get(ctx, d, "/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetSize() != int64(len(data)) {
+		t.Errorf("expect size %d, got %d", len(data), obj.GetSize())
+	}
+	if got := readRange(t, d, "/b.txt", http_range.Range{Start: 70000, Length: 1000}); !bytes.Equal(got, data[70000:71000]) {
+		t.Error("read mismatch")
+	}
+
+	// a rename keeps the hash, an overwrite replaces the remote file
+	if err = op.Rename(ctx, d, "/b.txt", "d.txt"); err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, d, "/", "a.txt", other)
+	hashes = contentHashes(t, d, m)
+	if len(hashes) != 3 || hashes["d.txt"] == "" || hashes["a.txt"] != hashes["c.txt"] {
+		t.Errorf("expect d.txt to keep its hash and a.txt to have the one of c.txt, got %v", hashes)
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, other) {
+		t.Error("read mismatch of the overwritten file")
+	}
+
+	// the hash is keyed with the keys of the storage
+	m2, remote2 := newTestRemote(t, linkModeRange)
+	d2 := newTestCrypt(t, remote2, map[string]interface{}{"dedup_names": true, "password": "other"})
+	putFile(t, d2, "/", "c.txt", other)
+	if got := contentHashes(t, d2, m2)["c.txt"]; got == "" || got == hashes["c.txt"] {
+		t.Errorf("expect another hash with another key, got %q", got)
+	}
+}
@@ -2,25 +2,26 @@ package crypt
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"net/http"
 	stdpath "path"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/alist-org/alist/v3/internal/driver"
 	"github.com/alist-org/alist/v3/internal/errs"
 	"github.com/alist-org/alist/v3/internal/fs"
 	"github.com/alist-org/alist/v3/internal/model"
-	"github.com/alist-org/alist/v3/internal/net"
 	"github.com/alist-org/alist/v3/internal/op"
 	"github.com/alist-org/alist/v3/pkg/http_range"
 	"github.com/alist-org/alist/v3/pkg/utils"
 	rcCrypt "github.com/rclone/rclone/backend/crypt"
-	"github.com/rclone/rclone/fs/config/configmap"
-	"github.com/rclone/rclone/fs/config/obscure"
-	log "github.com/sirupsen/logrus"
 )
 
 type Crypt struct {
@@ -28,6 +29,37 @@ type Crypt struct {
 	Addition
 	cipher        *rcCrypt.Cipher
 	remoteStorage driver.Driver
+	// remoteRoot is RemotePath in the form it is stored on the remote
+	remoteRoot string
+	failures   decryptFailureCounters
+	warnings   warnLimiter
+	index      searchIndex
+	plainDirs  plainDirSet
+	caps       capabilityState
+	streams    streamSlots
+	// hiddenNames are the patterns of HiddenNames
+	hiddenNames []string
+	// key is the password and salt read from KeyFile, KeyEnv or KeyRef, never saved
+	key externalKey
+	// resolveMu guards the resolution of the remote and the cipher, done once it succeeds
+	resolveMu sync.Mutex
+	resolved  bool
+	// paused is set between Pause and Resume
+	paused atomic.Bool
+	// pending are the paginated listings of the remote that stopped in the middle
+	pending pendingListings
+	// fingerprint is the CipherFingerprint of cipher
+	fingerprint string
+	// dedupKey keys the content hashes of dedup_names, it is derived from the keys of cipher
+	dedupKey []byte
+	// checks are the results of ContentCheck
+	checks contentChecks
+	// sidecars are the sidecars read by listings
+	sidecars sidecarCache
+	// formatsMu guards FormatsApplied
+	formatsMu sync.Mutex
+	// saveMu serializes the saves of the storage
+	saveMu sync.Mutex
 }
 
 const obfuscatedPrefix = "___Obfuscated___"
@@ -40,116 +72,332 @@ func (d *Crypt) GetAddition() driver.Additional {
 	return &d.Addition
 }
 
+// savedCrypt is the storage as it is saved, with copies of its Storage and Addition. saving writes
+// to the Storage it is given, which the other requests read
+type savedCrypt struct {
+	*Crypt
+	storage  model.Storage
+	addition Addition
+}
+
+func (s *savedCrypt) GetStorage() *model.Storage {
+	return &s.storage
+}
+
+func (s *savedCrypt) GetAddition() driver.Additional {
+	return &s.addition
+}
+
+// additionCopy returns a copy of Addition, listings may record formats while it is copied
+func (d *Crypt) additionCopy() Addition {
+	d.formatsMu.Lock()
+	defer d.formatsMu.Unlock()
+	return d.Addition
+}
+
+// save saves the storage with a copy of its Addition
+func (d *Crypt) save() {
+	d.saveMu.Lock()
+	defer d.saveMu.Unlock()
+	op.MustSaveDriverStorage(&savedCrypt{Crypt: d, storage: *d.GetStorage(), addition: d.additionCopy()})
+}
+
 func (d *Crypt) Init(ctx context.Context) error {
-	//obfuscate credentials if it's updated or just created
-	err := d.updateObfusParm(&d.Password)
+	err := d.loadKey(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to obfuscate password: %w", err)
+		return err
 	}
-	err = d.updateObfusParm(&d.Salt)
-	if err != nil {
-		return fmt.Errorf("failed to obfuscate salt: %w", err)
+	if !d.key.loaded {
+		//obfuscate or seal credentials if they are updated or just created
+		if err = d.storeCredentials(); err != nil {
+			return err
+		}
 	}
 
 	isCryptExt := regexp.MustCompile(`^[.][A-Za-z0-9-_]{2,}$`).MatchString
 	if !isCryptExt(d.EncryptedSuffix) {
 		return fmt.Errorf("EncryptedSuffix is Illegal")
 	}
+	if d.hiddenNames, err = parseHiddenNames(d.HiddenNames); err != nil {
+		return err
+	}
 
-	op.MustSaveDriverStorage(d)
+	d.addFormats(d.optionFormats()...)
+	d.save()
+	d.streams = newStreamSlots(d.MaxStreams)
+
+	if d.LazyInit {
+		return nil
+	}
+	return d.resolve(ctx)
+}
+
+// resolve finds the remote storage and builds the cipher. it runs in Init, or on first use
+// with LazyInit. a failure is not kept, the next call tries again
+func (d *Crypt) resolve(ctx context.Context) error {
+	if d.paused.Load() {
+		// every operation resolves first, the remote is left alone
+		return ErrPaused
+	}
+	d.resolveMu.Lock()
+	defer d.resolveMu.Unlock()
+	if d.resolved {
+		return nil
+	}
 
 	//need remote storage exist
 	storage, err := fs.GetStorage(d.RemotePath, &fs.GetStoragesArgs{})
 	if err != nil {
 		return fmt.Errorf("can't find remote storage: %w", err)
 	}
-	d.remoteStorage = storage
 
-	p, _ := strings.CutPrefix(d.Password, obfuscatedPrefix)
-	p2, _ := strings.CutPrefix(d.Salt, obfuscatedPrefix)
-	config := configmap.Simple{
-		"password":                  p,
-		"password2":                 p2,
-		"filename_encryption":       d.FileNameEnc,
-		"directory_name_encryption": d.DirNameEnc,
-		"filename_encoding":         "base32",
-		"suffix":                    d.EncryptedSuffix,
-		"pass_bad_blocks":           "",
+	if err = d.buildCipher(); err != nil {
+		return err
 	}
-	c, err := rcCrypt.NewCipher(config)
+	c := d.cipher
+
+	remoteRoot := d.RemotePath
+	if d.EncryptRemotePath {
+		_, actualPath, err := op.GetStorageAndActualPath(d.RemotePath)
+		if err != nil {
+			return fmt.Errorf("can't find remote storage: %w", err)
+		}
+		mountPath := utils.GetActualMountPath(storage.GetStorage().MountPath)
+		remoteRoot = stdpath.Join(mountPath, c.EncryptDirName(actualPath))
+	}
+	d.remoteStorage, d.remoteRoot = storage, remoteRoot
+	d.caps.set(storage)
+	if err = d.probeRange(ctx); err != nil {
+		return err
+	}
+
+	kdfApplied := d.KdfApplied
+	err = d.checkKdf(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create Cipher: %w", err)
+		return err
+	}
+	if d.KdfApplied != kdfApplied {
+		d.save()
+	}
+	if d.SelfTest {
+		err = d.selfTest(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if err = d.checkForeign(ctx); err != nil {
+		return err
 	}
-	d.cipher = c
 
 	//c, err := rcCrypt.newCipher(rcCrypt.NameEncryptionStandard, "", "", true, nil)
+	d.resolved = true
 	return nil
 }
 
-func (d *Crypt) updateObfusParm(str *string) error {
-	temp := *str
-	if !strings.HasPrefix(temp, obfuscatedPrefix) {
-		temp, err := obscure.Obscure(temp)
-		if err != nil {
-			return err
-		}
-		temp = obfuscatedPrefix + temp
-		*str = temp
+// buildCipher builds the cipher from the addition unless it is built already,
+// it needs no remote. the caller holds resolveMu
+func (d *Crypt) buildCipher() error {
+	if d.cipher != nil {
+		return nil
 	}
-	return nil
+	p, p2, err := d.credentials()
+	if err != nil {
+		return err
+	}
+	c, err := newCipher(&d.Addition, p, p2)
+	if err != nil {
+		return fmt.Errorf("failed to create Cipher: %w", err)
+	}
+	return d.setCipher(c, p, p2)
 }
 
 func (d *Crypt) Drop(ctx context.Context) error {
 	return nil
 }
 
+// List lists the directory dir. when a paginated listing of the remote fails after some pages, it
+// returns the objects of those pages with a *PartialListingError
 func (d *Crypt) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
-	path := dir.GetPath()
-	//return d.list(ctx, d.RemotePath, path)
-	//remoteFull
+	return d.list(ctx, dir.GetPath(), false)
+}
+
+// ListDirs lists only the directories in path, files are skipped before any decryption
+func (d *Crypt) ListDirs(ctx context.Context, path string) ([]model.Obj, error) {
+	return d.list(ctx, path, true)
+}
 
-	objs, err := fs.List(ctx, d.getPathForRemote(path, true), &fs.ListArgs{NoLog: true})
+func (d *Crypt) list(ctx context.Context, path string, dirsOnly bool) ([]model.Obj, error) {
+	if err := d.resolve(ctx); err != nil {
+		return nil, err
+	}
+	path, _ = d.cleanPath(path)
+	remoteDir := d.getPathForRemote(path, true)
+	objs, err := d.listRemote(ctx, remoteDir)
 	// the obj must implement the model.SetPath interface
 	// return objs, err
-	if err != nil {
+	var partial *PartialListingError
+	if err != nil && !errors.As(err, &partial) {
 		return nil, err
 	}
+	// a listing that stopped in the middle gives what it listed with the error
+	listErr := err
+	if d.StatSizeConcurrency > 0 && !dirsOnly {
+		objs = d.statSizes(ctx, remoteDir, objs)
+	}
+
+	orderBy, orderDirection := d.GetStorage().OrderBy, d.GetStorage().OrderDirection
+	if orderBy == "modified" && !d.remoteSorted() {
+		// the remote modification time is kept by encryption, sort before paying for decryption.
+		// objs may be cached by the remote, don't sort it in place
+		objs = append([]model.Obj(nil), objs...)
+		model.SortFiles(objs, orderBy, orderDirection)
+	}
 
 	var result []model.Obj
+	var remoteNames []string
 	for _, obj := range objs {
+		add := func(o model.Obj) {
+			result = append(result, withMode(o, obj))
+			remoteNames = append(remoteNames, obj.GetName())
+		}
+		if format := remoteNameFormat(obj.GetName()); format != "" && !obj.IsDir() && !d.formatApplied(format) {
+			// stored before FormatsApplied was recorded, or by another instance. it is saved with the
+			// storage next time, a listing doesn't write to the database
+			d.addFormats(format)
+		}
+		if isReservedName(obj.GetName()) {
+			if d.ShowReserved {
+				add(d.reservedObj(obj))
+			}
+			continue
+		}
+		if !obj.IsDir() && uploading(obj) {
+			// only part of it can be read until the upload completes
+			if d.ShowIncomplete && !dirsOnly {
+				if incomplete := d.incompleteObj(obj); incomplete != nil {
+					add(incomplete)
+				}
+			}
+			continue
+		}
+		encryptedName, compressedSize, compressed := parseCompressedName(obj.GetName())
+		dedupName, contentHash, dedup := parseDedupName(obj.GetName())
+		if d.LazyDecrypt && (obj.IsDir() || !dirsOnly && !compressed && !dedup && !strings.HasSuffix(obj.GetName(), plainSuffix) && !strings.HasSuffix(obj.GetName(), clearSuffix)) {
+			add(d.lazyObj(path, obj))
+			continue
+		}
 		if obj.IsDir() {
 			name, err := d.cipher.DecryptDirName(obj.GetName())
+			if err != nil && d.plainDirName(path, obj.GetName()) {
+				name, err = obj.GetName(), nil
+			}
 			if err != nil {
+				d.failures.names.Add(1)
 				//filter illegal files
 				continue
 			}
 			objRes := model.Object{
+				ID:       obj.GetID(),
 				Name:     name,
 				Size:     0,
 				Modified: obj.ModTime(),
 				IsFolder: obj.IsDir(),
 			}
-			result = append(result, &objRes)
-		} else {
-			thumb, ok := model.GetThumb(obj)
+			add(&objRes)
+		} else if !dirsOnly {
+			if name, ok := strings.CutSuffix(obj.GetName(), clearSuffix); ok {
+				clearObj := &plainObject{Object: model.Object{
+					ID:       obj.GetID(),
+					Name:     name,
+					Size:     obj.GetSize(),
+					Modified: obj.ModTime(),
+				}, clear: true}
+				clearObj.Hash, clearObj.HashType = remoteHash(obj)
+				add(clearObj)
+				continue
+			}
+			if encryptedName, ok := strings.CutSuffix(obj.GetName(), plainSuffix); ok {
+				name, err := d.cipher.DecryptFileName(encryptedName)
+				if err != nil {
+					d.failures.names.Add(1)
+					continue
+				}
+				plain := &plainObject{Object: model.Object{
+					ID:       obj.GetID(),
+					Name:     name,
+					Size:     obj.GetSize(),
+					Modified: obj.ModTime(),
+				}}
+				// the remote holds the content as it is, its hash is of the plaintext
+				plain.Hash, plain.HashType = remoteHash(obj)
+				add(plain)
+				continue
+			}
+			if compressed {
+				name, err := d.cipher.DecryptFileName(encryptedName)
+				if err != nil {
+					d.failures.names.Add(1)
+					continue
+				}
+				compressedObj := &compressedObject{Object: model.Object{
+					ID:       obj.GetID(),
+					Name:     name,
+					Size:     compressedSize,
+					Modified: obj.ModTime(),
+				}}
+				compressedObj.Hash, compressedObj.HashType = ciphertextHash(obj)
+				add(compressedObj)
+				continue
+			}
+			if dedup {
+				name, err := d.cipher.DecryptFileName(dedupName)
+				if err != nil {
+					d.failures.names.Add(1)
+					continue
+				}
+				size, err := d.cipher.DecryptedSize(obj.GetSize())
+				if err != nil {
+					d.failures.sizes.Add(1)
+					continue
+				}
+				dedupObj := &dedupObject{Object: model.Object{
+					ID:       obj.GetID(),
+					Name:     name,
+					Size:     size,
+					Modified: obj.ModTime(),
+				}, contentHash: contentHash}
+				dedupObj.Hash, dedupObj.HashType = ciphertextHash(obj)
+				add(dedupObj)
+				continue
+			}
+			thumb, ok := d.remoteThumb(obj)
 			size, err := d.cipher.DecryptedSize(obj.GetSize())
 			if err != nil {
+				d.failures.sizes.Add(1)
+				if d.ShowIncomplete {
+					if incomplete := d.incompleteObj(obj); incomplete != nil {
+						add(incomplete)
+					}
+				}
 				//filter illegal files
 				continue
 			}
 			name, err := d.cipher.DecryptFileName(obj.GetName())
 			if err != nil {
+				d.failures.names.Add(1)
 				//filter illegal files
 				continue
 			}
 			objRes := model.Object{
+				ID:       obj.GetID(),
 				Name:     name,
 				Size:     size,
 				Modified: obj.ModTime(),
 				IsFolder: obj.IsDir(),
 			}
+			objRes.Hash, objRes.HashType = ciphertextHash(obj)
 			if !ok {
-				result = append(result, &objRes)
+				add(&objRes)
 			} else {
 				objWithThumb := model.ObjThumb{
 					Object: objRes,
@@ -157,255 +405,1111 @@ func (d *Crypt) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([
 						Thumbnail: thumb,
 					},
 				}
-				result = append(result, &objWithThumb)
+				add(&objWithThumb)
 			}
 		}
 	}
 
-	return result, nil
+	if d.AppleDouble == appleDoubleHide && !d.LazyDecrypt {
+		result, remoteNames = d.hideAppleDoubles(result, remoteNames)
+	}
+	if len(d.hiddenNames) > 0 && !d.LazyDecrypt {
+		result, remoteNames = d.hideNames(result, remoteNames)
+	}
+	if d.LazyDecrypt {
+		// both need every name decrypted
+		return result, listErr
+	}
+	if (d.PlaintextHash || d.ZeroModified == zeroModifiedSidecar) && !dirsOnly {
+		if dirActualPath, err := d.getActualPathForRemote(path, true); err == nil && d.setListedSidecars(ctx, dirActualPath, result, objs) && orderBy == "modified" {
+			// sorted by the times of the remote
+			model.SortFiles(result, orderBy, orderDirection)
+		}
+	}
+	result = d.dropCollisions(remoteDir, result, remoteNames)
+
+	if orderBy != "modified" {
+		model.SortFiles(result, orderBy, orderDirection)
+	}
+	return result, listErr
+}
+
+// Get gets the object at rawPath, with PreserveMetadata a file carries the metadata it was uploaded with
+func (d *Crypt) Get(ctx context.Context, rawPath string) (model.Obj, error) {
+	obj, err := d.get(ctx, rawPath)
+	if err != nil {
+		return nil, err
+	}
+	return d.withSidecarMetadata(ctx, obj), nil
 }
 
-func (d *Crypt) Get(ctx context.Context, path string) (model.Obj, error) {
-	if utils.PathEqual(path, "/") {
+func (d *Crypt) get(ctx context.Context, rawPath string) (model.Obj, error) {
+	path, dirHint := d.cleanPath(rawPath)
+	if path == "/" {
 		return &model.Object{
 			Name:     "Root",
 			IsFolder: true,
 			Path:     "/",
 		}, nil
 	}
+	if err := d.resolve(ctx); err != nil {
+		return nil, err
+	}
+	if isReservedName(stdpath.Base(path)) {
+		if !d.ShowReserved {
+			return nil, errs.ObjectNotFound
+		}
+		remoteObj, err := fs.Get(ctx, d.getPathForRemote(path, false), d.remoteGetArgs())
+		if err != nil {
+			return nil, err
+		}
+		obj := d.reservedObj(remoteObj)
+		obj.Path = path
+		return obj, nil
+	}
 	remoteFullPath := ""
 	var remoteObj model.Obj
 	var err, err2 error
 	firstTryIsFolder, secondTry := guessPath(path)
+	if dirHint {
+		firstTryIsFolder, secondTry = true, false
+	}
 	remoteFullPath = d.getPathForRemote(path, firstTryIsFolder)
-	remoteObj, err = fs.Get(ctx, remoteFullPath, &fs.GetArgs{NoLog: true})
+	remoteObj, err = fs.Get(ctx, remoteFullPath, d.remoteGetArgs())
 	if err != nil {
 		if errs.IsObjectNotFound(err) && secondTry {
 			//try the opposite
 			remoteFullPath = d.getPathForRemote(path, !firstTryIsFolder)
-			remoteObj, err2 = fs.Get(ctx, remoteFullPath, &fs.GetArgs{NoLog: true})
-			if err2 != nil {
-				return nil, err2
-			}
-		} else {
-			return nil, err
+			remoteObj, err2 = fs.Get(ctx, remoteFullPath, d.remoteGetArgs())
+			err = err2
+		}
+	}
+	if err != nil && errs.IsObjectNotFound(err) {
+		if d.discoverPlainDirs(ctx, path) {
+			// a directory of the path is plaintext, it maps to another remote path now
+			return d.get(ctx, rawPath)
+		}
+		// the last chance is a file stored without content encryption
+		obj, err := d.getPlain(ctx, path)
+		if errs.IsObjectNotFound(err) {
+			return d.getIncomplete(ctx, path)
 		}
+		return obj, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dirHint && !remoteObj.IsDir() {
+		return nil, fmt.Errorf("%w: %s is a file on the remote, expected a directory", ErrTypeMismatch, path)
+	}
+	return d.encryptedObj(ctx, path, remoteFullPath, remoteObj)
+	//return nil, errs.ObjectNotFound
+}
+
+// encryptedObj returns the object at path stored encrypted as remoteObj, at remoteFullPath
+func (d *Crypt) encryptedObj(ctx context.Context, path, remoteFullPath string, remoteObj model.Obj) (model.Obj, error) {
+	var err error
+	if !remoteObj.IsDir() && uploading(remoteObj) {
+		// it is got as incomplete with ShowIncomplete
+		return nil, errs.ObjectNotFound
 	}
 	var size int64 = 0
 	name := ""
 	if !remoteObj.IsDir() {
 		size, err = d.cipher.DecryptedSize(remoteObj.GetSize())
 		if err != nil {
-			log.Warnf("DecryptedSize failed for %s ,will use original size, err:%s", path, err)
+			d.failures.sizes.Add(1)
+			d.warnDecrypt(remoteFullPath, "DecryptedSize failed for %s ,will use original size, err:%s", path, err)
 			size = remoteObj.GetSize()
 		}
+		if err = d.checkDecryptedSize(path, size); err != nil {
+			return nil, err
+		}
 		name, err = d.cipher.DecryptFileName(remoteObj.GetName())
 		if err != nil {
-			log.Warnf("DecryptFileName failed for %s ,will use original name, err:%s", path, err)
+			d.failures.names.Add(1)
+			d.warnDecrypt(remoteFullPath, "DecryptFileName failed for %s ,will use original name, err:%s", path, err)
 			name = remoteObj.GetName()
 		}
+	} else if d.plainDirs.has(path) {
+		name = remoteObj.GetName()
 	} else {
 		name, err = d.cipher.DecryptDirName(remoteObj.GetName())
 		if err != nil {
-			log.Warnf("DecryptDirName failed for %s ,will use original name, err:%s", path, err)
+			d.failures.names.Add(1)
+			d.warnDecrypt(remoteFullPath, "DecryptDirName failed for %s ,will use original name, err:%s", path, err)
 			name = remoteObj.GetName()
 		}
 	}
 	obj := &model.Object{
+		ID:       remoteObj.GetID(),
 		Path:     path,
 		Name:     name,
 		Size:     size,
 		Modified: remoteObj.ModTime(),
 		IsFolder: remoteObj.IsDir(),
 	}
-	return obj, nil
-	//return nil, errs.ObjectNotFound
+	if !remoteObj.IsDir() {
+		obj.Hash, obj.HashType = ciphertextHash(remoteObj)
+		if d.PlaintextHash {
+			if sidecarPath, err := d.getSidecarActualPath(path, false); err == nil {
+				d.setPlaintextHash(ctx, obj, sidecarPath)
+			}
+		}
+		d.setSidecarModTime(ctx, obj)
+	}
+	return withMode(obj, remoteObj), nil
+}
+
+// getPlain gets the file at path stored in one of FormatsApplied, the lookups of the others are spared
+func (d *Crypt) getPlain(ctx context.Context, path string) (model.Obj, error) {
+	var remoteObj model.Obj
+	err := errs.ObjectNotFound
+	if d.formatApplied(formatPlain) {
+		remoteObj, err = fs.Get(ctx, d.getPathForRemote(path, false)+plainSuffix, d.remoteGetArgs())
+	}
+	isClear := false
+	if errs.IsObjectNotFound(err) && d.formatApplied(formatClear) {
+		// the last of the last is a file stored as it is
+		clearPath := stdpath.Join(d.getPathForRemote(stdpath.Dir(path), true), stdpath.Base(path)+clearSuffix)
+		remoteObj, err = fs.Get(ctx, clearPath, d.remoteGetArgs())
+		isClear = true
+	}
+	if errs.IsObjectNotFound(err) {
+		if !d.formatApplied(formatGzip) && !d.formatApplied(formatDedup) {
+			return nil, errs.ObjectNotFound
+		}
+		return d.getCompressed(ctx, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.plainObj(ctx, path, remoteObj, isClear)
+}
+
+// plainObj returns the file at path stored without content encryption as remoteObj, as it is if isClear
+func (d *Crypt) plainObj(ctx context.Context, path string, remoteObj model.Obj, isClear bool) (model.Obj, error) {
+	if remoteObj.IsDir() || uploading(remoteObj) {
+		return nil, errs.ObjectNotFound
+	}
+	plain := &plainObject{Object: model.Object{
+		ID:       remoteObj.GetID(),
+		Path:     path,
+		Name:     stdpath.Base(path),
+		Size:     remoteObj.GetSize(),
+		Modified: remoteObj.ModTime(),
+	}, clear: isClear}
+	plain.Hash, plain.HashType = remoteHash(remoteObj)
+	if d.PlaintextHash {
+		if sidecarPath, err := d.getSidecarActualPath(path, false); err == nil {
+			d.setPlaintextHash(ctx, plain, sidecarPath)
+		}
+	}
+	d.setSidecarModTime(ctx, plain)
+	return withMode(plain, remoteObj), nil
 }
 
 func (d *Crypt) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
-	dstDirActualPath, err := d.getActualPathForRemote(file.GetPath(), false)
+	link, _, err := d.sizedLink(ctx, file, args)
+	return link, err
+}
+
+// sizedLink is Link that also returns the decrypted size of file, the one of the remote file when
+// it decrypts. the links don't carry it, the servers of links tell the length of every response
+func (d *Crypt) sizedLink(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, int64, error) {
+	if err := d.resolve(ctx); err != nil {
+		return nil, 0, err
+	}
+	if isIncompleteObj(file) {
+		return nil, 0, incompleteError(file)
+	}
+	dstDirActualPath, err := d.getObjActualPathForRemote(file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert path to remote path: %w", err)
+		return nil, 0, fmt.Errorf("failed to convert path to remote path: %w", err)
+	}
+	var remoteLink *model.Link
+	var remoteFile model.Obj
+	var renew func(ctx context.Context, args model.LinkArgs) (*model.Link, error)
+	if snapshot := snapshotOf(file); snapshot != nil {
+		// the file of a snapshot is not at its path anymore
+		renew = func(ctx context.Context, args model.LinkArgs) (*model.Link, error) {
+			return d.snapshotLink(ctx, snapshot, args)
+		}
+		remoteFile = snapshot.remote
+		remoteLink, err = renew(ctx, args)
+	} else {
+		remoteLink, remoteFile, err = op.Link(ctx, d.remoteStorage, dstDirActualPath, args)
+	}
+	if errors.Is(err, errs.NotFile) {
+		return nil, 0, fmt.Errorf("%w: %s is a directory on the remote, expected a file", ErrTypeMismatch, file.GetPath())
 	}
-	remoteLink, remoteFile, err := op.Link(ctx, d.remoteStorage, dstDirActualPath, args)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if remoteLink.RangeReadCloser.RangeReader == nil && remoteLink.ReadSeekCloser == nil && len(remoteLink.URL) == 0 {
-		return nil, fmt.Errorf("the remote storage driver need to be enhanced to support encrytion")
+		return nil, 0, fmt.Errorf("the remote storage driver need to be enhanced to support encrytion")
 	}
 	remoteFileSize := remoteFile.GetSize()
+	size := file.GetSize()
+	if !isPlainObj(file) && !isCompressedObj(file) {
+		// the size of the remote file is authoritative, file may carry a stale or undecrypted size
+		if decryptedSize, err := d.cipher.DecryptedSize(remoteFileSize); err == nil {
+			size = decryptedSize
+		}
+	}
+	if err = d.checkDecryptedSize(file.GetPath(), size); err != nil {
+		return nil, 0, err
+	}
 	remoteClosers := utils.NewClosers()
+	if remoteLink.ReadSeekCloser != nil {
+		//the same ReadSeekCloser is reused by every range request, close it at last
+		remoteClosers.Add(remoteLink.ReadSeekCloser)
+	}
+	urlLink := &remoteURL{link: remoteLink, path: dstDirActualPath, renew: renew}
 	rangeReaderFunc := func(ctx context.Context, underlyingOffset, underlyingLength int64) (io.ReadCloser, error) {
 		length := underlyingLength
-		if underlyingLength >= 0 && underlyingOffset+underlyingLength >= remoteFileSize {
-			length = -1
-		}
-		if remoteLink.RangeReadCloser.RangeReader != nil {
-			//remoteRangeReader, err :=
-			remoteReader, err := remoteLink.RangeReadCloser.RangeReader(http_range.Range{Start: underlyingOffset, Length: length})
-			remoteClosers.Add(remoteLink.RangeReadCloser.Closers)
-			if err != nil {
-				return nil, err
-			}
-			return remoteReader, nil
+		if underlyingLength >= 0 && remoteFileSize > 0 && underlyingOffset+underlyingLength > remoteFileSize {
+			// the cipher reads whole blocks, don't ask for more than the remote has.
+			// -1 is kept for reads that are open ended
+			length = remoteFileSize - underlyingOffset
 		}
-		if remoteLink.ReadSeekCloser != nil {
-			_, err := remoteLink.ReadSeekCloser.Seek(underlyingOffset, io.SeekStart)
-			if err != nil {
-				return nil, err
-			}
-			//remoteClosers.Add(remoteLink.ReadSeekCloser)
-			//keep reuse same ReadSeekCloser and close at last.
-			return io.NopCloser(remoteLink.ReadSeekCloser), nil
-		}
-		if len(remoteLink.URL) > 0 {
-			rangedRemoteLink := &model.Link{
-				URL:    remoteLink.URL,
-				Header: remoteLink.Header,
-			}
-			response, err := RequestRangedHttp(args.HttpReq, rangedRemoteLink, underlyingOffset, length)
-			//remoteClosers.Add(response.Body)
-			if err != nil {
-				return nil, fmt.Errorf("remote storage http request failure,status: %d err:%s", response.StatusCode, err)
+		return d.openWithTimeout(ctx, func(reqCtx context.Context) (io.ReadCloser, error) {
+			if remoteLink.RangeReadCloser.RangeReader != nil {
+				//remoteRangeReader, err :=
+				remoteReader, err := remoteLink.RangeReadCloser.RangeReader(http_range.Range{Start: underlyingOffset, Length: length})
+				remoteClosers.Add(remoteLink.RangeReadCloser.Closers)
+				if err != nil {
+					return nil, err
+				}
+				return remoteReader, nil
 			}
-			if underlyingOffset == 0 && length == -1 || response.StatusCode == http.StatusPartialContent {
-				return response.Body, nil
-			} else if response.StatusCode == http.StatusOK {
-				log.Warnf("remote http server not supporting range request, expect low perfromace!")
-				readCloser, err := net.GetRangedHttpReader(response.Body, underlyingOffset, length)
+			if remoteLink.ReadSeekCloser != nil {
+				_, err := remoteLink.ReadSeekCloser.Seek(underlyingOffset, io.SeekStart)
 				if err != nil {
 					return nil, err
 				}
-				return readCloser, nil
+				return io.NopCloser(remoteLink.ReadSeekCloser), nil
 			}
-
-			return response.Body, nil
-		}
-		//if remoteLink.Data != nil {
-		//	log.Warnf("remote storage not supporting range request, expect low perfromace!")
-		//	readCloser, err := net.GetRangedHttpReader(remoteLink.Data, underlyingOffset, length)
-		//	remoteCloser = remoteLink.Data
-		//	if err != nil {
-		//		return nil, err
-		//	}
-		//	return readCloser, nil
-		//}
-		return nil, errs.NotSupport
+			if len(remoteLink.URL) > 0 {
+				return d.openURLRange(reqCtx, urlLink, args, underlyingOffset, length)
+			}
+			// model.Link no longer carries a plain Data reader, remotes that only have a stream
+			// expose it as ReadSeekCloser, which is handled above
+			return nil, errs.NotSupport
+		})
 
 	}
+	slots := newLinkSlots()
+	remoteClosers.Add(slots)
 	resultRangeReader := func(httpRange http_range.Range) (io.ReadCloser, error) {
+		if httpRange.Start > 0 && httpRange.Start >= size {
+			return nil, fmt.Errorf("%w: start %d, size %d", http_range.ErrNoOverlap, httpRange.Start, size)
+		}
+		release, err := d.acquireStream()
+		if err != nil {
+			return nil, err
+		}
+		if isPlainObj(file) {
+			rc, err := rangeReaderFunc(ctx, httpRange.Start, httpRange.Length)
+			if err != nil {
+				release()
+				return nil, err
+			}
+			return slots.reader(rc, release), nil
+		}
+		if isCompressedObj(file) {
+			rc, err := openCompressed(ctx, d.cipher, rangeReaderFunc, httpRange.Start, httpRange.Length)
+			if err != nil {
+				release()
+				if isDecryptError(err) {
+					d.failures.content.Add(1)
+				}
+				return nil, err
+			}
+			return slots.reader(rc, release), nil
+		}
 		readSeeker, err := d.cipher.DecryptDataSeek(ctx, rangeReaderFunc, httpRange.Start, httpRange.Length)
 		if err != nil {
+			release()
+			if isDecryptError(err) {
+				d.failures.content.Add(1)
+				d.contentFailed(dstDirActualPath, file)
+			}
 			return nil, err
 		}
-		return readSeeker, nil
+		return slots.reader(&failureCountingReader{ReadCloser: readSeeker, d: d}, release), nil
 	}
 
 	resultRangeReadCloser := &model.RangeReadCloser{RangeReader: resultRangeReader, Closers: remoteClosers}
 	resultLink := &model.Link{
-		Header:          remoteLink.Header,
+		Header:          linkHeader(remoteLink.Header),
 		RangeReadCloser: *resultRangeReadCloser,
 		Expiration:      remoteLink.Expiration,
 	}
+	if d.streams != nil {
+		// the slots are released when the link is closed, a link cached by op.Link would be
+		// shared by requests, and the first to finish would release the slots of the others
+		resultLink.Expiration = nil
+	}
 
-	return resultLink, nil
+	return resultLink, size, nil
 
 }
 
+// DecryptTo writes the range rng of the decrypted content of file to w, for server side consumers
+// that have no use for a link. the remote is read through the same pipeline as Link
+func (d *Crypt) DecryptTo(ctx context.Context, file model.Obj, w io.Writer, rng http_range.Range) error {
+	if snapshotOf(file) == nil {
+		// the wrapper of a snapshot tells Link where to read from
+		file = model.UnwrapObj(file)
+	}
+	link, err := d.Link(ctx, file, model.LinkArgs{})
+	if err != nil {
+		return err
+	}
+	defer link.RangeReadCloser.Closers.Close()
+	rc, err := link.RangeReadCloser.RangeReader(rng)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return utils.CopyWithCtx(ctx, w, rc, 0, nil)
+}
+
 func (d *Crypt) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
+	if err := checkNewName(dirName); err != nil {
+		return err
+	}
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
 	dstDirActualPath, err := d.getActualPathForRemote(parentDir.GetPath(), true)
 	if err != nil {
 		return fmt.Errorf("failed to convert path to remote path: %w", err)
 	}
-	dir := d.cipher.EncryptDirName(dirName)
-	return op.MakeDir(ctx, d.remoteStorage, stdpath.Join(dstDirActualPath, dir))
+	dirName, dir, err := d.resolveCaseCollision(ctx, dstDirActualPath, dirName, true, d.cipher.EncryptDirName, "")
+	if err != nil {
+		return err
+	}
+	if err = d.checkNameLength(dirName, dir); err != nil {
+		return err
+	}
+	dirActualPath := stdpath.Join(dstDirActualPath, dir)
+	err = d.retry(ctx, "make dir", func() error {
+		return op.MakeDir(ctx, d.remoteStorage, dirActualPath)
+	}, func() bool {
+		return d.remoteExists(ctx, dirActualPath)
+	})
+	if err != nil {
+		return err
+	}
+	d.index.put(stdpath.Join(parentDir.GetPath(), dirName), true, 0, d.SearchIndexLimit)
+	return nil
 }
 
 func (d *Crypt) Move(ctx context.Context, srcObj, dstDir model.Obj) error {
-	srcRemoteActualPath, err := d.getActualPathForRemote(srcObj.GetPath(), srcObj.IsDir())
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	var progress CopyProgress
+	report := copyProgressOf(ctx)
+	if report != nil {
+		var err error
+		if progress, err = d.treeProgress(ctx, srcObj); err != nil {
+			return err
+		}
+		report(progress)
+	}
+	srcRemoteActualPath, err := d.getObjActualPathForRemote(srcObj)
 	if err != nil {
 		return fmt.Errorf("failed to convert path to remote path: %w", err)
 	}
+	if err = d.checkRemoteType(ctx, srcObj.GetPath(), srcRemoteActualPath, srcObj.IsDir()); err != nil {
+		return err
+	}
 	dstRemoteActualPath, err := d.getActualPathForRemote(dstDir.GetPath(), dstDir.IsDir())
 	if err != nil {
 		return fmt.Errorf("failed to convert path to remote path: %w", err)
 	}
-	return op.Move(ctx, d.remoteStorage, srcRemoteActualPath, dstRemoteActualPath)
+	// encrypted names don't depend on the path of their directory, with or without
+	// directory name encryption, so one remote move carries the whole tree
+	err = d.retry(ctx, "move", func() error {
+		return op.Move(ctx, d.remoteStorage, srcRemoteActualPath, dstRemoteActualPath)
+	}, func() bool {
+		return d.remoteMoved(ctx, srcRemoteActualPath, stdpath.Join(dstRemoteActualPath, stdpath.Base(srcRemoteActualPath)))
+	})
+	if err != nil {
+		return err
+	}
+	d.syncSidecar(ctx, srcObj, func(sidecarPath string) error {
+		return op.Move(ctx, d.remoteStorage, sidecarPath, dstRemoteActualPath)
+	})
+	d.syncAppleDouble(ctx, srcObj, func(_ model.Obj, remoteActualPath string) error {
+		return op.Move(ctx, d.remoteStorage, remoteActualPath, dstRemoteActualPath)
+	})
+	if !srcObj.IsDir() {
+		d.syncVersions(ctx, srcRemoteActualPath, func(versionPath string) error {
+			return op.Move(ctx, d.remoteStorage, versionPath, dstRemoteActualPath)
+		})
+	}
+	d.index.move(srcObj.GetPath(), stdpath.Join(dstDir.GetPath(), srcObj.GetName()), false, d.SearchIndexLimit)
+	if report != nil {
+		progress.Files, progress.Bytes = progress.TotalFiles, progress.TotalBytes
+		report(progress)
+	}
+	return nil
 }
 
 func (d *Crypt) Rename(ctx context.Context, srcObj model.Obj, newName string) error {
-	remoteActualPath, err := d.getActualPathForRemote(srcObj.GetPath(), srcObj.IsDir())
+	if newName == "" || newName == "." || newName == ".." || strings.Contains(newName, "/") {
+		// the remote renames in place, a path would end up as a name or in another directory
+		return fmt.Errorf("%w: %q, rename can't change the directory of an object, move it instead", ErrInvalidName, newName)
+	}
+	if err := checkNewName(newName); err != nil {
+		return err
+	}
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	remoteActualPath, err := d.getObjActualPathForRemote(srcObj)
 	if err != nil {
 		return fmt.Errorf("failed to convert path to remote path: %w", err)
 	}
-	var newEncryptedName string
+	if err = d.checkRemoteType(ctx, srcObj.GetPath(), remoteActualPath, srcObj.IsDir()); err != nil {
+		return err
+	}
+	encryptName := d.cipher.EncryptFileName
 	if srcObj.IsDir() {
-		newEncryptedName = d.cipher.EncryptDirName(newName)
-	} else {
-		newEncryptedName = d.cipher.EncryptFileName(newName)
+		encryptName = d.cipher.EncryptDirName
+	}
+	// the object itself doesn't collide, a rename may only change the case of its name
+	newName, newRemoteName, err := d.resolveCaseCollision(ctx, stdpath.Dir(remoteActualPath), newName, srcObj.IsDir(), func(name string) string {
+		return d.remoteFileName(srcObj, name, encryptName(name))
+	}, stdpath.Base(remoteActualPath))
+	if err != nil {
+		return err
+	}
+	newEncryptedName := encryptName(newName)
+	if err = d.checkNameLength(newName, newRemoteName); err != nil {
+		return err
 	}
-	return op.Rename(ctx, d.remoteStorage, remoteActualPath, newEncryptedName)
+	err = d.retry(ctx, "rename", func() error {
+		return op.Rename(ctx, d.remoteStorage, remoteActualPath, newRemoteName)
+	}, func() bool {
+		return d.remoteMoved(ctx, remoteActualPath, stdpath.Join(stdpath.Dir(remoteActualPath), newRemoteName))
+	})
+	if err != nil {
+		return err
+	}
+	d.syncSidecar(ctx, srcObj, func(sidecarPath string) error {
+		return op.Rename(ctx, d.remoteStorage, sidecarPath, newEncryptedName+metaSidecarSuffix)
+	})
+	d.syncAppleDouble(ctx, srcObj, func(sidecar model.Obj, remoteActualPath string) error {
+		name := appleDoublePrefix + newName
+		return op.Rename(ctx, d.remoteStorage, remoteActualPath, d.remoteFileName(sidecar, name, d.cipher.EncryptFileName(name)))
+	})
+	if !srcObj.IsDir() {
+		d.syncVersions(ctx, remoteActualPath, func(versionPath string) error {
+			return op.Rename(ctx, d.remoteStorage, versionPath, renamedVersionName(stdpath.Base(versionPath), newRemoteName))
+		})
+	}
+	d.index.move(srcObj.GetPath(), stdpath.Join(stdpath.Dir(srcObj.GetPath()), newName), false, d.SearchIndexLimit)
+	return nil
 }
 
+// Copy copies srcObj with a single Copy of the remote, encrypted names are the same in any directory,
+// so a directory is copied by the remote as a whole, server side if the remote supports it
 func (d *Crypt) Copy(ctx context.Context, srcObj, dstDir model.Obj) error {
-	srcRemoteActualPath, err := d.getActualPathForRemote(srcObj.GetPath(), srcObj.IsDir())
+	if err := checkNewName(srcObj.GetName()); err != nil {
+		return err
+	}
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	report := copyProgressOf(ctx)
+	if report != nil && srcObj.IsDir() {
+		if err := d.copyTree(ctx, srcObj, dstDir, report); err != nil {
+			return err
+		}
+		d.index.move(srcObj.GetPath(), stdpath.Join(dstDir.GetPath(), srcObj.GetName()), true, d.SearchIndexLimit)
+		return nil
+	}
+	srcRemoteActualPath, err := d.getObjActualPathForRemote(srcObj)
 	if err != nil {
 		return fmt.Errorf("failed to convert path to remote path: %w", err)
 	}
+	if err = d.checkRemoteType(ctx, srcObj.GetPath(), srcRemoteActualPath, srcObj.IsDir()); err != nil {
+		return err
+	}
 	dstRemoteActualPath, err := d.getActualPathForRemote(dstDir.GetPath(), dstDir.IsDir())
 	if err != nil {
 		return fmt.Errorf("failed to convert path to remote path: %w", err)
 	}
-	return op.Copy(ctx, d.remoteStorage, srcRemoteActualPath, dstRemoteActualPath)
-
+	// copying again overwrites what a failed attempt copied
+	err = d.retry(ctx, "copy", func() error {
+		return op.Copy(ctx, d.remoteStorage, srcRemoteActualPath, dstRemoteActualPath)
+	}, nil)
+	if err != nil {
+		return err
+	}
+	d.syncSidecar(ctx, srcObj, func(sidecarPath string) error {
+		return op.Copy(ctx, d.remoteStorage, sidecarPath, dstRemoteActualPath)
+	})
+	d.syncAppleDouble(ctx, srcObj, func(_ model.Obj, remoteActualPath string) error {
+		return op.Copy(ctx, d.remoteStorage, remoteActualPath, dstRemoteActualPath)
+	})
+	d.index.move(srcObj.GetPath(), stdpath.Join(dstDir.GetPath(), srcObj.GetName()), true, d.SearchIndexLimit)
+	if report != nil {
+		report(CopyProgress{Files: 1, TotalFiles: 1, Bytes: srcObj.GetSize(), TotalBytes: srcObj.GetSize()})
+	}
+	return nil
 }
 
 func (d *Crypt) Remove(ctx context.Context, obj model.Obj) error {
-	remoteActualPath, err := d.getActualPathForRemote(obj.GetPath(), obj.IsDir())
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	remoteActualPath, err := d.getObjActualPathForRemote(obj)
 	if err != nil {
 		return fmt.Errorf("failed to convert path to remote path: %w", err)
 	}
-	return op.Remove(ctx, d.remoteStorage, remoteActualPath)
+	if err = d.checkRemoteType(ctx, obj.GetPath(), remoteActualPath, obj.IsDir()); err != nil {
+		return err
+	}
+	if d.Trash {
+		err = d.trash(ctx, obj, remoteActualPath)
+	} else {
+		// removing what is gone already succeeds
+		err = d.retry(ctx, "remove", func() error {
+			return op.Remove(ctx, d.remoteStorage, remoteActualPath)
+		}, nil)
+		if err == nil {
+			d.syncSidecar(ctx, obj, func(sidecarPath string) error {
+				return op.Remove(ctx, d.remoteStorage, sidecarPath)
+			})
+			if !obj.IsDir() {
+				d.syncVersions(ctx, remoteActualPath, func(versionPath string) error {
+					return op.Remove(ctx, d.remoteStorage, versionPath)
+				})
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	d.syncAppleDouble(ctx, obj, func(sidecar model.Obj, remoteActualPath string) error {
+		if d.Trash {
+			return d.trash(ctx, sidecar, remoteActualPath)
+		}
+		return op.Remove(ctx, d.remoteStorage, remoteActualPath)
+	})
+	d.index.remove(obj.GetPath())
+	return nil
 }
 
 func (d *Crypt) Put(ctx context.Context, dstDir model.Obj, stream model.FileStreamer, up driver.UpdateProgress) error {
+	if err := checkNewName(stream.GetName()); err != nil {
+		return err
+	}
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
 	dstDirActualPath, err := d.getActualPathForRemote(dstDir.GetPath(), true)
 	if err != nil {
 		return fmt.Errorf("failed to convert path to remote path: %w", err)
 	}
 
-	in := stream.GetReadCloser()
-	// Encrypt the data into wrappedIn
-	wrappedIn, err := d.cipher.EncryptData(in)
+	size := stream.GetSize()
+	unknownSize := size < 0
+	if unknownSize && !d.UnknownSizeUpload {
+		return fmt.Errorf("%w: %s, enable unknown_size_upload if the remote accepts chunked uploads", ErrUnknownSize, stream.GetName())
+	}
+	in := &byteCounter{Reader: stream.GetReadCloser()}
+	var plaintextHash hash.Hash
+	if d.PlaintextHash {
+		plaintextHash = sha1.New()
+		in.Reader = io.TeeReader(in.Reader, plaintextHash)
+	}
+	clearUpload := isClearUpload(ctx)
+	plain := clearUpload || d.isPlainExt(stream.GetName())
+	var compressed *compressedUpload
+	if d.Compression == compressionGzip && !plain {
+		// the compressed size is only known once the whole file is compressed
+		if compressed, err = spoolCompressed(in); err != nil {
+			return err
+		}
+		defer compressed.close()
+		size, unknownSize = compressed.plainSize, false
+	}
+	var hashed *hashedUpload
+	if d.DedupNames && !plain && compressed == nil {
+		// the name needs the hash of the whole content
+		if hashed, err = spoolHashed(in, d.dedupKey); err != nil {
+			return err
+		}
+		defer hashed.close()
+		size, unknownSize = hashed.size, false
+	}
+	name, encryptedName, err := d.resolveCaseCollision(ctx, dstDirActualPath, stream.GetName(), false, func(name string) string {
+		if clearUpload {
+			return name + clearSuffix
+		} else if plain {
+			return d.cipher.EncryptFileName(name) + plainSuffix
+		}
+		return d.cipher.EncryptFileName(name)
+	}, "")
 	if err != nil {
-		return fmt.Errorf("failed to EncryptData: %w", err)
+		return err
 	}
-
+	// read is what gets encrypted
+	var read io.Reader = in
+	if compressed != nil {
+		r, err := compressed.reader()
+		if err != nil {
+			return err
+		}
+		read = r
+		if compressed.worth() {
+			size = compressed.size
+			encryptedName = compressedName(encryptedName, compressed.plainSize)
+		}
+	}
+	if hashed != nil {
+		read = hashed.file
+		encryptedName = dedupName(encryptedName, hashed.contentHash)
+	}
+	if format := remoteNameFormat(encryptedName); format != "" {
+		// before the upload, a failed one may leave the file
+		d.applyFormats(format)
+	}
+	var wrappedIn io.Reader = read
+	if !plain {
+		// Encrypt the data into wrappedIn
+		wrappedIn, err = d.cipher.EncryptData(read)
+		if err != nil {
+			return fmt.Errorf("failed to EncryptData: %w", err)
+		}
+		if !unknownSize {
+			// an unknown size is passed on as -1, the remote streams it
+			size = d.cipher.EncryptedSize(size)
+		}
+	}
+	uploadName := encryptedName
+	old := stream.GetOld()
+	if name != stream.GetName() {
+		// stored under another name, the file of the name is left as it is
+		old = nil
+	}
+	var stale model.Obj
+	if old != nil {
+		if oldActualPath, err := d.getObjActualPathForRemote(old); err == nil && stdpath.Base(oldActualPath) != encryptedName {
+			// the old file is stored under another name, it's removed once the upload succeeds
+			stale, old = old, nil
+		}
+	}
+	if d.AtomicPut {
+		uploadName = encryptedName + uploadingSuffix
+		old = nil
+	}
+	if err = d.checkNameLength(name, uploadName); err != nil {
+		return err
+	}
+	if err = d.checkFreeSpace(ctx, name, size); err != nil {
+		return err
+	}
+	// the remote replaces an empty object of the name, a directory included
+	if err = d.checkRemoteType(ctx, stdpath.Join(dstDir.GetPath(), name), stdpath.Join(dstDirActualPath, encryptedName), false); err != nil {
+		return err
+	}
+	// the file replaced is kept as a version, the upload doesn't overwrite it
+	keepOld := d.Versions > 0 && stream.GetOld() != nil && name == stream.GetName()
+	var versionPath, oldActualPath string
+	if keepOld && !d.AtomicPut {
+		if versionPath, oldActualPath, err = d.keepOldVersion(ctx, stream.GetOld()); err != nil {
+			return err
+		}
+		old, stale = nil, nil
+	}
+	// sent counts what the remote took, the header of the encryption is sent before any plaintext is read
+	sent := &byteCounter{Reader: wrappedIn}
 	streamOut := &model.FileStream{
 		Obj: &model.Object{
 			ID:       stream.GetID(),
 			Path:     stream.GetPath(),
-			Name:     d.cipher.EncryptFileName(stream.GetName()),
-			Size:     d.cipher.EncryptedSize(stream.GetSize()),
+			Name:     uploadName,
+			Size:     size,
 			Modified: stream.ModTime(),
 			IsFolder: stream.IsDir(),
 		},
-		ReadCloser:   io.NopCloser(wrappedIn),
-		Mimetype:     "application/octet-stream",
+		ReadCloser:   io.NopCloser(sent),
+		Mimetype:     d.uploadMimetype(stream),
 		WebPutAsTask: stream.NeedStore(),
-		Old:          stream.GetOld(),
+		Old:          old,
 	}
-	err = op.Put(ctx, d.remoteStorage, dstDirActualPath, streamOut, up, false)
-	if err != nil {
+	err = d.retry(ctx, "upload", func() error {
+		err := op.Put(ctx, d.remoteStorage, dstDirActualPath, streamOut, up, false)
+		if err != nil && sent.n > 0 {
+			// the stream can't be read again
+			return permanentError{err}
+		}
 		return err
+	}, nil)
+	if err != nil {
+		// whatever was written is incomplete ciphertext, unless it may still be the old object
+		if d.AtomicPut || old == nil {
+			d.removeUpload(stdpath.Join(dstDirActualPath, uploadName))
+		}
+		if versionPath != "" {
+			d.dropOldVersion(ctx, versionPath, oldActualPath)
+		}
+		return classifyPutError(err)
+	}
+	if d.AtomicPut {
+		if keepOld {
+			if versionPath, oldActualPath, err = d.keepOldVersion(ctx, stream.GetOld()); err != nil {
+				d.removeUpload(stdpath.Join(dstDirActualPath, uploadName))
+				return err
+			}
+			stale = nil
+		}
+		err = d.commitUpload(ctx, dstDirActualPath, uploadName, encryptedName)
+		if err != nil {
+			if versionPath != "" {
+				d.dropOldVersion(ctx, versionPath, oldActualPath)
+			}
+			return err
+		}
+	}
+	if versionPath != "" {
+		d.pruneVersions(ctx, dstDirActualPath, stdpath.Base(oldActualPath))
+	}
+	d.setRemoteMode(ctx, stream, stdpath.Join(dstDirActualPath, encryptedName))
+	if stale != nil {
+		d.removeStale(ctx, stale)
+	}
+	d.index.put(stdpath.Join(dstDir.GetPath(), name), false, in.n, d.SearchIndexLimit)
+	var metadata map[string]string
+	if d.PreserveMetadata {
+		metadata, _ = MetadataOf(stream)
+	}
+	// the metadata of a file replaced is dropped
+	storeMetadata := metadata != nil || d.PreserveMetadata && stream.GetOld() != nil
+	if plaintextHash != nil || d.ZeroModified == zeroModifiedSidecar || storeMetadata {
+		sha1 := ""
+		if plaintextHash != nil {
+			sha1 = hex.EncodeToString(plaintextHash.Sum(nil))
+		}
+		d.storeUploadMeta(ctx, stdpath.Join(dstDir.GetPath(), name), sha1, stream.ModTime(), metadata)
+	}
+	if d.ConfirmPutTimeout > 0 {
+		return d.confirmPut(ctx, dstDirActualPath, encryptedName)
 	}
 	return nil
 }
 
-//func (d *Safe) Other(ctx context.Context, args model.OtherArgs) (interface{}, error) {
-//	return nil, errs.NotSupport
-//}
+func (d *Crypt) Other(ctx context.Context, args model.OtherArgs) (interface{}, error) {
+	switch args.Method {
+	case "decrypt_failures":
+		return d.DecryptFailures(), nil
+	case "list_dirs":
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		user := otherUser(ctx)
+		if user == nil {
+			return nil, fmt.Errorf("%w: list_dirs needs a user", errs.PermissionDenied)
+		}
+		dirs, err := d.ListDirs(ctx, args.Obj.GetPath())
+		if err != nil {
+			return nil, err
+		}
+		readable := d.userCanRead(user, req.Password)
+		res := make([]model.Obj, 0, len(dirs))
+		for _, dir := range dirs {
+			if readable(stdpath.Join(args.Obj.GetPath(), dir.GetName())) {
+				res = append(res, dir)
+			}
+		}
+		return res, nil
+	case "get_meta":
+		return d.GetMeta(ctx, args.Obj.GetPath(), args.Obj.IsDir())
+	case "set_meta":
+		var meta ObjMeta
+		if err := decodeOtherData(args.Data, &meta); err != nil {
+			return nil, err
+		}
+		if err := d.requireWrite(ctx, args.Obj.GetPath()); err != nil {
+			return nil, err
+		}
+		return nil, d.SetMeta(ctx, args.Obj.GetPath(), args.Obj.IsDir(), &meta)
+	case "migrate_names_off":
+		if err := d.requireWrite(ctx, "/"); err != nil {
+			return nil, err
+		}
+		return nil, d.MigrateNamesOff(ctx)
+	case "list_trash":
+		// the trash holds the paths of the files removed anywhere in the storage
+		if err := d.requireWrite(ctx, "/"); err != nil {
+			return nil, err
+		}
+		return d.ListTrash(ctx)
+	case "restore_trash":
+		var req struct {
+			ID string `json:"id"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		if err := d.requireWrite(ctx, "/"); err != nil {
+			return nil, err
+		}
+		return nil, d.RestoreTrash(ctx, req.ID)
+	case "empty_trash":
+		if err := d.requireWrite(ctx, "/"); err != nil {
+			return nil, err
+		}
+		return nil, d.EmptyTrash(ctx)
+	case "verify_content":
+		return nil, d.VerifyContent(ctx, args.Obj.GetPath())
+	case "export":
+		var req struct {
+			MaxDepth int    `json:"max_depth"`
+			Password string `json:"password"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		user := otherUser(ctx)
+		if user == nil {
+			return nil, fmt.Errorf("%w: export needs a user", errs.PermissionDenied)
+		}
+		var entries []ManifestEntry
+		err := d.exportFiltered(ctx, args.Obj.GetPath(), req.MaxDepth, d.userCanRead(user, req.Password), func(entry ManifestEntry) error {
+			entries = append(entries, entry)
+			return nil
+		})
+		return entries, err
+	case "count":
+		var req struct {
+			Accurate bool `json:"accurate"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		// the count is of the whole storage, for the dashboards of admins
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+		return d.Count(ctx, req.Accurate)
+	case "list_versions":
+		return d.ListVersions(ctx, args.Obj.GetPath())
+	case "restore_version":
+		var req struct {
+			ID string `json:"id"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		if err := d.requireWrite(ctx, args.Obj.GetPath()); err != nil {
+			return nil, err
+		}
+		return nil, d.RestoreVersion(ctx, args.Obj.GetPath(), req.ID)
+	case "plan_put":
+		var req struct {
+			Name string `json:"name"`
+			Size int64  `json:"size"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		// the plan reports the remote path, for those who could upload there
+		if err := d.requireWrite(ctx, args.Obj.GetPath()); err != nil {
+			return nil, err
+		}
+		return d.PlanPut(ctx, args.Obj.GetPath(), req.Name, req.Size)
+	case "import":
+		var req struct {
+			SrcPath     string `json:"src_path"`
+			SrcPassword string `json:"src_password"`
+			DstDir      string `json:"dst_dir"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		if err := d.requireWrite(ctx, req.DstDir); err != nil {
+			return nil, err
+		}
+		user := otherUser(ctx)
+		if !user.CanCopy() {
+			return nil, fmt.Errorf("%w: copy permission required", errs.PermissionDenied)
+		}
+		// src_path is a path of the user, like the paths of /fs
+		srcPath, err := user.JoinPath(req.SrcPath)
+		if err != nil {
+			return nil, err
+		}
+		if !canRead(user, srcPath, req.SrcPassword) {
+			return nil, fmt.Errorf("%w: password is incorrect or you have no permission for %s", errs.PermissionDenied, req.SrcPath)
+		}
+		return d.submitImport(ctx, user, srcPath, req.SrcPassword, req.DstDir)
+	case "copy_to":
+		var req struct {
+			DstMountPath string `json:"dst_mount_path"`
+			DstDir       string `json:"dst_dir"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		// dst_mount_path is a path of the user, like the paths of /fs
+		user := otherUser(ctx)
+		if user == nil {
+			return nil, fmt.Errorf("%w: write permission required", errs.PermissionDenied)
+		}
+		dstMountPath, err := user.JoinPath(req.DstMountPath)
+		if err != nil {
+			return nil, err
+		}
+		storage, err := op.GetStorageByMountPath(dstMountPath)
+		if err != nil {
+			return nil, err
+		}
+		dst, ok := storage.(*Crypt)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a Crypt storage", req.DstMountPath)
+		}
+		if err = dst.requireWrite(ctx, req.DstDir); err != nil {
+			return nil, err
+		}
+		return d.CopyTo(ctx, args.Obj.GetPath(), dst, req.DstDir, nil)
+	case "scan_orphans":
+		// the scan walks the whole storage and reports remote paths, for those who can prune them
+		if err := d.requireWrite(ctx, "/"); err != nil {
+			return nil, err
+		}
+		return d.ScanOrphans(ctx)
+	case "prune_orphans":
+		var req struct {
+			RemotePaths []string `json:"remote_paths"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		if err := d.requireWrite(ctx, "/"); err != nil {
+			return nil, err
+		}
+		return d.PruneOrphans(ctx, req.RemotePaths)
+	case "get_by_id":
+		var req struct {
+			ID string `json:"id"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		// the object may be anywhere in the storage, out of the base path and behind metas of the user
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+		return d.GetByID(ctx, req.ID)
+	case "list_snapshot":
+		var req struct {
+			Snapshot string `json:"snapshot"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		return d.ListSnapshot(ctx, req.Snapshot, args.Obj.GetPath())
+	case "pause":
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+		d.Pause()
+		return nil, nil
+	case "resume":
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+		d.Resume()
+		return nil, nil
+	case "remote_actual_path":
+		return d.RemoteActualPath(args.Obj.GetPath(), args.Obj.IsDir())
+	case "capabilities":
+		return d.Capabilities(ctx)
+	case "try_credentials":
+		var req struct {
+			Candidates []Credentials `json:"candidates"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+		return d.TryCredentials(ctx, req.Candidates)
+	case "decrypt_names":
+		var req struct {
+			Names   []string `json:"names"`
+			AreDirs []bool   `json:"are_dirs"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		// the names may be of any object of the store, out of the base path and behind metas of the user
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+		names, errs := d.DecryptNames(req.Names, req.AreDirs)
+		res := make([]DecryptedName, len(names))
+		for i := range names {
+			res[i].Name = names[i]
+			if errs[i] != nil {
+				res[i].Error = errs[i].Error()
+			}
+		}
+		return res, nil
+	case "diagnose_name":
+		var req struct {
+			Name  string `json:"name"`
+			IsDir bool   `json:"is_dir"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		// with the hardened kdf every call derives keys, and the names it decrypts may be of any object
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+		return d.DiagnoseName(req.Name, req.IsDir)
+	case "search":
+		var req struct {
+			Keywords string `json:"keywords"`
+			Scope    int    `json:"scope"`
+			Password string `json:"password"`
+		}
+		if err := decodeOtherData(args.Data, &req); err != nil {
+			return nil, err
+		}
+		user := otherUser(ctx)
+		if user == nil {
+			return nil, fmt.Errorf("%w: search needs a user", errs.PermissionDenied)
+		}
+		nodes, err := d.Search(ctx, args.Obj.GetPath(), req.Keywords, req.Scope)
+		if err != nil {
+			return nil, err
+		}
+		return d.readableNodes(user, nodes, req.Password), nil
+	case "rebuild_search_index":
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+		return nil, d.RebuildSearchIndex(ctx)
+	default:
+		return nil, errs.NotSupport
+	}
+}
 
 var _ driver.Driver = (*Crypt)(nil)
+var _ driver.HeadSizer = (*Crypt)(nil)
@@ -0,0 +1,1118 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	stdpath "path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/net"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+	"github.com/alist-org/alist/v3/server/common"
+)
+
+func TestLinkReadSeekRemote(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeSeek)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(200 * 1024)
+	putFile(t, d, "/", "a.txt", data)
+
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("full read mismatch, got %d bytes", len(got))
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Start: 70000, Length: 1000}); !bytes.Equal(got, data[70000:71000]) {
+		t.Errorf("ranged read mismatch, got %d bytes", len(got))
+	}
+
+	link, _, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link.RangeReadCloser.Closers.Close()
+	if atomic.LoadInt32(&m.closed) != 1 {
+		t.Errorf("expect remote reader to be closed with the link")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	if status := d.HealthCheck(context.Background()); !status.Healthy() {
+		t.Errorf("expect healthy, got %+v", status)
+	}
+
+	uninitialized := &Crypt{Addition: Addition{RemotePath: remote}}
+	status := uninitialized.HealthCheck(context.Background())
+	if status.Healthy() || !status.RemoteResolved || status.CipherReady {
+		t.Errorf("expect cipher not ready, got %+v", status)
+	}
+
+	remoteStorage, err := op.GetStorageByMountPath(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := op.DeleteStorageById(context.Background(), remoteStorage.GetStorage().ID); err != nil {
+		t.Fatal(err)
+	}
+	status = d.HealthCheck(context.Background())
+	if status.Healthy() || status.RemoteResolved || status.Error == "" {
+		t.Errorf("expect remote unreachable, got %+v", status)
+	}
+}
+
+func TestLazyInit(t *testing.T) {
+	d := newTestCrypt(t, "/no/such/remote", map[string]interface{}{"lazy_init": true})
+	if d.remoteStorage != nil || d.cipher != nil {
+		t.Errorf("expect Init to leave the remote and the cipher unresolved")
+	}
+	if _, err := op.List(context.Background(), d, "/", model.ListArgs{}); err == nil || !strings.Contains(err.Error(), "can't find remote storage") {
+		t.Errorf("expect the first access to fail on the missing remote, got %v", err)
+	}
+
+	_, remote := newTestRemote(t, linkModeRange)
+	d = newTestCrypt(t, remote, map[string]interface{}{"lazy_init": true, "self_test": true})
+	if d.remoteStorage != nil || d.cipher != nil {
+		t.Errorf("expect Init to leave the remote and the cipher unresolved")
+	}
+	data := testData(100)
+	putFile(t, d, "/", "a.txt", data)
+	if d.remoteStorage == nil || d.cipher == nil || !d.resolved {
+		t.Fatalf("expect the first access to resolve the remote and the cipher")
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("read mismatch")
+	}
+}
+
+func TestMultiSegmentRemotePath(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		m, remote := newTestRemote(t, linkModeRange)
+		d := newTestCrypt(t, remote+"/backup/encrypted", map[string]interface{}{"encrypt_remote_path": encrypt})
+		data := testData(100)
+		putFile(t, d, "/dir", "a.txt", data)
+
+		prefix := "/backup/encrypted"
+		if encrypt {
+			prefix = "/" + d.cipher.EncryptDirName("backup/encrypted")
+		}
+		expect := stdpath.Join(prefix, d.cipher.EncryptDirName("dir"), d.cipher.EncryptFileName("a.txt"))
+		if _, ok := m.read(expect); !ok {
+			t.Errorf("encrypt_remote_path=%v: expect %s on remote, got %v", encrypt, expect, m.paths())
+		}
+		if got := readRange(t, d, "/dir/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+			t.Errorf("encrypt_remote_path=%v: read mismatch", encrypt)
+		}
+	}
+}
+
+func TestLinkGzipRemote(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeURL)
+	m.gzip = true
+	d := newTestCrypt(t, remote, nil)
+	data := testData(150 * 1024)
+	putFile(t, d, "/", "a.txt", data)
+
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("full read mismatch, got %d bytes", len(got))
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Start: 100000, Length: 5000}); !bytes.Equal(got, data[100000:105000]) {
+		t.Errorf("ranged read mismatch, got %d bytes", len(got))
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Start: 140000, Length: -1}); !bytes.Equal(got, data[140000:]) {
+		t.Errorf("open ended read mismatch, got %d bytes", len(got))
+	}
+
+	// a compressed 206 is requested again whole, as the client
+	m.gzipPartial = true
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "client-ua")
+	link, _, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{HttpReq: req})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.userAgents = nil
+	m.mu.Unlock()
+	rc, err := link.RangeReadCloser.RangeReader(http_range.Range{Start: 100000, Length: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, data[100000:105000]) {
+		t.Errorf("partial compressed read mismatch, got %d bytes, %v", len(got), err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ua := range m.userAgents {
+		if ua != "client-ua" {
+			t.Errorf("expect every request with the client User-Agent, got %v", m.userAgents)
+			break
+		}
+	}
+}
+
+func TestLinkRangeBeyondEOF(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(1000)
+	putFile(t, d, "/", "a.txt", data)
+	link, _, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, start := range []int64{1000, 1001, 1 << 40} {
+		_, err := link.RangeReadCloser.RangeReader(http_range.Range{Start: start, Length: -1})
+		if !errors.Is(err, http_range.ErrNoOverlap) {
+			t.Errorf("start %d: expect ErrNoOverlap, got %v", start, err)
+		}
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Start: 999, Length: 1}); !bytes.Equal(got, data[999:]) {
+		t.Errorf("expect the last byte, got %v", got)
+	}
+}
+
+func TestListDirs(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	putFile(t, d, "/", "a.txt", testData(10))
+	if err := op.MakeDir(context.Background(), d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	// a file whose size can't be decrypted
+	m.putFile("/"+d.cipher.EncryptFileName("short.txt"), []byte("short"))
+
+	objs, err := d.ListDirs(context.Background(), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "dir" || !objs[0].IsDir() {
+		t.Errorf("expect only dir, got %+v", objs)
+	}
+}
+
+func TestLinkUserAgent(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeURL)
+	d := newTestCrypt(t, remote, map[string]interface{}{"user_agent": "crypt-ua"})
+	putFile(t, d, "/", "a.txt", testData(100))
+
+	readRange(t, d, "/a.txt", http_range.Range{Length: -1})
+	if ua := m.userAgents[len(m.userAgents)-1]; ua != "crypt-ua" {
+		t.Errorf("expect configured User-Agent, got %s", ua)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "client-ua")
+	link, _, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{HttpReq: req})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := link.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if ua := m.userAgents[len(m.userAgents)-1]; ua != "client-ua" {
+		t.Errorf("expect client User-Agent to win, got %s", ua)
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	putFile(t, d, "/", "a.txt", testData(10))
+	m.putFile("/foreign.txt", testData(100))
+	m.putDir("/foreign")
+	m.putFile("/"+d.cipher.EncryptFileName("short.txt"), []byte("short"))
+	// a valid name and size but content of another key
+	m.putFile("/"+d.cipher.EncryptFileName("bad.txt"), testData(int(d.cipher.EncryptedSize(100))))
+
+	if _, err := op.List(ctx, d, "/", model.ListArgs{}); err != nil {
+		t.Fatal(err)
+	}
+	link, _, err := op.Link(ctx, d, "/bad.txt", model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := link.RangeReadCloser.RangeReader(http_range.Range{Length: -1}); err == nil {
+		t.Errorf("expect content decryption to fail")
+	}
+	expect := DecryptFailures{Names: 2, Sizes: 1, Content: 1}
+	if got := d.DecryptFailures(); got != expect {
+		t.Errorf("expect %+v, got %+v", expect, got)
+	}
+}
+
+func TestMaxNameLength(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"max_name_length": 40})
+	long := "abcdefghijklmnopqr.txt"
+	if len(d.cipher.EncryptFileName(long)) <= 40 {
+		t.Fatalf("expect %s to overflow once encrypted", long)
+	}
+
+	err := putStream(d, "/", long, testData(10))
+	if !errors.Is(err, ErrNameTooLong) {
+		t.Errorf("put: expect ErrNameTooLong, got %v", err)
+	}
+	if err := op.MakeDir(ctx, d, "/"+long); !errors.Is(err, ErrNameTooLong) {
+		t.Errorf("mkdir: expect ErrNameTooLong, got %v", err)
+	}
+	putFile(t, d, "/", "a.txt", testData(10))
+	if err := op.Rename(ctx, d, "/a.txt", long); !errors.Is(err, ErrNameTooLong) {
+		t.Errorf("rename: expect ErrNameTooLong, got %v", err)
+	}
+	if paths := m.paths(); len(paths) != 2 {
+		t.Errorf("expect only a.txt on the remote, got %v", paths)
+	}
+}
+
+func TestListSort(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	storage := d.GetStorage()
+	storage.OrderBy, storage.OrderDirection = "modified", "desc"
+	names := []string{"b.txt", "c.txt", "a10.txt", "a9.txt"}
+	for i, name := range names {
+		putFile(t, d, "/", name, testData(10*(len(names)-i)))
+		m.mu.Lock()
+		m.nodes["/"+d.cipher.EncryptFileName(name)].modified = time.Unix(int64(1000+i), 0)
+		m.mu.Unlock()
+	}
+	listNames := func() []string {
+		t.Helper()
+		objs, err := d.List(ctx, &model.Object{Path: "/", IsFolder: true}, model.ListArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res []string
+		for _, obj := range objs {
+			res = append(res, obj.GetName())
+		}
+		return res
+	}
+	expectOrder := func(expect ...string) {
+		t.Helper()
+		got := listNames()
+		if fmt.Sprint(got) != fmt.Sprint(expect) {
+			t.Errorf("order_by %s %s: expect %v, got %v", storage.OrderBy, storage.OrderDirection, expect, got)
+		}
+	}
+
+	expectOrder("a9.txt", "a10.txt", "c.txt", "b.txt")
+	// the remote already sorts the same way, its order is kept
+	remoteStorage, err := op.GetStorageByMountPath(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteStorage.GetStorage().OrderBy, remoteStorage.GetStorage().OrderDirection = "modified", "desc"
+	if !d.remoteSorted() {
+		t.Errorf("expect the remote order to be used")
+	}
+	objs, err := op.List(ctx, remoteStorage, "/", model.ListArgs{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"a9.txt", "a10.txt", "c.txt", "b.txt"} {
+		if objs[i].GetName() != d.cipher.EncryptFileName(name) {
+			t.Fatalf("expect the remote to be sorted")
+		}
+	}
+	expectOrder("a9.txt", "a10.txt", "c.txt", "b.txt")
+	storage.OrderBy, storage.OrderDirection = "name", "asc"
+	expectOrder("a9.txt", "a10.txt", "b.txt", "c.txt")
+	storage.OrderBy, storage.OrderDirection = "size", "asc"
+	expectOrder("a9.txt", "a10.txt", "c.txt", "b.txt")
+
+	// op sorts the listing again the same way
+	objs, err = op.List(ctx, d, "/", model.ListArgs{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, obj := range objs {
+		got = append(got, obj.GetName())
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]string{"a9.txt", "a10.txt", "c.txt", "b.txt"}) {
+		t.Errorf("op.List: expect the order by size, got %v", got)
+	}
+}
+
+func TestStatSizes(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"stat_size_concurrency": 2, "stat_size_limit": 3})
+	for i := 1; i <= 4; i++ {
+		putFile(t, d, "/", fmt.Sprintf("%d.txt", i), testData(100*i))
+	}
+	m.listNoSize = true
+	atomic.StoreInt32(&m.gets, 0)
+
+	objs, err := d.List(context.Background(), &model.Object{Path: "/", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gets := atomic.LoadInt32(&m.gets); gets != 3 {
+		t.Errorf("expect 3 stats, got %d", gets)
+	}
+	resolved := 0
+	for _, obj := range objs {
+		var i int
+		fmt.Sscanf(obj.GetName(), "%d.txt", &i)
+		if obj.GetSize() != int64(100*i) {
+			t.Errorf("%s: expect size %d, got %d", obj.GetName(), 100*i, obj.GetSize())
+		}
+		resolved++
+	}
+	if resolved != 3 {
+		t.Errorf("expect the 3 resolved files, got %d", resolved)
+	}
+}
+
+func TestRenameName(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(100)
+	putFile(t, d, "/", "a.txt", data)
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := op.Rename(ctx, d, "/a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRange(t, d, "/b.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("read mismatch after rename")
+	}
+
+	before := m.paths()
+	for _, name := range []string{"dir/c.txt", "/c.txt", "..", ""} {
+		if err := d.Rename(ctx, &model.Object{Path: "/b.txt", Name: "b.txt"}, name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%q: expect ErrInvalidName, got %v", name, err)
+		}
+	}
+	if after := m.paths(); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Errorf("expect the remote to be unchanged, got %v", after)
+	}
+}
+
+func TestCopyDirTree(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	files := map[string][]byte{
+		"/src/a.txt":         testData(10),
+		"/src/sub/b.txt":     testData(70 * 1024),
+		"/src/sub/deep/c.md": testData(0),
+	}
+	for _, dir := range []string{"/src/sub/deep", "/dst"} {
+		if err := op.MakeDir(ctx, d, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for p, data := range files {
+		putFile(t, d, stdpath.Dir(p), stdpath.Base(p), data)
+	}
+
+	if err := op.Copy(ctx, d, "/src", "/dst"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&m.copies); n != 1 {
+		t.Errorf("expect the tree to be copied by one remote copy, got %d", n)
+	}
+	for p, data := range files {
+		dst := "/dst" + p
+		obj, err := op.Get(ctx, d, dst)
+		if err != nil {
+			t.Errorf("%s: %v", dst, err)
+			continue
+		}
+		if obj.GetName() != stdpath.Base(p) || obj.GetSize() != int64(len(data)) {
+			t.Errorf("%s: expect %s of %d bytes, got %s of %d", dst, stdpath.Base(p), len(data), obj.GetName(), obj.GetSize())
+		}
+		if got := readRange(t, d, dst, http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+			t.Errorf("%s: content mismatch", dst)
+		}
+	}
+}
+
+func TestMoveDirTree(t *testing.T) {
+	ctx := context.Background()
+	for _, dirNames := range []string{"true", "false"} {
+		m, remote := newTestRemote(t, linkModeRange)
+		d := newTestCrypt(t, remote, map[string]interface{}{"directory_name_encryption": dirNames})
+		files := map[string][]byte{
+			"/src/a.txt":         testData(10),
+			"/src/sub/b.txt":     testData(70 * 1024),
+			"/src/sub/deep/c.md": testData(0),
+		}
+		for _, dir := range []string{"/src/sub/deep", "/dst"} {
+			if err := op.MakeDir(ctx, d, dir); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for p, data := range files {
+			putFile(t, d, stdpath.Dir(p), stdpath.Base(p), data)
+		}
+
+		if err := op.Move(ctx, d, "/src", "/dst"); err != nil {
+			t.Fatal(err)
+		}
+		// the names of the children don't depend on the path of their directory
+		if n := atomic.LoadInt32(&m.moves); n != 1 {
+			t.Errorf("directory_name_encryption %s: expect the tree to be moved by one remote move, got %d", dirNames, n)
+		}
+		if n := atomic.LoadInt32(&m.copies); n != 0 {
+			t.Errorf("directory_name_encryption %s: expect no remote copy, got %d", dirNames, n)
+		}
+		for p, data := range files {
+			dst := "/dst" + p
+			if got := readRange(t, d, dst, http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+				t.Errorf("directory_name_encryption %s: %s: content mismatch", dirNames, dst)
+			}
+		}
+		if _, err := op.Get(ctx, d, "/src"); err == nil {
+			t.Errorf("directory_name_encryption %s: expect the source to be gone", dirNames)
+		}
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(100)
+	putFile(t, d, "/", "a.txt", data)
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	// base32 is decoded case insensitively, the upper case name decrypts to a.txt as well
+	encrypted, _ := m.read("/" + d.cipher.EncryptFileName("a.txt"))
+	m.putFile("/"+strings.ToUpper(d.cipher.EncryptFileName("a.txt")), append(append([]byte(nil), encrypted...), testData(1000)...))
+	m.putDir("/" + strings.ToUpper(d.cipher.EncryptDirName("dir")))
+	m.putFile("/"+strings.ToUpper(d.cipher.EncryptDirName("dir"))+"/"+d.cipher.EncryptFileName("b.txt"), encrypted)
+
+	for i := 0; i < 2; i++ {
+		objs, err := op.List(ctx, d, "/", model.ListArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objs) != 2 {
+			t.Fatalf("expect one object of each name, got %d", len(objs))
+		}
+		for _, obj := range objs {
+			got, err := op.Get(ctx, d, "/"+obj.GetName())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.IsDir() != obj.IsDir() || got.GetSize() != obj.GetSize() {
+				t.Errorf("%s: expect List to show what Get resolves, list %v %d, get %v %d",
+					obj.GetName(), obj.IsDir(), obj.GetSize(), got.IsDir(), got.GetSize())
+			}
+		}
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("expect a.txt to read the canonical file")
+	}
+	if n := d.DecryptFailures().Collisions; n != 4 {
+		t.Errorf("expect 2 collisions in each listing, got %d", n)
+	}
+}
+
+func TestRemoteIDs(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"plain_extensions": "7z"})
+	putFile(t, d, "/", "a.txt", testData(10))
+	putFile(t, d, "/", "b.7z", testData(10))
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	remoteIDs := map[string]string{
+		"a.txt": m.nodes["/"+d.cipher.EncryptFileName("a.txt")].id,
+		"b.7z":  m.nodes["/"+d.cipher.EncryptFileName("b.7z")+plainSuffix].id,
+		"dir":   m.nodes["/"+d.cipher.EncryptDirName("dir")].id,
+	}
+
+	objs, err := d.List(ctx, &model.Object{Path: "/", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != len(remoteIDs) {
+		t.Fatalf("expect %d objects, got %d", len(remoteIDs), len(objs))
+	}
+	for _, obj := range objs {
+		if id := remoteIDs[obj.GetName()]; id == "" || obj.GetID() != id {
+			t.Errorf("list %s: expect id %s, got %s", obj.GetName(), id, obj.GetID())
+		}
+	}
+	for name, id := range remoteIDs {
+		obj, err := d.Get(ctx, "/"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.GetID() != id {
+			t.Errorf("get %s: expect id %s, got %s", name, id, obj.GetID())
+		}
+	}
+}
+
+func TestLinkRangeLength(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(200 * 1024)
+	putFile(t, d, "/", "a.txt", data)
+	remoteSize := d.cipher.EncryptedSize(int64(len(data)))
+
+	lastRange := func() http_range.Range {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.ranges[len(m.ranges)-1]
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Start: 100000, Length: -1}); !bytes.Equal(got, data[100000:]) {
+		t.Errorf("open ended read mismatch")
+	}
+	if r := lastRange(); r.Length != -1 {
+		t.Errorf("expect an open ended remote range, got %+v", r)
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Start: 100000, Length: int64(len(data)) - 100000}); !bytes.Equal(got, data[100000:]) {
+		t.Errorf("bounded read mismatch")
+	}
+	if r := lastRange(); r.Length < 0 || r.Start+r.Length != remoteSize {
+		t.Errorf("expect a remote range bounded to EOF at %d, got %+v", remoteSize, r)
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: int64(len(data))}); !bytes.Equal(got, data) {
+		t.Errorf("full read mismatch")
+	}
+	if r := lastRange(); r.Start != 0 || r.Length != remoteSize {
+		t.Errorf("expect the whole remote file as a bounded range, got %+v", r)
+	}
+}
+
+func TestLinkContentLength(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(200 * 1024)
+	putFile(t, d, "/", "a.txt", data)
+
+	for _, tt := range []struct {
+		rangeHeader string
+		status      int
+		want        []byte
+	}{
+		{"", http.StatusOK, data},
+		{"bytes=100000-", http.StatusPartialContent, data[100000:]},
+		{"bytes=1000-70999", http.StatusPartialContent, data[1000:71000]},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+		if tt.rangeHeader != "" {
+			req.Header.Set("Range", tt.rangeHeader)
+		}
+		link, file, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{Header: req.Header, HttpReq: req})
+		if err != nil {
+			t.Fatalf("failed to link: %+v", err)
+		}
+		want := strconv.Itoa(len(tt.want))
+		if got := link.Header.Get("Content-Length"); got != "" {
+			t.Errorf("range %q: expect the link to leave the length to the server, got %s", tt.rangeHeader, got)
+		}
+		w := httptest.NewRecorder()
+		net.ServeHTTP(w, req, file.GetName(), file.ModTime(), file.GetSize(), link.RangeReadCloser.RangeReader)
+		if w.Code != tt.status {
+			t.Errorf("range %q: expect status %d, got %d", tt.rangeHeader, tt.status, w.Code)
+		}
+		if got := w.Header().Get("Content-Length"); got != want {
+			t.Errorf("range %q: expect Content-Length %s, got %s", tt.rangeHeader, want, got)
+		}
+		if !bytes.Equal(w.Body.Bytes(), tt.want) {
+			t.Errorf("range %q: body mismatch", tt.rangeHeader)
+		}
+	}
+}
+
+func TestLinkStallTimeout(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeURL)
+	d := newTestCrypt(t, remote, map[string]interface{}{"remote_read_timeout": 1})
+	data := testData(200 * 1024)
+	putFile(t, d, "/", "a.txt", data)
+	m.stallAfter = 1000
+
+	link, _, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		// every range has its own timeout, a retry stalls the same way
+		start := time.Now()
+		rc, err := link.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+		if err == nil {
+			_, err = io.ReadAll(rc)
+			_ = rc.Close()
+		}
+		if !errors.Is(err, ErrRemoteStalled) {
+			t.Errorf("expect the read to stall, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("expect the stall to fail after the 1s timeout, took %s", elapsed)
+		}
+	}
+
+	// the range is aborted with the ctx of the link before the timeout
+	d.RemoteReadTimeout = 60
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	obj, err := op.Get(ctx, d, "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err = d.Link(ctx, obj, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := link.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err = io.ReadAll(rc); err == nil || errors.Is(err, ErrRemoteStalled) {
+		t.Errorf("expect the read to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expect the cancel to stop the read, took %s", elapsed)
+	}
+}
+
+func TestLinkExpiredURL(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeURL)
+	d := newTestCrypt(t, remote, map[string]interface{}{"expired_link_retries": 3})
+	data := testData(200 * 1024)
+	putFile(t, d, "/", "a.txt", data)
+	m.expireAfter = 50 * 1024
+
+	link, _, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []http_range.Range{{Length: -1}, {Start: 70000, Length: 100000}} {
+		rc, err := link.RangeReadCloser.RangeReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatalf("expect the range %+v to go on with a new link, got %+v", r, err)
+		}
+		end := int64(len(data))
+		if r.Length >= 0 {
+			end = r.Start + r.Length
+		}
+		if !bytes.Equal(got, data[r.Start:end]) {
+			t.Errorf("range %+v: read %d bytes that don't match", r, len(got))
+		}
+	}
+	if v := atomic.LoadInt32(&m.linkVersion); v < 4 {
+		t.Errorf("expect the links to expire on the way, version %d", v)
+	}
+
+	m.linkExpired = true
+	atomic.StoreInt32(&m.links, 0)
+	_, err = link.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+	if !errors.Is(err, errLinkExpired) {
+		t.Errorf("expect a link that keeps expiring to fail, got %v", err)
+	}
+	if links := atomic.LoadInt32(&m.links); links != 3 {
+		t.Errorf("expect 3 new links, got %d", links)
+	}
+}
+
+func TestLinkMisalignedRange(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeURL)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(200 * 1024)
+	putFile(t, d, "/", "a.txt", data)
+	read := func(r http_range.Range) ([]byte, error) {
+		link, _, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := link.RangeReadCloser.RangeReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	m.badRange = "full"
+	for _, r := range []http_range.Range{{Start: 70000, Length: 1000}, {Start: 150000, Length: -1}, {Length: 100}} {
+		end := int64(len(data))
+		if r.Length >= 0 {
+			end = r.Start + r.Length
+		}
+		if got, err := read(r); err != nil || !bytes.Equal(got, data[r.Start:end]) {
+			t.Errorf("expect the range %+v to be found in the whole file, got %d bytes, %v", r, len(got), err)
+		}
+	}
+	for _, bad := range []string{"bare", "ahead"} {
+		m.badRange = bad
+		if _, err := read(http_range.Range{Start: 70000, Length: 1000}); err == nil {
+			t.Errorf("%s: expect misaligned bytes to be an error", bad)
+		}
+	}
+}
+
+func TestPathNormalization(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	if err := op.MakeDir(ctx, d, "/dir/sub"); err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, d, "/dir", "a.txt", testData(10))
+
+	equivalent := []struct {
+		isDir bool
+		paths []string
+	}{
+		{true, []string{"/dir/sub", "/dir/sub/", "dir/sub", "/dir//sub", "/dir/./sub/", "/dir/x/../sub", `\dir\sub`}},
+		{false, []string{"/dir/a.txt", "dir/a.txt", "/dir/./a.txt", "/dir/sub/../a.txt", "//dir/a.txt"}},
+		{true, []string{"/", "", ".", "/..", "//"}},
+	}
+	for _, e := range equivalent {
+		want := d.getPathForRemote(e.paths[0], e.isDir)
+		for _, p := range e.paths[1:] {
+			if got := d.getPathForRemote(p, e.isDir); got != want {
+				t.Errorf("expect %q to resolve to %s like %q, got %s", p, want, e.paths[0], got)
+			}
+		}
+		if !e.isDir {
+			continue
+		}
+		for _, p := range e.paths {
+			if _, err := d.list(ctx, p, false); err != nil {
+				t.Errorf("expect %q to be listed, got %v", p, err)
+			}
+		}
+	}
+	for _, p := range []string{"/dir/sub/", "dir/./sub", "/dir/sub/../a.txt"} {
+		if _, err := d.Get(ctx, p); err != nil {
+			t.Errorf("expect %q to be found, got %v", p, err)
+		}
+	}
+
+	// a trailing slash only finds directories, unless it is ignored. it makes a difference
+	// when directory names are stored differently from file names
+	_, plainDirsRemote := newTestRemote(t, linkModeRange)
+	plainDirs := newTestCrypt(t, plainDirsRemote, map[string]interface{}{"directory_name_encryption": "false"})
+	putFile(t, plainDirs, "/", "a.txt", testData(10))
+	if _, err := plainDirs.Get(ctx, "/a.txt/"); err == nil {
+		t.Errorf("expect a file not to be found with a trailing slash")
+	}
+	ignoring := newTestCrypt(t, plainDirsRemote, map[string]interface{}{"directory_name_encryption": "false", "ignore_trailing_slash": true})
+	if obj, err := ignoring.Get(ctx, "/a.txt/"); err != nil || obj.IsDir() || obj.GetPath() != "/a.txt" {
+		t.Errorf("expect the trailing slash to be ignored, got %+v, %v", obj, err)
+	}
+}
+
+func TestMaxStreams(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	open := func(d *Crypt) (io.ReadCloser, error) {
+		link, _, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return link.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+	}
+
+	d := newTestCrypt(t, remote, map[string]interface{}{"max_streams": 2})
+	putFile(t, d, "/", "a.txt", testData(1000))
+	var streams []io.ReadCloser
+	for i := 0; i < 2; i++ {
+		rc, err := open(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams = append(streams, rc)
+	}
+	if _, err := open(d); !errors.Is(err, ErrTooManyStreams) {
+		t.Errorf("expect a stream over the limit to be refused, got %v", err)
+	}
+	_ = streams[0].Close()
+	_ = streams[0].Close()
+	rc, err := open(d)
+	if err != nil {
+		t.Fatalf("expect a closed stream to free its slot, got %v", err)
+	}
+	if _, err = open(d); !errors.Is(err, ErrTooManyStreams) {
+		t.Errorf("expect a stream closed twice to free one slot, got %v", err)
+	}
+	_ = rc.Close()
+	_ = streams[1].Close()
+
+	queued := newTestCrypt(t, remote, map[string]interface{}{"max_streams": 1, "stream_queue_timeout": 1})
+	held, err := open(queued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(200*time.Millisecond, func() { _ = held.Close() })
+	start := time.Now()
+	rc, err = open(queued)
+	if err != nil {
+		t.Fatalf("expect a queued stream to get the slot of a closed one, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expect the stream to wait for the slot, took %s", elapsed)
+	}
+	if _, err = open(queued); !errors.Is(err, ErrTooManyStreams) {
+		t.Errorf("expect a stream to be refused when no slot frees up in time, got %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil || !bytes.Equal(data, testData(1000)) {
+		t.Errorf("expect the queued stream to read the file, got %d bytes, %v", len(data), err)
+	}
+}
+
+// the readers served by common.Proxy are never closed, their slots are released all the same
+func TestMaxStreamsProxy(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"max_streams": 1})
+	data := testData(100000)
+	putFile(t, d, "/", "a.txt", data)
+	for i, rng := range []string{"", "bytes=0-99", "bytes=500-", "bytes=0-99", ""} {
+		link, file, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/d/a.txt", nil)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		w := httptest.NewRecorder()
+		if err = common.Proxy(w, req, link, file); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusOK && w.Code != http.StatusPartialContent {
+			t.Fatalf("request %d with range %q: expect the slot of the request before to be released, got %d %s", i, rng, w.Code, w.Body.String())
+		}
+		if rng == "" && !bytes.Equal(w.Body.Bytes(), data) {
+			t.Errorf("request %d: read mismatch", i)
+		}
+	}
+}
+
+// links holding stream slots aren't cached, a request closing its link would release the slots of
+// the readers of other requests
+func TestMaxStreamsLinkNotCached(t *testing.T) {
+	fs, remote := newTestRemote(t, linkModeRange)
+	fs.linkExpiration = time.Hour
+	d := newTestCrypt(t, remote, map[string]interface{}{"max_streams": 1})
+	data := testData(1000)
+	putFile(t, d, "/", "a.txt", data)
+	ctx := context.Background()
+	first, _, err := op.Link(ctx, d, "/a.txt", model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := first.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	second, _, err := op.Link(ctx, d, "/a.txt", model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatal("expect a link holding slots not to be cached")
+	}
+	_ = second.RangeReadCloser.Closers.Close()
+	if _, err = second.RangeReadCloser.RangeReader(http_range.Range{Length: -1}); err == nil {
+		t.Error("expect the slot of the open reader to be kept when another link is closed")
+	}
+	if data, err := io.ReadAll(rc); err != nil || len(data) != 1000 {
+		t.Errorf("expect the open reader to read the file, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestDecryptTo(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []string{linkModeRange, linkModeSeek, linkModeURL} {
+		_, remote := newTestRemote(t, mode)
+		d := newTestCrypt(t, remote, nil)
+		data := testData(200 * 1024)
+		putFile(t, d, "/", "a.txt", data)
+		obj, err := op.Get(ctx, d, "/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range []http_range.Range{{Length: -1}, {Start: 70000, Length: 1000}, {Start: 150000, Length: -1}} {
+			var buf bytes.Buffer
+			if err := d.DecryptTo(ctx, obj, &buf, r); err != nil {
+				t.Fatalf("%s %+v: %v", mode, r, err)
+			}
+			want := data[r.Start:]
+			if r.Length >= 0 {
+				want = want[:r.Length]
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%s %+v: content mismatch", mode, r)
+			}
+		}
+	}
+}
+
+func TestOpenReader(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []string{linkModeRange, linkModeSeek, linkModeURL} {
+		_, remote := newTestRemote(t, mode)
+		d := newTestCrypt(t, remote, nil)
+		data := testData(200 * 1024)
+		putFile(t, d, "/", "a.mkv", data)
+		obj, err := op.Get(ctx, d, "/a.mkv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := d.OpenReader(ctx, obj)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		seeks := []struct {
+			offset int64
+			whence int
+			want   int64
+		}{
+			{0, io.SeekStart, 0},
+			{150000, io.SeekStart, 150000},
+			{-1000, io.SeekEnd, int64(len(data)) - 1000},
+			{65530, io.SeekStart, 65530},
+			{-30000, io.SeekCurrent, 65530 + 100 - 30000},
+			{0, io.SeekEnd, int64(len(data))},
+		}
+		for _, s := range seeks {
+			pos, err := r.Seek(s.offset, s.whence)
+			if err != nil || pos != s.want {
+				t.Fatalf("%s: seek %d %d: expect %d, got %d %v", mode, s.offset, s.whence, s.want, pos, err)
+			}
+			buf := make([]byte, 100)
+			n, err := io.ReadFull(r, buf)
+			want := data[pos:]
+			if len(want) > 100 {
+				want = want[:100]
+			}
+			if n != len(want) || !bytes.Equal(buf[:n], want) {
+				t.Errorf("%s: read at %d: content mismatch, %v", mode, pos, err)
+			}
+			if len(want) == 0 && err != io.EOF {
+				t.Errorf("%s: expect EOF at the end, got %v", mode, err)
+			}
+		}
+		if err = r.Close(); err != nil {
+			t.Errorf("%s: %v", mode, err)
+		}
+		if _, err = r.Read(make([]byte, 1)); err == nil {
+			t.Errorf("%s: expect a closed reader to fail", mode)
+		}
+	}
+}
+
+func TestStoragesBackedBy(t *testing.T) {
+	_, remote1 := newTestRemote(t, linkModeRange)
+	_, remote2 := newTestRemote(t, linkModeRange)
+	d1 := newTestCrypt(t, remote1, nil)
+	d2 := newTestCrypt(t, remote1+"/sub/dir", nil)
+	d3 := newTestCrypt(t, remote2, nil)
+
+	got := StoragesBackedBy(remote1 + "/")
+	if len(got) != 2 || !(got[0] == d1 && got[1] == d2 || got[0] == d2 && got[1] == d1) {
+		t.Errorf("expect the 2 storages on %s, got %d", remote1, len(got))
+	}
+	if got := StoragesBackedBy(remote2); len(got) != 1 || got[0] != d3 {
+		t.Errorf("expect the storage on %s, got %d", remote2, len(got))
+	}
+	if got := StoragesBackedBy("/not/mounted"); len(got) != 0 {
+		t.Errorf("expect none, got %d", len(got))
+	}
+}
+
+func TestLinkPrefixRead(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(4 << 20)
+	putFile(t, d, "/", "a.mp3", data)
+	m.mu.Lock()
+	m.ranges = nil
+	m.mu.Unlock()
+
+	if got := readRange(t, d, "/a.mp3", http_range.Range{Length: 4096}); !bytes.Equal(got, data[:4096]) {
+		t.Fatalf("prefix read mismatch")
+	}
+	// the header and the first block are all that's needed to decrypt the first 64k
+	firstBlock := d.cipher.EncryptedSize(64 * 1024)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.ranges) != 1 || m.ranges[0].Start != 0 || m.ranges[0].Length != firstBlock {
+		t.Errorf("expect one remote range of %d bytes, got %+v", firstBlock, m.ranges)
+	}
+}
+
+func TestBackslashRemote(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	m.backslash = true
+	d := newTestCrypt(t, remote, nil)
+	data := testData(70 * 1024)
+	for _, dir := range []string{"/a/b", "/c"} {
+		if err := op.MakeDir(ctx, d, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	putFile(t, d, "/a/b", "f.txt", data)
+	remoteObj, err := op.Get(ctx, d.remoteStorage, "/"+d.cipher.EncryptDirName("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(remoteObj.GetPath(), "\\") {
+		t.Fatalf("expect the remote to use backslashes internally, got %s", remoteObj.GetPath())
+	}
+
+	if err = op.Rename(ctx, d, "/a/b/f.txt", "g.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = op.Move(ctx, d, "/a/b", "/c"); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := op.List(ctx, d, "/c/b", model.ListArgs{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "g.txt" || objs[0].GetSize() != int64(len(data)) {
+		t.Fatalf("expect g.txt in /c/b, got %v", objs)
+	}
+	if got := readRange(t, d, "/c/b/g.txt", http_range.Range{Start: 65530, Length: 100}); !bytes.Equal(got, data[65530:65630]) {
+		t.Errorf("content mismatch")
+	}
+	if err = op.Remove(ctx, d, "/c/b/g.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = op.Get(ctx, d, "/c/b/g.txt"); err == nil {
+		t.Errorf("expect g.txt to be removed")
+	}
+}
@@ -0,0 +1,52 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+)
+
+// PlannedUpload is what Put would store on the remote for an upload, as reported by PlanPut
+type PlannedUpload struct {
+	// Name is the remote name, EncryptFileName of the name unless the file is stored plain or clear
+	Name string `json:"name"`
+	// Size is the remote size, EncryptedSize of the size when the content is encrypted. -1 for an upload of unknown size
+	Size int64 `json:"size"`
+	// ActualPath is the path of the file in the remote storage
+	ActualPath string `json:"actual_path"`
+	// Exact is false when the name and size depend on the content, with compression or dedup_names.
+	// Name and Size are then the ones of the file without compression and without its hash
+	Exact bool `json:"exact"`
+}
+
+// PlanPut reports what Put would store for an upload of name and size into dstDir, without reading
+// or writing the remote. an upload whose name collides with another file differing in case, with
+// case_collision set, may still be stored under another name
+func (d *Crypt) PlanPut(ctx context.Context, dstDir, name string, size int64) (PlannedUpload, error) {
+	var res PlannedUpload
+	if err := d.resolve(ctx); err != nil {
+		return res, err
+	}
+	if size < 0 && !d.UnknownSizeUpload {
+		return res, fmt.Errorf("%w: %s, enable unknown_size_upload if the remote accepts chunked uploads", ErrUnknownSize, name)
+	}
+	dstDirActualPath, err := d.getActualPathForRemote(dstDir, true)
+	if err != nil {
+		return res, fmt.Errorf("failed to convert path to remote path: %w", err)
+	}
+	res.Size, res.Exact = size, true
+	switch {
+	case isClearUpload(ctx):
+		res.Name = name + clearSuffix
+	case d.isPlainExt(name):
+		res.Name = d.cipher.EncryptFileName(name) + plainSuffix
+	default:
+		res.Name = d.cipher.EncryptFileName(name)
+		if size >= 0 {
+			res.Size = d.cipher.EncryptedSize(size)
+		}
+		res.Exact = d.Compression != compressionGzip && !d.DedupNames
+	}
+	res.ActualPath = stdpath.Join(dstDirActualPath, res.Name)
+	return res, nil
+}
@@ -0,0 +1,83 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	stdpath "path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestPlanPut(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"plain_extensions": "7z"})
+	if err := op.MakeDir(context.Background(), d, "/docs"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		ctx  context.Context
+		dir  string
+		name string
+		size int
+	}{
+		{context.Background(), "/", "a.txt", 1000},
+		{context.Background(), "/docs", "b.bin", 200000},
+		{context.Background(), "/docs", "empty.txt", 0},
+		{context.Background(), "/docs", "c.7z", 1000},
+		{WithClearUpload(context.Background()), "/docs", "README", 100},
+	} {
+		gets, links, paths := atomic.LoadInt32(&m.gets), atomic.LoadInt32(&m.links), len(m.paths())
+		plan, err := d.PlanPut(c.ctx, c.dir, c.name, int64(c.size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if atomic.LoadInt32(&m.gets) != gets || atomic.LoadInt32(&m.links) != links || len(m.paths()) != paths {
+			t.Errorf("%s: expect the plan not to touch the remote", c.name)
+		}
+		if !plan.Exact {
+			t.Errorf("%s: expect an exact plan", c.name)
+		}
+		err = op.Put(c.ctx, d, c.dir, &model.FileStream{
+			Obj: &model.Object{
+				Name:     c.name,
+				Size:     int64(c.size),
+				Modified: time.Now(),
+			},
+			ReadCloser: io.NopCloser(bytes.NewReader(testData(c.size))),
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, ok := m.read(plan.ActualPath)
+		if !ok || int64(len(data)) != plan.Size || stdpath.Base(plan.ActualPath) != plan.Name {
+			t.Errorf("%s: planned %+v, got %d bytes, %v", c.name, plan, len(data), m.paths())
+		}
+	}
+	if plan, _ := d.PlanPut(context.Background(), "/", "a.txt", 1000); plan.Name != d.EncryptName("a.txt", false) || plan.Size != d.cipher.EncryptedSize(1000) {
+		t.Errorf("expect the name and size of the cipher, got %+v", plan)
+	}
+	if _, err := d.PlanPut(context.Background(), "/", "pipe", -1); !errors.Is(err, ErrUnknownSize) {
+		t.Errorf("expect an upload of unknown size to be refused, got %v", err)
+	}
+	want, _ := d.PlanPut(context.Background(), "/docs", "d.txt", 1000)
+	got, err := d.Other(userCtx(testWriter), model.OtherArgs{
+		Obj:    &model.Object{Path: "/docs", IsFolder: true},
+		Method: "plan_put",
+		Data:   map[string]interface{}{"name": "d.txt", "size": 1000},
+	})
+	if err != nil || got != want {
+		t.Errorf("expect plan_put to report %+v, got %+v, %v", want, got, err)
+	}
+
+	_, remote = newTestRemote(t, linkModeRange)
+	d = newTestCrypt(t, remote, map[string]interface{}{"compression": "gzip"})
+	if plan, err := d.PlanPut(context.Background(), "/", "a.txt", 1000); err != nil || plan.Exact {
+		t.Errorf("expect the plan of a compressed upload not to be exact, got %+v, %v", plan, err)
+	}
+}
@@ -0,0 +1,97 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/fs"
+)
+
+// Export walks the tree under path and passes fn an entry for every object, with its decrypted path,
+// size and modification time, e.g. to share a manifest with those who have the key. the objects that
+// don't decrypt are passed with Error set, nothing under such a directory is. maxDepth > 0 stops at
+// that many levels below path. the files the driver keeps for itself, uploads in progress and the
+// objects List hides are left out
+func (d *Crypt) Export(ctx context.Context, path string, maxDepth int, fn func(ManifestEntry) error) error {
+	return d.exportFiltered(ctx, path, maxDepth, nil, fn)
+}
+
+// exportFiltered is Export of the objects for which canRead returns true, all of them if it is nil.
+// nothing under a directory it refuses is exported
+func (d *Crypt) exportFiltered(ctx context.Context, path string, maxDepth int, canRead func(path string) bool, fn func(ManifestEntry) error) error {
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	path, _ = d.cleanPath(path)
+	if canRead != nil && !canRead(path) {
+		return fmt.Errorf("%w: %s", errs.PermissionDenied, path)
+	}
+	return d.export(ctx, path, d.getPathForRemote(path, true), 1, maxDepth, canRead, fn)
+}
+
+func (d *Crypt) export(ctx context.Context, path, remoteDir string, depth, maxDepth int, canRead func(path string) bool, fn func(ManifestEntry) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	objs, err := fs.List(ctx, remoteDir, d.remoteListArgs())
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", remoteDir, err)
+	}
+	for _, remoteObj := range objs {
+		if isReservedName(remoteObj.GetName()) || !remoteObj.IsDir() && uploading(remoteObj) {
+			continue
+		}
+		entry := ManifestEntry{
+			Path:     stdpath.Join(path, remoteObj.GetName()),
+			IsDir:    remoteObj.IsDir(),
+			Modified: remoteObj.ModTime(),
+		}
+		name, ok := d.decryptRemoteName(remoteObj.GetName(), remoteObj.IsDir())
+		if !ok && remoteObj.IsDir() && d.plainDirName(path, remoteObj.GetName()) {
+			name, ok = remoteObj.GetName(), true
+		}
+		if canRead != nil {
+			readPath := entry.Path
+			if ok {
+				readPath = stdpath.Join(path, name)
+			}
+			if !canRead(readPath) {
+				continue
+			}
+		}
+		if !ok || !remoteObj.IsDir() && !d.decryptable(remoteObj) {
+			entry.Error = "doesn't decrypt"
+			if err = fn(entry); err != nil {
+				return err
+			}
+			continue
+		}
+		if d.hiddenName(name) || d.hiddenAppleDouble(name, remoteObj.IsDir()) {
+			continue
+		}
+		obj, err := d.decryptRemoteObj(ctx, stdpath.Join(path, name), remoteObj)
+		if err != nil {
+			// e.g. over MaxDecryptedSize, Get refuses it the same
+			entry.Error = err.Error()
+			if err = fn(entry); err != nil {
+				return err
+			}
+			continue
+		}
+		entry.Path, entry.Modified = obj.GetPath(), obj.ModTime()
+		if !obj.IsDir() {
+			entry.Size = obj.GetSize()
+		}
+		if err = fn(entry); err != nil {
+			return err
+		}
+		if obj.IsDir() && (maxDepth <= 0 || depth < maxDepth) {
+			if err = d.export(ctx, obj.GetPath(), stdpath.Join(remoteDir, remoteObj.GetName()), depth+1, maxDepth, canRead, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	if err := op.MakeDir(ctx, d, "/a/b"); err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, d, "/", "top.txt", testData(10))
+	putFile(t, d, "/a", "mid.txt", testData(20))
+	putFile(t, d, "/a/b", "deep.txt", testData(30))
+	m.putFile(d.getPathForRemote("/a", true)[len(remote):]+"/foreign", testData(100))
+
+	export := func(maxDepth int) map[string]ManifestEntry {
+		entries := map[string]ManifestEntry{}
+		err := d.Export(ctx, "/", maxDepth, func(entry ManifestEntry) error {
+			entries[entry.Path] = entry
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+	entries := export(0)
+	expect := map[string]int64{"/top.txt": 10, "/a": 0, "/a/mid.txt": 20, "/a/b": 0, "/a/b/deep.txt": 30}
+	for path, size := range expect {
+		entry, ok := entries[path]
+		if !ok || entry.Size != size || entry.Error != "" || entry.IsDir != (size == 0) || entry.Modified.IsZero() {
+			t.Errorf("expect %s of %d bytes in the manifest, got %+v", path, size, entry)
+		}
+	}
+	if entry := entries["/a/foreign"]; entry.Error == "" {
+		t.Errorf("expect the undecryptable file to be flagged, got %+v", entry)
+	}
+	if len(entries) != len(expect)+1 {
+		t.Errorf("expect %d entries, got %d", len(expect)+1, len(entries))
+	}
+
+	if entries = export(1); len(entries) != 2 {
+		t.Errorf("expect max depth 1 to export the top level only, got %d entries", len(entries))
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := d.Export(canceled, "/", 0, func(ManifestEntry) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("expect a canceled export to stop, got %v", err)
+	}
+}
+
+// the files List hides and uploads in progress are left out of the manifest
+func TestExportHidden(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"apple_double": appleDoubleHide, "hidden_names": "*.tmp"})
+	for _, name := range []string{"a.txt", "._a.txt", "b.tmp", "c.txt"} {
+		putFile(t, d, "/", name, testData(10))
+	}
+	m.mu.Lock()
+	m.nodes["/"+d.cipher.EncryptFileName("c.txt")].uploading = true
+	m.mu.Unlock()
+	var paths []string
+	err := d.Export(ctx, "/", 0, func(entry ManifestEntry) error {
+		paths = append(paths, entry.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != "/a.txt" {
+		t.Errorf("expect only a.txt to be exported, got %v", paths)
+	}
+}
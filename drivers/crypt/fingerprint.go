@@ -0,0 +1,63 @@
+package crypt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+)
+
+// fingerprintProbe is the name encrypted to fingerprint the keys of a cipher
+const fingerprintProbe = "alist crypt fingerprint"
+
+// standardCipher returns c, or a cipher with its keys that encrypts names in the standard mode, the
+// other modes don't use the keys, or not all of them
+func standardCipher(c *rcCrypt.Cipher, a *Addition, password, salt string) (*rcCrypt.Cipher, error) {
+	if a.FileNameEnc == "standard" {
+		return c, nil
+	}
+	std := *a
+	std.FileNameEnc = "standard"
+	return newCipher(&std, password, salt)
+}
+
+// cipherFingerprint hashes the name fingerprintProbe is encrypted to with the keys of std, a standard
+// cipher, and the options of a that change the remote names. the keys are derived from the password
+// by scrypt and the hash can't be reversed, it tells no more about the password than any encrypted name does
+func cipherFingerprint(std *rcCrypt.Cipher, a *Addition) string {
+	encoding := a.FileNameEncoding
+	if encoding == "" {
+		encoding = "base32"
+	}
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s",
+		std.EncryptFileName(fingerprintProbe), a.FileNameEnc, a.DirNameEnc, encoding, a.EncryptedSuffix)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// setCipher makes c the cipher of the storage, password and salt are those it was built with
+func (d *Crypt) setCipher(c *rcCrypt.Cipher, password, salt string) error {
+	std, err := standardCipher(c, &d.Addition, password, salt)
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint Cipher: %w", err)
+	}
+	d.cipher, d.fingerprint, d.dedupKey = c, cipherFingerprint(std, &d.Addition), dedupKey(std)
+	return nil
+}
+
+// CipherFingerprint identifies the keys and name options of the storage without revealing them, the
+// storages with the same fingerprint read the remote files of each other. it is computed with the
+// cipher at Init, it is empty if the cipher can't be built
+func (d *Crypt) CipherFingerprint() string {
+	if _, err := d.nameCipher(); err != nil {
+		return ""
+	}
+	return d.fingerprint
+}
+
+// sameCipher tells whether the remote files of d can be copied to dst as they are
+func (d *Crypt) sameCipher(dst *Crypt) bool {
+	fingerprint := d.CipherFingerprint()
+	return fingerprint != "" && fingerprint == dst.CipherFingerprint()
+}
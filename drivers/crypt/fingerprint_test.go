@@ -0,0 +1,66 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestCipherFingerprint(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	_, other := newTestRemote(t, linkModeRange)
+	base := newTestCrypt(t, remote, nil).CipherFingerprint()
+	if len(base) != 32 || strings.Contains(base, "password") {
+		t.Fatalf("unexpected fingerprint %q", base)
+	}
+	if got := newTestCrypt(t, other, nil).CipherFingerprint(); got != base {
+		t.Errorf("expect identical configs to have the same fingerprint, got %q and %q", base, got)
+	}
+	if got := newTestCrypt(t, other, map[string]interface{}{"lazy_init": true}).CipherFingerprint(); got != base {
+		t.Errorf("expect the fingerprint before the storage is resolved, got %q", got)
+	}
+	seen := map[string]string{base: "base"}
+	for name, extra := range map[string]map[string]interface{}{
+		"password":    {"password": "other"},
+		"salt":        {"salt": "other"},
+		"kdf":         {"kdf": kdfHardened},
+		"names off":   {"filename_encryption": "off"},
+		"obfuscate":   {"filename_encryption": "obfuscate"},
+		"dirs plain":  {"directory_name_encryption": "false"},
+		"encoding":    {"filename_encoding": "base64"},
+		"off, suffix": {"filename_encryption": "off", "encrypted_suffix": ".enc"},
+	} {
+		got := newTestCrypt(t, other, extra).CipherFingerprint()
+		if prev, ok := seen[got]; ok {
+			t.Errorf("%s: expect a different fingerprint, got the one of %s", name, prev)
+		}
+		seen[got] = name
+	}
+}
+
+func TestCopyToSameCipher(t *testing.T) {
+	ctx := context.Background()
+	srcFS, srcRemote := newTestRemote(t, linkModeRange)
+	dstFS, dstRemote := newTestRemote(t, linkModeRange)
+	src := newTestCrypt(t, srcRemote, nil)
+	dst := newTestCrypt(t, dstRemote, nil)
+	data := testData(100000)
+	putFile(t, src, "/", "a.txt", data)
+
+	res, err := src.CopyTo(ctx, "/a.txt", dst, "/", nil)
+	if err != nil || res != (ImportResult{Imported: 1}) {
+		t.Fatalf("got %+v, %v", res, err)
+	}
+	remoteName := "/" + src.EncryptName("a.txt", false)
+	srcCiphertext, _ := srcFS.read(remoteName)
+	dstCiphertext, ok := dstFS.read(remoteName)
+	if !ok || !bytes.Equal(srcCiphertext, dstCiphertext) {
+		t.Errorf("expect the ciphertext to be copied as it is, got %v", dstFS.paths())
+	}
+	if got := readRange(t, dst, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Error("read mismatch of the copy")
+	}
+}
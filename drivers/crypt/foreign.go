@@ -0,0 +1,62 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+)
+
+// ForeignCheck options
+const (
+	foreignCheckWarn   = "warn"
+	foreignCheckRefuse = "refuse"
+)
+
+// ErrForeignCipher is returned by Init when the remote holds names encrypted with other credentials
+// and ForeignCheck is refuse
+var ErrForeignCipher = errors.New("the remote holds data encrypted with other credentials")
+
+// checkForeign samples the names under the remote root. when none of them decrypts while most look
+// like names encrypted by a cipher, the remote path likely belongs to a store with other credentials:
+// uploads would be invisible next to it. only standard filename encryption can tell. with SelfTest,
+// Init has already refused a root where nothing decrypts, the root isn't listed again
+func (d *Crypt) checkForeign(ctx context.Context) error {
+	if d.ForeignCheck != foreignCheckWarn && d.ForeignCheck != foreignCheckRefuse || d.FileNameEnc != "standard" || d.SelfTest {
+		return nil
+	}
+	names, err := d.sampleNames(ctx, d.remoteRoot)
+	if err != nil {
+		// an unreachable remote is reported by the health check
+		return nil
+	}
+	encoding := d.FileNameEncoding
+	if encoding == "" {
+		encoding = "base32"
+	}
+	enc, err := rcCrypt.NewNameEncoding(encoding)
+	if err != nil {
+		return err
+	}
+	foreign := 0
+	for _, name := range names {
+		if decryptSampleName(d.cipher, name) {
+			return nil
+		}
+		// encrypted names are padded to the block size of the cipher
+		if data, err := enc.DecodeString(name.name); err == nil && len(data) > 0 && len(data)%16 == 0 {
+			foreign++
+		}
+	}
+	if foreign == 0 || foreign*2 <= len(names) {
+		return nil
+	}
+	err = fmt.Errorf("%w: none of the %d names sampled in %s decrypts, %d look encrypted. check the password, salt and remote path",
+		ErrForeignCipher, len(names), d.RemotePath, foreign)
+	if d.ForeignCheck == foreignCheckRefuse {
+		return err
+	}
+	d.logger().Warn(err)
+	return nil
+}
@@ -0,0 +1,52 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/op"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestForeignCheck(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	other := newTestCrypt(t, remote, map[string]interface{}{"password": "other password"})
+	putFile(t, other, "/", "a.txt", testData(10))
+	if err := op.MakeDir(ctx, other, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := createTestCrypt(t, remote, map[string]interface{}{"foreign_check": "refuse"}); !errors.Is(err, ErrForeignCipher) {
+		t.Errorf("expect refuse to fail the mount with ErrForeignCipher, got %v", err)
+	}
+	var buf bytes.Buffer
+	out := log.StandardLogger().Out
+	log.SetOutput(&buf)
+	_, err := createTestCrypt(t, remote, map[string]interface{}{"foreign_check": "warn"})
+	log.SetOutput(out)
+	if err != nil {
+		t.Errorf("expect warn to mount, got %v", err)
+	}
+	if !strings.Contains(buf.String(), ErrForeignCipher.Error()) {
+		t.Errorf("expect a warning, got %q", buf.String())
+	}
+	// the self test fails the mount first, the root isn't listed twice
+	if _, err = createTestCrypt(t, remote, map[string]interface{}{"foreign_check": "refuse", "self_test": true}); err == nil || errors.Is(err, ErrForeignCipher) {
+		t.Errorf("expect the self test to fail the mount, got %v", err)
+	}
+	if _, err = createTestCrypt(t, remote, map[string]interface{}{"foreign_check": "refuse", "password": "other password"}); err != nil {
+		t.Errorf("expect the right credentials to mount, got %v", err)
+	}
+
+	// files that were never encrypted are not taken for another store
+	m, plainRemote := newTestRemote(t, linkModeRange)
+	m.putFile("/holiday photo.jpg", testData(10))
+	m.putFile("/notes.txt", testData(10))
+	if _, err = createTestCrypt(t, plainRemote, map[string]interface{}{"foreign_check": "refuse"}); err != nil {
+		t.Errorf("expect a remote of plain files to mount, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package crypt
+
+import (
+	"strings"
+
+	"github.com/alist-org/alist/v3/pkg/utils"
+)
+
+// the ways of storing a file other than the encrypted content under its encrypted name, recorded in
+// FormatsApplied once the store may hold such files, so that Get only looks them up then. uploads
+// and Init record them, and listings record those of the files they meet. a file stored so by another
+// instance isn't found by Get until a listing of its directory met it, or a format was turned on here
+const (
+	formatPlain = "plain"
+	formatClear = "clear"
+	formatGzip  = "gzip"
+	formatDedup = "dedup"
+	// formatVersions is recorded once versions of files are kept, they are then handled with their files
+	formatVersions = "versions"
+)
+
+// formatApplied tells whether files stored as format may be in the store
+func (d *Crypt) formatApplied(format string) bool {
+	d.formatsMu.Lock()
+	defer d.formatsMu.Unlock()
+	return utils.SliceContains(strings.Split(d.FormatsApplied, ","), format)
+}
+
+// applyFormats records that files stored as formats may be in the store, and saves the storage if
+// that is new
+func (d *Crypt) applyFormats(formats ...string) {
+	if d.addFormats(formats...) {
+		d.save()
+	}
+}
+
+// addFormats adds formats to FormatsApplied, it tells whether any of them is new
+func (d *Crypt) addFormats(formats ...string) bool {
+	d.formatsMu.Lock()
+	defer d.formatsMu.Unlock()
+	applied := strings.Split(d.FormatsApplied, ",")
+	if d.FormatsApplied == "" {
+		applied = nil
+	}
+	changed := false
+	for _, format := range formats {
+		if !utils.SliceContains(applied, format) {
+			applied = append(applied, format)
+			changed = true
+		}
+	}
+	d.FormatsApplied = strings.Join(applied, ",")
+	return changed
+}
+
+// optionFormats are the formats the options store new files as
+func (d *Crypt) optionFormats() []string {
+	var formats []string
+	if strings.TrimSpace(d.PlainExtensions) != "" {
+		formats = append(formats, formatPlain)
+	}
+	if d.Compression == compressionGzip {
+		formats = append(formats, formatGzip)
+	}
+	if d.DedupNames {
+		formats = append(formats, formatDedup)
+	}
+	return formats
+}
+
+// remoteNameFormat is the format of the file stored under remoteName, "" for an encrypted one
+func remoteNameFormat(remoteName string) string {
+	if _, _, ok := parseVersionName(remoteName); ok {
+		return formatVersions
+	}
+	if strings.HasSuffix(remoteName, clearSuffix) {
+		return formatClear
+	}
+	if strings.HasSuffix(remoteName, plainSuffix) {
+		return formatPlain
+	}
+	if _, _, ok := parseCompressedName(remoteName); ok {
+		return formatGzip
+	}
+	if _, _, ok := parseDedupName(remoteName); ok {
+		return formatDedup
+	}
+	return ""
+}
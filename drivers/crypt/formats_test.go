@@ -0,0 +1,104 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/conf"
+	"github.com/alist-org/alist/v3/internal/db"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+// a miss looks up the other ways of storing a file only if the store may hold files stored that way
+func TestFormatsApplied(t *testing.T) {
+	ctx := context.Background()
+	tempDir := conf.Conf.TempDir
+	conf.Conf.TempDir = t.TempDir()
+	defer func() { conf.Conf.TempDir = tempDir }()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	putFile(t, d, "/", "a.txt", testData(100))
+	missed := len(m.missed)
+	if _, err := d.Get(ctx, "/b.txt"); err == nil {
+		t.Fatal("expect b.txt not to be found")
+	}
+	for _, path := range m.missed[missed:] {
+		if strings.HasSuffix(path, plainSuffix) || strings.HasSuffix(path, clearSuffix) {
+			t.Errorf("expect a miss not to look up %s", path)
+		}
+	}
+
+	d.PlainExtensions, d.Compression = "7z", compressionGzip
+	putFile(t, d, "/", "c.7z", testData(100))
+	putFile(t, d, "/", "d.txt", bytes.Repeat([]byte("a"), 10000))
+	if d.FormatsApplied != "plain,gzip" {
+		t.Errorf("expect the formats of the uploads to be recorded, got %q", d.FormatsApplied)
+	}
+	// turned off again, the files stored before are still found
+	d.PlainExtensions, d.Compression = "", "off"
+	for _, path := range []string{"/c.7z", "/d.txt"} {
+		if _, err := d.Get(ctx, path); err != nil {
+			t.Errorf("expect %s to be found once its option is off, got %v", path, err)
+		}
+	}
+}
+
+// stores written before FormatsApplied was recorded learn it from their listings
+func TestFormatsAppliedByList(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"plain_extensions": "7z"})
+	data := testData(100)
+	putFile(t, d, "/", "a.7z", data)
+	d.PlainExtensions, d.FormatsApplied = "", ""
+	d.save()
+	if _, err := d.Get(ctx, "/a.7z"); err == nil {
+		t.Fatal("expect a.7z to be looked up only as an encrypted file")
+	}
+	if _, err := op.List(ctx, d, "/", model.ListArgs{}); err != nil {
+		t.Fatal(err)
+	}
+	if d.FormatsApplied != formatPlain {
+		t.Errorf("expect the listing to record the plain file, got %q", d.FormatsApplied)
+	}
+	if saved, err := db.GetStorageById(d.GetStorage().ID); err != nil || !strings.Contains(saved.Addition, `"formats_applied":""`) {
+		t.Errorf("expect the listing not to save the storage, got %v", err)
+	}
+	if got := readRange(t, d, "/a.7z", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Error("read mismatch of a.7z")
+	}
+}
+
+// listings record formats while the storage is saved
+func TestFormatsAppliedConcurrent(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"plain_extensions": "7z"})
+	putFile(t, d, "/", "a.7z", testData(100))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			d.formatsMu.Lock()
+			d.FormatsApplied = ""
+			d.formatsMu.Unlock()
+			if _, err := d.List(ctx, &model.Object{Path: "/", IsFolder: true}, model.ListArgs{}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			d.save()
+		}()
+	}
+	wg.Wait()
+	if !d.formatApplied(formatPlain) {
+		t.Errorf("expect the listings to record the plain file, got %q", d.FormatsApplied)
+	}
+}
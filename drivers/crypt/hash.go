@@ -0,0 +1,65 @@
+package crypt
+
+import (
+	"context"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// plaintextHashType is the hash type of the plaintext hashes kept with PlaintextHash
+const plaintextHashType = "SHA1"
+
+// ciphertextHashPrefix namespaces the hash types of the encrypted bytes on the remote,
+// so they are never taken for a hash of the decrypted content
+const ciphertextHashPrefix = "crypt-ciphertext-"
+
+type hashGetter interface {
+	GetHash() (string, string)
+}
+
+// remoteHash returns the hash the remote reports for obj, if any
+func remoteHash(obj model.Obj) (hash, hashType string) {
+	for obj != nil {
+		if h, ok := obj.(hashGetter); ok {
+			return h.GetHash()
+		}
+		unwrap, ok := obj.(model.ObjUnwrap)
+		if !ok {
+			break
+		}
+		obj = unwrap.Unwrap()
+	}
+	return "", ""
+}
+
+// ciphertextHash returns the hash the remote reports for the encrypted file obj, under the type
+// crypt-ciphertext-<type of the remote>, e.g. crypt-ciphertext-md5
+func ciphertextHash(obj model.Obj) (hash, hashType string) {
+	hash, hashType = remoteHash(obj)
+	if hash == "" || hashType == "" {
+		return "", ""
+	}
+	return hash, ciphertextHashPrefix + strings.ToLower(hashType)
+}
+
+// setPlaintextHash sets the plaintext hash from the sidecar at sidecarPath on obj, in place of any hash of the remote
+func (d *Crypt) setPlaintextHash(ctx context.Context, obj model.Obj, sidecarPath string) {
+	var meta ObjMeta
+	if err := d.readEncryptedJson(ctx, sidecarPath, &meta); err != nil {
+		if !errs.IsObjectNotFound(err) {
+			log.Warnf("failed to read the plaintext hash of %s: %s", obj.GetName(), err)
+		}
+		return
+	}
+	setHashFromSidecar(obj, &meta)
+}
+
+// setHashFromSidecar sets the plaintext hash meta holds on obj, if any
+func setHashFromSidecar(obj model.Obj, meta *ObjMeta) {
+	if s, ok := obj.(model.SetHash); ok && meta.SHA1 != "" {
+		s.SetHash(meta.SHA1, plaintextHashType)
+	}
+}
@@ -0,0 +1,154 @@
+package crypt
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestCiphertextHash(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	m.md5 = true
+	for _, lazy := range []bool{false, true} {
+		d := newTestCrypt(t, remote, map[string]interface{}{"plain_extensions": "7z", "lazy_decrypt": lazy})
+		putFile(t, d, "/", "a.txt", testData(100))
+		putFile(t, d, "/", "b.7z", testData(50))
+		encrypted, _ := m.read("/" + d.cipher.EncryptFileName("a.txt"))
+		want := map[string]string{
+			"a.txt": fmt.Sprintf("%x:crypt-ciphertext-md5", md5.Sum(encrypted)),
+			"b.7z":  fmt.Sprintf("%x:MD5", md5.Sum(testData(50))),
+		}
+
+		objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objs) != len(want) {
+			t.Fatalf("expect %d objects, got %d", len(want), len(objs))
+		}
+		for _, obj := range objs {
+			hash, hashType := remoteHash(obj)
+			if got := hash + ":" + hashType; got != want[obj.GetName()] {
+				t.Errorf("lazy %v: expect List to give %s the hash %s, got %s", lazy, obj.GetName(), want[obj.GetName()], got)
+			}
+		}
+		for name, w := range want {
+			obj, err := d.Get(ctx, "/"+name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, hashType := remoteHash(obj)
+			if got := hash + ":" + hashType; got != w {
+				t.Errorf("expect Get to give %s the hash %s, got %s", name, w, got)
+			}
+		}
+		if err = op.Remove(ctx, d, "/a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err = op.Remove(ctx, d, "/b.7z"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPlaintextHash(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"plaintext_hash": true, "meta_sidecar": true})
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	data := testData(1000)
+	putFile(t, d, "/", "a.txt", data)
+	putFile(t, d, "/dir", "b.txt", data)
+	putFile(t, d, "/", "c.txt", testData(999))
+	want := fmt.Sprintf("%x:SHA1", sha1.Sum(data))
+
+	hashOf := func(path string) string {
+		obj, err := d.Get(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, hashType := remoteHash(obj)
+		return hash + ":" + hashType
+	}
+	listed := func(dir string) map[string]string {
+		objs, err := op.List(ctx, d, dir, model.ListArgs{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes := make(map[string]string)
+		for _, obj := range objs {
+			hash, hashType := remoteHash(obj)
+			hashes[obj.GetName()] = hash + ":" + hashType
+		}
+		return hashes
+	}
+	if a, b := hashOf("/a.txt"), hashOf("/dir/b.txt"); a != want || b != want {
+		t.Errorf("expect identical files to have the hash %s, got %s and %s", want, a, b)
+	}
+	if c := hashOf("/c.txt"); c == want || c == ":" {
+		t.Errorf("expect another file to have another hash, got %s", c)
+	}
+	if hashes := listed("/"); hashes["a.txt"] != want || hashes["c.txt"] != hashOf("/c.txt") {
+		t.Errorf("expect List to report the hashes of Get, got %v", hashes)
+	}
+	if hashes := listed("/dir"); hashes["b.txt"] != want {
+		t.Errorf("expect List to report the hashes of Get, got %v", hashes)
+	}
+
+	if err := d.SetMeta(ctx, "/a.txt", false, &ObjMeta{Description: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Rename(ctx, d, "/a.txt", "d.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := hashOf("/d.txt"); got != want {
+		t.Errorf("expect the hash to be kept by SetMeta and Rename, got %s", got)
+	}
+	if meta, err := d.GetMeta(ctx, "/d.txt", false); err != nil || meta.Description != "first" {
+		t.Errorf("expect the metadata to be kept, got %+v, %v", meta, err)
+	}
+}
+
+func TestListedSidecarsReadOnce(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	m.zeroModified = true
+	d := newTestCrypt(t, remote, map[string]interface{}{"plaintext_hash": true, "zero_modified": "sidecar"})
+	for i := 0; i < 10; i++ {
+		putFile(t, d, "/", fmt.Sprintf("%d.txt", i), testData(100+i))
+	}
+	// a storage that didn't list the directory yet
+	d = newTestCrypt(t, remote, map[string]interface{}{"plaintext_hash": true, "zero_modified": "sidecar"})
+	list := func() (links int32, set int) {
+		links = atomic.LoadInt32(&m.links)
+		objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, obj := range objs {
+			if hash, _ := remoteHash(obj); hash != "" && !obj.ModTime().IsZero() {
+				set++
+			}
+		}
+		return atomic.LoadInt32(&m.links) - links, set
+	}
+	if links, set := list(); links != 10 || set != 10 {
+		t.Errorf("expect each sidecar to be read once for its hash and time, got %d reads and %d files set", links, set)
+	}
+	if links, set := list(); links != 0 || set != 10 {
+		t.Errorf("expect the sidecars to be kept, got %d reads and %d files set", links, set)
+	}
+	putFile(t, d, "/", "3.txt", testData(50))
+	if links, set := list(); links != 1 || set != 10 {
+		t.Errorf("expect the sidecar written again to be read again, got %d reads and %d files set", links, set)
+	}
+}
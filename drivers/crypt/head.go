@@ -0,0 +1,20 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+)
+
+// HeadSize returns the size to answer a HEAD request for file, got from the storage with Get.
+// Get has decrypted it from the stat of the remote, so the remote is not asked for a link and no
+// content is read. it fails when file carries no size to trust or can't be read, the request is
+// answered from a link then
+func (d *Crypt) HeadSize(ctx context.Context, file model.Obj) (int64, error) {
+	if file.IsDir() || isIncompleteObj(file) || file.GetSize() <= 0 && !isPlainObj(file) {
+		return 0, fmt.Errorf("%w: no size to trust for %s", errs.NotSupport, file.GetName())
+	}
+	return file.GetSize(), nil
+}
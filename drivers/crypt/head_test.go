@@ -0,0 +1,50 @@
+package crypt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/server/common"
+)
+
+func TestHeadSize(t *testing.T) {
+	ctx := context.Background()
+	for _, linkMode := range []string{linkModeRange, linkModeURL} {
+		m, remote := newTestRemote(t, linkMode)
+		d := newTestCrypt(t, remote, nil)
+		putFile(t, d, "/", "a.txt", testData(100000))
+		reads := func() int {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			return len(m.ranges) + len(m.userAgents)
+		}
+		links, before := atomic.LoadInt32(&m.links), reads()
+
+		for rangeHeader, length := range map[string]string{"": "100000", "bytes=10-19": "10"} {
+			r := httptest.NewRequest(http.MethodHead, "/a.txt", nil)
+			if rangeHeader != "" {
+				r.Header.Set("Range", rangeHeader)
+			}
+			file, err := op.Get(ctx, d, "/a.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			size, err := d.HeadSize(ctx, file)
+			if err != nil {
+				t.Fatalf("%s: expect the size of the file to be trusted, got %v", linkMode, err)
+			}
+			w := httptest.NewRecorder()
+			common.ServeHead(w, r, file, size)
+			if got := w.Header().Get("Content-Length"); got != length || w.Body.Len() != 0 {
+				t.Errorf("%s %q: expect Content-Length %s and no body, got %s and %d bytes", linkMode, rangeHeader, length, got, w.Body.Len())
+			}
+		}
+		if got := atomic.LoadInt32(&m.links); got != links || reads() != before {
+			t.Errorf("%s: expect HEAD not to link or read the remote, got %d links", linkMode, got-links)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package crypt
+
+import (
+	"fmt"
+	stdpath "path"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/model"
+)
+
+// parseHiddenNames parses HiddenNames, comma separated patterns matched against decrypted names
+// regardless of case
+func parseHiddenNames(s string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := stdpath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("HiddenNames is Illegal: %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// hiddenName reports whether the object called name is left out of listings.
+// it is still reached by its path, to be read, overwritten or removed
+func (d *Crypt) hiddenName(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range d.hiddenNames {
+		if ok, _ := stdpath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hideNames drops the objects matching HiddenNames from a listing and their remote names alongside
+func (d *Crypt) hideNames(objs []model.Obj, remoteNames []string) ([]model.Obj, []string) {
+	var keptObjs []model.Obj
+	var keptNames []string
+	for i, obj := range objs {
+		if d.hiddenName(obj.GetName()) {
+			continue
+		}
+		keptObjs = append(keptObjs, obj)
+		keptNames = append(keptNames, remoteNames[i])
+	}
+	return keptObjs, keptNames
+}
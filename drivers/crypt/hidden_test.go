@@ -0,0 +1,61 @@
+package crypt
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestHiddenNames(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"hidden_names": ".DS_Store, thumbs.db,*.tmp"})
+	putFile(t, d, "/", "a.txt", testData(100))
+	putFile(t, d, "/", ".DS_Store", testData(10))
+	putFile(t, d, "/", "Thumbs.db", testData(10))
+	putFile(t, d, "/", "b.tmp", testData(10))
+	if err := op.MakeDir(ctx, d, "/c.tmp"); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func() []string {
+		objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, obj := range objs {
+			names = append(names, obj.GetName())
+		}
+		sort.Strings(names)
+		return names
+	}
+	if got := names(); len(got) != 1 || got[0] != "a.txt" {
+		t.Errorf("expect the hidden names to be left out, got %v", got)
+	}
+
+	// targeted by path, hidden files still work
+	putFile(t, d, "/", ".DS_Store", testData(20))
+	obj, err := op.Get(ctx, d, "/.DS_Store")
+	if err != nil || obj.GetSize() != 20 {
+		t.Fatalf("expect the hidden file to be overwritten, got %v %v", obj, err)
+	}
+	if err = op.Remove(ctx, d, "/.DS_Store"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = op.Get(ctx, d, "/.DS_Store"); err == nil {
+		t.Errorf("expect the hidden file to be removed")
+	}
+
+	d.hiddenNames = nil
+	if got := names(); len(got) != 4 {
+		t.Errorf("expect every file without hidden names, got %v", got)
+	}
+
+	if _, err = createTestCrypt(t, remote, map[string]interface{}{"hidden_names": "[a"}); err == nil {
+		t.Errorf("expect a malformed pattern to be refused")
+	}
+}
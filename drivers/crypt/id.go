@@ -0,0 +1,129 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/driver"
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/pkg/utils"
+)
+
+// GetByID gets the object stored as the remote object id, its path, name and size are decrypted from
+// the remote object like Get does. it returns errs.NotSupport if the remote can't look objects up by
+// id, and errs.ObjectNotFound if the object is out of RemotePath or not shown by the storage
+func (d *Crypt) GetByID(ctx context.Context, id string) (model.Obj, error) {
+	if err := d.resolve(ctx); err != nil {
+		return nil, err
+	}
+	remote, ok := d.remoteStorage.(driver.GetterByID)
+	if !ok {
+		return nil, fmt.Errorf("%w: the remote can't look objects up by id", errs.NotSupport)
+	}
+	remoteObj, err := remote.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	rootActualPath, err := d.getActualPathForRemote("/", true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert path to remote path: %w", err)
+	}
+	rel := utils.FixAndCleanPath(remoteObj.GetPath())
+	if r, ok := d.remoteStorage.GetAddition().(driver.IRootPath); ok {
+		// the path of the remote object is joined with the root path of the remote
+		if rel, ok = cutPathPrefix(rel, utils.FixAndCleanPath(r.GetRootPath())); !ok {
+			return nil, fmt.Errorf("%w: %s is out of the remote", errs.ObjectNotFound, remoteObj.GetPath())
+		}
+	}
+	if rel, ok = cutPathPrefix(rel, rootActualPath); !ok {
+		return nil, fmt.Errorf("%w: %s is out of the storage", errs.ObjectNotFound, remoteObj.GetPath())
+	}
+	path, ok := d.decryptRemotePath(rel, remoteObj.IsDir())
+	if !ok {
+		return nil, fmt.Errorf("%w: %s doesn't decrypt", errs.ObjectNotFound, remoteObj.GetPath())
+	}
+	obj, err := d.decryptRemoteObj(ctx, path, remoteObj)
+	if err != nil {
+		return nil, err
+	}
+	return d.withSidecarMetadata(ctx, obj), nil
+}
+
+// cutPathPrefix returns path relative to prefix, ok is false if path isn't prefix or under it
+func cutPathPrefix(path, prefix string) (string, bool) {
+	if !utils.IsSubPath(prefix, path) {
+		return "", false
+	}
+	if prefix == "/" {
+		return path, true
+	}
+	return utils.FixAndCleanPath(strings.TrimPrefix(path, prefix)), true
+}
+
+// decryptRemotePath returns the path of the storage of the remote path rel, relative to RemotePath.
+// ok is false if a segment isn't shown by List
+func (d *Crypt) decryptRemotePath(rel string, isDir bool) (string, bool) {
+	segments := strings.Split(strings.Trim(rel, "/"), "/")
+	path := "/"
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		segmentIsDir := isDir || i < len(segments)-1
+		name, ok := segment, true
+		if !isReservedName(segment) && !(segmentIsDir && d.plainDirs.has(stdpath.Join(path, segment))) {
+			name, ok = d.decryptRemoteName(segment, segmentIsDir)
+			if !ok && segmentIsDir && d.plainDirName(path, segment) {
+				name, ok = segment, true
+			}
+		}
+		if !ok {
+			return "", false
+		}
+		path = stdpath.Join(path, name)
+	}
+	return path, true
+}
+
+// decryptRemoteObj returns the object at path stored as remoteObj, with the helpers Get builds
+// its objects with once it found remoteObj
+func (d *Crypt) decryptRemoteObj(ctx context.Context, path string, remoteObj model.Obj) (model.Obj, error) {
+	if path == "/" {
+		return &model.Object{
+			Name:     "Root",
+			IsFolder: true,
+			Path:     "/",
+		}, nil
+	}
+	remoteName := remoteObj.GetName()
+	if isReservedName(remoteName) {
+		if !d.ShowReserved {
+			return nil, errs.ObjectNotFound
+		}
+		obj := d.reservedObj(remoteObj)
+		obj.Path = path
+		return obj, nil
+	}
+	if remoteObj.IsDir() {
+		return d.encryptedObj(ctx, path, remoteObj.GetPath(), remoteObj)
+	}
+	if uploading(remoteObj) {
+		return nil, errs.ObjectNotFound
+	}
+	if strings.HasSuffix(remoteName, clearSuffix) {
+		return d.plainObj(ctx, path, remoteObj, true)
+	}
+	if _, suffix := contentSuffix(remoteName); suffix == plainSuffix {
+		return d.plainObj(ctx, path, remoteObj, false)
+	}
+	if _, size, ok := parseCompressedName(remoteName); ok {
+		return d.compressedObj(ctx, path, remoteObj, size), nil
+	}
+	if _, contentHash, ok := parseDedupName(remoteName); ok {
+		return d.dedupObj(ctx, path, remoteObj, contentHash), nil
+	}
+	return d.encryptedObj(ctx, path, remoteObj.GetPath(), remoteObj)
+}
@@ -0,0 +1,95 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestGetByID(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	data := testData(1000)
+	putFile(t, d, "/dir", "a.txt", data)
+	m.putFile("/undecryptable", testData(100))
+
+	remoteID := func(path string) string {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.nodes[path].id
+	}
+	dirPath := d.getPathForRemote("/dir", true)
+	fileID := remoteID(d.getPathForRemote("/dir/a.txt", false)[len(remote):])
+	obj, err := d.GetByID(ctx, fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetPath() != "/dir/a.txt" || obj.GetName() != "a.txt" || obj.GetSize() != int64(len(data)) || obj.IsDir() {
+		t.Errorf("expect the decrypted file, got %s %s %d", obj.GetPath(), obj.GetName(), obj.GetSize())
+	}
+	link, err := d.Link(ctx, obj, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := link.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	_, _ = got.ReadFrom(rc)
+	_ = rc.Close()
+	_ = link.RangeReadCloser.Closers.Close()
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Errorf("expect the object got by id to decrypt")
+	}
+
+	obj, err = d.GetByID(ctx, remoteID(dirPath[len(remote):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetPath() != "/dir" || !obj.IsDir() {
+		t.Errorf("expect the decrypted directory, got %s", obj.GetPath())
+	}
+	if _, err = d.GetByID(ctx, remoteID("/undecryptable")); !errs.IsObjectNotFound(err) {
+		t.Errorf("expect an object not shown by the storage not to be found, got %v", err)
+	}
+	if _, err = d.GetByID(ctx, "nope"); !errs.IsObjectNotFound(err) {
+		t.Errorf("expect an unknown id not to be found, got %v", err)
+	}
+	// the path is still the way to get objects
+	if obj, err = op.Get(ctx, d, "/dir/a.txt"); err != nil || obj.GetID() != fileID {
+		t.Errorf("expect Get by path to find the same object, got %v", err)
+	}
+}
+
+// an object got by id is refused like the same object got by path
+func TestGetByIDLikeGet(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"max_decrypted_size": 1})
+	putFile(t, d, "/", "huge.txt", testData(1000))
+	putFile(t, d, "/", "uploading.txt", testData(1000))
+	m.mu.Lock()
+	huge := m.nodes["/"+d.cipher.EncryptFileName("huge.txt")]
+	huge.size = d.cipher.EncryptedSize(2 << 30)
+	uploading := m.nodes["/"+d.cipher.EncryptFileName("uploading.txt")]
+	uploading.uploading = true
+	m.mu.Unlock()
+
+	if _, err := d.GetByID(ctx, huge.id); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expect a file over max_decrypted_size to be refused, got %v", err)
+	}
+	if _, err := d.GetByID(ctx, uploading.id); !errs.IsObjectNotFound(err) {
+		t.Errorf("expect an upload in progress not to be found, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+
+	"github.com/alist-org/alist/v3/internal/fs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/task"
+	"github.com/alist-org/alist/v3/pkg/utils"
+)
+
+// Import encrypts the files under srcPath, a path of any storage, into dstDir of this storage.
+// files whose encrypted copy is as large and not older are skipped, so an import can be run again
+// to only copy what is new or changed. MigrationWorkers files are imported at once, a file that
+// fails doesn't stop the others
+func (d *Crypt) Import(ctx context.Context, srcPath, dstDir string) (ImportResult, error) {
+	return d.importFiltered(ctx, srcPath, dstDir, nil)
+}
+
+// submitImport runs the import of srcPath into dstDir for user as a task of fs.CopyTaskManager,
+// the objects user can't read with password are skipped
+func (d *Crypt) submitImport(ctx context.Context, user *model.User, srcPath, password, dstDir string) (ImportTask, error) {
+	srcPath, dstDir = utils.FixAndCleanPath(srcPath), utils.FixAndCleanPath(dstDir)
+	if err := d.checkImportSource(srcPath, dstDir); err != nil {
+		return ImportTask{}, err
+	}
+	if _, err := fs.Get(ctx, srcPath, d.remoteGetArgs()); err != nil {
+		return ImportTask{}, fmt.Errorf("failed to get %s: %w", srcPath, err)
+	}
+	id := fs.CopyTaskManager.Submit(task.WithCancelCtx(&task.Task[uint64]{
+		Name: fmt.Sprintf("import [%s] to [%s](%s)", srcPath, d.GetStorage().MountPath, dstDir),
+		Func: func(t *task.Task[uint64]) error {
+			t.SetStatus("importing")
+			res, err := d.importFiltered(t.Ctx, srcPath, dstDir, func(path string) bool {
+				return canRead(user, path, password)
+			})
+			t.SetStatus(fmt.Sprintf("imported %d, skipped %d, failed %d", res.Imported, res.Skipped, res.Failed))
+			return err
+		},
+	}))
+	return ImportTask{ID: id}, nil
+}
+
+// checkImportSource refuses to import srcPath into dstDir when the copy would be written under
+// srcPath, through this storage or its remote, and the import would walk its own output
+func (d *Crypt) checkImportSource(srcPath, dstDir string) error {
+	if utils.IsSubPath(srcPath, stdpath.Join(d.GetStorage().MountPath, dstDir)) ||
+		utils.IsSubPath(srcPath, d.getPathForRemote(dstDir, true)) {
+		return fmt.Errorf("can't import %s into %s, it holds the destination", srcPath, dstDir)
+	}
+	return nil
+}
+
+// importFiltered is Import of the objects for which canRead returns true, all of them if it is nil.
+// the objects of a directory it refuses are skipped
+func (d *Crypt) importFiltered(ctx context.Context, srcPath, dstDir string, canRead func(path string) bool) (ImportResult, error) {
+	var res ImportResult
+	srcPath, dstDir = utils.FixAndCleanPath(srcPath), utils.FixAndCleanPath(dstDir)
+	if err := d.checkImportSource(srcPath, dstDir); err != nil {
+		return res, err
+	}
+	src, err := fs.Get(ctx, srcPath, d.remoteGetArgs())
+	if err != nil {
+		return res, fmt.Errorf("failed to get %s: %w", srcPath, err)
+	}
+	var jobs []copyJob
+	if src.IsDir() {
+		jobs, err = d.importJobs(ctx, srcPath, dstDir, canRead, jobs)
+		if err != nil {
+			return res, err
+		}
+	} else {
+		jobs = append(jobs, copyJob{srcPath: srcPath, src: src, dstDir: dstDir})
+	}
+	err = runCopyJobs(ctx, d.copyWorkers(), jobs, &res, d.importFile)
+	return res, err
+}
+
+// importJobs makes the directories of srcPath in dstDir and adds its files to jobs
+func (d *Crypt) importJobs(ctx context.Context, srcPath, dstDir string, canRead func(path string) bool, jobs []copyJob) ([]copyJob, error) {
+	err := op.MakeDir(ctx, d, dstDir)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := fs.List(ctx, srcPath, d.remoteListArgs())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", srcPath, err)
+	}
+	for _, obj := range objs {
+		srcObjPath := stdpath.Join(srcPath, obj.GetName())
+		if canRead != nil && !canRead(srcObjPath) {
+			continue
+		}
+		if obj.IsDir() {
+			jobs, err = d.importJobs(ctx, srcObjPath, stdpath.Join(dstDir, obj.GetName()), canRead, jobs)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			jobs = append(jobs, copyJob{srcPath: srcObjPath, src: obj, dstDir: dstDir})
+		}
+	}
+	return jobs, nil
+}
+
+func (d *Crypt) importFile(ctx context.Context, job copyJob) (bool, error) {
+	if dst, err := op.Get(ctx, d, stdpath.Join(job.dstDir, job.src.GetName())); err == nil && unchanged(job.src, dst) {
+		return true, nil
+	}
+	storage, actualPath, err := op.GetStorageAndActualPath(job.srcPath)
+	if err != nil {
+		return false, err
+	}
+	rc, err := d.openFile(ctx, storage, actualPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", job.srcPath, err)
+	}
+	err = op.Put(ctx, d, job.dstDir, &model.FileStream{
+		Obj: &model.Object{
+			Name:     job.src.GetName(),
+			Size:     job.src.GetSize(),
+			Modified: job.src.ModTime(),
+		},
+		ReadCloser: rc,
+		Mimetype:   utils.GetMimeType(job.src.GetName()),
+	}, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to import %s: %w", job.srcPath, err)
+	}
+	return false, nil
+}
+
+// unchanged reports whether dst is an up to date copy of src. the plaintext of dst has no hash
+// to compare without downloading it, so it is judged by size and modification time
+func unchanged(src, dst model.Obj) bool {
+	return !dst.IsDir() && dst.GetSize() == src.GetSize() && !dst.ModTime().Before(src.ModTime())
+}
@@ -0,0 +1,117 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	src, srcMount := newTestRemote(t, linkModeRange)
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	a, b := testData(1000), testData(2000)
+	src.putDir("/docs")
+	src.putDir("/docs/sub")
+	src.putFile("/docs/a.txt", a)
+	src.putFile("/docs/sub/b.txt", b)
+
+	res, err := d.Import(ctx, srcMount+"/docs", "/backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (ImportResult{Imported: 2}) {
+		t.Errorf("first import: got %+v", res)
+	}
+	res, err = d.Import(ctx, srcMount+"/docs", "/backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (ImportResult{Skipped: 2}) {
+		t.Errorf("second import: got %+v", res)
+	}
+
+	// same size, modified later
+	b = bytes.Repeat([]byte("b"), len(b))
+	src.putFile("/docs/sub/b.txt", b)
+	src.mu.Lock()
+	src.nodes["/docs/sub/b.txt"].modified = time.Now().Add(time.Hour)
+	src.mu.Unlock()
+	res, err = d.Import(ctx, srcMount+"/docs", "/backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (ImportResult{Imported: 1, Skipped: 1}) {
+		t.Errorf("import after a change: got %+v", res)
+	}
+	if got := readRange(t, d, "/backup/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, a) {
+		t.Errorf("read mismatch of a.txt")
+	}
+	if got := readRange(t, d, "/backup/sub/b.txt", http_range.Range{Length: -1}); !bytes.Equal(got, b) {
+		t.Errorf("read mismatch of the changed b.txt")
+	}
+
+	// the copy would be written under the source
+	for _, srcPath := range []string{"/", d.GetStorage().MountPath + "/backup", remote} {
+		if _, err = d.Import(ctx, srcPath, "/backup/sub"); err == nil {
+			t.Errorf("expect an import of %s into /backup/sub to be refused", srcPath)
+		}
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	ctx := context.Background()
+	_, srcRemote := newTestRemote(t, linkModeRange)
+	m, dstRemote := newTestRemote(t, linkModeURL)
+	src := newTestCrypt(t, srcRemote, nil)
+	dst := newTestCrypt(t, dstRemote, map[string]interface{}{"password": "new password", "salt": "new salt"})
+	a, b := testData(1000), testData(200000)
+	if err := op.MakeDir(ctx, src, "/docs/sub"); err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, src, "/docs", "a.txt", a)
+	putFile(t, src, "/docs/sub", "b.txt", b)
+
+	var progress []int
+	res, err := src.CopyTo(ctx, "/docs", dst, "/moved", func(p int) { progress = append(progress, p) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (ImportResult{Imported: 2}) {
+		t.Errorf("first copy: got %+v", res)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] < progress[i-1] {
+			t.Errorf("expect the progress to grow, got %v", progress)
+			break
+		}
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != 100 {
+		t.Errorf("expect the progress to end at 100, got %v", progress)
+	}
+	for path, data := range map[string][]byte{"/moved/a.txt": a, "/moved/sub/b.txt": b} {
+		if got := readRange(t, dst, path, http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+			t.Errorf("read mismatch of %s", path)
+		}
+	}
+	if _, ok := m.read("/" + dst.EncryptName("moved", true) + "/" + dst.EncryptName("a.txt", false)); !ok {
+		t.Errorf("expect the copy to be stored with the names of the destination, got %v", m.paths())
+	}
+
+	res, err = src.CopyTo(ctx, "/docs", dst, "/moved", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (ImportResult{Skipped: 2}) {
+		t.Errorf("resumed copy: got %+v", res)
+	}
+	res, err = src.CopyTo(ctx, "/docs/a.txt", dst, "/", nil)
+	if err != nil || res != (ImportResult{Imported: 1}) {
+		t.Errorf("copy of a file: got %+v, %v", res, err)
+	}
+}
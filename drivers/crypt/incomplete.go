@@ -0,0 +1,90 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdpath "path"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/fs"
+	"github.com/alist-org/alist/v3/internal/model"
+)
+
+// incompleteSuffix is added to the names of the files listed with ShowIncomplete
+const incompleteSuffix = ".incomplete"
+
+// ErrIncomplete is returned by Link for the files listed with ShowIncomplete, they can't be read
+var ErrIncomplete = errors.New("incomplete upload")
+
+// incompleteObject is a file whose name decrypts but whose remote size can't be the one of an
+// encrypted file, most likely left by an interrupted upload, or that the remote reports still being
+// uploaded. its size is the remote size
+type incompleteObject struct {
+	model.Object
+	uploading bool
+}
+
+// uploadingObj is implemented by the remote objects that can be uploads in progress, like a
+// multipart upload of S3 not completed yet, of which only the parts uploaded can be read
+type uploadingObj interface {
+	IsUploading() bool
+}
+
+// uploading tells whether the remote reports remoteObj still being uploaded
+func uploading(remoteObj model.Obj) bool {
+	u, ok := unwrapObj(remoteObj).(uploadingObj)
+	return ok && u.IsUploading()
+}
+
+func isIncompleteObj(obj model.Obj) bool {
+	_, ok := unwrapObj(obj).(*incompleteObject)
+	return ok
+}
+
+// incompleteObj returns the incomplete file stored as remoteObj, or nil if its name doesn't decrypt
+func (d *Crypt) incompleteObj(remoteObj model.Obj) model.Obj {
+	name, err := d.cipher.DecryptFileName(remoteObj.GetName())
+	if err != nil {
+		return nil
+	}
+	return &incompleteObject{Object: model.Object{
+		ID:       remoteObj.GetID(),
+		Name:     name + incompleteSuffix,
+		Size:     remoteObj.GetSize(),
+		Modified: remoteObj.ModTime(),
+	}, uploading: uploading(remoteObj)}
+}
+
+// getIncomplete gets the incomplete file at path, with ShowIncomplete
+func (d *Crypt) getIncomplete(ctx context.Context, path string) (model.Obj, error) {
+	filePath, ok := strings.CutSuffix(path, incompleteSuffix)
+	if !ok || !d.ShowIncomplete {
+		return nil, errs.ObjectNotFound
+	}
+	remoteObj, err := fs.Get(ctx, d.getPathForRemote(filePath, false), d.remoteGetArgs())
+	if err != nil {
+		return nil, err
+	}
+	if remoteObj.IsDir() {
+		return nil, errs.ObjectNotFound
+	}
+	if _, err = d.cipher.DecryptedSize(remoteObj.GetSize()); err == nil && !uploading(remoteObj) {
+		return nil, errs.ObjectNotFound
+	}
+	obj := d.incompleteObj(remoteObj)
+	if obj == nil {
+		return nil, errs.ObjectNotFound
+	}
+	obj.(*incompleteObject).Path = path
+	return withMode(obj, remoteObj), nil
+}
+
+// incompleteError is the error of Link for an incomplete file
+func incompleteError(file model.Obj) error {
+	if incomplete, ok := unwrapObj(file).(*incompleteObject); ok && incomplete.uploading {
+		return fmt.Errorf("%w: %s is still being uploaded to the remote", ErrIncomplete, stdpath.Base(file.GetPath()))
+	}
+	return fmt.Errorf("%w: %s is too short to be a whole encrypted file, remove it", ErrIncomplete, stdpath.Base(file.GetPath()))
+}
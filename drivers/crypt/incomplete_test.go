@@ -0,0 +1,113 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestShowIncomplete(t *testing.T) {
+	ctx := context.Background()
+	for _, show := range []bool{false, true} {
+		m, remote := newTestRemote(t, linkModeRange)
+		d := newTestCrypt(t, remote, map[string]interface{}{"show_incomplete": show})
+		putFile(t, d, "/", "a.txt", testData(1000))
+		// an upload cut in the header
+		truncated := "/" + d.cipher.EncryptFileName("b.txt")
+		m.putFile(truncated, testData(20))
+
+		objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := map[string]bool{}
+		for _, obj := range objs {
+			names[obj.GetName()] = true
+		}
+		if !names["a.txt"] || names["b.txt.incomplete"] != show || len(objs) != map[bool]int{false: 1, true: 2}[show] {
+			t.Fatalf("show_incomplete %v: unexpected listing %v", show, names)
+		}
+		if !show {
+			continue
+		}
+		obj, err := op.Get(ctx, d, "/b.txt.incomplete")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.GetSize() != 20 {
+			t.Errorf("expect the remote size of the incomplete file, got %d", obj.GetSize())
+		}
+		if _, _, err = op.Link(ctx, d, "/b.txt.incomplete", model.LinkArgs{}); !errors.Is(err, ErrIncomplete) {
+			t.Errorf("expect the incomplete file not to be read, got %v", err)
+		}
+		if _, err = op.Get(ctx, d, "/a.txt.incomplete"); err == nil {
+			t.Errorf("expect a whole file not to be incomplete")
+		}
+		if err = op.Remove(ctx, d, "/b.txt.incomplete"); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m.read(truncated); ok {
+			t.Errorf("expect the incomplete file to be removed from the remote")
+		}
+	}
+}
+
+func TestUploadingHidden(t *testing.T) {
+	ctx := context.Background()
+	for _, show := range []bool{false, true} {
+		m, remote := newTestRemote(t, linkModeRange)
+		d := newTestCrypt(t, remote, map[string]interface{}{"show_incomplete": show})
+		putFile(t, d, "/", "a.txt", testData(1000))
+		putFile(t, d, "/", "b.txt", testData(1000))
+		// the parts uploaded so far have the size of a whole encrypted file
+		remotePath := "/" + d.cipher.EncryptFileName("b.txt")
+		m.mu.Lock()
+		m.nodes[remotePath].uploading = true
+		m.mu.Unlock()
+		op.ClearCache(d, "/")
+
+		objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := map[string]bool{}
+		for _, obj := range objs {
+			names[obj.GetName()] = true
+		}
+		if !names["a.txt"] || names["b.txt"] || names["b.txt.incomplete"] != show {
+			t.Fatalf("show_incomplete %v: unexpected listing %v", show, names)
+		}
+		if _, err = op.Get(ctx, d, "/b.txt"); err == nil {
+			t.Errorf("show_incomplete %v: expect the upload in progress not to be got", show)
+		}
+		if show {
+			if _, err = op.Get(ctx, d, "/b.txt.incomplete"); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err = op.Link(ctx, d, "/b.txt.incomplete", model.LinkArgs{}); !errors.Is(err, ErrIncomplete) {
+				t.Errorf("expect the upload in progress not to be read, got %v", err)
+			}
+		}
+		for _, accurate := range []bool{false, true} {
+			if count, err := d.Count(ctx, accurate); err != nil || count != (ObjectCount{Files: 1}) {
+				t.Errorf("show_incomplete %v: expect the upload in progress not to be counted, got %+v %v", show, count, err)
+			}
+		}
+		if got := searchPaths(t, d, "/", "b.txt", 0); got != "[]" {
+			t.Errorf("show_incomplete %v: expect the upload in progress not to be found, got %s", show, got)
+		}
+
+		m.mu.Lock()
+		m.nodes[remotePath].uploading = false
+		m.mu.Unlock()
+		op.ClearCache(d, "/")
+		if got := readRange(t, d, "/b.txt", http_range.Range{Length: -1}); !bytes.Equal(got, testData(1000)) {
+			t.Errorf("show_incomplete %v: expect the completed upload to be read", show)
+		}
+	}
+}
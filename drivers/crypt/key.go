@@ -0,0 +1,138 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs/config/obscure"
+)
+
+// SecretProvider resolves the password and salt of Crypt storages from outside of their config,
+// e.g. from a secret manager, so that the password never gets in the config. ref tells which secret,
+// the provider gives it its own meaning
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref string) (password, salt string, err error)
+}
+
+// SecretProviderFunc is a SecretProvider as a function
+type SecretProviderFunc func(ctx context.Context, ref string) (password, salt string, err error)
+
+func (f SecretProviderFunc) Resolve(ctx context.Context, ref string) (string, string, error) {
+	return f(ctx, ref)
+}
+
+var secretProviders sync.Map
+
+// RegisterSecretProvider makes provider resolve the key_ref of storages written name:ref, it is
+// given the ref part. a provider registered again under the same name replaces the first
+func RegisterSecretProvider(name string, provider SecretProvider) {
+	secretProviders.Store(name, provider)
+}
+
+// keyFile reads the password from the first line of the file at path and the salt from the second
+func keyFile(_ context.Context, path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read key_file: %w", err)
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	salt := ""
+	if len(lines) > 1 {
+		salt = lines[1]
+	}
+	return lines[0], salt, nil
+}
+
+// keyEnv reads the password from the environment variable name and the salt from name_SALT
+func keyEnv(_ context.Context, name string) (string, string, error) {
+	return os.Getenv(name), os.Getenv(name + "_SALT"), nil
+}
+
+// keySource returns the provider of the password and salt and its ref, nil if they are in the config
+func (d *Crypt) keySource() (SecretProvider, string, error) {
+	set := 0
+	for _, option := range []string{d.KeyFile, d.KeyEnv, d.KeyRef} {
+		if option != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, "", fmt.Errorf("only one of key_file, key_env and key_ref can be set")
+	}
+	switch {
+	case d.KeyFile != "":
+		return SecretProviderFunc(keyFile), d.KeyFile, nil
+	case d.KeyEnv != "":
+		return SecretProviderFunc(keyEnv), d.KeyEnv, nil
+	case d.KeyRef != "":
+		name, ref, ok := strings.Cut(d.KeyRef, ":")
+		if !ok {
+			return nil, "", fmt.Errorf("key_ref must be written provider:reference")
+		}
+		provider, ok := secretProviders.Load(name)
+		if !ok {
+			return nil, "", fmt.Errorf("no secret provider %q is registered for key_ref", name)
+		}
+		return provider.(SecretProvider), ref, nil
+	}
+	return nil, "", nil
+}
+
+// externalKey is the password and salt read from outside of the config, obscured like the options
+type externalKey struct {
+	loaded         bool
+	password, salt string
+}
+
+// loadKey reads the password and salt from KeyFile, KeyEnv or KeyRef. the password and salt options
+// must be empty then, so the secret is only in one place and never saved with the storage
+func (d *Crypt) loadKey(ctx context.Context) error {
+	d.key = externalKey{}
+	provider, ref, err := d.keySource()
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		if d.Password == "" {
+			return fmt.Errorf("password is required unless key_file, key_env or key_ref is set")
+		}
+		return nil
+	}
+	if d.Password != "" || d.Salt != "" {
+		return fmt.Errorf("password and salt must be empty when key_file, key_env or key_ref is set")
+	}
+	password, salt, err := provider.Resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		return fmt.Errorf("no password found in key_file, key_env or key_ref")
+	}
+	if d.key.password, err = obscure.Obscure(password); err != nil {
+		return fmt.Errorf("failed to obfuscate password: %w", err)
+	}
+	if d.key.salt, err = obscure.Obscure(salt); err != nil {
+		return fmt.Errorf("failed to obfuscate salt: %w", err)
+	}
+	d.key.loaded = true
+	return nil
+}
+
+// credentials returns the obscured password and salt the cipher is built with
+func (d *Crypt) credentials() (string, string, error) {
+	if d.key.loaded {
+		return d.key.password, d.key.salt, nil
+	}
+	p, err := obscuredCredential(d.Password)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read password: %w", err)
+	}
+	p2, err := obscuredCredential(d.Salt)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read salt: %w", err)
+	}
+	return p, p2, nil
+}
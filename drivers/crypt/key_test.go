@@ -0,0 +1,151 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/conf"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+	"github.com/rclone/rclone/fs/config/obscure"
+)
+
+func TestExternalKey(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	inline := newTestCrypt(t, remote, nil)
+	data := testData(1000)
+	putFile(t, inline, "/", "a.txt", data)
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("password\nsalt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CRYPT_TEST_KEY", "password")
+	t.Setenv("CRYPT_TEST_KEY_SALT", "salt")
+	for _, source := range []map[string]interface{}{
+		{"key_file": keyFile},
+		{"key_env": "CRYPT_TEST_KEY"},
+	} {
+		source["password"], source["salt"] = "", ""
+		d := newTestCrypt(t, remote, source)
+		if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+			t.Errorf("%v: expect the same key as the inline password", source)
+		}
+		if d.Password != "" || d.Salt != "" || strings.Contains(d.GetStorage().Addition, obfuscatedPrefix) {
+			t.Errorf("%v: expect the key not to be saved, got %s", source, d.GetStorage().Addition)
+		}
+	}
+
+	for name, extra := range map[string]map[string]interface{}{
+		"both set":       {"key_file": keyFile, "key_env": "CRYPT_TEST_KEY", "password": "", "salt": ""},
+		"inline too":     {"key_file": keyFile},
+		"missing file":   {"key_file": keyFile + ".missing", "password": "", "salt": ""},
+		"empty variable": {"key_env": "CRYPT_TEST_NO_KEY", "password": "", "salt": ""},
+		"no password":    {"password": ""},
+	} {
+		if _, err := createTestCrypt(t, remote, extra); err == nil {
+			t.Errorf("%s: expect init to fail", name)
+		}
+	}
+}
+
+func TestSecretProvider(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	data := testData(1000)
+	putFile(t, newTestCrypt(t, remote, nil), "/", "a.txt", data)
+
+	var refs []string
+	RegisterSecretProvider("fake", SecretProviderFunc(func(ctx context.Context, ref string) (string, string, error) {
+		refs = append(refs, ref)
+		if ref != "team/crypt" {
+			return "", "", errors.New("secret not found")
+		}
+		return "password", "salt", nil
+	}))
+	d := newTestCrypt(t, remote, map[string]interface{}{"key_ref": "fake:team/crypt", "password": "", "salt": ""})
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("expect the key of the provider to be the one of the inline password")
+	}
+	if len(refs) != 1 || refs[0] != "team/crypt" {
+		t.Errorf("expect the provider to be asked for the reference, got %v", refs)
+	}
+	if d.Password != "" || d.Salt != "" || strings.Contains(d.GetStorage().Addition, obfuscatedPrefix) {
+		t.Errorf("expect the key not to be saved, got %s", d.GetStorage().Addition)
+	}
+
+	for name, ref := range map[string]string{
+		"unknown provider": "vault:team/crypt",
+		"unknown secret":   "fake:team/other",
+		"no provider":      "team/crypt",
+	} {
+		if _, err := createTestCrypt(t, remote, map[string]interface{}{"key_ref": ref, "password": "", "salt": ""}); err == nil {
+			t.Errorf("%s: expect init to fail", name)
+		}
+	}
+}
+
+func TestCredentialFormat(t *testing.T) {
+	a := Addition{Password: "password", Salt: obfuscatedPrefix + obscure.MustObscure("salt")}
+	for _, format := range []string{credentialSecret, credentialObscure, credentialSecret} {
+		a.CredentialFormat = format
+		if err := a.storeCredentials(); err != nil {
+			t.Fatal(err)
+		}
+		prefix := obfuscatedPrefix
+		if format == credentialSecret {
+			prefix = sealedPrefix
+		}
+		for value, plain := range map[string]string{a.Password: "password", a.Salt: "salt"} {
+			if got, err := revealCredential(value); err != nil || got != plain || !strings.HasPrefix(value, prefix) {
+				t.Errorf("%s: expect %q stored with %s, got %q, %v", format, plain, prefix, got, err)
+			}
+		}
+	}
+
+	_, remote := newTestRemote(t, linkModeRange)
+	data := testData(1000)
+	putFile(t, newTestCrypt(t, remote, nil), "/", "a.txt", data)
+	for _, password := range []string{"password", obfuscatedPrefix + obscure.MustObscure("password")} {
+		d := newTestCrypt(t, remote, map[string]interface{}{"password": password, "credential_format": credentialSecret})
+		if !strings.HasPrefix(d.Password, sealedPrefix) || strings.Contains(d.GetStorage().Addition, obfuscatedPrefix) {
+			t.Errorf("expect the credentials to be sealed, got %s", d.GetStorage().Addition)
+		}
+		if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+			t.Errorf("expect a sealed password to derive the same key")
+		}
+	}
+}
+
+func TestSealingKey(t *testing.T) {
+	sealed, err := sealCredential("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the key is not the jwt_secret hashed, which signs the tokens
+	key := sha256.Sum256([]byte(conf.Conf.JwtSecret))
+	block, _ := aes.NewCipher(key[:])
+	aead, _ := cipher.NewGCM(block)
+	data, _ := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+	if _, err = aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil); err == nil {
+		t.Error("expect the sealing key to be derived apart from the jwt_secret")
+	}
+
+	secret := conf.Conf.JwtSecret
+	t.Cleanup(func() { conf.Conf.JwtSecret = secret })
+	conf.Conf.JwtSecret = secret + "rotated"
+	if _, err = openCredential(sealed); err == nil {
+		t.Error("expect a credential sealed before jwt_secret was rotated not to be opened")
+	}
+	conf.Conf.JwtSecret = secret
+	if got, err := openCredential(sealed); err != nil || got != "password" {
+		t.Errorf("expect the sealed credential to be opened, got %q, %v", got, err)
+	}
+}
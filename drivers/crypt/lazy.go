@@ -0,0 +1,91 @@
+package crypt
+
+import (
+	stdpath "path"
+	"sync"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+)
+
+// lazyObj is an object of a listing with LazyDecrypt, its name and size are decrypted on first use.
+// a name or size that doesn't decrypt is shown as it is on the remote
+type lazyObj struct {
+	d      *Crypt
+	remote model.Obj
+	// parent is the path of the listed directory
+	parent   string
+	nameOnce sync.Once
+	name     string
+	sizeOnce sync.Once
+	size     int64
+}
+
+func (d *Crypt) lazyObj(parent string, remote model.Obj) model.Obj {
+	obj := &lazyObj{d: d, remote: remote, parent: parent}
+	if thumb, ok := d.remoteThumb(remote); ok && !remote.IsDir() {
+		return &lazyThumbObj{lazyObj: obj, thumb: thumb}
+	}
+	return obj
+}
+
+func (o *lazyObj) GetName() string {
+	o.nameOnce.Do(func() {
+		remoteName := o.remote.GetName()
+		var err error
+		if o.remote.IsDir() {
+			o.name, err = o.d.cipher.DecryptDirName(remoteName)
+			if err != nil && o.d.plainDirName(o.parent, remoteName) {
+				err = nil
+			}
+		} else {
+			o.name, err = o.d.cipher.DecryptFileName(remoteName)
+		}
+		if err != nil {
+			o.d.failures.names.Add(1)
+		}
+		if err != nil || o.name == "" {
+			o.name = remoteName
+		}
+	})
+	return o.name
+}
+
+func (o *lazyObj) GetSize() int64 {
+	if o.remote.IsDir() {
+		return 0
+	}
+	o.sizeOnce.Do(func() {
+		var err error
+		o.size, err = o.d.cipher.DecryptedSize(o.remote.GetSize())
+		if err != nil {
+			o.d.failures.sizes.Add(1)
+			o.size = o.remote.GetSize()
+		}
+	})
+	return o.size
+}
+
+func (o *lazyObj) GetPath() string {
+	return stdpath.Join(o.parent, o.GetName())
+}
+
+func (o *lazyObj) ModTime() time.Time { return o.remote.ModTime() }
+func (o *lazyObj) IsDir() bool        { return o.remote.IsDir() }
+func (o *lazyObj) GetID() string      { return o.remote.GetID() }
+
+func (o *lazyObj) GetHash() (string, string) {
+	if o.remote.IsDir() {
+		return "", ""
+	}
+	return ciphertextHash(o.remote)
+}
+
+type lazyThumbObj struct {
+	*lazyObj
+	thumb string
+}
+
+func (o *lazyThumbObj) Thumb() string {
+	return o.thumb
+}
@@ -0,0 +1,78 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestLazyDecrypt(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"lazy_decrypt": true})
+	for i := 0; i < 3; i++ {
+		putFile(t, d, "/", fmt.Sprintf("%d.txt", i), testData(10*i))
+	}
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	m.putFile("/not-encrypted.txt", testData(5))
+
+	objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy := make([]*lazyObj, len(objs))
+	for i, obj := range objs {
+		var ok bool
+		if lazy[i], ok = model.UnwrapObj(obj).(*lazyObj); !ok {
+			t.Fatalf("expect a lazy object, got %T", model.UnwrapObj(obj))
+		}
+		if lazy[i].name != "" {
+			t.Errorf("expect %s not to be decrypted before it is read", lazy[i].remote.GetName())
+		}
+	}
+
+	var sizes []string
+	for _, o := range lazy {
+		sizes = append(sizes, fmt.Sprint(o.GetSize()))
+		if o.name != "" {
+			t.Errorf("expect the size to be read without decrypting the name")
+		}
+	}
+	sort.Strings(sizes)
+	if fmt.Sprint(sizes) != "[0 0 10 20 5]" {
+		t.Errorf("unexpected sizes %v", sizes)
+	}
+
+	names := make([][]string, 4)
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for _, o := range lazy {
+				names[i] = append(names[i], o.GetName())
+			}
+		}(i)
+	}
+	wg.Wait()
+	sort.Strings(names[0])
+	if got := fmt.Sprint(names[0]); got != "[0.txt 1.txt 2.txt dir not-encrypted.txt]" {
+		t.Errorf("unexpected names %s", got)
+	}
+	for i := range names {
+		sort.Strings(names[i])
+		if fmt.Sprint(names[i]) != fmt.Sprint(names[0]) {
+			t.Errorf("expect concurrent reads to see the same names, got %v", names[i])
+		}
+	}
+	if failures := d.DecryptFailures(); failures.Names != 1 || failures.Sizes != 1 {
+		t.Errorf("expect the plain file to be counted once, got %+v", failures)
+	}
+}
@@ -0,0 +1,139 @@
+package crypt
+
+import (
+	"context"
+	stdpath "path"
+	"sync"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// listedSidecarConcurrency bounds the sidecars a listing reads at once
+const listedSidecarConcurrency = 4
+
+// sidecarCacheSize bounds the sidecars kept by sidecarCache
+const sidecarCacheSize = 10000
+
+// sidecarCache keeps the sidecars read by listings by remote actual path, as long as the remote
+// lists them with the same id, size and modification time. the sidecars the driver writes are dropped
+type sidecarCache struct {
+	mu       sync.Mutex
+	sidecars map[string]cachedSidecar
+}
+
+type cachedSidecar struct {
+	id       string
+	size     int64
+	modified time.Time
+	meta     ObjMeta
+}
+
+func (c *sidecarCache) get(remoteActualPath string, remoteObj model.Obj) (ObjMeta, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sidecar, ok := c.sidecars[remoteActualPath]
+	if !ok || sidecar.id != remoteObj.GetID() || sidecar.size != remoteObj.GetSize() || !sidecar.modified.Equal(remoteObj.ModTime()) {
+		return ObjMeta{}, false
+	}
+	return sidecar.meta, true
+}
+
+func (c *sidecarCache) put(remoteActualPath string, remoteObj model.Obj, meta ObjMeta) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sidecars == nil {
+		c.sidecars = make(map[string]cachedSidecar)
+	}
+	if _, ok := c.sidecars[remoteActualPath]; !ok && len(c.sidecars) >= sidecarCacheSize {
+		// no order to keep, any one makes room
+		for path := range c.sidecars {
+			delete(c.sidecars, path)
+			break
+		}
+	}
+	c.sidecars[remoteActualPath] = cachedSidecar{id: remoteObj.GetID(), size: remoteObj.GetSize(), modified: remoteObj.ModTime(), meta: meta}
+}
+
+func (c *sidecarCache) remove(remoteActualPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sidecars, remoteActualPath)
+}
+
+// readListedSidecars calls fn with the sidecar of each file of objs, a listing of the remote directory
+// dirActualPath, that want picks and that has one in remoteObjs, the listing of the remote. the sidecars
+// are read a few at a time and kept until the remote lists them changed, fn is called one after the other
+func (d *Crypt) readListedSidecars(ctx context.Context, dirActualPath string, objs, remoteObjs []model.Obj, want func(obj model.Obj) bool, fn func(obj model.Obj, meta *ObjMeta)) {
+	listed := make(map[string]model.Obj, len(remoteObjs))
+	for _, remoteObj := range remoteObjs {
+		listed[remoteObj.GetName()] = remoteObj
+	}
+	metas := make([]*ObjMeta, len(objs))
+	sem := make(chan struct{}, listedSidecarConcurrency)
+	var wg sync.WaitGroup
+	for i, obj := range objs {
+		if obj.IsDir() || isReservedName(obj.GetName()) || !want(obj) {
+			continue
+		}
+		sidecarName := d.cipher.EncryptFileName(obj.GetName()) + metaSidecarSuffix
+		sidecar, ok := listed[sidecarName]
+		if !ok {
+			continue
+		}
+		sidecarPath := stdpath.Join(dirActualPath, sidecarName)
+		if meta, ok := d.sidecars.get(sidecarPath, sidecar); ok {
+			metas[i] = &meta
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, sidecarPath string, sidecar model.Obj) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var meta ObjMeta
+			if err := d.readEncryptedJson(ctx, sidecarPath, &meta); err != nil {
+				if !errs.IsObjectNotFound(err) {
+					log.Warnf("failed to read the sidecar of %s: %s", objs[i].GetName(), err)
+				}
+				return
+			}
+			d.sidecars.put(sidecarPath, sidecar, meta)
+			metas[i] = &meta
+		}(i, sidecarPath, sidecar)
+	}
+	wg.Wait()
+	for i, meta := range metas {
+		if meta != nil {
+			fn(objs[i], meta)
+		}
+	}
+}
+
+// setListedSidecars sets the plaintext hashes, with PlaintextHash, and the modification times, with
+// ZeroModified sidecar, that the sidecars hold on objs, a listing of the remote directory dirActualPath.
+// remoteObjs is the listing of the remote. each sidecar is read once for both, it reports whether a
+// time was set
+func (d *Crypt) setListedSidecars(ctx context.Context, dirActualPath string, objs, remoteObjs []model.Obj) bool {
+	hashes, times := d.PlaintextHash, d.ZeroModified == zeroModifiedSidecar
+	timeMissing := func(obj model.Obj) bool {
+		object := objectOf(obj)
+		return times && object != nil && modifiedMissing(object.Modified)
+	}
+	set := false
+	d.readListedSidecars(ctx, dirActualPath, objs, remoteObjs, func(obj model.Obj) bool {
+		return hashes || timeMissing(obj)
+	}, func(obj model.Obj, meta *ObjMeta) {
+		if hashes {
+			setHashFromSidecar(obj, meta)
+		}
+		if timeMissing(obj) && setModTimeFromSidecar(objectOf(obj), meta) {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,77 @@
+package crypt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alist-org/alist/v3/cmd/flags"
+	"github.com/alist-org/alist/v3/internal/fs"
+	log "github.com/sirupsen/logrus"
+)
+
+// at most warnBurst decryption warnings are logged per warnInterval for a storage
+const (
+	warnBurst    = 10
+	warnInterval = time.Minute
+)
+
+// warnLimiter bounds the number of warnings logged in a time window
+type warnLimiter struct {
+	mu         sync.Mutex
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// allow reports whether a warning can be logged now,
+// and how many were suppressed since the last one that was
+func (l *warnLimiter) allow(now time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.start) >= warnInterval {
+		l.start, l.count = now, 0
+	}
+	if l.count >= warnBurst {
+		l.suppressed++
+		return false, 0
+	}
+	l.count++
+	suppressed := l.suppressed
+	l.suppressed = 0
+	return true, suppressed
+}
+
+// logger returns an entry that identifies the storage
+func (d *Crypt) logger() *log.Entry {
+	return log.WithFields(log.Fields{
+		"storage":    d.MountPath,
+		"storage_id": d.ID,
+	})
+}
+
+// warnDecrypt logs a decryption failure of the object at remotePath, rate limited per storage
+func (d *Crypt) warnDecrypt(remotePath string, format string, args ...interface{}) {
+	ok, suppressed := d.warnings.allow(time.Now())
+	if !ok {
+		return
+	}
+	entry := d.logger().WithField("remote_path", remotePath)
+	if suppressed > 0 {
+		entry = entry.WithField("suppressed", suppressed)
+	}
+	entry.Warnf(format, args...)
+}
+
+// remoteLogs tells whether the failed listings and gets of the remote are logged. many are expected,
+// like the tries of Get, so they are only logged with DebugRemote, or when alist runs with --debug or --dev
+func (d *Crypt) remoteLogs() bool {
+	return d.DebugRemote || flags.Debug || flags.Dev
+}
+
+func (d *Crypt) remoteListArgs() *fs.ListArgs {
+	return &fs.ListArgs{NoLog: !d.remoteLogs()}
+}
+
+func (d *Crypt) remoteGetArgs() *fs.GetArgs {
+	return &fs.GetArgs{NoLog: !d.remoteLogs()}
+}
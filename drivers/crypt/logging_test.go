@@ -0,0 +1,90 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/cmd/flags"
+	"github.com/alist-org/alist/v3/internal/op"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestDecryptWarningFields(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	m.putFile("/"+d.cipher.EncryptFileName("short.txt"), []byte("short"))
+
+	var buf bytes.Buffer
+	out := log.StandardLogger().Out
+	log.SetOutput(&buf)
+	for i := 0; i < warnBurst+5; i++ {
+		if _, err := op.Get(context.Background(), d, "/short.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log.SetOutput(out)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != warnBurst {
+		t.Errorf("expect %d warnings, got %d", warnBurst, len(lines))
+	}
+	for _, field := range []string{
+		"storage=" + d.MountPath,
+		fmt.Sprintf("storage_id=%d", d.ID),
+		"remote_path=" + remote + "/" + d.cipher.EncryptFileName("short.txt"),
+	} {
+		if !strings.Contains(lines[0], field) {
+			t.Errorf("expect %s in %s", field, lines[0])
+		}
+	}
+}
+
+func TestWarnLimiter(t *testing.T) {
+	var l warnLimiter
+	now := time.Now()
+	for i := 0; i < warnBurst; i++ {
+		if ok, _ := l.allow(now); !ok {
+			t.Fatalf("expect warning %d to be allowed", i)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow(now); ok {
+			t.Fatalf("expect warnings over the burst to be suppressed")
+		}
+	}
+	ok, suppressed := l.allow(now.Add(warnInterval))
+	if !ok || suppressed != 3 {
+		t.Errorf("expect the next window to report 3 suppressed warnings, got %v %d", ok, suppressed)
+	}
+}
+
+func TestRemoteLogs(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	quiet := newTestCrypt(t, remote, nil)
+	verbose := newTestCrypt(t, remote, map[string]interface{}{"debug_remote": true})
+	failedGets := func(d *Crypt) int {
+		var buf bytes.Buffer
+		out := log.StandardLogger().Out
+		log.SetOutput(&buf)
+		defer log.SetOutput(out)
+		if _, err := op.Get(context.Background(), d, "/missing.txt"); err == nil {
+			t.Fatal("expect missing.txt not to be found")
+		}
+		return strings.Count(buf.String(), "failed get")
+	}
+	if n := failedGets(quiet); n != 0 {
+		t.Errorf("expect the remote to be quiet by default, got %d logs", n)
+	}
+	if n := failedGets(verbose); n == 0 {
+		t.Error("expect the remote gets to be logged with debug_remote")
+	}
+	flags.Debug = true
+	defer func() { flags.Debug = false }()
+	if n := failedGets(quiet); n == 0 {
+		t.Error("expect the remote gets to be logged with --debug")
+	}
+}
@@ -0,0 +1,18 @@
+package crypt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooLarge is returned by Get and Link for files whose size, decrypted from the remote size, is
+// above MaxDecryptedSize. a crafted remote object can claim any size
+var ErrTooLarge = errors.New("file is larger than max_decrypted_size")
+
+// checkDecryptedSize checks the decrypted size of the file at path against MaxDecryptedSize
+func (d *Crypt) checkDecryptedSize(path string, size int64) error {
+	if d.MaxDecryptedSize > 0 && size > int64(d.MaxDecryptedSize)<<30 {
+		return fmt.Errorf("%w: %s is %d bytes, the limit is %d GiB", ErrTooLarge, path, size, d.MaxDecryptedSize)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestMaxDecryptedSize(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"max_decrypted_size": 1})
+	putFile(t, d, "/", "small.txt", testData(1000))
+	putFile(t, d, "/", "huge.txt", testData(1000))
+	m.mu.Lock()
+	// the remote claims 2 GiB of ciphertext
+	m.nodes["/"+d.cipher.EncryptFileName("huge.txt")].size = d.cipher.EncryptedSize(2 << 30)
+	m.mu.Unlock()
+
+	if _, err := d.Get(ctx, "/huge.txt"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expect Get to refuse the crafted file, got %v", err)
+	}
+	huge := &model.Object{Path: "/huge.txt", Name: "huge.txt", Size: 1000}
+	if _, err := d.Link(ctx, huge, model.LinkArgs{}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expect Link to refuse the crafted file, got %v", err)
+	}
+	if _, _, err := op.Link(ctx, d, "/small.txt", model.LinkArgs{}); err != nil {
+		t.Errorf("expect files under the limit to be read, got %v", err)
+	}
+}
@@ -11,13 +11,72 @@ type Addition struct {
 	//driver.RootID
 	// define other
 
-	FileNameEnc string `json:"filename_encryption" type:"select" required:"true" options:"off,standard,obfuscate" default:"off"`
-	DirNameEnc  string `json:"directory_name_encryption" type:"select" required:"true" options:"false,true" default:"false"`
-	RemotePath  string `json:"remote_path" required:"true" help:"This is where the encrypted data stores"`
+	FileNameEnc      string `json:"filename_encryption" type:"select" required:"true" options:"off,standard,obfuscate" default:"off"`
+	DirNameEnc       string `json:"directory_name_encryption" type:"select" required:"true" options:"false,true" default:"false"`
+	FileNameEncoding string `json:"filename_encoding" type:"select" options:"base32,base64,base32768" default:"base32" help:"How encrypted names are encoded, base64 and base32768 give shorter names but need a case sensitive remote"`
+	RemotePath       string `json:"remote_path" required:"true" help:"This is where the encrypted data stores"`
+	// EncryptRemotePath only applies to the part of RemotePath under the mount path of the remote storage
+	EncryptRemotePath bool `json:"encrypt_remote_path" help:"Encrypt the directories of remote_path below the remote storage's mount path. By default remote_path is used literally"`
 
-	Password        string `json:"password" required:"true" confidential:"true" help:"the main password"`
+	// KeyFile, KeyEnv and KeyRef replace Password and Salt to keep them out of the database, they are read at every Init
+	Password        string `json:"password" confidential:"true" help:"the main password, required unless key_file, key_env or key_ref is set"`
 	Salt            string `json:"salt" confidential:"true"  help:"If you don't know what is salt, treat it as a second password'. Optional but recommended"`
+	KeyFile         string `json:"key_file" help:"Read the password from the first line of this file and the salt from the second, instead of the password and salt options"`
+	KeyEnv          string `json:"key_env" help:"Read the password from this environment variable and the salt from the same name with _SALT appended, instead of the password and salt options"`
+	KeyRef          string `json:"key_ref" help:"Get the password and salt from a secret provider, as provider:reference, instead of the password and salt options. Providers are registered by the programs embedding alist"`
 	EncryptedSuffix string `json:"encrypted_suffix" required:"true" default:".bin" help:"encrypted files will have this suffix"`
+	Kdf             string `json:"kdf" type:"select" options:"standard,hardened" default:"standard" help:"hardened stretches the password with a costlier scrypt first, the store can't be read by rclone then. Can't be changed once the store has data"`
+	// KdfApplied records the kdf the store was written with
+	KdfApplied string `json:"kdf_applied" ignore:"true"`
+	// FormatsApplied records the ways other than encryption the store may hold files in, e.g. plain,gzip,versions.
+	// Get only looks up files stored in those, see formatPlain
+	FormatsApplied string `json:"formats_applied" ignore:"true"`
+
+	MetaSidecar       bool   `json:"meta_sidecar" help:"Store tags and description of files in encrypted sidecars next to them on the remote"`
+	PlaintextHash     bool   `json:"plaintext_hash" help:"Compute the SHA1 of files while they are uploaded and keep it in their encrypted sidecar, to report it for deduplication. Listings read the sidecar of every file that has one"`
+	ShowReserved      bool   `json:"show_reserved" help:"Show the internal sidecar files of the driver in listings"`
+	Undecryptable     string `json:"undecryptable" type:"select" options:"hide,plain_dirs" default:"hide" help:"What to do with remote names that don't decrypt. plain_dirs shows such directories as plaintext, for stores that turned on directory name encryption after having data"`
+	UserAgent         string `json:"user_agent" help:"User-Agent of the requests to the remote's download links, unless the remote or the client sets one"`
+	AtomicPut         bool   `json:"atomic_put" help:"Upload to a temporary name and rename it when done, so failed uploads never leave a truncated file. Only use it when the remote renames cheaply"`
+	UnknownSizeUpload bool   `json:"unknown_size_upload" help:"Pass uploads of unknown size, e.g. from a pipe, on to the remote as a stream of unknown length. Only use it when the remote accepts chunked uploads, otherwise such uploads are refused"`
+	ConfirmPutTimeout int    `json:"confirm_put_timeout" type:"number" default:"0" help:"For eventually consistent remotes: seconds to wait after an upload until the remote lists the file. 0 doesn't wait"`
+	Trash             bool   `json:"trash" help:"Move removed files to an encrypted trash on the remote instead of deleting them"`
+	// PlainExtensions only affects new uploads, existing files are read the way they were stored
+	PlainExtensions     string `json:"plain_extensions" help:"Comma separated extensions, e.g. gpg,7z, whose content is uploaded without encryption. Their names are still encrypted"`
+	MaxNameLength       int    `json:"max_name_length" type:"number" default:"0" help:"The longest name in bytes the remote accepts, names that are longer once encrypted are refused. 0 means no limit"`
+	SelfTest            bool   `json:"self_test" help:"Check at startup that the cipher works and can decrypt what is already on the remote"`
+	RemoteReadTimeout   int    `json:"remote_read_timeout" type:"number" default:"0" help:"Seconds a read of the remote may wait, for a range to open or for its next bytes, before it fails so the player can retry. 0 waits as long as the request"`
+	MaxStreams          int    `json:"max_streams" type:"number" default:"0" help:"The most decrypted streams open at once from this storage, to spare the connections of the remote. 0 means no limit"`
+	StreamQueueTimeout  int    `json:"stream_queue_timeout" type:"number" default:"0" help:"Seconds a stream over max_streams waits for another one to close before it is refused. 0 refuses it at once"`
+	ExpiredLinkRetries  int    `json:"expired_link_retries" type:"number" default:"3" help:"For remotes whose download links expire: how often in a row a stream gets a new link and resumes where it stopped, when the link is refused or the connection is cut. 0 fails the stream"`
+	IgnoreTrailingSlash bool   `json:"ignore_trailing_slash" help:"Look paths up the same with and without a trailing slash. By default a trailing slash only finds a directory"`
+	CredentialFormat    string `json:"credential_format" type:"select" options:"obscure,secret" default:"obscure" help:"How the password and salt are stored. obscure is rclone's reversible form, secret seals them with the jwt_secret of alist, for configs shared by instances with the same jwt_secret, changing jwt_secret makes them unreadable. Either form is read"`
+	Retries             int    `json:"retries" type:"number" default:"0" help:"How often an upload, move, copy, rename, removal or new directory is tried again when the remote fails with what looks like a transient error, e.g. a timeout, a reset connection or a 429, 500, 502, 503 or 504 status kept in the error of the remote. Uploads are only tried again if the remote failed before reading anything"`
+	RetryBackoff        int    `json:"retry_backoff" type:"number" default:"1000" help:"Milliseconds to wait before the first retry, the wait doubles with every retry up to 30 seconds"`
+	ContentTypeHint     bool   `json:"content_type_hint" help:"Upload with the content type of the plaintext name instead of application/octet-stream, for remotes that record it. The remote then learns the types of the files"`
+	CheckFreeSpace      bool   `json:"check_free_space" help:"Refuse uploads whose encrypted size is more than the free space of the remote before sending anything. Remotes that can't tell their free space are not checked"`
+	AppleDouble         string `json:"apple_double" type:"select" options:"show,hide" default:"show" help:"hide leaves the ._ AppleDouble files macOS writes next to files out of listings and moves, renames, copies and removes them with their file. Lazy decrypted listings still show them"`
+	RangeProbe          string `json:"range_probe" type:"select" options:"off,warn,refuse" default:"off" help:"Check at startup that the remote reads ranges of a file, which seeking in encrypted files needs. warn logs once when it doesn't, refuse fails the mount"`
+	HiddenNames         string `json:"hidden_names" type:"text" default:".DS_Store,Thumbs.db,desktop.ini" help:"Decrypted names left out of listings, separated by commas and matched regardless of case, * and ? are wildcards. They can still be read, uploaded and removed by their path. Clear it to show every file. Lazy decrypted listings show them"`
+	Versions            int    `json:"versions" type:"number" default:"0" help:"Keep that many previous versions of a file when it is overwritten, renamed next to it on the remote and hidden from listings. 0 keeps none"`
+	ForeignCheck        string `json:"foreign_check" type:"select" options:"off,warn,refuse" default:"off" help:"Check at startup that the remote path doesn't hold names encrypted with other credentials, which this storage would show nothing of. warn logs it, refuse fails the mount. Skipped with self_test, which already fails the mount when nothing decrypts"`
+	CaseCollision       string `json:"case_collision" type:"select" options:"off,refuse,suffix" default:"off" help:"For case insensitive remotes: check before uploads, new directories and renames that the remote name doesn't differ only in case from another one, which the remote would take for the same. refuse fails, suffix adds (1), (2)... to the name"`
+	Compression         string `json:"compression" type:"select" options:"off,gzip" default:"off" help:"Compress new files with gzip before encryption, when it makes them smaller. The remote name then carries the file size. Reads of a range decompress from the start of the file. Files stored before are read as they are"`
+	ZeroModified        string `json:"zero_modified" type:"select" options:"unknown,sidecar" default:"unknown" help:"For remotes that report no modification time: unknown passes the zero time on, which marks it as unknown. sidecar records the time of uploads in their encrypted sidecar and reports it when the remote has none"`
+	MaxDecryptedSize    int    `json:"max_decrypted_size" type:"number" default:"0" help:"Refuse to get or read files larger than that many GiB once decrypted, the size the remote reports can be crafted. 0 is no limit"`
+	ShowIncomplete      bool   `json:"show_incomplete" help:"List the files whose remote size is too short to be a whole encrypted file, left by interrupted uploads, and the files the remote reports still being uploaded, as <name>.incomplete so that they can be removed. They can't be read. By default they are left out"`
+	Thumbnails          string `json:"thumbnails" type:"select" options:"suppress,passthrough" default:"suppress" help:"Thumbnails the remote gives for files. The remote makes them from the ciphertext, so they are broken unless it decrypts server side. suppress leaves them out, passthrough shows them as they are"`
+	DedupNames          bool   `json:"dedup_names" help:"Put a hash of the content in the remote names of new files, so that a remote deduplicating by name sees the files of the same content. The hash is keyed with the key of the storage, but the remote can tell which files are the same. Uploads are written to a temporary file first to hash them. With compression on, files are named by it instead"`
+	ContentCheck        bool   `json:"content_check" help:"Check on first access that the header and first block of a file decrypt, and report it as content_valid in the metadata of the file, so that files that list fine but won't play can be told. The result is kept in memory until the file changes"`
+	DebugRemote         bool   `json:"debug_remote" help:"Log the listings and gets of the remote that fail, to debug an empty listing. They are also logged when alist runs with --debug or --dev, otherwise they are quiet"`
+	PreserveMetadata    bool   `json:"preserve_metadata" help:"Keep the metadata map an upload carries, like the user metadata of S3, encrypted in the sidecar of the file, and give it back with the file when it is got by its path. Listings don't read it"`
+	MigrationWorkers    int    `json:"migration_workers" type:"number" default:"1" help:"The files CopyTo and Import copy at once. Each copy of a file of this storage reads a stream of it, so with max_streams they copy at most that many"`
+	LazyInit            bool   `json:"lazy_init" help:"Find the remote storage and build the cipher on first access instead of at startup, the storage then mounts even if the remote is down"`
+	StatSizeConcurrency int    `json:"stat_size_concurrency" type:"number" default:"0" help:"For remotes that list files without their size: stat such files, this many at once. 0 disables it"`
+	StatSizeLimit       int    `json:"stat_size_limit" type:"number" default:"100" help:"The most files to stat in one listing, 0 means no limit"`
+	LazyDecrypt         bool   `json:"lazy_decrypt" help:"Decrypt the names and sizes of a listing when they are first read instead of all at once, for large directories. The listing keeps the order of the remote unless sorted by modified, and names that don't decrypt are shown as they are on the remote"`
+	SearchIndex         bool   `json:"search_index" help:"Keep the decrypted names in memory after the first search, so later searches don't walk the remote"`
+	SearchIndexLimit    int    `json:"search_index_limit" type:"number" default:"100000" help:"The most objects in the search index, larger stores are walked on every search. 0 means no limit"`
 }
 
 /*// inMemory contains decrypted confidential info and other temp data. will not persist these info anywhere
@@ -0,0 +1,76 @@
+package crypt
+
+import (
+	"context"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// metadataObj is an object that carries a map of metadata, like the user metadata of an S3 object.
+// the object model has no room for it, the objects and streams that have it offer it this way
+type metadataObj interface {
+	GetMetadata() map[string]string
+}
+
+// MetadataOf returns the metadata obj carries, looking through wrappers and the object of a stream
+func MetadataOf(obj model.Obj) (map[string]string, bool) {
+	if m, ok := obj.(metadataObj); ok {
+		return m.GetMetadata(), true
+	}
+	if stream, ok := obj.(*model.FileStream); ok {
+		return MetadataOf(stream.Obj)
+	}
+	if unwrap, ok := obj.(model.ObjUnwrap); ok {
+		return MetadataOf(unwrap.Unwrap())
+	}
+	return nil, false
+}
+
+// metadataObject is an object carrying metadata, a file of the storage with the metadata of its sidecar
+type metadataObject struct {
+	model.Obj
+	metadata map[string]string
+}
+
+// WithMetadata returns obj carrying metadata, for the object of a stream uploaded with it
+func WithMetadata(obj model.Obj, metadata map[string]string) model.Obj {
+	return &metadataObject{Obj: obj, metadata: metadata}
+}
+
+func (o *metadataObject) Unwrap() model.Obj {
+	return o.Obj
+}
+
+func (o *metadataObject) GetMetadata() map[string]string {
+	return o.metadata
+}
+
+func (o *metadataObject) SetPath(path string) {
+	if s, ok := o.Obj.(model.SetPath); ok {
+		s.SetPath(path)
+	}
+}
+
+// withSidecarMetadata gives the file obj the metadata kept in its sidecar, with PreserveMetadata
+func (d *Crypt) withSidecarMetadata(ctx context.Context, obj model.Obj) model.Obj {
+	if !d.PreserveMetadata || obj.IsDir() || isReservedName(obj.GetName()) {
+		return obj
+	}
+	sidecarPath, err := d.getSidecarActualPath(obj.GetPath(), false)
+	if err != nil {
+		return obj
+	}
+	var meta ObjMeta
+	if err = d.readEncryptedJson(ctx, sidecarPath, &meta); err != nil {
+		if !errs.IsObjectNotFound(err) {
+			log.Warnf("failed to read the metadata of %s: %s", obj.GetPath(), err)
+		}
+		return obj
+	}
+	if meta.Metadata == nil {
+		return obj
+	}
+	return WithMetadata(obj, meta.Metadata)
+}
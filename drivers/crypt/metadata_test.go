@@ -0,0 +1,69 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestPreserveMetadata(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"preserve_metadata": true})
+	data := testData(1000)
+	metadata := map[string]string{"original-path": "/home/me/a.txt", "content-language": "en"}
+	err := op.Put(ctx, d, "/", &model.FileStream{
+		Obj: WithMetadata(&model.Object{
+			Name:     "a.txt",
+			Size:     int64(len(data)),
+			Modified: time.Now(),
+		}, metadata),
+		ReadCloser: io.NopCloser(bytes.NewReader(data)),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sidecar, ok := m.read("/" + d.cipher.EncryptFileName("a.txt") + metaSidecarSuffix)
+	if !ok || bytes.Contains(sidecar, []byte("original-path")) {
+		t.Fatalf("expect the metadata to be stored encrypted in the sidecar, got %v", m.paths())
+	}
+
+	getMetadata := func(path string) map[string]string {
+		t.Helper()
+		op.ClearCache(d, "/")
+		obj, err := op.Get(ctx, d, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := MetadataOf(obj)
+		return got
+	}
+	if got := getMetadata("/a.txt"); !reflect.DeepEqual(got, metadata) {
+		t.Errorf("expect %v, got %v", metadata, got)
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Error("read mismatch")
+	}
+	if err = op.Rename(ctx, d, "/a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := getMetadata("/b.txt"); !reflect.DeepEqual(got, metadata) {
+		t.Errorf("expect the metadata to follow a rename, got %v", got)
+	}
+	// an upload without metadata replaces the file and its metadata
+	putFile(t, d, "/", "b.txt", data)
+	if got := getMetadata("/b.txt"); got != nil {
+		t.Errorf("expect no metadata after an upload without any, got %v", got)
+	}
+	putFile(t, d, "/", "c.txt", data)
+	if _, ok := m.read("/" + d.cipher.EncryptFileName("c.txt") + metaSidecarSuffix); ok {
+		t.Error("expect no sidecar for a file uploaded without metadata")
+	}
+}
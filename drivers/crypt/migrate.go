@@ -0,0 +1,181 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+	log "github.com/sirupsen/logrus"
+)
+
+// nameMigrator renames the objects on the remote from the names of one cipher to the names of another
+type nameMigrator struct {
+	from, to *rcCrypt.Cipher
+}
+
+// MigrateNamesOff turns off filename encryption of a store that has data: every object on the remote is
+// renamed to its plaintext name, content stays encrypted. Names that are already plaintext are skipped,
+// so an interrupted migration can simply be run again. The store shouldn't be used while it runs
+func (d *Crypt) MigrateNamesOff(ctx context.Context) error {
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	if d.FileNameEnc == "off" {
+		return fmt.Errorf("filename encryption is already off")
+	}
+	if d.EncryptRemotePath && d.DirNameEnc == "true" {
+		return fmt.Errorf("can't migrate a store whose remote_path is encrypted")
+	}
+	to := d.additionCopy()
+	to.FileNameEnc = "off"
+	p, p2, err := d.credentials()
+	if err != nil {
+		return err
+	}
+	toCipher, err := newCipher(&to, p, p2)
+	if err != nil {
+		return fmt.Errorf("failed to create Cipher: %w", err)
+	}
+	_, rootActualPath, err := op.GetStorageAndActualPath(d.remoteRoot)
+	if err != nil {
+		return fmt.Errorf("can't find remote storage: %w", err)
+	}
+	m := &nameMigrator{from: d.cipher, to: toCipher}
+	if err = m.migrateDir(ctx, d, rootActualPath); err != nil {
+		return err
+	}
+	if err = m.migrateTrash(ctx, d); err != nil {
+		return err
+	}
+	d.FileNameEnc = to.FileNameEnc
+	err = d.setCipher(toCipher, p, p2)
+	d.save()
+	return err
+}
+
+// migrateDir migrates the children of dirActualPath, directories are renamed after their content
+func (m *nameMigrator) migrateDir(ctx context.Context, d *Crypt, dirActualPath string) error {
+	objs, err := op.List(ctx, d.remoteStorage, dirActualPath, model.ListArgs{}, true)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", dirActualPath, err)
+	}
+	dirs := make(map[string]bool)
+	for _, obj := range objs {
+		if obj.IsDir() {
+			dirs[obj.GetName()] = true
+		}
+	}
+	for _, obj := range objs {
+		if obj.GetName() == trashDirName || obj.GetName() == trashInfoName && !obj.IsDir() {
+			// the trash is migrated by migrateTrash, and the info of its entries isn't named after an object
+			continue
+		}
+		objPath := stdpath.Join(dirActualPath, obj.GetName())
+		if obj.IsDir() && !isReservedName(obj.GetName()) {
+			if err = m.migrateDir(ctx, d, objPath); err != nil {
+				return err
+			}
+		}
+		name, isDir := obj.GetName(), obj.IsDir()
+		suffix := reservedSuffix(name)
+		if remoteName, id, ok := parseVersionName(name); ok {
+			name, suffix = remoteName, "."+id+versionSuffix
+		} else if suffix != "" {
+			// a reserved file is named after the object it belongs to
+			name = strings.TrimSuffix(name, suffix)
+			isDir = dirs[name]
+		}
+		if name == "" {
+			continue
+		}
+		newName, ok := m.rename(name, isDir)
+		if !ok {
+			continue
+		}
+		newName += suffix
+		if err = op.Rename(ctx, d.remoteStorage, objPath, newName); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", objPath, err)
+		}
+		renamed, err := op.GetUnwrap(ctx, d.remoteStorage, stdpath.Join(dirActualPath, newName))
+		if err != nil {
+			return fmt.Errorf("failed to verify the rename of %s: %w", objPath, err)
+		}
+		if renamed.IsDir() != obj.IsDir() || (!obj.IsDir() && renamed.GetSize() != obj.GetSize()) {
+			return fmt.Errorf("failed to verify the rename of %s: got a different object", objPath)
+		}
+		log.Debugf("crypt migrated %s to %s", objPath, newName)
+	}
+	return nil
+}
+
+// migrateTrash migrates the objects in the entries of the trash, and the remote names their infos keep
+func (m *nameMigrator) migrateTrash(ctx context.Context, d *Crypt) error {
+	trashPath, err := d.getTrashActualPath()
+	if err != nil {
+		return err
+	}
+	entries, err := op.List(ctx, d.remoteStorage, trashPath, model.ListArgs{}, true)
+	if err != nil {
+		if errs.IsObjectNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list %s: %w", trashPath, err)
+	}
+	for _, entry := range entries {
+		entryPath := stdpath.Join(trashPath, entry.GetName())
+		infoPath := stdpath.Join(entryPath, trashInfoName)
+		var info trashInfo
+		if err = d.readEncryptedJson(ctx, infoPath, &info); err != nil {
+			log.Warnf("failed to read trash entry %s: %s", entry.GetName(), err)
+			continue
+		}
+		if err = m.migrateDir(ctx, d, entryPath); err != nil {
+			return err
+		}
+		newName, ok := m.rename(info.RemoteName, info.IsDir)
+		if !ok {
+			continue
+		}
+		info.RemoteName = newName
+		if err = d.writeEncryptedJson(ctx, infoPath, &info); err != nil {
+			return fmt.Errorf("failed to update trash entry %s: %w", entry.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// rename returns the name of the object stored as name under the new cipher, keeping the suffix of how
+// its content is stored, ok is false if the object doesn't need a rename
+func (m *nameMigrator) rename(name string, isDir bool) (string, bool) {
+	var suffix string
+	if base, stored := contentSuffix(name); stored != "" && !isDir {
+		name, suffix = base, stored
+	}
+	newName, ok := m.newName(name, isDir)
+	return newName + suffix, ok
+}
+
+// newName returns the name of an object under the new cipher,
+// ok is false if the object doesn't need a rename
+func (m *nameMigrator) newName(name string, isDir bool) (string, bool) {
+	var newName string
+	if isDir {
+		plain, err := m.from.DecryptDirName(name)
+		if err != nil {
+			return "", false
+		}
+		newName = m.to.EncryptDirName(plain)
+	} else {
+		plain, err := m.from.DecryptFileName(name)
+		if err != nil {
+			return "", false
+		}
+		newName = m.to.EncryptFileName(plain)
+	}
+	return newName, newName != name
+}
@@ -0,0 +1,97 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestMigrateNamesOff(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	a, b := testData(100), testData(200)
+	putFile(t, d, "/", "a.txt", a)
+	putFile(t, d, "/dir", "b.txt", b)
+
+	// an interrupted migration left one file renamed already
+	remoteStorage, err := op.GetStorageByMountPath(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Rename(ctx, remoteStorage, "/"+d.cipher.EncryptFileName("a.txt"), "a.txt.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.MigrateNamesOff(ctx); err != nil {
+		t.Fatal(err)
+	}
+	paths := m.paths()
+	sort.Strings(paths)
+	expect := []string{"/", "/a.txt.bin", "/dir", "/dir/b.txt.bin"}
+	if len(paths) != len(expect) {
+		t.Fatalf("expect %v, got %v", expect, paths)
+	}
+	for i := range expect {
+		if paths[i] != expect[i] {
+			t.Fatalf("expect %v, got %v", expect, paths)
+		}
+	}
+	if stored, _ := m.read("/dir/b.txt.bin"); bytes.Contains(stored, b) || int64(len(stored)) != d.cipher.EncryptedSize(int64(len(b))) {
+		t.Errorf("expect content to stay encrypted")
+	}
+	if d.FileNameEnc != "off" {
+		t.Errorf("expect filename encryption to be off, got %s", d.FileNameEnc)
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, a) {
+		t.Errorf("read mismatch of a.txt")
+	}
+	if got := readRange(t, d, "/dir/b.txt", http_range.Range{Length: -1}); !bytes.Equal(got, b) {
+		t.Errorf("read mismatch of dir/b.txt")
+	}
+	if err := d.MigrateNamesOff(ctx); err == nil {
+		t.Errorf("expect migrating again to fail")
+	}
+}
+
+// the trash keeps its place, and its entries can be restored under the new names
+func TestMigrateNamesOffTrash(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"trash": true})
+	a := testData(100)
+	putFile(t, d, "/dir", "a.txt", a)
+	if err := op.Remove(ctx, d, "/dir/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.MigrateNamesOff(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range m.paths() {
+		if strings.Contains(path, ".bin"+trashDirName) {
+			t.Errorf("expect the trash not to be renamed, got %s", path)
+		}
+	}
+	entries, err := d.ListTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/dir/a.txt" {
+		t.Fatalf("expect the trash entry of a.txt, got %+v", entries)
+	}
+	if err := d.RestoreTrash(ctx, entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRange(t, d, "/dir/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, a) {
+		t.Errorf("read mismatch of restored a.txt")
+	}
+	if _, ok := m.read("/dir/a.txt.bin"); !ok {
+		t.Errorf("expect a.txt to be restored under its plaintext name, got %v", m.paths())
+	}
+}
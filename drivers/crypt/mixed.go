@@ -0,0 +1,91 @@
+package crypt
+
+import (
+	"context"
+	stdpath "path"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// undecryptablePlainDirs shows the directories whose name doesn't decrypt as plaintext directories,
+// they are left by stores that turned directory_name_encryption on after having data
+const undecryptablePlainDirs = "plain_dirs"
+
+// plainDirSet holds the paths of the storage of the directories shown as plaintext
+type plainDirSet struct {
+	mu    sync.RWMutex
+	paths map[string]bool
+}
+
+// add reports whether path is new to the set
+func (s *plainDirSet) add(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paths[path] {
+		return false
+	}
+	if s.paths == nil {
+		s.paths = make(map[string]bool)
+	}
+	s.paths[path] = true
+	return true
+}
+
+func (s *plainDirSet) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.paths)
+}
+
+func (s *plainDirSet) has(path string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.paths[path]
+}
+
+// plainDirName tells whether the remote directory remoteName under parent, whose name doesn't decrypt,
+// is shown as a plaintext directory. it is when Undecryptable is plain_dirs and the name is valid text
+func (d *Crypt) plainDirName(parent, remoteName string) bool {
+	if d.Undecryptable != undecryptablePlainDirs || !utf8.ValidString(remoteName) {
+		return false
+	}
+	d.plainDirs.add(stdpath.Join(parent, remoteName))
+	return true
+}
+
+// encryptDirPath is EncryptDirName of the directory path dir, keeping the plaintext directories literal
+func (d *Crypt) encryptDirPath(dir string) string {
+	if d.Undecryptable != undecryptablePlainDirs {
+		return d.cipher.EncryptDirName(dir)
+	}
+	segments := strings.Split(dir, "/")
+	p := "/"
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		p = stdpath.Join(p, segment)
+		if !d.plainDirs.has(p) {
+			segments[i] = d.cipher.EncryptDirName(segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// discoverPlainDirs lists the directories above path, which finds the plaintext directories among them
+// that weren't listed since startup. it reports whether a new one was found
+func (d *Crypt) discoverPlainDirs(ctx context.Context, path string) bool {
+	if d.Undecryptable != undecryptablePlainDirs {
+		return false
+	}
+	before := d.plainDirs.size()
+	dir := "/"
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if _, err := d.list(ctx, dir, true); err != nil {
+			break
+		}
+		dir = stdpath.Join(dir, segment)
+	}
+	return d.plainDirs.size() > before
+}
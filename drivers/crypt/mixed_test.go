@@ -0,0 +1,92 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestUndecryptablePlainDirs(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"undecryptable": undecryptablePlainDirs})
+	data := testData(100)
+	if err := op.MakeDir(ctx, d, "/mixed/encrypted"); err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, d, "/mixed/encrypted", "a.txt", data)
+	encrypted, _ := m.read("/" + d.cipher.EncryptDirName("mixed/encrypted") + "/" + d.cipher.EncryptFileName("a.txt"))
+	// a directory made before directory name encryption was turned on
+	plainDir := "/" + d.cipher.EncryptDirName("mixed") + "/old photos"
+	m.putDir(plainDir)
+	m.putFile(plainDir+"/"+d.cipher.EncryptFileName("a.txt"), encrypted)
+
+	names := func(d *Crypt) string {
+		objs, err := op.List(ctx, d, "/mixed", model.ListArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		model.SortFiles(objs, "name", "asc")
+		var names []string
+		for _, obj := range objs {
+			names = append(names, obj.GetName())
+		}
+		return fmt.Sprint(names)
+	}
+	if got := names(d); got != "[encrypted old photos]" {
+		t.Errorf("expect the plaintext directory to be listed, got %s", got)
+	}
+	if got := readRange(t, d, "/mixed/old photos/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("read mismatch in the plaintext directory")
+	}
+
+	// a storage that didn't list /mixed yet finds the directory on access
+	fresh := newTestCrypt(t, remote, map[string]interface{}{"undecryptable": undecryptablePlainDirs})
+	if got := readRange(t, fresh, "/mixed/old photos/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("read mismatch in the plaintext directory")
+	}
+	if _, err := op.Get(ctx, fresh, "/mixed/old photos/missing.txt"); err == nil {
+		t.Errorf("expect a missing file to stay missing")
+	}
+
+	hiding := newTestCrypt(t, remote, nil)
+	if got := names(hiding); got != "[encrypted]" {
+		t.Errorf("expect undecryptable directories to be hidden by default, got %s", got)
+	}
+}
+
+func TestPlainDirGetReadsSidecarOnce(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"undecryptable": undecryptablePlainDirs})
+	putFile(t, d, "/", "a.txt", testData(100))
+	encrypted, _ := m.read("/" + d.cipher.EncryptFileName("a.txt"))
+	m.putDir("/old photos")
+	m.putFile("/old photos/"+d.cipher.EncryptFileName("a.txt"), encrypted)
+
+	// the plaintext directory is found on access, the file is looked up again then
+	fresh := newTestCrypt(t, remote, map[string]interface{}{"undecryptable": undecryptablePlainDirs, "preserve_metadata": true})
+	m.mu.Lock()
+	m.missed = nil
+	m.mu.Unlock()
+	if _, err := fresh.Get(ctx, "/old photos/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sidecars := 0
+	for _, path := range m.missed {
+		if strings.HasSuffix(path, metaSidecarSuffix) {
+			sidecars++
+		}
+	}
+	if sidecars != 1 {
+		t.Errorf("expect the sidecar to be looked up once, got %d lookups in %v", sidecars, m.missed)
+	}
+}
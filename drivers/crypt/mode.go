@@ -0,0 +1,95 @@
+package crypt
+
+import (
+	"context"
+	"os"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	log "github.com/sirupsen/logrus"
+)
+
+// modeObj is an object that carries Unix permissions, like those of a local or SFTP remote.
+// the object model has no room for them, remotes that have them offer them this way
+type modeObj interface {
+	GetMode() os.FileMode
+}
+
+// modeSetter is a remote that can set the permissions of its objects
+type modeSetter interface {
+	SetMode(ctx context.Context, obj model.Obj, mode os.FileMode) error
+}
+
+// ModeOf returns the permissions obj carries, looking through wrappers and the object of a stream
+func ModeOf(obj model.Obj) (os.FileMode, bool) {
+	if m, ok := obj.(modeObj); ok {
+		return m.GetMode(), true
+	}
+	if stream, ok := obj.(*model.FileStream); ok {
+		return ModeOf(stream.Obj)
+	}
+	if unwrap, ok := obj.(model.ObjUnwrap); ok {
+		return ModeOf(unwrap.Unwrap())
+	}
+	return 0, false
+}
+
+// modeObject is an object of the storage with the permissions of its remote object
+type modeObject struct {
+	model.Obj
+	mode os.FileMode
+}
+
+func (o *modeObject) Unwrap() model.Obj {
+	return o.Obj
+}
+
+func (o *modeObject) GetMode() os.FileMode {
+	return o.mode
+}
+
+func (o *modeObject) SetPath(path string) {
+	if s, ok := o.Obj.(model.SetPath); ok {
+		s.SetPath(path)
+	}
+}
+
+// withMode gives obj the permissions of remoteObj, if it has any
+func withMode(obj, remoteObj model.Obj) model.Obj {
+	mode, ok := ModeOf(remoteObj)
+	if !ok {
+		return obj
+	}
+	return &modeObject{Obj: obj, mode: mode}
+}
+
+// unwrapObj removes every wrapper of obj, those of op and modeObject
+func unwrapObj(obj model.Obj) model.Obj {
+	for {
+		unwrap, ok := obj.(model.ObjUnwrap)
+		if !ok {
+			return obj
+		}
+		obj = unwrap.Unwrap()
+	}
+}
+
+// setRemoteMode gives the uploaded file at remoteActualPath the permissions of stream, when both
+// carry them. failures are only logged like for the meta sidecar
+func (d *Crypt) setRemoteMode(ctx context.Context, stream model.FileStreamer, remoteActualPath string) {
+	mode, ok := ModeOf(stream)
+	if !ok {
+		return
+	}
+	setter, ok := d.remoteStorage.(modeSetter)
+	if !ok {
+		return
+	}
+	remoteObj, err := op.Get(ctx, d.remoteStorage, remoteActualPath)
+	if err == nil {
+		err = setter.SetMode(ctx, remoteObj, mode)
+	}
+	if err != nil {
+		log.Warnf("failed to set the mode of %s: %s", remoteActualPath, err)
+	}
+}
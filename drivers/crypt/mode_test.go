@@ -0,0 +1,66 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestMode(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(100)
+	err := op.Put(ctx, d, "/", &model.FileStream{
+		Obj: &memModeObj{Object: &model.Object{
+			Name:     "run.sh",
+			Size:     int64(len(data)),
+			Modified: time.Now(),
+		}, mode: 0750},
+		ReadCloser: io.NopCloser(bytes.NewReader(data)),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, d, "/", "plain.txt", testData(10))
+	if err = op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.nodes["/"+d.cipher.EncryptDirName("dir")].mode = os.ModeDir | 0700
+	if mode := m.nodes["/"+d.cipher.EncryptFileName("run.sh")].mode; mode != 0750 {
+		t.Errorf("expect the upload to set the mode on the remote, got %v", mode)
+	}
+	m.mu.Unlock()
+
+	modes := map[string]os.FileMode{"run.sh": 0750, "dir": os.ModeDir | 0700}
+	objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objs {
+		mode, ok := ModeOf(obj)
+		if want, has := modes[obj.GetName()]; ok != has || mode != want {
+			t.Errorf("List %s: expect mode %v, got %v %v", obj.GetName(), want, mode, ok)
+		}
+	}
+	for name, want := range modes {
+		obj, err := op.Get(ctx, d, "/"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode, ok := ModeOf(obj); !ok || mode != want {
+			t.Errorf("Get %s: expect mode %v, got %v %v", name, want, mode, ok)
+		}
+	}
+	if got := readRange(t, d, "/run.sh", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("expect a file with a mode to read back")
+	}
+}
@@ -0,0 +1,70 @@
+package crypt
+
+import (
+	"context"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// zeroModifiedSidecar is the ZeroModified option that keeps the time of uploads in their sidecar
+const zeroModifiedSidecar = "sidecar"
+
+// modifiedMissing reports whether a modification time of the remote is no time, some remotes give
+// the zero time and others the Unix epoch
+func modifiedMissing(t time.Time) bool {
+	return t.IsZero() || t.Unix() == 0
+}
+
+// objectOf returns the object under the wrappers of obj, a file of the driver
+func objectOf(obj model.Obj) *model.Object {
+	switch o := unwrapObj(obj).(type) {
+	case *model.Object:
+		return o
+	case *model.ObjThumb:
+		return &o.Object
+	case *plainObject:
+		return &o.Object
+	case *compressedObject:
+		return &o.Object
+	case *dedupObject:
+		return &o.Object
+	}
+	return nil
+}
+
+// readSidecarModTime sets the modification time recorded in the sidecar at sidecarPath on obj,
+// it reports whether there was one
+func (d *Crypt) readSidecarModTime(ctx context.Context, obj *model.Object, sidecarPath string) bool {
+	var meta ObjMeta
+	if err := d.readEncryptedJson(ctx, sidecarPath, &meta); err != nil {
+		if !errs.IsObjectNotFound(err) {
+			log.Warnf("failed to read the modification time of %s: %s", obj.GetName(), err)
+		}
+		return false
+	}
+	return setModTimeFromSidecar(obj, &meta)
+}
+
+// setModTimeFromSidecar sets the modification time meta holds on obj, it reports whether there was one
+func setModTimeFromSidecar(obj *model.Object, meta *ObjMeta) bool {
+	if meta.Modified == nil {
+		return false
+	}
+	obj.Modified = *meta.Modified
+	return true
+}
+
+// setSidecarModTime sets the modification time recorded at upload on the file obj got by path,
+// with ZeroModified sidecar and when the remote has none
+func (d *Crypt) setSidecarModTime(ctx context.Context, obj model.Obj) {
+	object := objectOf(obj)
+	if d.ZeroModified != zeroModifiedSidecar || object == nil || !modifiedMissing(object.Modified) {
+		return
+	}
+	if sidecarPath, err := d.getSidecarActualPath(object.GetPath(), false); err == nil {
+		d.readSidecarModTime(ctx, object, sidecarPath)
+	}
+}
@@ -0,0 +1,68 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestZeroModified(t *testing.T) {
+	ctx := context.Background()
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	put := func(d *Crypt, name string, modified time.Time) {
+		err := op.Put(ctx, d, "/", &model.FileStream{
+			Obj:        &model.Object{Name: name, Size: 100, Modified: modified},
+			ReadCloser: io.NopCloser(bytes.NewReader(testData(100))),
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, option := range []string{"unknown", "sidecar"} {
+		m, remote := newTestRemote(t, linkModeRange)
+		m.zeroModified = true
+		d := newTestCrypt(t, remote, map[string]interface{}{"zero_modified": option})
+		d.GetStorage().OrderBy, d.GetStorage().OrderDirection = "modified", "asc"
+		put(d, "a.txt", modified)
+		put(d, "b.txt", modified.Add(-time.Hour))
+
+		expect := time.Time{}
+		if option == "sidecar" {
+			expect = modified
+		}
+		objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objs) != 2 {
+			t.Fatalf("%s: expect the sidecars to be hidden, got %d objects", option, len(objs))
+		}
+		if option == "sidecar" && (objs[0].GetName() != "b.txt" || !objs[1].ModTime().Equal(expect)) {
+			t.Errorf("%s: expect the listing sorted by the recorded times, got %s at %s first", option, objs[0].GetName(), objs[0].ModTime())
+		}
+		if option == "unknown" && !objs[0].ModTime().IsZero() {
+			t.Errorf("%s: expect the listed time to be unknown, got %s", option, objs[0].ModTime())
+		}
+		op.ClearCache(d, "/")
+		obj, err := op.Get(ctx, d, "/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !obj.ModTime().Equal(expect) {
+			t.Errorf("%s: expect Get to report %s, got %s", option, expect, obj.ModTime())
+		}
+		if option == "sidecar" {
+			if err = op.Rename(ctx, d, "/a.txt", "c.txt"); err != nil {
+				t.Fatal(err)
+			}
+			if obj, err = op.Get(ctx, d, "/c.txt"); err != nil || !obj.ModTime().Equal(expect) {
+				t.Errorf("%s: expect the time to follow a rename, got %v", option, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+)
+
+// nameCipher returns the cipher of the storage, built without touching the remote
+// if the storage isn't resolved yet
+func (d *Crypt) nameCipher() (*rcCrypt.Cipher, error) {
+	d.resolveMu.Lock()
+	defer d.resolveMu.Unlock()
+	if err := d.buildCipher(); err != nil {
+		return nil, err
+	}
+	return d.cipher, nil
+}
+
+// EncryptName returns the name a file or directory called name is stored under on the remote.
+// it does no I/O, and is a stable API for tools built on the driver.
+// the result is empty if the password, salt or encryption options of the storage are invalid
+func (d *Crypt) EncryptName(name string, isDir bool) string {
+	c, err := d.nameCipher()
+	if err != nil {
+		d.logger().Errorf("failed to encrypt name %s: %v", name, err)
+		return ""
+	}
+	if isDir {
+		return c.EncryptDirName(name)
+	}
+	return c.EncryptFileName(name)
+}
+
+// DecryptName returns the plaintext name of the remote file or directory called name.
+// it does no I/O, and is a stable API for tools built on the driver
+func (d *Crypt) DecryptName(name string, isDir bool) (string, error) {
+	c, err := d.nameCipher()
+	if err != nil {
+		return "", err
+	}
+	if isDir {
+		return c.DecryptDirName(name)
+	}
+	return c.DecryptFileName(name)
+}
+
+// RemoteActualPath returns the path in the remote storage of the file or directory at plaintextPath,
+// for tools working on the remote directly. it starts with the part of RemotePath below the mount path
+// of the remote, encrypted with encrypt_remote_path. it is where an encrypted object is stored,
+// files uploaded plain or clear have a suffix added, see getObjActualPathForRemote
+func (d *Crypt) RemoteActualPath(plaintextPath string, isDir bool) (string, error) {
+	// resolving only looks the remote storage up, it does no I/O
+	if err := d.resolve(context.Background()); err != nil {
+		return "", err
+	}
+	return d.getActualPathForRemote(plaintextPath, isDir)
+}
+
+// decryptNamesChunk is the size of the batches DecryptNames decrypts without spreading them over the CPUs
+const decryptNamesChunk = 256
+
+// DecryptNames is DecryptName for a batch of names, e.g. to build an index outside of alist.
+// areDirs tells which names are of directories, names past its end are of files.
+// large batches are decrypted in parallel, the results are in the order of names
+func (d *Crypt) DecryptNames(names []string, areDirs []bool) ([]string, []error) {
+	res, errs := make([]string, len(names)), make([]error, len(names))
+	c, err := d.nameCipher()
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return res, errs
+	}
+	decrypt := func(from, to int) {
+		for i := from; i < to; i++ {
+			if i < len(areDirs) && areDirs[i] {
+				res[i], errs[i] = c.DecryptDirName(names[i])
+			} else {
+				res[i], errs[i] = c.DecryptFileName(names[i])
+			}
+		}
+	}
+	if len(names) <= decryptNamesChunk {
+		decrypt(0, len(names))
+		return res, errs
+	}
+	chunk := (len(names) + runtime.NumCPU() - 1) / runtime.NumCPU()
+	var wg sync.WaitGroup
+	for from := 0; from < len(names); from += chunk {
+		to := from + chunk
+		if to > len(names) {
+			to = len(names)
+		}
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+			decrypt(from, to)
+		}(from, to)
+	}
+	wg.Wait()
+	return res, errs
+}
+
+// fileNameEncodings are the options of FileNameEncoding
+var fileNameEncodings = []string{"base32", "base64", "base32768"}
+
+// DiagnoseName decrypts the remote name with every filename encoding, keeping the other options
+// of the storage, to tell which encoding the name was written with when it doesn't decrypt.
+// the cipher of the storage serves its own encoding, the password is hardened once for the others
+func (d *Crypt) DiagnoseName(name string, isDir bool) ([]NameDecoding, error) {
+	own, err := d.nameCipher()
+	if err != nil {
+		return nil, err
+	}
+	p, p2, err := d.credentials()
+	if err != nil {
+		return nil, err
+	}
+	a := d.additionCopy()
+	if a.Kdf == kdfHardened {
+		if p, err = hardenPassword(p, p2); err != nil {
+			return nil, err
+		}
+		a.Kdf = kdfStandard
+	}
+	ownEncoding := a.FileNameEncoding
+	if ownEncoding == "" {
+		ownEncoding = "base32"
+	}
+	res := make([]NameDecoding, 0, len(fileNameEncodings))
+	for _, encoding := range fileNameEncodings {
+		c := own
+		if encoding != ownEncoding {
+			a.FileNameEncoding = encoding
+			if c, err = newCipher(&a, p, p2); err != nil {
+				return nil, fmt.Errorf("failed to create Cipher: %w", err)
+			}
+		}
+		decoding := NameDecoding{Encoding: encoding}
+		if isDir {
+			decoding.Name, err = c.DecryptDirName(name)
+		} else {
+			decoding.Name, err = c.DecryptFileName(name)
+		}
+		if err != nil {
+			decoding.Error = err.Error()
+		}
+		res = append(res, decoding)
+	}
+	return res, nil
+}
@@ -0,0 +1,109 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alist-org/alist/v3/internal/fs"
+	"github.com/alist-org/alist/v3/internal/model"
+)
+
+// ScanOrphans finds the directories under the remote root that hold nothing the storage can decrypt:
+// directories whose name doesn't decrypt, and directories left with only undecryptable entries,
+// sidecars or such directories. only the topmost directory of an orphaned tree is reported
+func (d *Crypt) ScanOrphans(ctx context.Context) ([]OrphanDir, error) {
+	if err := d.resolve(ctx); err != nil {
+		return nil, err
+	}
+	orphans, _, err := d.scanOrphans(ctx, d.remoteRoot)
+	return orphans, err
+}
+
+// scanOrphans returns the orphans under remoteDir, and whether remoteDir holds anything that decrypts
+func (d *Crypt) scanOrphans(ctx context.Context, remoteDir string) ([]OrphanDir, bool, error) {
+	objs, err := fs.List(ctx, remoteDir, &fs.ListArgs{NoLog: !d.remoteLogs(), Refresh: true})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list %s: %w", remoteDir, err)
+	}
+	var orphans []OrphanDir
+	hasContent := false
+	for _, obj := range objs {
+		objPath := stdpath.Join(remoteDir, obj.GetName())
+		if isReservedName(obj.GetName()) {
+			// the trash is not for the scan to judge, sidecars don't count as content
+			hasContent = hasContent || obj.IsDir()
+			continue
+		}
+		if !obj.IsDir() {
+			hasContent = hasContent || d.decryptable(obj)
+			continue
+		}
+		if !d.dirDecryptable(obj.GetName()) {
+			orphans = append(orphans, OrphanDir{RemotePath: objPath, Foreign: true})
+			continue
+		}
+		subOrphans, subContent, err := d.scanOrphans(ctx, objPath)
+		if err != nil {
+			return nil, false, err
+		}
+		if !subContent {
+			orphans = append(orphans, OrphanDir{RemotePath: objPath})
+			continue
+		}
+		hasContent = true
+		orphans = append(orphans, subOrphans...)
+	}
+	return orphans, hasContent, nil
+}
+
+// decryptable reports whether the remote file obj is shown by List
+func (d *Crypt) decryptable(obj model.Obj) bool {
+	if strings.HasSuffix(obj.GetName(), clearSuffix) {
+		return true
+	}
+	encryptedName, suffix := contentSuffix(obj.GetName())
+	if _, err := d.cipher.DecryptFileName(encryptedName); err != nil {
+		return false
+	}
+	if suffix == plainSuffix {
+		return true
+	}
+	_, err := d.cipher.DecryptedSize(obj.GetSize())
+	return err == nil
+}
+
+// dirDecryptable reports whether the remote directory called name is shown by List,
+// a plaintext directory is judged by what it holds
+func (d *Crypt) dirDecryptable(name string) bool {
+	if _, err := d.cipher.DecryptDirName(name); err == nil {
+		return true
+	}
+	return d.Undecryptable == undecryptablePlainDirs && utf8.ValidString(name)
+}
+
+// PruneOrphans removes the orphaned directories in remotePaths, as reported by ScanOrphans,
+// passing them is the confirmation of the admin. directories that are no longer orphaned are kept
+func (d *Crypt) PruneOrphans(ctx context.Context, remotePaths []string) (int, error) {
+	confirmed := make(map[string]bool)
+	for _, p := range remotePaths {
+		confirmed[p] = true
+	}
+	orphans, err := d.ScanOrphans(ctx)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, orphan := range orphans {
+		if !confirmed[orphan.RemotePath] {
+			continue
+		}
+		if err = fs.Remove(ctx, orphan.RemotePath); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", orphan.RemotePath, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
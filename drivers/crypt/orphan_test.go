@@ -0,0 +1,66 @@
+package crypt
+
+import (
+	"context"
+	"sort"
+	"testing"
+)
+
+func TestOrphans(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	enc := d.cipher.EncryptDirName
+	putFile(t, d, "/dir", "a.txt", testData(10))
+	m.putDir("/" + enc("dir") + "/" + enc("old"))
+	m.putDir("/" + enc("empty"))
+	m.putDir("/" + enc("junk"))
+	m.putFile("/"+enc("junk")+"/garbage.bin", testData(100))
+	m.putDir("/" + enc("nested"))
+	m.putDir("/" + enc("nested") + "/" + enc("inner"))
+	m.putDir("/foreign-dir")
+
+	orphans, err := d.ScanOrphans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, orphan := range orphans {
+		got[orphan.RemotePath] = orphan.Foreign
+	}
+	expect := map[string]bool{
+		remote + "/" + enc("dir") + "/" + enc("old"): false,
+		remote + "/" + enc("empty"):                  false,
+		remote + "/" + enc("junk"):                   false,
+		remote + "/" + enc("nested"):                 false,
+		remote + "/foreign-dir":                      true,
+	}
+	if len(got) != len(expect) {
+		t.Errorf("expect %v, got %v", expect, got)
+	}
+	for p, foreign := range expect {
+		if f, ok := got[p]; !ok || f != foreign {
+			t.Errorf("expect %s to be reported with foreign=%v, got %v", p, foreign, got)
+		}
+	}
+
+	removed, err := d.PruneOrphans(ctx, []string{remote + "/" + enc("empty"), remote + "/" + enc("nested"), remote + "/" + enc("dir")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("expect 2 removed, got %d", removed)
+	}
+	paths := m.paths()
+	sort.Strings(paths)
+	for _, p := range []string{"/" + enc("empty"), "/" + enc("nested")} {
+		if i := sort.SearchStrings(paths, p); i < len(paths) && paths[i] == p {
+			t.Errorf("expect %s to be pruned", p)
+		}
+	}
+	for _, p := range []string{"/" + enc("dir") + "/" + d.cipher.EncryptFileName("a.txt"), "/foreign-dir", "/" + enc("junk")} {
+		if i := sort.SearchStrings(paths, p); i >= len(paths) || paths[i] != p {
+			t.Errorf("expect %s to be kept", p)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+	"sync"
+
+	"github.com/alist-org/alist/v3/internal/fs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+// pagedLister is implemented by the remotes that list a directory in pages. token is empty for the
+// first page, next is the token of the page after objs and empty after the last one
+type pagedLister interface {
+	ListPage(ctx context.Context, dir model.Obj, token string) (objs []model.Obj, next string, err error)
+}
+
+// PartialListingError is returned by List with the objects of the pages listed before the remote
+// failed in the middle of a paginated listing. listing the directory again goes on from the page
+// that failed instead of the first one
+type PartialListingError struct {
+	// Dir is the directory of the remote
+	Dir string
+	// Listed is the number of remote objects listed before the failure
+	Listed int
+	Err    error
+}
+
+func (e *PartialListingError) Error() string {
+	return fmt.Sprintf("listing of %s stopped after %d objects: %v", e.Dir, e.Listed, e.Err)
+}
+
+func (e *PartialListingError) Unwrap() error {
+	return e.Err
+}
+
+// pendingListing is a paginated listing of the remote that stopped, to go on from token
+type pendingListing struct {
+	objs  []model.Obj
+	token string
+}
+
+// pendingListings are the listings that stopped, by remote directory
+type pendingListings struct {
+	mu sync.Mutex
+	m  map[string]pendingListing
+}
+
+// take returns and forgets the listing of dir that stopped, if any
+func (p *pendingListings) take(dir string) ([]model.Obj, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l := p.m[dir]
+	delete(p.m, dir)
+	return l.objs, l.token
+}
+
+func (p *pendingListings) put(dir string, objs []model.Obj, token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.m == nil {
+		p.m = make(map[string]pendingListing)
+	}
+	p.m[dir] = pendingListing{objs: objs, token: token}
+}
+
+// listRemote lists the remote directory remoteDir. a remote listing in pages is listed page by page
+// until the last one, if a page fails after others were listed their objects are returned with a
+// *PartialListingError
+func (d *Crypt) listRemote(ctx context.Context, remoteDir string) ([]model.Obj, error) {
+	pager, ok := d.remoteStorage.(pagedLister)
+	if !ok {
+		return fs.List(ctx, remoteDir, d.remoteListArgs())
+	}
+	storage, actualPath, err := op.GetStorageAndActualPath(remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	if storage != d.remoteStorage {
+		// another storage is mounted inside the remote
+		return fs.List(ctx, remoteDir, d.remoteListArgs())
+	}
+	dir, err := op.GetUnwrap(ctx, storage, actualPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed get dir: %w", err)
+	}
+	objs, token := d.pending.take(remoteDir)
+	for {
+		page, next, err := pager.ListPage(ctx, dir, token)
+		if err != nil {
+			if len(objs) == 0 && token == "" {
+				return nil, fmt.Errorf("failed to list objs: %w", err)
+			}
+			d.pending.put(remoteDir, objs, token)
+			return objs, &PartialListingError{Dir: remoteDir, Listed: len(objs), Err: err}
+		}
+		for _, obj := range page {
+			if s, ok := obj.(model.SetPath); ok && obj.GetPath() == "" && dir.GetPath() != "" {
+				s.SetPath(stdpath.Join(dir.GetPath(), obj.GetName()))
+			}
+		}
+		model.WrapObjsName(page)
+		objs = append(objs, page...)
+		if next == "" {
+			return objs, nil
+		}
+		token = next
+	}
+}
@@ -0,0 +1,81 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func listNames(t *testing.T, objs []model.Obj) []string {
+	t.Helper()
+	var names []string
+	for _, obj := range objs {
+		names = append(names, obj.GetName())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPagedListing(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestPagedRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	var expect []string
+	// the last page is short
+	for i := 0; i < 7; i++ {
+		name := fmt.Sprintf("f%d.txt", i)
+		putFile(t, d, "/", name, testData(10))
+		expect = append(expect, name)
+	}
+	m.pageSize, m.pageTokens = 3, nil
+	objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := listNames(t, objs); !reflect.DeepEqual(names, expect) {
+		t.Fatalf("expect %v, got %v", expect, names)
+	}
+	if tokens := m.pageTokens; !reflect.DeepEqual(tokens, []string{"", "3", "6"}) {
+		t.Errorf("expect 3 pages, got tokens %q", tokens)
+	}
+
+	// the second page fails
+	m.pageFail, m.pageTokens = 2, nil
+	objs, err = d.List(ctx, &model.Object{Path: "/", IsFolder: true}, model.ListArgs{})
+	var partial *PartialListingError
+	if !errors.As(err, &partial) || partial.Listed != 3 {
+		t.Fatalf("expect a partial listing of 3 objects, got %v", err)
+	}
+	if len(objs) != 3 {
+		t.Errorf("expect the 3 objects of the first page, got %v", listNames(t, objs))
+	}
+	// listing again goes on from the page that failed
+	objs, err = d.List(ctx, &model.Object{Path: "/", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := listNames(t, objs); !reflect.DeepEqual(names, expect) {
+		t.Errorf("expect %v, got %v", expect, names)
+	}
+	if tokens := m.pageTokens; !reflect.DeepEqual(tokens, []string{"", "3", "3", "6"}) {
+		t.Errorf("expect the listing to resume at 3, got tokens %q", tokens)
+	}
+
+	m.pageFail = 3
+	if _, err = op.List(ctx, d, "/", model.ListArgs{}, true); !errors.As(err, &partial) {
+		t.Errorf("expect the partial listing error through op.List, got %v", err)
+	}
+	d.pending.take(d.getPathForRemote("/", true))
+
+	// the first page fails, nothing was listed
+	m.pageFail = 1
+	if _, err = d.List(ctx, &model.Object{Path: "/", IsFolder: true}, model.ListArgs{}); err == nil || errors.As(err, &partial) {
+		t.Errorf("expect a plain error, got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package crypt
+
+import "errors"
+
+// ErrPaused is returned by the operations of a storage paused with Pause. it is temporary, the
+// message is one the retries of callers take for a transient failure
+var ErrPaused = errors.New("storage paused for maintenance, temporarily unavailable")
+
+// Pause makes the operations of the storage fail with ErrPaused until Resume, so that a remote under
+// maintenance isn't asked anything. the streams of links got before go on until they end
+func (d *Crypt) Pause() {
+	d.paused.Store(true)
+}
+
+// Resume ends a Pause
+func (d *Crypt) Resume() {
+	d.paused.Store(false)
+}
+
+// Paused reports whether the storage is paused
+func (d *Crypt) Paused() bool {
+	return d.paused.Load()
+}
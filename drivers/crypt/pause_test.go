@@ -0,0 +1,73 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestPause(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(100000)
+	putFile(t, d, "/", "a.txt", data)
+	file, err := d.Get(ctx, "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := d.Link(ctx, file, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer link.RangeReadCloser.Closers.Close()
+	rc, err := link.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	d.Pause()
+	if !d.Paused() {
+		t.Fatal("expect the storage to be paused")
+	}
+	root := &model.Object{Path: "/", IsFolder: true}
+	stream := &model.FileStream{
+		Obj:        &model.Object{Name: "b.txt", Size: 10, Modified: time.Now()},
+		ReadCloser: io.NopCloser(bytes.NewReader(testData(10))),
+	}
+	gated := map[string]error{}
+	_, gated["list"] = d.List(ctx, root, model.ListArgs{})
+	_, gated["get"] = d.Get(ctx, "/a.txt")
+	_, gated["link"] = d.Link(ctx, file, model.LinkArgs{})
+	gated["put"] = d.Put(ctx, root, stream, nil)
+	gated["mkdir"] = d.MakeDir(ctx, root, "dir")
+	gated["remove"] = d.Remove(ctx, file)
+	for op, err := range gated {
+		if !errors.Is(err, ErrPaused) {
+			t.Errorf("expect %s to fail while paused, got %v", op, err)
+		}
+	}
+	if !isTransient(ErrPaused) {
+		t.Errorf("expect the pause error to be retryable")
+	}
+	// the stream opened before the pause finishes
+	got, err := io.ReadAll(rc)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("expect the open stream to finish while paused, got %d bytes, %v", len(got), err)
+	}
+
+	d.Resume()
+	if _, err = d.Get(ctx, "/a.txt"); err != nil {
+		t.Errorf("expect Get to work after resume, got %v", err)
+	}
+	if _, err = d.List(ctx, root, model.ListArgs{}); err != nil {
+		t.Errorf("expect List to work after resume, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdpath "path"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/utils"
+)
+
+// otherUser is the user of the request calling Other, nil for a call not from a request
+func otherUser(ctx context.Context) *model.User {
+	user, _ := ctx.Value("user").(*model.User)
+	return user
+}
+
+// requireAdmin fails unless Other is called by an admin. /fs/other only checks read access, the
+// methods that act on the whole storage or its credentials check the user themselves
+func requireAdmin(ctx context.Context) error {
+	if user := otherUser(ctx); user == nil || !user.IsAdmin() {
+		return fmt.Errorf("%w: admin only", errs.PermissionDenied)
+	}
+	return nil
+}
+
+// requireWrite fails unless Other is called by a user who can write path of this storage, a path
+// under their base path. the write permissions granted by metas aren't taken into account
+func (d *Crypt) requireWrite(ctx context.Context, path string) error {
+	user := otherUser(ctx)
+	if user == nil || !user.CanWrite() {
+		return fmt.Errorf("%w: write permission required", errs.PermissionDenied)
+	}
+	if !utils.IsSubPath(user.BasePath, stdpath.Join(d.GetStorage().MountPath, path)) {
+		return fmt.Errorf("%w: %s is outside the base path", errs.PermissionDenied, path)
+	}
+	return nil
+}
+
+// canRead reports whether user can read path, a path of any storage, with password for the meta
+// protecting it. like /fs/list, only the nearest meta of path is taken into account
+func canRead(user *model.User, path, password string) bool {
+	meta, err := op.GetNearestMeta(path)
+	if err != nil && !errors.Is(err, errs.MetaNotFound) {
+		return false
+	}
+	return op.CanAccess(user, meta, path, password)
+}
+
+// userCanRead returns whether user can read a path of this storage with password, the way /fs/search
+// filters its results
+func (d *Crypt) userCanRead(user *model.User, password string) func(path string) bool {
+	return func(path string) bool {
+		path = stdpath.Join(d.GetStorage().MountPath, path)
+		return utils.IsSubPath(user.BasePath, path) && canRead(user, path, password)
+	}
+}
+
+// readableNodes returns the search nodes of this storage user can read with password
+func (d *Crypt) readableNodes(user *model.User, nodes []model.SearchNode, password string) []model.SearchNode {
+	var res []model.SearchNode
+	readable := d.userCanRead(user, password)
+	for _, node := range nodes {
+		if readable(stdpath.Join(node.Parent, node.Name)) {
+			res = append(res, node)
+		}
+	}
+	return res
+}
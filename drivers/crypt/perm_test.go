@@ -0,0 +1,370 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdpath "path"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/fs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/task"
+)
+
+// userCtx is the context of a request to /fs/other from user
+func userCtx(user *model.User) context.Context {
+	return context.WithValue(context.Background(), "user", user)
+}
+
+var (
+	testAdmin  = &model.User{Role: model.ADMIN, BasePath: "/"}
+	testGuest  = &model.User{Role: model.GUEST, BasePath: "/"}
+	testWriter = &model.User{Role: model.GENERAL, BasePath: "/", Permission: 1 << 3}
+)
+
+func TestOtherAdminOnly(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	putFile(t, d, "/", "a.txt", testData(10))
+	m.mu.Lock()
+	fileID := m.nodes["/"+d.cipher.EncryptFileName("a.txt")].id
+	m.mu.Unlock()
+	root := &model.Object{Path: "/", IsFolder: true}
+	for _, args := range []model.OtherArgs{
+		{Obj: root, Method: "pause"},
+		{Obj: root, Method: "resume"},
+		{Obj: root, Method: "try_credentials", Data: map[string]interface{}{"candidates": []Credentials{{Password: "guess"}}}},
+		{Obj: root, Method: "get_by_id", Data: map[string]string{"id": fileID}},
+		{Obj: root, Method: "rebuild_search_index"},
+		{Obj: root, Method: "count"},
+		{Obj: root, Method: "decrypt_names", Data: map[string]interface{}{"names": []string{d.cipher.EncryptFileName("a.txt")}}},
+		{Obj: root, Method: "diagnose_name", Data: map[string]interface{}{"name": d.cipher.EncryptFileName("a.txt")}},
+	} {
+		for _, ctx := range []context.Context{context.Background(), userCtx(testGuest), userCtx(testWriter)} {
+			if _, err := d.Other(ctx, args); !errors.Is(err, errs.PermissionDenied) {
+				t.Errorf("%s: expect a user other than an admin to be denied, got %v", args.Method, err)
+			}
+		}
+		if _, err := d.Other(userCtx(testAdmin), args); err != nil {
+			t.Errorf("%s: expect an admin to be allowed, got %v", args.Method, err)
+		}
+	}
+	if d.Paused() {
+		t.Error("expect the storage resumed")
+	}
+}
+
+func TestOtherNoCredentialChange(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	password := d.Password
+	_, err := d.Other(userCtx(testAdmin), model.OtherArgs{
+		Obj:    &model.Object{Path: "/", IsFolder: true},
+		Method: "import_rclone",
+		Data:   map[string]string{"password": "guessed"},
+	})
+	if !errors.Is(err, errs.NotSupport) || d.Password != password {
+		t.Errorf("expect the credentials not to be changed through Other, got %v", err)
+	}
+}
+
+func TestOtherImportPermissions(t *testing.T) {
+	src, srcMount := newTestRemote(t, linkModeRange)
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	src.putDir("/docs")
+	src.putFile("/docs/a.txt", testData(1000))
+	src.putFile("/docs/secret.txt", testData(100))
+	meta := &model.Meta{Path: srcMount + "/docs", Password: "pw", PSub: true, Hide: "secret", HSub: true}
+	if err := op.CreateMeta(meta); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = op.DeleteMetaById(meta.ID) })
+	mountPath := d.GetStorage().MountPath
+	importArgs := func(srcPath, password string) model.OtherArgs {
+		return model.OtherArgs{
+			Obj:    &model.Object{Path: "/", IsFolder: true},
+			Method: "import",
+			Data:   map[string]string{"src_path": srcPath, "src_password": password, "dst_dir": "/backup"},
+		}
+	}
+	copier := &model.User{Role: model.GENERAL, BasePath: "/", Permission: 1<<3 | 1<<6}
+
+	if _, err := d.Other(userCtx(testGuest), importArgs(srcMount+"/docs", "pw")); !errors.Is(err, errs.PermissionDenied) {
+		t.Errorf("expect a user who can't write to be denied, got %v", err)
+	}
+	if _, err := d.Other(userCtx(testWriter), importArgs(srcMount+"/docs", "pw")); !errors.Is(err, errs.PermissionDenied) {
+		t.Errorf("expect a user who can't copy to be denied, got %v", err)
+	}
+	outside := &model.User{Role: model.GENERAL, BasePath: srcMount, Permission: 1<<3 | 1<<6}
+	if _, err := d.Other(userCtx(outside), importArgs("/docs", "pw")); !errors.Is(err, errs.PermissionDenied) {
+		t.Errorf("expect an import outside the base path to be denied, got %v", err)
+	}
+	// the source is a path under the base path of the user
+	confined := &model.User{Role: model.GENERAL, BasePath: mountPath, Permission: 1<<3 | 1<<6}
+	if _, err := d.Other(userCtx(confined), importArgs(srcMount+"/docs", "pw")); err == nil {
+		t.Error("expect the source to be looked up under the base path")
+	}
+	if _, err := d.Other(userCtx(copier), importArgs(srcMount+"/docs", "wrong")); !errors.Is(err, errs.PermissionDenied) {
+		t.Errorf("expect a source protected by a password to be denied, got %v", err)
+	}
+	if _, err := d.Other(userCtx(copier), importArgs("/", "")); err == nil {
+		t.Error("expect an import of an ancestor of the storage to be refused")
+	}
+
+	res, err := d.Other(userCtx(copier), importArgs(srcMount+"/docs", "pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported := waitCopyTask(t, res.(ImportTask).ID)
+	if imported.GetErrMsg() != "" {
+		t.Errorf("expect the import to succeed, got %s", imported.GetErrMsg())
+	}
+	if _, err = op.Get(context.Background(), d, "/backup/a.txt"); err != nil {
+		t.Errorf("expect a.txt to be imported, got %v", err)
+	}
+	if _, err = op.Get(context.Background(), d, "/backup/secret.txt"); err == nil {
+		t.Error("expect the file hidden from the user not to be imported")
+	}
+}
+
+func TestOtherSearchPermissions(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"search_index": true})
+	mountPath := d.GetStorage().MountPath
+	for _, dir := range []string{"/pub", "/priv"} {
+		if err := op.MakeDir(context.Background(), d, dir); err != nil {
+			t.Fatal(err)
+		}
+		putFile(t, d, dir, "a.txt", testData(10))
+	}
+	putFile(t, d, "/pub", "hidden_a.txt", testData(10))
+	for _, meta := range []*model.Meta{
+		{Path: mountPath + "/priv", Password: "pw", PSub: true},
+		{Path: mountPath + "/pub", Hide: "hidden", HSub: true},
+	} {
+		if err := op.CreateMeta(meta); err != nil {
+			t.Fatal(err)
+		}
+		id := meta.ID
+		t.Cleanup(func() { _ = op.DeleteMetaById(id) })
+	}
+	search := func(user *model.User, password string) string {
+		t.Helper()
+		res, err := d.Other(userCtx(user), model.OtherArgs{
+			Obj:    &model.Object{Path: "/", IsFolder: true},
+			Method: "search",
+			Data:   map[string]interface{}{"keywords": "a.txt", "password": password},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, node := range res.([]model.SearchNode) {
+			paths = append(paths, stdpath.Join(node.Parent, node.Name))
+		}
+		return fmt.Sprint(paths)
+	}
+
+	for _, c := range []struct {
+		user     *model.User
+		password string
+		expect   string
+	}{
+		{testGuest, "", "[/pub/a.txt]"},
+		{testGuest, "pw", "[/priv/a.txt /pub/a.txt]"},
+		{&model.User{Role: model.GENERAL, BasePath: mountPath + "/priv"}, "pw", "[/priv/a.txt]"},
+		{testAdmin, "", "[/priv/a.txt /pub/a.txt /pub/hidden_a.txt]"},
+	} {
+		if got := search(c.user, c.password); got != c.expect {
+			t.Errorf("%s with %q: expect %s, got %s", c.user.BasePath, c.password, c.expect, got)
+		}
+	}
+	if _, err := d.Other(context.Background(), model.OtherArgs{Obj: &model.Object{Path: "/", IsFolder: true}, Method: "search"}); !errors.Is(err, errs.PermissionDenied) {
+		t.Errorf("expect a search without a user to be denied, got %v", err)
+	}
+}
+
+func TestOtherExportPermissions(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	mountPath := d.GetStorage().MountPath
+	for _, dir := range []string{"/pub/secret", "/priv"} {
+		if err := op.MakeDir(ctx, d, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	putFile(t, d, "/pub", "a.txt", testData(10))
+	putFile(t, d, "/pub/secret", "b.txt", testData(10))
+	putFile(t, d, "/priv", "c.txt", testData(10))
+	for _, meta := range []*model.Meta{
+		{Path: mountPath + "/priv", Password: "pw", PSub: true},
+		{Path: mountPath + "/pub", Hide: "secret", HSub: true},
+	} {
+		if err := op.CreateMeta(meta); err != nil {
+			t.Fatal(err)
+		}
+		id := meta.ID
+		t.Cleanup(func() { _ = op.DeleteMetaById(id) })
+	}
+	export := func(user *model.User, password string) string {
+		t.Helper()
+		res, err := d.Other(userCtx(user), model.OtherArgs{
+			Obj:    &model.Object{Path: "/", IsFolder: true},
+			Method: "export",
+			Data:   map[string]interface{}{"password": password},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, entry := range res.([]ManifestEntry) {
+			paths = append(paths, entry.Path)
+		}
+		sort.Strings(paths)
+		return fmt.Sprint(paths)
+	}
+
+	for _, c := range []struct {
+		user     *model.User
+		password string
+		expect   string
+	}{
+		{testGuest, "", "[/pub /pub/a.txt]"},
+		{testGuest, "pw", "[/priv /priv/c.txt /pub /pub/a.txt]"},
+		{testAdmin, "", "[/priv /priv/c.txt /pub /pub/a.txt /pub/secret /pub/secret/b.txt]"},
+	} {
+		if got := export(c.user, c.password); got != c.expect {
+			t.Errorf("%v with %q: expect %s, got %s", c.user.Role, c.password, c.expect, got)
+		}
+	}
+	if _, err := d.Other(ctx, model.OtherArgs{Obj: &model.Object{Path: "/", IsFolder: true}, Method: "export"}); !errors.Is(err, errs.PermissionDenied) {
+		t.Errorf("expect an export without a user to be denied, got %v", err)
+	}
+}
+
+func TestOtherListDirsPermissions(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	mountPath := d.GetStorage().MountPath
+	for _, dir := range []string{"/pub", "/secret"} {
+		if err := op.MakeDir(ctx, d, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta := &model.Meta{Path: mountPath, Hide: "secret"}
+	if err := op.CreateMeta(meta); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = op.DeleteMetaById(meta.ID) })
+	listDirs := func(user *model.User) string {
+		t.Helper()
+		res, err := d.Other(userCtx(user), model.OtherArgs{Obj: &model.Object{Path: "/", IsFolder: true}, Method: "list_dirs"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, obj := range res.([]model.Obj) {
+			names = append(names, obj.GetName())
+		}
+		sort.Strings(names)
+		return fmt.Sprint(names)
+	}
+	if got := listDirs(testGuest); got != "[pub]" {
+		t.Errorf("expect the hidden directory to be left out, got %s", got)
+	}
+	if got := listDirs(testAdmin); got != "[pub secret]" {
+		t.Errorf("expect an admin to see every directory, got %s", got)
+	}
+	if _, err := d.Other(ctx, model.OtherArgs{Obj: &model.Object{Path: "/", IsFolder: true}, Method: "list_dirs"}); !errors.Is(err, errs.PermissionDenied) {
+		t.Errorf("expect list_dirs without a user to be denied, got %v", err)
+	}
+}
+
+// waitCopyTask waits for the task id of fs.CopyTaskManager to end
+func waitCopyTask(t *testing.T, id uint64) *task.Task[uint64] {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		tsk, ok := fs.CopyTaskManager.Get(id)
+		if !ok {
+			t.Fatalf("task %d not found", id)
+		}
+		if tsk.Done() {
+			return tsk
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("task %d didn't end: %s", id, tsk.GetStatus())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOtherCopyToPermissions(t *testing.T) {
+	_, srcRemote := newTestRemote(t, linkModeRange)
+	_, dstRemote := newTestRemote(t, linkModeRange)
+	src := newTestCrypt(t, srcRemote, nil)
+	dst := newTestCrypt(t, dstRemote, map[string]interface{}{"password": "new password"})
+	putFile(t, src, "/", "a.txt", testData(1000))
+	dstMount := dst.GetStorage().MountPath
+	copyArgs := func(dstMountPath string) model.OtherArgs {
+		return model.OtherArgs{
+			Obj:    &model.Object{Path: "/", IsFolder: true},
+			Method: "copy_to",
+			Data:   map[string]string{"dst_mount_path": dstMountPath, "dst_dir": "/moved"},
+		}
+	}
+
+	if _, err := src.Other(userCtx(testGuest), copyArgs(dstMount)); !errors.Is(err, errs.PermissionDenied) {
+		t.Errorf("expect a user who can't write to be denied, got %v", err)
+	}
+	confined := &model.User{Role: model.GENERAL, BasePath: src.GetStorage().MountPath, Permission: 1 << 3}
+	if _, err := src.Other(userCtx(confined), copyArgs(dstMount)); err == nil {
+		t.Error("expect the destination to be looked up under the base path")
+	}
+	res, err := src.Other(userCtx(testWriter), copyArgs(dstMount))
+	if err != nil || res != (ImportResult{Imported: 1}) {
+		t.Errorf("expect the copy to run for a user who can write, got %+v, %v", res, err)
+	}
+}
+
+func TestOtherWriteRequired(t *testing.T) {
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	putFile(t, d, "/", "a.txt", testData(1000))
+	root := &model.Object{Path: "/", IsFolder: true}
+	file := &model.Object{Path: "/a.txt", Name: "a.txt"}
+	// a user who can write only a directory of the storage
+	subdir := &model.User{Role: model.GENERAL, BasePath: d.GetStorage().MountPath + "/sub", Permission: 1 << 3}
+	for _, args := range []model.OtherArgs{
+		{Obj: root, Method: "scan_orphans"},
+		{Obj: root, Method: "prune_orphans", Data: map[string]interface{}{"remote_paths": []string{}}},
+		{Obj: root, Method: "list_trash"},
+		{Obj: root, Method: "empty_trash"},
+		{Obj: root, Method: "restore_trash", Data: map[string]string{"id": "missing"}},
+		{Obj: file, Method: "set_meta", Data: map[string]interface{}{"tags": []string{"x"}}},
+		{Obj: file, Method: "restore_version", Data: map[string]string{"id": "missing"}},
+		{Obj: root, Method: "plan_put", Data: map[string]interface{}{"name": "b.txt", "size": 1000}},
+		// last, it renames everything
+		{Obj: root, Method: "migrate_names_off"},
+	} {
+		for _, user := range []*model.User{testGuest, subdir} {
+			if _, err := d.Other(userCtx(user), args); !errors.Is(err, errs.PermissionDenied) {
+				t.Errorf("%s: expect a user who can't write the storage to be denied, got %v", args.Method, err)
+			}
+		}
+		if _, err := d.Other(context.Background(), args); !errors.Is(err, errs.PermissionDenied) {
+			t.Errorf("%s: expect a call without a user to be denied, got %v", args.Method, err)
+		}
+		if _, err := d.Other(userCtx(testWriter), args); errors.Is(err, errs.PermissionDenied) {
+			t.Errorf("%s: expect a user who can write to be allowed, got %v", args.Method, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package crypt
+
+import (
+	"context"
+	stdpath "path"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// plainSuffix is appended to the encrypted name of a file whose content is stored without encryption
+const plainSuffix = ".alist_plain"
+
+// clearSuffix is appended to the name of a file stored as it is, name and content,
+// e.g. a README for anyone with access to the remote
+const clearSuffix = ".alist_clear"
+
+// plainObject is a file whose content is stored without encryption, only its name is encrypted unless clear
+type plainObject struct {
+	model.Object
+	clear bool
+}
+
+func isPlainObj(obj model.Obj) bool {
+	_, ok := unwrapObj(obj).(*plainObject)
+	return ok
+}
+
+func isClearObj(obj model.Obj) bool {
+	plain, ok := unwrapObj(obj).(*plainObject)
+	return ok && plain.clear
+}
+
+type clearUploadKey struct{}
+
+// WithClearUpload makes the uploads to Crypt storages with the returned context stored as they are,
+// name and content, under the name of the upload with the suffix .alist_clear
+func WithClearUpload(ctx context.Context) context.Context {
+	return context.WithValue(ctx, clearUploadKey{}, true)
+}
+
+func isClearUpload(ctx context.Context) bool {
+	ok, _ := ctx.Value(clearUploadKey{}).(bool)
+	return ok
+}
+
+// isPlainExt reports whether new files named name are stored without content encryption
+func (d *Crypt) isPlainExt(name string) bool {
+	ext := utils.Ext(name)
+	if ext == "" {
+		return false
+	}
+	for _, plainExt := range strings.Split(d.PlainExtensions, ",") {
+		if strings.ToLower(strings.TrimPrefix(strings.TrimSpace(plainExt), ".")) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// getObjActualPathForRemote is getActualPathForRemote for an object got from the driver,
+// which knows how the content of the object is stored
+func (d *Crypt) getObjActualPathForRemote(obj model.Obj) (string, error) {
+	if isClearObj(obj) {
+		dirActualPath, err := d.getActualPathForRemote(stdpath.Dir(obj.GetPath()), true)
+		if err != nil {
+			return "", err
+		}
+		return stdpath.Join(dirActualPath, obj.GetName()+clearSuffix), nil
+	}
+	if isIncompleteObj(obj) {
+		return d.getActualPathForRemote(strings.TrimSuffix(obj.GetPath(), incompleteSuffix), false)
+	}
+	remoteActualPath, err := d.getActualPathForRemote(obj.GetPath(), obj.IsDir())
+	if err != nil {
+		return "", err
+	}
+	if isPlainObj(obj) {
+		remoteActualPath += plainSuffix
+	} else if isCompressedObj(obj) {
+		remoteActualPath = compressedName(remoteActualPath, obj.GetSize())
+	} else if dedup, ok := dedupObjOf(obj); ok {
+		remoteActualPath = dedupName(remoteActualPath, dedup.contentHash)
+	}
+	return remoteActualPath, nil
+}
+
+// remoteFileName is the name in the remote of the file obj called name, encryptedName is the encrypted name
+func (d *Crypt) remoteFileName(obj model.Obj, name, encryptedName string) string {
+	if isClearObj(obj) {
+		return name + clearSuffix
+	}
+	if isPlainObj(obj) {
+		return encryptedName + plainSuffix
+	}
+	if isCompressedObj(obj) {
+		return compressedName(encryptedName, obj.GetSize())
+	}
+	if dedup, ok := dedupObjOf(obj); ok {
+		return dedupName(encryptedName, dedup.contentHash)
+	}
+	if isIncompleteObj(obj) {
+		return d.cipher.EncryptFileName(strings.TrimSuffix(name, incompleteSuffix))
+	}
+	return encryptedName
+}
+
+// removeStale removes the old file replaced by an upload stored under another name, best effort
+func (d *Crypt) removeStale(ctx context.Context, old model.Obj) {
+	remoteActualPath, err := d.getObjActualPathForRemote(old)
+	if err == nil {
+		err = op.Remove(ctx, d.remoteStorage, remoteActualPath)
+	}
+	if err != nil {
+		log.Warnf("failed to remove the replaced file %s: %s", old.GetPath(), err)
+	}
+}
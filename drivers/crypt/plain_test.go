@@ -0,0 +1,113 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestPlainExtensions(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"plain_extensions": "7z, .GPG"})
+	archive, text := testData(1000), testData(2000)
+	putFile(t, d, "/", "a.7z", archive)
+	putFile(t, d, "/", "b.txt", text)
+
+	if stored, ok := m.read("/" + d.cipher.EncryptFileName("a.7z") + plainSuffix); !ok || !bytes.Equal(stored, archive) {
+		t.Errorf("expect a.7z to be stored verbatim, got %v", m.paths())
+	}
+	if stored, ok := m.read("/" + d.cipher.EncryptFileName("b.txt")); !ok || bytes.Equal(stored, text) {
+		t.Errorf("expect b.txt to be encrypted")
+	}
+
+	objs, err := op.List(ctx, d, "/", model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := make(map[string]int64)
+	for _, obj := range objs {
+		sizes[obj.GetName()] = obj.GetSize()
+	}
+	if sizes["a.7z"] != 1000 || sizes["b.txt"] != 2000 {
+		t.Errorf("unexpected listing %v", sizes)
+	}
+
+	if got := readRange(t, d, "/a.7z", http_range.Range{Start: 100, Length: 50}); !bytes.Equal(got, archive[100:150]) {
+		t.Errorf("ranged read mismatch of a.7z")
+	}
+	if got := readRange(t, d, "/b.txt", http_range.Range{Length: -1}); !bytes.Equal(got, text) {
+		t.Errorf("read mismatch of b.txt")
+	}
+
+	if err := op.Rename(ctx, d, "/a.7z", "c.7z"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRange(t, d, "/c.7z", http_range.Range{Length: -1}); !bytes.Equal(got, archive) {
+		t.Errorf("read mismatch of renamed c.7z")
+	}
+}
+
+func TestClearFiles(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"plain_extensions": "7z"})
+	if err := op.MakeDir(ctx, d, "/docs"); err != nil {
+		t.Fatal(err)
+	}
+	readme, text, archive := []byte("read me first"), testData(2000), testData(1000)
+	err := op.Put(WithClearUpload(ctx), d, "/docs", &model.FileStream{
+		Obj:        &model.Object{Name: "README.md", Size: int64(len(readme)), Modified: time.Now()},
+		ReadCloser: io.NopCloser(bytes.NewReader(readme)),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, d, "/docs", "a.txt", text)
+	putFile(t, d, "/docs", "b.7z", archive)
+
+	remoteDir := "/" + d.cipher.EncryptDirName("docs")
+	if stored, ok := m.read(remoteDir + "/README.md" + clearSuffix); !ok || !bytes.Equal(stored, readme) {
+		t.Errorf("expect README.md to be stored as it is, got %v", m.paths())
+	}
+	objs, err := op.List(ctx, d, "/docs", model.ListArgs{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := make(map[string]int64)
+	for _, obj := range objs {
+		sizes[obj.GetName()] = obj.GetSize()
+	}
+	if len(sizes) != 3 || sizes["README.md"] != int64(len(readme)) || sizes["a.txt"] != 2000 || sizes["b.7z"] != 1000 {
+		t.Errorf("unexpected listing %v", sizes)
+	}
+	for path, data := range map[string][]byte{"/docs/README.md": readme, "/docs/a.txt": text, "/docs/b.7z": archive} {
+		if got := readRange(t, d, path, http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+			t.Errorf("read mismatch of %s", path)
+		}
+	}
+	if got := readRange(t, d, "/docs/README.md", http_range.Range{Start: 5, Length: 2}); string(got) != "me" {
+		t.Errorf("ranged read mismatch of README.md, got %q", got)
+	}
+
+	if err = op.Rename(ctx, d, "/docs/README.md", "READ.md"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.read(remoteDir + "/READ.md" + clearSuffix); !ok {
+		t.Errorf("expect a renamed clear file to stay clear, got %v", m.paths())
+	}
+	// an upload without the flag replaces the clear file by an encrypted one
+	putFile(t, d, "/docs", "READ.md", readme)
+	if _, ok := m.read(remoteDir + "/READ.md" + clearSuffix); ok {
+		t.Errorf("expect the clear file to be replaced, got %v", m.paths())
+	}
+	if got := readRange(t, d, "/docs/READ.md", http_range.Range{Length: -1}); !bytes.Equal(got, readme) {
+		t.Errorf("read mismatch of the replaced READ.md")
+	}
+}
@@ -0,0 +1,82 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	stdpath "path"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+// RangeProbe options
+const (
+	rangeProbeWarn   = "warn"
+	rangeProbeRefuse = "refuse"
+)
+
+// ErrNoRange is returned by Init when the remote can't read ranges and RangeProbe is refuse
+var ErrNoRange = errors.New("the remote storage can't read ranges, every read would download the file from its start")
+
+// probeRange checks once that the remote reads ranges of a file of the remote root, decrypting a seek
+// or a part of a file needs them. a root without files can't tell, it is taken as supporting them
+func (d *Crypt) probeRange(ctx context.Context) error {
+	if d.RangeProbe != rangeProbeWarn && d.RangeProbe != rangeProbeRefuse {
+		return nil
+	}
+	ranged, err := d.rangeSupported(ctx)
+	if err != nil {
+		d.logger().Debugf("range probe skipped: %s", err)
+		return nil
+	}
+	if ranged {
+		return nil
+	}
+	d.caps.noRange()
+	if d.RangeProbe == rangeProbeRefuse {
+		return fmt.Errorf("%w: %s", ErrNoRange, d.RemotePath)
+	}
+	d.logger().Warnf("%s, seeking and partial reads of %s will be slow", ErrNoRange, d.RemotePath)
+	return nil
+}
+
+// rangeSupported asks the remote for a range of the first file of the remote root
+func (d *Crypt) rangeSupported(ctx context.Context) (bool, error) {
+	root, err := d.getActualPathForRemote("/", true)
+	if err != nil {
+		return false, err
+	}
+	objs, err := op.List(ctx, d.remoteStorage, root, model.ListArgs{})
+	if err != nil {
+		return false, err
+	}
+	for _, obj := range objs {
+		if obj.IsDir() || obj.GetSize() < 2 {
+			continue
+		}
+		link, _, err := op.Link(ctx, d.remoteStorage, stdpath.Join(root, obj.GetName()), model.LinkArgs{})
+		if err != nil {
+			return false, err
+		}
+		if link.ReadSeekCloser != nil {
+			_ = link.ReadSeekCloser.Close()
+			return true, nil
+		}
+		if link.RangeReadCloser.RangeReader != nil {
+			return true, nil
+		}
+		if len(link.URL) == 0 {
+			return false, nil
+		}
+		response, err := requestRangedHttp(ctx, nil, &model.Link{URL: link.URL, Header: d.remoteHeader(nil, link.Header)}, 1, 1)
+		if err != nil {
+			return false, err
+		}
+		_ = response.Body.Close()
+		encoding := response.Header.Get("Content-Encoding")
+		return response.StatusCode == http.StatusPartialContent && (encoding == "" || encoding == "identity"), nil
+	}
+	return false, errors.New("no file in the remote root")
+}
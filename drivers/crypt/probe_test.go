@@ -0,0 +1,44 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRangeProbe(t *testing.T) {
+	m, remotePath := newTestRemote(t, linkModeURL)
+	m.noRange = true
+	m.putFile("/file", testData(100))
+
+	var buf bytes.Buffer
+	out := log.StandardLogger().Out
+	log.SetOutput(&buf)
+	d := newTestCrypt(t, remotePath, map[string]interface{}{"range_probe": "warn"})
+	log.SetOutput(out)
+	if n := strings.Count(buf.String(), ErrNoRange.Error()); n != 1 {
+		t.Errorf("expect one warning at init, got %d in %q", n, buf.String())
+	}
+	if d.caps.noRange() {
+		t.Errorf("expect the probe to record that the remote can't read ranges")
+	}
+
+	if _, err := createTestCrypt(t, remotePath, map[string]interface{}{"range_probe": "refuse"}); !errors.Is(err, ErrNoRange) {
+		t.Errorf("expect refuse to fail the mount with ErrNoRange, got %v", err)
+	}
+
+	m.noRange = false
+	buf.Reset()
+	log.SetOutput(&buf)
+	_, err := createTestCrypt(t, remotePath, map[string]interface{}{"range_probe": "refuse"})
+	log.SetOutput(out)
+	if err != nil {
+		t.Errorf("expect a remote reading ranges to mount, got %v", err)
+	}
+	if strings.Contains(buf.String(), ErrNoRange.Error()) {
+		t.Errorf("expect no warning for a remote reading ranges, got %q", buf.String())
+	}
+}
@@ -0,0 +1,105 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+type copyProgressKey struct{}
+
+// WithCopyProgress makes Copy and Move of Crypt storages with the returned context report their
+// progress to fn. a directory is then copied file by file, to report after each one. a move is a
+// single move of the remote which moves no bytes, it is reported done at once
+func WithCopyProgress(ctx context.Context, fn func(CopyProgress)) context.Context {
+	return context.WithValue(ctx, copyProgressKey{}, fn)
+}
+
+func copyProgressOf(ctx context.Context) func(CopyProgress) {
+	fn, _ := ctx.Value(copyProgressKey{}).(func(CopyProgress))
+	return fn
+}
+
+// treeEntry is an object of a tree to copy, with the directory it goes to
+type treeEntry struct {
+	obj     model.Obj
+	srcPath string
+	dstDir  string
+}
+
+// walkTree adds the directories and files under srcPath to dirs and files, they go under dstPath
+func (d *Crypt) walkTree(ctx context.Context, srcPath, dstPath string, dirs, files *[]treeEntry) error {
+	objs, err := op.List(ctx, d, srcPath, model.ListArgs{})
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", srcPath, err)
+	}
+	for _, obj := range objs {
+		entry := treeEntry{obj: obj, srcPath: stdpath.Join(srcPath, obj.GetName()), dstDir: dstPath}
+		if !obj.IsDir() {
+			*files = append(*files, entry)
+			continue
+		}
+		*dirs = append(*dirs, entry)
+		if err = d.walkTree(ctx, entry.srcPath, stdpath.Join(dstPath, obj.GetName()), dirs, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTree copies the directory srcObj into dstDir one file at a time, reporting to fn after each.
+// only what the listing shows is copied, names that don't decrypt are left behind
+func (d *Crypt) copyTree(ctx context.Context, srcObj, dstDir model.Obj, fn func(CopyProgress)) error {
+	root := treeEntry{obj: srcObj, srcPath: srcObj.GetPath(), dstDir: dstDir.GetPath()}
+	dirs, files := []treeEntry{root}, []treeEntry(nil)
+	if err := d.walkTree(ctx, root.srcPath, stdpath.Join(root.dstDir, srcObj.GetName()), &dirs, &files); err != nil {
+		return err
+	}
+	progress := CopyProgress{TotalFiles: len(files)}
+	for _, file := range files {
+		progress.TotalBytes += file.obj.GetSize()
+	}
+	fn(progress)
+	// the copies of the files are not reported again
+	ctx = WithCopyProgress(ctx, nil)
+	for _, dir := range dirs {
+		if err := op.MakeDir(ctx, d, stdpath.Join(dir.dstDir, dir.obj.GetName())); err != nil {
+			return err
+		}
+		d.syncSidecar(ctx, dir.obj, func(sidecarPath string) error {
+			dstRemoteActualPath, err := d.getActualPathForRemote(dir.dstDir, true)
+			if err != nil {
+				return err
+			}
+			return op.Copy(ctx, d.remoteStorage, sidecarPath, dstRemoteActualPath)
+		})
+	}
+	for _, file := range files {
+		if err := op.Copy(ctx, d, file.srcPath, file.dstDir); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", file.srcPath, err)
+		}
+		progress.Files++
+		progress.Bytes += file.obj.GetSize()
+		fn(progress)
+	}
+	return nil
+}
+
+// treeProgress is the progress of copying or moving srcObj before it starts
+func (d *Crypt) treeProgress(ctx context.Context, srcObj model.Obj) (CopyProgress, error) {
+	if !srcObj.IsDir() {
+		return CopyProgress{TotalFiles: 1, TotalBytes: srcObj.GetSize()}, nil
+	}
+	var dirs, files []treeEntry
+	if err := d.walkTree(ctx, srcObj.GetPath(), "", &dirs, &files); err != nil {
+		return CopyProgress{}, err
+	}
+	progress := CopyProgress{TotalFiles: len(files)}
+	for _, file := range files {
+		progress.TotalBytes += file.obj.GetSize()
+	}
+	return progress, nil
+}
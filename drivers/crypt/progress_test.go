@@ -0,0 +1,68 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestCopyProgress(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"meta_sidecar": true})
+	for _, dir := range []string{"/src/sub/deeper", "/dst", "/moved"} {
+		if err := op.MakeDir(ctx, d, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string][]byte{"/src/a.txt": testData(100), "/src/sub/b.txt": testData(200), "/src/sub/deeper/c.txt": testData(300)}
+	putFile(t, d, "/src", "a.txt", files["/src/a.txt"])
+	putFile(t, d, "/src/sub", "b.txt", files["/src/sub/b.txt"])
+	putFile(t, d, "/src/sub/deeper", "c.txt", files["/src/sub/deeper/c.txt"])
+	if err := d.SetMeta(ctx, "/src/sub", true, &ObjMeta{Description: "sub"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []CopyProgress
+	progressCtx := WithCopyProgress(ctx, func(p CopyProgress) { reports = append(reports, p) })
+	if err := op.Copy(progressCtx, d, "/src", "/dst"); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 4 {
+		t.Fatalf("expect a report before the copy and after each file, got %+v", reports)
+	}
+	var bytesDone int64
+	for i, p := range reports {
+		if p.Files != i || p.TotalFiles != 3 || p.TotalBytes != 600 || p.Bytes < bytesDone {
+			t.Errorf("unexpected report %d: %+v", i, p)
+		}
+		bytesDone = p.Bytes
+	}
+	if bytesDone != 600 {
+		t.Errorf("expect all bytes done, got %d", bytesDone)
+	}
+	for path, data := range files {
+		copied := "/dst" + path
+		if got := readRange(t, d, copied, http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+			t.Errorf("read mismatch of %s", copied)
+		}
+	}
+	if meta, err := d.GetMeta(ctx, "/dst/src/sub", true); err != nil || meta.Description != "sub" {
+		t.Errorf("expect the sidecar of a directory to be copied, got %+v, %v", meta, err)
+	}
+
+	reports = nil
+	if err := op.Move(progressCtx, d, "/dst/src", "/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || reports[0] != (CopyProgress{TotalFiles: 3, TotalBytes: 600}) ||
+		reports[1] != (CopyProgress{Files: 3, TotalFiles: 3, Bytes: 600, TotalBytes: 600}) {
+		t.Errorf("expect a move to be reported done at once, got %+v", reports)
+	}
+	if got := readRange(t, d, "/moved/src/sub/deeper/c.txt", http_range.Range{Length: -1}); !bytes.Equal(got, files["/src/sub/deeper/c.txt"]) {
+		t.Errorf("read mismatch of the moved file")
+	}
+}
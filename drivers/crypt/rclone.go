@@ -0,0 +1,114 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+)
+
+// applyRclone sets the fields of a from the options of an rclone crypt remote, as written in rclone.conf.
+// options rclone doesn't write to the config get rclone's defaults
+func (a *Addition) applyRclone(conf map[string]string) error {
+	if t, ok := conf["type"]; ok && t != "crypt" {
+		return fmt.Errorf("not an rclone crypt remote: type %s", t)
+	}
+	if conf["password"] == "" {
+		return fmt.Errorf("rclone config has no password")
+	}
+	for _, key := range []string{"password", "password2"} {
+		if conf[key] == "" {
+			continue
+		}
+		if _, err := obscure.Reveal(conf[key]); err != nil {
+			return fmt.Errorf("rclone config has an invalid %s, it must be obscured as in rclone.conf: %w", key, err)
+		}
+	}
+	if conf["no_data_encryption"] == "true" {
+		return fmt.Errorf("rclone remotes with no_data_encryption are not supported")
+	}
+	option := func(key, defaultValue string, options ...string) (string, error) {
+		value, ok := conf[key]
+		if !ok {
+			return defaultValue, nil
+		}
+		for _, option := range options {
+			if strings.EqualFold(value, option) {
+				return option, nil
+			}
+		}
+		return "", fmt.Errorf("unsupported rclone %s: %s", key, value)
+	}
+	var err error
+	if a.FileNameEnc, err = option("filename_encryption", "standard", "off", "standard", "obfuscate"); err != nil {
+		return err
+	}
+	if a.DirNameEnc, err = option("directory_name_encryption", "true", "false", "true"); err != nil {
+		return err
+	}
+	if a.FileNameEncoding, err = option("filename_encoding", "base32", "base32", "base64", "base32768"); err != nil {
+		return err
+	}
+	a.EncryptedSuffix = ".bin"
+	if suffix, ok := conf["suffix"]; ok {
+		if suffix == "none" {
+			return fmt.Errorf("rclone suffix none is not supported")
+		}
+		a.EncryptedSuffix = suffix
+	}
+	a.Password = obfuscatedPrefix + conf["password"]
+	a.Salt = ""
+	if conf["password2"] != "" {
+		a.Salt = obfuscatedPrefix + conf["password2"]
+	}
+	// rclone only knows its own key derivation
+	a.Kdf, a.KdfApplied = kdfStandard, kdfStandard
+	return nil
+}
+
+// ImportRclone configures the storage from the options of an rclone crypt remote, as written in rclone.conf.
+// the config is only applied if it can decrypt what is in the remote root. it replaces the credentials
+// of the storage, so it isn't offered through Other, whose callers only need read access
+func (d *Crypt) ImportRclone(ctx context.Context, conf map[string]string) error {
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	if d.EncryptRemotePath {
+		return fmt.Errorf("can't import an rclone config to a storage whose remote_path is encrypted")
+	}
+	if d.key.loaded {
+		return fmt.Errorf("can't import an rclone config to a storage whose password is read from key_file, key_env or key_ref")
+	}
+	a := d.additionCopy()
+	if err := a.applyRclone(conf); err != nil {
+		return err
+	}
+	p, _ := strings.CutPrefix(a.Password, obfuscatedPrefix)
+	p2, _ := strings.CutPrefix(a.Salt, obfuscatedPrefix)
+	c, err := newCipher(&a, p, p2)
+	if err != nil {
+		return fmt.Errorf("failed to create Cipher: %w", err)
+	}
+	objs, err := fs.List(ctx, d.getPathForRemote("/", true), d.remoteListArgs())
+	if err != nil {
+		return fmt.Errorf("failed to list remote: %w", err)
+	}
+	if err = checkDecryptable(c, objs); err != nil {
+		return fmt.Errorf("rclone config is not compatible with %s: %w", d.RemotePath, err)
+	}
+	if err = a.storeCredentials(); err != nil {
+		return err
+	}
+	d.formatsMu.Lock()
+	a.FormatsApplied = d.FormatsApplied
+	d.Addition = a
+	d.formatsMu.Unlock()
+	if err = d.setCipher(c, p, p2); err != nil {
+		return err
+	}
+	d.index.reset()
+	d.save()
+	return nil
+}
@@ -0,0 +1,147 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
+)
+
+func TestImportRclone(t *testing.T) {
+	conf := map[string]string{
+		"type":              "crypt",
+		"remote":            "gdrive:encrypted",
+		"password":          obscure.MustObscure("rclone password"),
+		"password2":         obscure.MustObscure("rclone salt"),
+		"filename_encoding": "base64",
+	}
+	// a file written by rclone with the config above, defaults included
+	rcloneConf := configmap.Simple{
+		"filename_encryption":       "standard",
+		"directory_name_encryption": "true",
+		"suffix":                    ".bin",
+	}
+	for k, v := range conf {
+		rcloneConf[k] = v
+	}
+	c, err := rcCrypt.NewCipher(rcloneConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := testData(5000)
+	encrypted, err := c.EncryptData(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := io.ReadAll(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, remote := newTestRemote(t, linkModeRange)
+	m.putDir("/" + c.EncryptDirName("photos"))
+	m.putFile("/"+c.EncryptDirName("photos")+"/"+c.EncryptFileName("a.jpg"), ciphertext)
+
+	d := newTestCrypt(t, remote, nil)
+	if err := d.ImportRclone(context.Background(), map[string]string{"password": obscure.MustObscure("wrong")}); err == nil || !strings.Contains(err.Error(), "not compatible") {
+		t.Errorf("expect a wrong password to be refused, got %v", err)
+	}
+	if err := d.ImportRclone(context.Background(), map[string]string{"password": conf["password"], "suffix": "none"}); err == nil {
+		t.Errorf("expect suffix none to be refused")
+	}
+	if err := d.ImportRclone(context.Background(), conf); err != nil {
+		t.Fatal(err)
+	}
+	if d.FileNameEnc != "standard" || d.DirNameEnc != "true" || d.FileNameEncoding != "base64" || d.EncryptedSuffix != ".bin" {
+		t.Errorf("unexpected addition %+v", d.Addition)
+	}
+	if got := readRange(t, d, "/photos/a.jpg", http_range.Range{Start: 1000, Length: 100}); !bytes.Equal(got, data[1000:1100]) {
+		t.Errorf("read mismatch of the rclone file")
+	}
+}
+
+// TestRcloneInterop checks files are laid out the same as by rclone's own crypt remote,
+// block for block, in both directions
+func TestRcloneInterop(t *testing.T) {
+	const blockSize = 64 * 1024
+	sizes := []int{0, 1, 100, blockSize - 1, blockSize, blockSize + 1, 3*blockSize + 17}
+	for _, encoding := range []string{"base32", "base64", "base32768"} {
+		for _, linkMode := range []string{linkModeRange, linkModeURL} {
+			c, err := rcCrypt.NewCipher(configmap.Simple{
+				"password":                  obscure.MustObscure("password"),
+				"password2":                 obscure.MustObscure("salt"),
+				"filename_encryption":       "standard",
+				"directory_name_encryption": "true",
+				"filename_encoding":         encoding,
+				"suffix":                    ".bin",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, remote := newTestRemote(t, linkMode)
+			d := newTestCrypt(t, remote, map[string]interface{}{"filename_encoding": encoding})
+			remoteDir := "/" + c.EncryptDirName("dir")
+			m.putDir(remoteDir)
+			for _, size := range sizes {
+				data := testData(size)
+				name := fmt.Sprintf("rclone %d.dat", size)
+				encrypted, err := c.EncryptData(bytes.NewReader(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				ciphertext, err := io.ReadAll(encrypted)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m.putFile(remoteDir+"/"+c.EncryptFileName(name), ciphertext)
+
+				obj, err := op.Get(context.Background(), d, "/dir/"+name)
+				if err != nil {
+					t.Fatalf("%s %s: rclone file not found: %v", encoding, linkMode, err)
+				}
+				if obj.GetSize() != int64(size) {
+					t.Errorf("%s %s: size of %s is %d", encoding, linkMode, name, obj.GetSize())
+				}
+				for _, offset := range []int{0, 1, blockSize - 1, blockSize, size / 2, size - 1} {
+					if offset < 0 || offset >= size {
+						continue
+					}
+					length := 2*blockSize + 3
+					if offset+length > size {
+						length = size - offset
+					}
+					got := readRange(t, d, "/dir/"+name, http_range.Range{Start: int64(offset), Length: int64(length)})
+					if !bytes.Equal(got, data[offset:offset+length]) {
+						t.Errorf("%s %s: read mismatch of %s at %d", encoding, linkMode, name, offset)
+					}
+				}
+
+				// and the other way round
+				name = fmt.Sprintf("alist %d.dat", size)
+				putFile(t, d, "/dir", name, data)
+				stored, ok := m.read(remoteDir + "/" + c.EncryptFileName(name))
+				if !ok {
+					t.Fatalf("%s %s: %s is not where rclone looks for it, got %v", encoding, linkMode, name, m.paths())
+				}
+				decrypted, err := c.DecryptData(io.NopCloser(bytes.NewReader(stored)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				plaintext, err := io.ReadAll(decrypted)
+				if err != nil || !bytes.Equal(plaintext, data) {
+					t.Errorf("%s %s: rclone can't decrypt %s: %v", encoding, linkMode, name, err)
+				}
+				if decryptedSize, err := c.DecryptedSize(int64(len(stored))); err != nil || decryptedSize != int64(size) {
+					t.Errorf("%s %s: unexpected encrypted size %d of %s", encoding, linkMode, len(stored), name)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+// OpenReader returns a seekable reader of the decrypted content of file, for consumers in the same
+// process that seek around, like a transcoder. the remote is read through the same pipeline as Link,
+// a seek closes the remote stream and the next read opens it at the block of the new offset
+func (d *Crypt) OpenReader(ctx context.Context, file model.Obj) (io.ReadSeekCloser, error) {
+	link, size, err := d.sizedLink(ctx, model.UnwrapObj(file), model.LinkArgs{})
+	if err != nil {
+		return nil, err
+	}
+	return &decryptedReader{link: link, size: size}, nil
+}
+
+type decryptedReader struct {
+	link   *model.Link
+	size   int64
+	offset int64
+	// rc reads from offset, it is opened on the first read after a seek
+	rc     io.ReadCloser
+	closed bool
+}
+
+func (r *decryptedReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.rc == nil {
+		rc, err := r.link.RangeReadCloser.RangeReader(http_range.Range{Start: r.offset, Length: -1})
+		if err != nil {
+			return 0, err
+		}
+		r.rc = rc
+	}
+	n, err := r.rc.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *decryptedReader) Seek(offset int64, whence int) (int64, error) {
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != r.offset && r.rc != nil {
+		_ = r.rc.Close()
+		r.rc = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *decryptedReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	var err error
+	if r.rc != nil {
+		err = r.rc.Close()
+	}
+	return errors.Join(err, r.link.RangeReadCloser.Closers.Close())
+}
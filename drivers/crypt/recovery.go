@@ -0,0 +1,139 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/fs"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/utils"
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+	"github.com/rclone/rclone/fs/config/obscure"
+)
+
+// credentialSampleSize is the most remote names TryCredentials decrypts with each candidate,
+// credentialSampleDirs the most remote directories it lists to find them
+const (
+	credentialSampleSize = 20
+	credentialSampleDirs = 10
+)
+
+// TryCredentials decrypts a sample of the names on the remote with each candidate password and salt,
+// keeping the other options of the storage, to recover the credentials of a store.
+// the storage is left as it is, and it doesn't have to be initialized
+func (d *Crypt) TryCredentials(ctx context.Context, candidates []Credentials) ([]CredentialResult, error) {
+	if d.FileNameEnc != "standard" {
+		// obfuscated names decode with any key
+		return nil, fmt.Errorf("only names encrypted with filename_encryption standard can tell the credentials")
+	}
+	res := make([]CredentialResult, 0, len(candidates))
+	for i, candidate := range candidates {
+		password, err := obscure.Obscure(candidate.Password)
+		if err != nil {
+			return nil, err
+		}
+		salt, err := obscure.Obscure(candidate.Salt)
+		if err != nil {
+			return nil, err
+		}
+		c, err := newCipher(&d.Addition, password, salt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Cipher for candidate %d: %w", i, err)
+		}
+		root, err := d.candidateRoot(c)
+		if err != nil {
+			return nil, err
+		}
+		names, err := d.sampleNames(ctx, root)
+		if err != nil {
+			return nil, err
+		}
+		result := CredentialResult{Index: i, Total: len(names)}
+		for _, name := range names {
+			if decryptSampleName(c, name) {
+				result.Decrypted++
+			}
+		}
+		result.Match = result.Total > 0 && result.Decrypted == result.Total
+		res = append(res, result)
+	}
+	return res, nil
+}
+
+// CheckCredentials tells whether credentials decrypt a sample of the names under the remote of a,
+// to test them before a storage is created. nothing is mounted or saved, a only needs the options
+// that find the remote and build the cipher. a result with Total 0 means the remote has no names to tell
+func CheckCredentials(ctx context.Context, a Addition, credentials Credentials) (CredentialResult, error) {
+	if _, err := fs.GetStorage(a.RemotePath, &fs.GetStoragesArgs{}); err != nil {
+		return CredentialResult{}, fmt.Errorf("can't find remote storage: %w", err)
+	}
+	res, err := (&Crypt{Addition: a}).TryCredentials(ctx, []Credentials{credentials})
+	if err != nil {
+		return CredentialResult{}, err
+	}
+	return res[0], nil
+}
+
+// candidateRoot is the remote root of the storage if c were its cipher
+func (d *Crypt) candidateRoot(c *rcCrypt.Cipher) (string, error) {
+	if !d.EncryptRemotePath {
+		return d.RemotePath, nil
+	}
+	storage, actualPath, err := op.GetStorageAndActualPath(d.RemotePath)
+	if err != nil {
+		return "", fmt.Errorf("can't find remote storage: %w", err)
+	}
+	return stdpath.Join(utils.GetActualMountPath(storage.GetStorage().MountPath), c.EncryptDirName(actualPath)), nil
+}
+
+// sampleName is a remote name found by sampleNames
+type sampleName struct {
+	name  string
+	isDir bool
+}
+
+// sampleNames returns up to credentialSampleSize of the encrypted names under the remote directory root,
+// breadth first. the names the driver stores as they are, and plain directory names, are skipped
+func (d *Crypt) sampleNames(ctx context.Context, root string) ([]sampleName, error) {
+	var names []sampleName
+	dirs := []string{root}
+	for listed := 0; len(dirs) > 0 && listed < credentialSampleDirs && len(names) < credentialSampleSize; listed++ {
+		dir := dirs[0]
+		dirs = dirs[1:]
+		objs, err := fs.List(ctx, dir, d.remoteListArgs())
+		if err != nil {
+			if listed == 0 {
+				return nil, fmt.Errorf("failed to list remote: %w", err)
+			}
+			continue
+		}
+		for _, obj := range objs {
+			if isReservedName(obj.GetName()) || strings.HasSuffix(obj.GetName(), clearSuffix) {
+				continue
+			}
+			if obj.IsDir() {
+				dirs = append(dirs, stdpath.Join(dir, obj.GetName()))
+				if d.DirNameEnc != "true" {
+					continue
+				}
+			}
+			if len(names) < credentialSampleSize {
+				name, _ := contentSuffix(obj.GetName())
+				names = append(names, sampleName{name: name, isDir: obj.IsDir()})
+			}
+		}
+	}
+	return names, nil
+}
+
+func decryptSampleName(c *rcCrypt.Cipher, name sampleName) bool {
+	var err error
+	if name.isDir {
+		_, err = c.DecryptDirName(name.name)
+	} else {
+		_, err = c.DecryptFileName(name.name)
+	}
+	return err == nil
+}
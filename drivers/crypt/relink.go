@@ -0,0 +1,172 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/alist-org/alist/v3/internal/driver"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	log "github.com/sirupsen/logrus"
+)
+
+// errLinkExpired is returned when the remote refuses a URL it gave out before
+var errLinkExpired = errors.New("remote link expired")
+
+// expiredStatus tells the statuses of a remote URL that is no longer valid
+func expiredStatus(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden || code == http.StatusGone
+}
+
+// remoteURL is the link of the remote file shared by the ranges of one Link, it is replaced when it expires
+type remoteURL struct {
+	mu   sync.Mutex
+	link *model.Link
+	// path is the actual path of the file in the remote storage
+	path string
+	// renew replaces the link of the path when set, for links that aren't of the current file
+	renew func(ctx context.Context, args model.LinkArgs) (*model.Link, error)
+}
+
+func (u *remoteURL) get() *model.Link {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.link
+}
+
+// relink asks the remote for a new link, unless another range did since expired was handed out
+func (u *remoteURL) relink(ctx context.Context, remote driver.Driver, args model.LinkArgs, expired *model.Link) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.link != expired {
+		return nil
+	}
+	var link *model.Link
+	var err error
+	if u.renew != nil {
+		link, err = u.renew(ctx, args)
+	} else {
+		// the link cache would hand out the expired link again
+		op.ClearLinkCache(remote, u.path, args)
+		link, _, err = op.Link(ctx, remote, u.path, args)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to renew the remote link: %w", err)
+	}
+	if len(link.URL) == 0 {
+		return fmt.Errorf("%w: the remote gave a new link without URL", errLinkExpired)
+	}
+	u.link = link
+	return nil
+}
+
+// openURLRange opens a range of the remote file from its URL. a range whose URL expires, when it
+// opens or in the middle, gets a new link and goes on from where it stopped. it gives up after
+// ExpiredLinkRetries attempts in a row that read nothing, a long stream may outlive many links
+func (d *Crypt) openURLRange(ctx context.Context, u *remoteURL, args model.LinkArgs, offset, length int64) (io.ReadCloser, error) {
+	r := &urlRange{ctx: ctx, d: d, url: u, args: args, offset: offset, length: length}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type urlRange struct {
+	ctx  context.Context
+	d    *Crypt
+	url  *remoteURL
+	args model.LinkArgs
+	// the rest of the range to read
+	offset, length int64
+	rc             io.ReadCloser
+	relinks        int
+}
+
+func (r *urlRange) open() error {
+	for {
+		link := r.url.get()
+		rc, err := r.d.requestURL(r.ctx, r.args.HttpReq, link, r.offset, r.length)
+		if err == nil {
+			r.rc = rc
+			return nil
+		}
+		if !errors.Is(err, errLinkExpired) || r.relinks >= r.d.ExpiredLinkRetries {
+			return err
+		}
+		r.relinks++
+		if err = r.url.relink(r.ctx, r.d.remoteStorage, r.args, link); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *urlRange) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if n > 0 {
+		r.offset += int64(n)
+		if r.length >= 0 {
+			r.length -= int64(n)
+		}
+		r.relinks = 0
+	}
+	if err == nil || err == io.EOF || r.length == 0 || r.relinks >= r.d.ExpiredLinkRetries || r.ctx.Err() != nil {
+		return n, err
+	}
+	// the response was cut, which is how some remotes end the use of an expired URL
+	log.Warnf("remote read failed at %d, resuming: %s", r.offset, err)
+	_ = r.rc.Close()
+	r.relinks++
+	if err = r.open(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (r *urlRange) Close() error {
+	return r.rc.Close()
+}
+
+// requestURL requests a range of the remote file from link
+func (d *Crypt) requestURL(ctx context.Context, r *http.Request, link *model.Link, offset, length int64) (io.ReadCloser, error) {
+	rangedRemoteLink := &model.Link{
+		URL:    link.URL,
+		Header: d.remoteHeader(r, link.Header),
+	}
+	response, err := requestRangedHttp(ctx, r, rangedRemoteLink, offset, length)
+	//remoteClosers.Add(response.Body)
+	if err != nil && response == nil {
+		return nil, fmt.Errorf("remote storage http request failure: %w", err)
+	}
+	if err != nil {
+		_ = response.Body.Close()
+		if expiredStatus(response.StatusCode) {
+			return nil, fmt.Errorf("%w: status %d", errLinkExpired, response.StatusCode)
+		}
+		return nil, fmt.Errorf("remote storage http request failure,status: %d err:%s", response.StatusCode, err)
+	}
+	if encoding := response.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return decodeRangedHttpBody(ctx, r, response, rangedRemoteLink, offset, length)
+	}
+	if response.StatusCode == http.StatusPartialContent {
+		return rangedBody(response, offset, length)
+	}
+	if offset == 0 && length == -1 {
+		return response.Body, nil
+	} else if response.StatusCode == http.StatusOK {
+		if d.caps.noRange() {
+			// logged once, or at init by the range probe
+			log.Warnf("remote http server not supporting range request, expect low perfromace!")
+		}
+		readCloser, err := getRangedReader(response.Body, offset, length)
+		if err != nil {
+			return nil, err
+		}
+		return readCloser, nil
+	}
+
+	return response.Body, nil
+}
@@ -0,0 +1,814 @@
+package crypt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	stdpath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/conf"
+	"github.com/alist-org/alist/v3/internal/db"
+	"github.com/alist-org/alist/v3/internal/driver"
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/gowebdav"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+	"github.com/alist-org/alist/v3/pkg/utils"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// memRemote is an in-memory driver used as the backing remote of Crypt in tests
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig()
+	db.Init(dB)
+	op.RegisterDriver(func() driver.Driver {
+		return &memRemote{}
+	})
+	op.RegisterDriver(func() driver.Driver {
+		return &memPagedRemote{}
+	})
+}
+
+const (
+	linkModeRange = "range"
+	linkModeSeek  = "seek"
+	linkModeURL   = "url"
+)
+
+type memNode struct {
+	id       string
+	isDir    bool
+	data     []byte
+	modified time.Time
+	// mode is reported by List and Get when set, like a remote on a filesystem does
+	mode os.FileMode
+	// visibleAt is when List and Get start to show the node
+	visibleAt time.Time
+	// size is reported in place of the size of data when set, like a crafted object would
+	size int64
+	// uploading makes List and Get report the node as an upload in progress
+	uploading bool
+}
+
+type memFS struct {
+	mu       sync.Mutex
+	nodes    map[string]*memNode
+	linkMode string
+	server   *httptest.Server
+	// gzip makes the server compress whole bodies and ignore ranges
+	gzip bool
+	// gzipPartial makes the gzip server answer requests with a range with 206
+	gzipPartial bool
+	// user agents of the requests to the server
+	userAgents []string
+	// putFailAfter makes Put store only that many bytes and fail, when > 0
+	putFailAfter int
+	// putErr makes Put fail with it before storing anything
+	putErr error
+	// md5 makes List and Get report the MD5 of files
+	md5 bool
+	// listNoSize makes List report files with size 0, their size is only known to Get
+	listNoSize bool
+	// listErr makes List fail with it
+	listErr error
+	// number of calls to Get on files
+	gets int32
+	// paths of the calls to Get that found nothing
+	missed []string
+	// number of calls to Copy and Move
+	copies int32
+	moves  int32
+	// hideFor makes files put invisible to List and Get for that long
+	hideFor time.Duration
+	// sizes the uploads to Put were announced with
+	putSizes []int64
+	// content types of the uploads to Put
+	putMimetypes []string
+	// putDelay makes every Put take that long, putsMaxActive is the most Puts that ran at once
+	putDelay      time.Duration
+	putsActive    int
+	putsMaxActive int
+	// stallAfter makes the server send that many bytes of a file and hang, when > 0
+	stallAfter int
+	// expireAfter makes every URL of linkModeURL serve that many bytes before the connection is cut
+	// and the URL refused with 403, when > 0. linkVersion is the version of the valid URL
+	expireAfter int
+	linkVersion int32
+	// badRange makes the server answer ranged requests with 206 and the wrong bytes: "full" sends the
+	// whole file with its Content-Range, "bare" without one, "ahead" starts 10 bytes after the range
+	badRange string
+	// backslash makes the objects of the remote carry paths separated by backslashes, the way a
+	// remote using another separator internally would. it converts them at its boundary
+	backslash bool
+	// snapshots are copies of nodes taken by snapshot, by id
+	snapshots map[string]map[string]*memNode
+	// thumbs makes List give a thumbnail with every file, without its permissions
+	thumbs bool
+	// zeroModified makes the remote report no modification time
+	zeroModified bool
+	// noRange makes the server answer ranged requests with the whole file
+	noRange bool
+	// linkExpired makes the server refuse every URL with 403
+	linkExpired bool
+	// freeSpace makes the remote report that much free space, when > 0. otherwise it can't tell
+	freeSpace int64
+	// flaky makes that many calls of MakeDir, Move, Rename, Copy, Remove and Put fail with a 503,
+	// flakyApplied makes them fail after taking effect, except for Put
+	flaky        int32
+	flakyApplied bool
+	// flakyPutRead makes the Puts failing with flaky read that many bytes of the stream first
+	flakyPutRead int64
+	// pageSize is the number of objects in the pages of memPagedRemote, pageFail makes the page of that
+	// number, counted from 1, fail once. pageTokens are the tokens of the pages requested
+	pageSize   int
+	pageFail   int
+	pageTokens []string
+	// linkExpiration makes Link give links expiring after that long, when > 0
+	linkExpiration time.Duration
+	// number of calls to Link
+	links int32
+	seq   int
+
+	// ranges requested through Link, for assertions
+	ranges []http_range.Range
+	// number of readers handed out by Link that were closed
+	closed int32
+}
+
+var memFSes sync.Map
+
+func newMemFS(linkMode string) *memFS {
+	m := &memFS{
+		nodes:    map[string]*memNode{"/": {id: "0", isDir: true}},
+		linkMode: linkMode,
+	}
+	m.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.userAgents = append(m.userAgents, r.UserAgent())
+		m.mu.Unlock()
+		data, ok := m.read(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if m.linkExpired || m.expireAfter > 0 && r.URL.Query().Get("v") != fmt.Sprint(atomic.LoadInt32(&m.linkVersion)) {
+			http.Error(w, "link expired", http.StatusForbidden)
+			return
+		}
+		if m.expireAfter > 0 {
+			w = &cutWriter{ResponseWriter: w, left: m.expireAfter, expire: func() { atomic.AddInt32(&m.linkVersion, 1) }}
+		}
+		if ranges, err := http_range.ParseRange(r.Header.Get("Range"), int64(len(data))); m.badRange != "" && err == nil && len(ranges) == 1 {
+			start := int64(0)
+			if m.badRange == "ahead" {
+				start = ranges[0].Start + 10
+			}
+			if m.badRange != "bare" {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(data)-1, len(data)))
+			}
+			w.Header().Set("Content-Length", fmt.Sprint(int64(len(data))-start))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(data[start:])
+			return
+		}
+		if m.noRange {
+			r.Header.Del("Range")
+		}
+		if m.stallAfter > 0 {
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+			_, _ = w.Write(data[:m.stallAfter])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		if m.gzip {
+			w.Header().Set("Content-Encoding", "gzip")
+			if m.gzipPartial && r.Header.Get("Range") != "" {
+				w.WriteHeader(http.StatusPartialContent)
+			}
+			gz := gzip.NewWriter(w)
+			_, _ = gz.Write(data)
+			_ = gz.Close()
+			return
+		}
+		http.ServeContent(w, r, stdpath.Base(r.URL.Path), time.Time{}, bytes.NewReader(data))
+	}))
+	return m
+}
+
+// cutWriter writes left bytes of a response, then expires the URL and aborts the connection
+type cutWriter struct {
+	http.ResponseWriter
+	left   int
+	expire func()
+}
+
+func (w *cutWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.left {
+		w.left -= len(p)
+		return w.ResponseWriter.Write(p)
+	}
+	_, _ = w.ResponseWriter.Write(p[:w.left])
+	w.ResponseWriter.(http.Flusher).Flush()
+	w.expire()
+	panic(http.ErrAbortHandler)
+}
+
+func (m *memFS) read(path string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[utils.FixAndCleanPath(path)]
+	if !ok || n.isDir {
+		return nil, false
+	}
+	return n.data, true
+}
+
+func (m *memFS) set(path string, n *memNode) {
+	path = utils.FixAndCleanPath(path)
+	m.seq++
+	if n.id == "" {
+		n.id = fmt.Sprint(m.seq)
+	}
+	m.nodes[path] = n
+}
+
+// paths returns all stored paths under prefix, sorted
+func (m *memFS) paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []string
+	for p := range m.nodes {
+		res = append(res, p)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// snapshot keeps the current content as the snapshot id
+func (m *memFS) snapshot(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nodes := make(map[string]*memNode, len(m.nodes))
+	for p, n := range m.nodes {
+		copied := *n
+		nodes[p] = &copied
+	}
+	if m.snapshots == nil {
+		m.snapshots = make(map[string]map[string]*memNode)
+	}
+	m.snapshots[id] = nodes
+}
+
+func (m *memFS) putFile(path string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(path, &memNode{data: data, modified: time.Now(), visibleAt: time.Now().Add(m.hideFor)})
+}
+
+func (m *memFS) putDir(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(path, &memNode{isDir: true, modified: time.Now()})
+}
+
+type memAddition struct {
+	driver.RootPath
+}
+
+type memRemote struct {
+	model.Storage
+	memAddition
+	fs *memFS
+}
+
+func (d *memRemote) Config() driver.Config {
+	return driver.Config{Name: "CryptTestRemote", LocalSort: true, NoCache: true, DefaultRoot: "/"}
+}
+
+func (d *memRemote) GetAddition() driver.Additional {
+	return &d.memAddition
+}
+
+func (d *memRemote) Init(ctx context.Context) error {
+	m, ok := memFSes.Load(d.MountPath)
+	if !ok {
+		return fmt.Errorf("no memFS for %s", d.MountPath)
+	}
+	d.fs = m.(*memFS)
+	return nil
+}
+
+func (d *memRemote) Drop(ctx context.Context) error {
+	return nil
+}
+
+// remotePath is path in the form the remote uses internally
+func (m *memFS) remotePath(path string) string {
+	if m.backslash {
+		return strings.ReplaceAll(path, "/", "\\")
+	}
+	return path
+}
+
+// path converts the internal path of an object of the remote back to a slash separated path
+func (d *memRemote) path(obj model.Obj) string {
+	if d.fs.backslash {
+		return strings.ReplaceAll(obj.GetPath(), "\\", "/")
+	}
+	return obj.GetPath()
+}
+
+func (d *memRemote) toObj(path string, n *memNode) *model.Object {
+	obj := &model.Object{
+		ID:       n.id,
+		Path:     d.fs.remotePath(path),
+		Name:     stdpath.Base(path),
+		Size:     int64(len(n.data)),
+		Modified: n.modified,
+		IsFolder: n.isDir,
+	}
+	if n.size > 0 {
+		obj.Size = n.size
+	}
+	if d.fs.zeroModified {
+		obj.Modified = time.Time{}
+	}
+	if d.fs.md5 && !n.isDir {
+		obj.SetHash(fmt.Sprintf("%x", md5.Sum(n.data)), "MD5")
+	}
+	return obj
+}
+
+func (d *memRemote) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	if d.fs.listErr != nil {
+		return nil, d.fs.listErr
+	}
+	dirPath := utils.FixAndCleanPath(d.path(dir))
+	var objs []model.Obj
+	for p, n := range d.fs.nodes {
+		if p != "/" && stdpath.Dir(p) == dirPath && !n.visibleAt.After(time.Now()) {
+			obj := d.toObj(p, n)
+			if d.fs.listNoSize {
+				obj.Size = 0
+			}
+			if d.fs.thumbs && !n.isDir {
+				objs = append(objs, &model.ObjThumb{Object: *obj, Thumbnail: model.Thumbnail{Thumbnail: "thumb:" + p}})
+				continue
+			}
+			objs = append(objs, withNodeMode(obj, n))
+		}
+	}
+	return objs, nil
+}
+
+// memPagedRemote is a memRemote listing directories in pages of pageSize objects, the token is the
+// index of the first object of the page
+type memPagedRemote struct {
+	memRemote
+}
+
+func (d *memPagedRemote) Config() driver.Config {
+	config := d.memRemote.Config()
+	config.Name = "CryptTestPagedRemote"
+	return config
+}
+
+func (d *memPagedRemote) ListPage(ctx context.Context, dir model.Obj, token string) ([]model.Obj, string, error) {
+	objs, err := d.List(ctx, dir, model.ListArgs{})
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].GetName() < objs[j].GetName() })
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	d.fs.pageTokens = append(d.fs.pageTokens, token)
+	start := 0
+	if token != "" {
+		if start, err = strconv.Atoi(token); err != nil {
+			return nil, "", fmt.Errorf("bad token %q", token)
+		}
+	}
+	if d.fs.pageSize <= 0 {
+		return objs[start:], "", nil
+	}
+	if d.fs.pageFail > 0 && start/d.fs.pageSize+1 == d.fs.pageFail {
+		d.fs.pageFail = 0
+		return nil, "", errors.New("page unavailable")
+	}
+	end := start + d.fs.pageSize
+	if end >= len(objs) {
+		return objs[start:], "", nil
+	}
+	return objs[start:end], strconv.Itoa(end), nil
+}
+
+func (d *memRemote) Get(ctx context.Context, path string) (model.Obj, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	path = utils.FixAndCleanPath(path)
+	n, ok := d.fs.nodes[path]
+	if !ok || n.visibleAt.After(time.Now()) {
+		d.fs.missed = append(d.fs.missed, path)
+		return nil, errs.ObjectNotFound
+	}
+	if !n.isDir {
+		atomic.AddInt32(&d.fs.gets, 1)
+	}
+	return withNodeMode(d.toObj(path, n), n), nil
+}
+
+// GetByID looks an object up by id, like remotes whose ids are stable do
+func (d *memRemote) GetByID(ctx context.Context, id string) (model.Obj, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	for path, n := range d.fs.nodes {
+		if n.id == id && !n.visibleAt.After(time.Now()) {
+			return withNodeMode(d.toObj(path, n), n), nil
+		}
+	}
+	return nil, errs.ObjectNotFound
+}
+
+// ListSnapshot and LinkSnapshot read the snapshots of memFS, like remotes keeping snapshots do
+func (d *memRemote) ListSnapshot(ctx context.Context, snapshot string, dir model.Obj) ([]model.Obj, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	nodes, ok := d.fs.snapshots[snapshot]
+	if !ok {
+		return nil, errs.ObjectNotFound
+	}
+	dirPath := utils.FixAndCleanPath(d.path(dir))
+	var objs []model.Obj
+	for p, n := range nodes {
+		if p != "/" && stdpath.Dir(p) == dirPath {
+			objs = append(objs, d.toObj(p, n))
+		}
+	}
+	return objs, nil
+}
+
+func (d *memRemote) LinkSnapshot(ctx context.Context, snapshot string, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	d.fs.mu.Lock()
+	n, ok := d.fs.snapshots[snapshot][utils.FixAndCleanPath(d.path(file))]
+	d.fs.mu.Unlock()
+	if !ok || n.isDir {
+		return nil, errs.ObjectNotFound
+	}
+	return &model.Link{ReadSeekCloser: &memReadSeekCloser{Reader: bytes.NewReader(n.data), fs: d.fs}}, nil
+}
+
+// memModeObj is an object of memRemote with permissions
+type memModeObj struct {
+	*model.Object
+	mode os.FileMode
+}
+
+func (o *memModeObj) GetMode() os.FileMode {
+	return o.mode
+}
+
+func withNodeMode(obj *model.Object, n *memNode) model.Obj {
+	if n.uploading {
+		return &memUploadingObj{Object: obj}
+	}
+	if n.mode == 0 {
+		return obj
+	}
+	return &memModeObj{Object: obj, mode: n.mode}
+}
+
+// memUploadingObj is an upload in progress, like a multipart upload not completed yet
+type memUploadingObj struct {
+	*model.Object
+}
+
+func (o *memUploadingObj) IsUploading() bool {
+	return true
+}
+
+func (d *memRemote) SetMode(ctx context.Context, obj model.Obj, mode os.FileMode) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	n, ok := d.fs.nodes[utils.FixAndCleanPath(d.path(obj))]
+	if !ok {
+		return errs.ObjectNotFound
+	}
+	n.mode = mode
+	return nil
+}
+
+type memReadSeekCloser struct {
+	*bytes.Reader
+	fs *memFS
+}
+
+func (r *memReadSeekCloser) Close() error {
+	atomic.AddInt32(&r.fs.closed, 1)
+	return nil
+}
+
+func (d *memRemote) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	link, err := d.link(file)
+	if err == nil && d.fs.linkExpiration > 0 {
+		link.Expiration = &d.fs.linkExpiration
+	}
+	return link, err
+}
+
+func (d *memRemote) link(file model.Obj) (*model.Link, error) {
+	atomic.AddInt32(&d.fs.links, 1)
+	data, ok := d.fs.read(d.path(file))
+	if !ok {
+		return nil, errs.ObjectNotFound
+	}
+	switch d.fs.linkMode {
+	case linkModeSeek:
+		return &model.Link{ReadSeekCloser: &memReadSeekCloser{Reader: bytes.NewReader(data), fs: d.fs}}, nil
+	case linkModeURL:
+		return &model.Link{URL: fmt.Sprintf("%s%s?v=%d", d.fs.server.URL, d.path(file), atomic.LoadInt32(&d.fs.linkVersion))}, nil
+	}
+	rangeReader := func(r http_range.Range) (io.ReadCloser, error) {
+		d.fs.mu.Lock()
+		d.fs.ranges = append(d.fs.ranges, r)
+		d.fs.mu.Unlock()
+		end := int64(len(data))
+		if r.Length >= 0 && r.Start+r.Length < end {
+			end = r.Start + r.Length
+		}
+		if r.Start > end {
+			r.Start = end
+		}
+		return io.NopCloser(bytes.NewReader(data[r.Start:end])), nil
+	}
+	return &model.Link{RangeReadCloser: model.RangeReadCloser{RangeReader: rangeReader, Closers: utils.NewClosers()}}, nil
+}
+
+// flake tells whether the call fails because of flaky
+func (d *memRemote) flake() bool {
+	if atomic.AddInt32(&d.fs.flaky, -1) >= 0 {
+		return true
+	}
+	atomic.AddInt32(&d.fs.flaky, 1)
+	return false
+}
+
+var errFlaky error = &os.PathError{Op: "remote", Path: "/", Err: gowebdav.StatusError{Status: http.StatusServiceUnavailable}}
+
+// flakyApply applies a change unless flaky fails the call before it
+func (d *memRemote) flakyApply(apply func()) error {
+	if !d.flake() {
+		apply()
+		return nil
+	}
+	if d.fs.flakyApplied {
+		apply()
+	}
+	return errFlaky
+}
+
+func (d *memRemote) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
+	return d.flakyApply(func() {
+		d.fs.putDir(stdpath.Join(d.path(parentDir), dirName))
+	})
+}
+
+// moveTree moves or copies src and all of its children to dst
+func (d *memRemote) moveTree(src, dst string, keep bool) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	for p, n := range d.fs.nodes {
+		if p == src || strings.HasPrefix(p, src+"/") {
+			if !keep {
+				delete(d.fs.nodes, p)
+				d.fs.nodes[dst+strings.TrimPrefix(p, src)] = n
+				continue
+			}
+			cp := *n
+			cp.id = ""
+			d.fs.set(dst+strings.TrimPrefix(p, src), &cp)
+		}
+	}
+}
+
+func (d *memRemote) Move(ctx context.Context, srcObj, dstDir model.Obj) error {
+	return d.flakyApply(func() {
+		atomic.AddInt32(&d.fs.moves, 1)
+		d.moveTree(d.path(srcObj), stdpath.Join(d.path(dstDir), srcObj.GetName()), false)
+	})
+}
+
+func (d *memRemote) Rename(ctx context.Context, srcObj model.Obj, newName string) error {
+	return d.flakyApply(func() {
+		d.moveTree(d.path(srcObj), stdpath.Join(stdpath.Dir(d.path(srcObj)), newName), false)
+	})
+}
+
+func (d *memRemote) Copy(ctx context.Context, srcObj, dstDir model.Obj) error {
+	return d.flakyApply(func() {
+		atomic.AddInt32(&d.fs.copies, 1)
+		d.moveTree(d.path(srcObj), stdpath.Join(d.path(dstDir), srcObj.GetName()), true)
+	})
+}
+
+func (d *memRemote) Remove(ctx context.Context, obj model.Obj) error {
+	return d.flakyApply(func() {
+		d.fs.mu.Lock()
+		defer d.fs.mu.Unlock()
+		src := d.path(obj)
+		for p := range d.fs.nodes {
+			if p == src || strings.HasPrefix(p, src+"/") {
+				delete(d.fs.nodes, p)
+			}
+		}
+	})
+}
+
+func (d *memRemote) Put(ctx context.Context, dstDir model.Obj, stream model.FileStreamer, up driver.UpdateProgress) error {
+	if d.fs.putErr != nil {
+		return d.fs.putErr
+	}
+	if d.flake() {
+		_, _ = io.CopyN(io.Discard, stream, d.fs.flakyPutRead)
+		return errFlaky
+	}
+	d.fs.mu.Lock()
+	d.fs.putSizes = append(d.fs.putSizes, stream.GetSize())
+	d.fs.putMimetypes = append(d.fs.putMimetypes, stream.GetMimetype())
+	d.fs.putsActive++
+	if d.fs.putsActive > d.fs.putsMaxActive {
+		d.fs.putsMaxActive = d.fs.putsActive
+	}
+	d.fs.mu.Unlock()
+	defer func() {
+		d.fs.mu.Lock()
+		d.fs.putsActive--
+		d.fs.mu.Unlock()
+	}()
+	time.Sleep(d.fs.putDelay)
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return err
+	}
+	if n := d.fs.putFailAfter; n > 0 && n < len(data) {
+		d.fs.putFile(stdpath.Join(d.path(dstDir), stream.GetName()), data[:n])
+		return fmt.Errorf("connection reset after %d bytes", n)
+	}
+	d.fs.putFile(stdpath.Join(d.path(dstDir), stream.GetName()), data)
+	return nil
+}
+
+func (d *memRemote) FreeSpace(ctx context.Context) (int64, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	if d.fs.freeSpace <= 0 {
+		return 0, errs.NotSupport
+	}
+	return d.fs.freeSpace, nil
+}
+
+var _ driver.Driver = (*memRemote)(nil)
+
+var mountSeq int32
+
+// newTestRemote mounts a fresh in-memory remote storage and returns its backing store and mount path
+func newTestRemote(t *testing.T, linkMode string) (*memFS, string) {
+	t.Helper()
+	return newTestRemoteDriver(t, "CryptTestRemote", linkMode)
+}
+
+// newTestPagedRemote is newTestRemote with a remote listing directories in pages
+func newTestPagedRemote(t *testing.T, linkMode string) (*memFS, string) {
+	t.Helper()
+	return newTestRemoteDriver(t, "CryptTestPagedRemote", linkMode)
+}
+
+func newTestRemoteDriver(t *testing.T, driverName, linkMode string) (*memFS, string) {
+	t.Helper()
+	m := newMemFS(linkMode)
+	mountPath := fmt.Sprintf("/remote%d", atomic.AddInt32(&mountSeq, 1))
+	memFSes.Store(mountPath, m)
+	id, err := op.CreateStorage(context.Background(), model.Storage{
+		Driver:    driverName,
+		MountPath: mountPath,
+		Addition:  `{"root_folder_path":"/"}`,
+	})
+	if err != nil {
+		t.Fatalf("failed to create remote storage: %+v", err)
+	}
+	t.Cleanup(func() {
+		_ = op.DeleteStorageById(context.Background(), id)
+		m.server.Close()
+	})
+	return m, mountPath
+}
+
+// newTestCrypt mounts a Crypt storage over remotePath, extra overrides the default addition
+func newTestCrypt(t *testing.T, remotePath string, extra map[string]interface{}) *Crypt {
+	t.Helper()
+	d, err := createTestCrypt(t, remotePath, extra)
+	if err != nil {
+		t.Fatalf("failed to create crypt storage: %+v", err)
+	}
+	return d
+}
+
+// createTestCrypt is newTestCrypt that returns the init error, the storage is still mounted on error
+func createTestCrypt(t *testing.T, remotePath string, extra map[string]interface{}) (*Crypt, error) {
+	t.Helper()
+	addition := map[string]interface{}{
+		"filename_encryption":       "standard",
+		"directory_name_encryption": "true",
+		"remote_path":               remotePath,
+		"password":                  "password",
+		"salt":                      "salt",
+		"encrypted_suffix":          ".bin",
+	}
+	for k, v := range extra {
+		addition[k] = v
+	}
+	additionStr, err := utils.Json.MarshalToString(addition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mountPath := fmt.Sprintf("/crypt%d", atomic.AddInt32(&mountSeq, 1))
+	id, err := op.CreateStorage(context.Background(), model.Storage{
+		Driver:    "Crypt",
+		MountPath: mountPath,
+		Addition:  additionStr,
+	})
+	if id != 0 {
+		t.Cleanup(func() {
+			_ = op.DeleteStorageById(context.Background(), id)
+		})
+	}
+	storage, getErr := op.GetStorageByMountPath(mountPath)
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	return storage.(*Crypt), err
+}
+
+func putFile(t *testing.T, d *Crypt, dir, name string, data []byte) {
+	t.Helper()
+	err := op.Put(context.Background(), d, dir, &model.FileStream{
+		Obj: &model.Object{
+			Name:     name,
+			Size:     int64(len(data)),
+			Modified: time.Now(),
+		},
+		ReadCloser: io.NopCloser(bytes.NewReader(data)),
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to put %s: %+v", name, err)
+	}
+}
+
+func readRange(t *testing.T, d *Crypt, path string, r http_range.Range) []byte {
+	t.Helper()
+	link, _, err := op.Link(context.Background(), d, path, model.LinkArgs{})
+	if err != nil {
+		t.Fatalf("failed to link %s: %+v", path, err)
+	}
+	rc, err := link.RangeReadCloser.RangeReader(r)
+	if err != nil {
+		t.Fatalf("failed to read range %+v of %s: %+v", r, path, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("failed to read %s: %+v", path, err)
+	}
+	return data
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
@@ -0,0 +1,59 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+// Download is a download of a file that can be resumed from a checkpoint, a plaintext offset the
+// client got to. it keeps the link of the remote file, so a resume doesn't get the file again.
+// it is for the consumers in the same process, clients over HTTP resume with a Range on /p/
+type Download struct {
+	link *model.Link
+	size int64
+	path string
+}
+
+// OpenDownload prepares the download of the file at path. the remote is only read by Resume, and
+// as long as ctx is. Close releases the link
+func (d *Crypt) OpenDownload(ctx context.Context, path string) (*Download, error) {
+	file, err := op.Get(ctx, d, path)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	link, size, err := d.sizedLink(ctx, model.UnwrapObj(file), model.LinkArgs{})
+	if err != nil {
+		return nil, err
+	}
+	return &Download{link: link, size: size, path: path}, nil
+}
+
+// Size is the decrypted size of the file
+func (dl *Download) Size() int64 {
+	return dl.size
+}
+
+// Resume returns the decrypted content of the file from checkpoint to its end. the remote is read
+// from the block of checkpoint, after the header of the file. a checkpoint at the size is the end
+func (dl *Download) Resume(checkpoint int64) (io.ReadCloser, error) {
+	if checkpoint < 0 || checkpoint > dl.size {
+		return nil, fmt.Errorf("%w: checkpoint %d of %s, size %d", http_range.ErrNoOverlap, checkpoint, dl.path, dl.size)
+	}
+	if checkpoint == dl.size {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	return dl.link.RangeReadCloser.RangeReader(http_range.Range{Start: checkpoint, Length: -1})
+}
+
+func (dl *Download) Close() error {
+	return dl.link.RangeReadCloser.Closers.Close()
+}
@@ -0,0 +1,69 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestResumeDownload(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	data := testData(200 * 1024)
+	putFile(t, d, "/", "a.txt", data)
+	dl, err := d.OpenDownload(ctx, "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dl.Close()
+	if dl.Size() != int64(len(data)) {
+		t.Fatalf("expect size %d, got %d", len(data), dl.Size())
+	}
+
+	// the client is cut at every checkpoint and resumes from what it got
+	var got []byte
+	for _, checkpoint := range []int64{0, 1000, 64 * 1024, 100000, 150000, int64(len(data)) - 1} {
+		got = got[:checkpoint]
+		m.mu.Lock()
+		m.ranges = nil
+		m.mu.Unlock()
+		rc, err := dl.Resume(checkpoint)
+		if err != nil {
+			t.Fatalf("resume at %d: %v", checkpoint, err)
+		}
+		b, err := io.ReadAll(io.LimitReader(rc, 70000))
+		_ = rc.Close()
+		if err != nil {
+			t.Fatalf("resume at %d: %v", checkpoint, err)
+		}
+		got = append(got, b...)
+		if !bytes.Equal(got, data[:len(got)]) {
+			t.Fatalf("resume at %d: the content doesn't follow", checkpoint)
+		}
+		m.mu.Lock()
+		last := m.ranges[len(m.ranges)-1]
+		m.mu.Unlock()
+		blockStart := 32 + checkpoint/(64*1024)*(64*1024+16)
+		if checkpoint > 0 && last.Start != blockStart {
+			t.Errorf("resume at %d: expect the remote read from %d, got %+v", checkpoint, blockStart, last)
+		}
+	}
+	if len(got) != len(data) {
+		t.Errorf("expect the whole file, got %d bytes", len(got))
+	}
+	rc, err := dl.Resume(int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(rc); len(b) != 0 {
+		t.Errorf("expect nothing after the end, got %d bytes", len(b))
+	}
+	if _, err = dl.Resume(int64(len(data)) + 1); !errors.Is(err, http_range.ErrNoOverlap) {
+		t.Errorf("expect a checkpoint past the end to fail, got %v", err)
+	}
+}
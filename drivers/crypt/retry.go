@@ -0,0 +1,111 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	stdpath "path"
+	"syscall"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/op"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRetryBackoff bounds the wait between two attempts
+const maxRetryBackoff = 30 * time.Second
+
+// transientStatuses are the HTTP statuses of remote errors that may not happen again
+var transientStatuses = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// transientFtpCodes are the FTP replies of a remote that may not happen again, 452 is out of space
+var transientFtpCodes = map[int]bool{
+	421: true,
+	425: true,
+	426: true,
+	450: true,
+	451: true,
+}
+
+// permanentError is an error that must not be retried whatever it says
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// isTransient reports whether an operation of the remote that failed with err may succeed if tried again
+func isTransient(err error) bool {
+	var permanent permanentError
+	if errors.As(err, &permanent) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, errs.QuotaExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, ErrPaused) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	return transientStatuses[httpStatus(err)] || transientFtpCodes[ftpCode(err)]
+}
+
+// retry runs fn, an operation of the remote, again while it fails with a transient error, at most
+// Retries times with a doubling wait. done reports whether a failed attempt took effect anyway, e.g.
+// a directory made before the connection was cut, so the next attempt failing doesn't fail the operation
+func (d *Crypt) retry(ctx context.Context, name string, fn func() error, done func() bool) error {
+	backoff := time.Duration(d.RetryBackoff) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt > 0 && done != nil && done() {
+			return nil
+		}
+		if attempt >= d.Retries || !isTransient(err) {
+			return err
+		}
+		log.Warnf("%s failed, retrying in %s: %s", name, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// remoteExists reports whether the remote has remoteActualPath, without its cached listing
+func (d *Crypt) remoteExists(ctx context.Context, remoteActualPath string) bool {
+	op.ClearCache(d.remoteStorage, stdpath.Dir(remoteActualPath))
+	_, err := op.Get(ctx, d.remoteStorage, remoteActualPath)
+	return err == nil
+}
+
+// remoteMoved reports whether src is at dst on the remote and no longer where it was
+func (d *Crypt) remoteMoved(ctx context.Context, src, dst string) bool {
+	return !d.remoteExists(ctx, src) && d.remoteExists(ctx, dst)
+}
@@ -0,0 +1,124 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/gowebdav"
+)
+
+func TestIsTransient(t *testing.T) {
+	for err, want := range map[error]bool{
+		errFlaky: true,
+		&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}:                true,
+		fmt.Errorf("upload failed: %w", &os.PathError{Err: gowebdav.StatusError{Status: http.StatusBadGateway}}): true,
+		&os.PathError{Err: gowebdav.StatusError{Status: http.StatusTooManyRequests}}:                             true,
+		fmt.Errorf("stor: %w", &textproto.Error{Code: 421, Msg: "Service not available"}):                        true,
+		fmt.Errorf("read body: %w", io.ErrUnexpectedEOF):                                                         true,
+		&net.DNSError{Err: "i/o", IsTimeout: true}:                                                               true,
+		errors.New("object not found"):                                                                           false,
+		errors.New("failed to open 503.txt"):                                                                     false,
+		// only the type of the error counts, not what it says
+		errors.New("upload failed, status code 502"):                                     false,
+		&os.PathError{Err: gowebdav.StatusError{Status: http.StatusNotFound}}:            false,
+		&os.PathError{Err: gowebdav.StatusError{Status: http.StatusInsufficientStorage}}: false,
+		fmt.Errorf("stor: %w", &textproto.Error{Code: 452, Msg: "Insufficient storage"}): false,
+		fmt.Errorf("put: %w", context.Canceled):                                          false,
+		fmt.Errorf("%w: %w", errs.QuotaExceeded, errFlaky):                               false,
+		permanentError{errFlaky}:                                                         false,
+	} {
+		if got := isTransient(err); got != want {
+			t.Errorf("%v: expect transient %v, got %v", err, want, got)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"retries": 2, "retry_backoff": 1})
+	exists := func(path string) bool {
+		_, err := op.Get(ctx, d, path)
+		return err == nil
+	}
+	flaky := func(n int32, applied bool) {
+		m.flaky, m.flakyApplied = n, applied
+	}
+	for _, applied := range []bool{false, true} {
+		// with applied, every attempt fails after taking effect, the retry finds it done
+		n := int32(2)
+		if applied {
+			n = 3
+		}
+		dir := fmt.Sprintf("/applied %v", applied)
+		flaky(n, applied)
+		if err := op.MakeDir(ctx, d, dir); err != nil || !exists(dir) {
+			t.Errorf("applied %v: make dir: %v", applied, err)
+		}
+		flaky(0, false)
+		if err := op.MakeDir(ctx, d, dir+"/sub"); err != nil {
+			t.Fatal(err)
+		}
+		putFile(t, d, dir, "a.txt", testData(100))
+
+		flaky(n, applied)
+		if err := op.Rename(ctx, d, dir+"/a.txt", "b.txt"); err != nil || !exists(dir+"/b.txt") {
+			t.Errorf("applied %v: rename: %v", applied, err)
+		}
+		flaky(n, applied)
+		if err := op.Move(ctx, d, dir+"/b.txt", dir+"/sub"); err != nil || !exists(dir+"/sub/b.txt") || exists(dir+"/b.txt") {
+			t.Errorf("applied %v: move: %v", applied, err)
+		}
+		flaky(n, applied)
+		if err := op.Remove(ctx, d, dir+"/sub/b.txt"); err != nil || exists(dir+"/sub/b.txt") {
+			t.Errorf("applied %v: remove: %v", applied, err)
+		}
+	}
+
+	flaky(2, false)
+	if err := putStream(d, "/", "c.txt", testData(100)); err != nil || !exists("/c.txt") {
+		t.Errorf("upload: %v", err)
+	}
+	flaky(2, false)
+	if err := op.Copy(ctx, d, "/c.txt", "/applied false"); err != nil || !exists("/applied false/c.txt") {
+		t.Errorf("copy: %v", err)
+	}
+	// more failures than retries
+	flaky(3, false)
+	if err := op.Copy(ctx, d, "/c.txt", "/applied true"); err == nil {
+		t.Errorf("expect the copy to fail once the retries are used up")
+	}
+	flaky(0, false)
+
+	// the remote took the header, or part of it, before failing, the stream can't be sent again
+	for _, c := range []struct {
+		size int
+		read int64
+	}{{0, 32}, {100, 16}} {
+		m.flakyPutRead = c.read
+		flaky(1, false)
+		name := fmt.Sprintf("consumed%d.txt", c.size)
+		if err := putStream(d, "/", name, testData(c.size)); err == nil || exists("/"+name) {
+			t.Errorf("size %d: expect an upload whose stream was read not to be retried, got %v", c.size, err)
+		}
+	}
+	m.flakyPutRead = 0
+	flaky(0, false)
+
+	once := newTestCrypt(t, remote, nil)
+	flaky(1, false)
+	if err := op.MakeDir(ctx, once, "/once"); err == nil {
+		t.Errorf("expect no retry by default")
+	}
+	flaky(0, false)
+}
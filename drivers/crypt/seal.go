@@ -0,0 +1,134 @@
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/conf"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"golang.org/x/crypto/hkdf"
+)
+
+// sealedPrefix marks a credential sealed with a key derived from the jwt_secret of alist, unlike an obscured one
+// it can only be read back with the secret, which instances sharing their configs share too.
+// rotating jwt_secret makes the sealed credentials unreadable, they have to be entered again
+const sealedPrefix = "___Sealed___"
+
+// sealInfo separates the sealing key from the other uses of jwt_secret, such as signing tokens
+const sealInfo = "alist crypt credential seal v1"
+
+const (
+	credentialObscure = "obscure"
+	credentialSecret  = "secret"
+)
+
+func sealingAEAD() (cipher.AEAD, error) {
+	if conf.Conf == nil || conf.Conf.JwtSecret == "" {
+		return nil, fmt.Errorf("no jwt_secret to seal credentials with")
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(conf.Conf.JwtSecret), nil, []byte(sealInfo)), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealCredential(plain string) (string, error) {
+	aead, err := sealingAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func openCredential(sealed string) (string, error) {
+	aead, err := sealingAEAD()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed sealed credential")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to open sealed credential, was jwt_secret changed? %w", err)
+	}
+	return string(plain), nil
+}
+
+// revealCredential returns a credential option in plaintext, whichever form it is stored in.
+// a value without prefix was just entered by the user
+func revealCredential(value string) (string, error) {
+	if strings.HasPrefix(value, sealedPrefix) {
+		return openCredential(value)
+	}
+	if obscured, ok := strings.CutPrefix(value, obfuscatedPrefix); ok {
+		return obscure.Reveal(obscured)
+	}
+	return value, nil
+}
+
+// obscuredCredential returns a credential option obscured the way the rclone cipher takes it
+func obscuredCredential(value string) (string, error) {
+	if obscured, ok := strings.CutPrefix(value, obfuscatedPrefix); ok {
+		return obscured, nil
+	}
+	plain, err := revealCredential(value)
+	if err != nil {
+		return "", err
+	}
+	return obscure.Obscure(plain)
+}
+
+// storeCredential converts a credential option to the form CredentialFormat asks for
+func (a *Addition) storeCredential(value *string) error {
+	format := a.CredentialFormat
+	if format == "" {
+		format = credentialObscure
+	}
+	if format == credentialObscure && strings.HasPrefix(*value, obfuscatedPrefix) ||
+		format == credentialSecret && strings.HasPrefix(*value, sealedPrefix) {
+		return nil
+	}
+	plain, err := revealCredential(*value)
+	if err != nil {
+		return err
+	}
+	if format == credentialSecret {
+		*value, err = sealCredential(plain)
+		return err
+	}
+	obscured, err := obscure.Obscure(plain)
+	if err != nil {
+		return err
+	}
+	*value = obfuscatedPrefix + obscured
+	return nil
+}
+
+// storeCredentials converts the password and salt to the form CredentialFormat asks for
+func (a *Addition) storeCredentials() error {
+	if err := a.storeCredential(&a.Password); err != nil {
+		return fmt.Errorf("failed to store password: %w", err)
+	}
+	if err := a.storeCredential(&a.Salt); err != nil {
+		return fmt.Errorf("failed to store salt: %w", err)
+	}
+	return nil
+}
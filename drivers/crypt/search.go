@@ -0,0 +1,235 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	stdpath "path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/pkg/utils"
+)
+
+// Search returns the objects under parent whose decrypted name contains keywords, case insensitively.
+// scope is the one of model.SearchReq: 0 for all, 1 for directories, 2 for files.
+// with SearchIndex the names come from the index, otherwise the remote is walked
+func (d *Crypt) Search(ctx context.Context, parent, keywords string, scope int) ([]model.SearchNode, error) {
+	if err := d.resolve(ctx); err != nil {
+		return nil, err
+	}
+	parent = utils.FixAndCleanPath(parent)
+	var res []model.SearchNode
+	match := func(node model.SearchNode) {
+		if searchMatch(node, keywords, scope) {
+			res = append(res, node)
+		}
+	}
+	nodes, indexed, err := d.indexNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if indexed {
+		for _, node := range nodes {
+			if utils.IsSubPath(parent, node.Parent) {
+				match(node)
+			}
+		}
+	} else if err = d.walk(ctx, parent, func(node model.SearchNode) error {
+		match(node)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return stdpath.Join(res[i].Parent, res[i].Name) < stdpath.Join(res[j].Parent, res[j].Name)
+	})
+	return res, nil
+}
+
+// RebuildSearchIndex drops the index and builds it again from the remote,
+// for changes the driver didn't make, or after the index went over SearchIndexLimit
+func (d *Crypt) RebuildSearchIndex(ctx context.Context) error {
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	d.index.reset()
+	_, _, err := d.indexNodes(ctx)
+	return err
+}
+
+func searchMatch(node model.SearchNode, keywords string, scope int) bool {
+	if scope == 1 && !node.IsDir || scope == 2 && node.IsDir {
+		return false
+	}
+	return strings.Contains(strings.ToLower(node.Name), strings.ToLower(keywords))
+}
+
+// walk calls fn for every object under dir, depth first
+func (d *Crypt) walk(ctx context.Context, dir string, fn func(node model.SearchNode) error) error {
+	objs, err := d.list(ctx, dir, false)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if isIncompleteObj(obj) {
+			// listed with ShowIncomplete, it can't be opened from the results
+			continue
+		}
+		if err = fn(model.SearchNode{Parent: dir, Name: obj.GetName(), IsDir: obj.IsDir(), Size: obj.GetSize()}); err != nil {
+			return err
+		}
+		if obj.IsDir() {
+			if err = d.walk(ctx, stdpath.Join(dir, obj.GetName()), fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// errIndexFull stops the walk that builds an index over SearchIndexLimit
+var errIndexFull = errors.New("search index is full")
+
+// indexNodes returns the nodes of the index, building it on first use.
+// indexed is false when the index is off or over SearchIndexLimit, the caller walks the remote then
+func (d *Crypt) indexNodes(ctx context.Context) (nodes []model.SearchNode, indexed bool, err error) {
+	if !d.SearchIndex {
+		return nil, false, nil
+	}
+	if nodes, built, overflow := d.index.snapshot(); built || overflow {
+		return nodes, built, nil
+	}
+	gen := d.index.generation()
+	built := make(map[string]model.SearchNode)
+	err = d.walk(ctx, "/", func(node model.SearchNode) error {
+		if d.SearchIndexLimit > 0 && len(built) >= d.SearchIndexLimit {
+			return errIndexFull
+		}
+		built[stdpath.Join(node.Parent, node.Name)] = node
+		return nil
+	})
+	if errors.Is(err, errIndexFull) {
+		d.logger().Warnf("search index is over %d objects, searches walk the remote", d.SearchIndexLimit)
+		d.index.setOverflow(gen)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	// a mutation during the walk may be missing from it, the next search builds again then
+	d.index.set(gen, built)
+	for _, node := range built {
+		nodes = append(nodes, node)
+	}
+	return nodes, true, nil
+}
+
+// searchIndex maps the paths of the storage to their search nodes, it is kept up to date by the
+// mutations of the driver. every mutation bumps gen, so a build that raced one is thrown away
+type searchIndex struct {
+	mu    sync.Mutex
+	nodes map[string]model.SearchNode
+	// overflow is set when the index went over SearchIndexLimit, until a rebuild
+	overflow bool
+	gen      uint64
+}
+
+func (x *searchIndex) snapshot() (nodes []model.SearchNode, built, overflow bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.nodes == nil {
+		return nil, false, x.overflow
+	}
+	nodes = make([]model.SearchNode, 0, len(x.nodes))
+	for _, node := range x.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes, true, false
+}
+
+func (x *searchIndex) generation() uint64 {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.gen
+}
+
+func (x *searchIndex) set(gen uint64, nodes map[string]model.SearchNode) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.gen == gen {
+		x.nodes, x.overflow = nodes, false
+	}
+}
+
+func (x *searchIndex) setOverflow(gen uint64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.gen == gen {
+		x.nodes, x.overflow = nil, true
+	}
+}
+
+func (x *searchIndex) reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.gen++
+	x.nodes, x.overflow = nil, false
+}
+
+// put adds or replaces the node at path, limit is SearchIndexLimit
+func (x *searchIndex) put(path string, isDir bool, size int64, limit int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.gen++
+	if x.nodes == nil {
+		return
+	}
+	x.nodes[path] = model.SearchNode{Parent: stdpath.Dir(path), Name: stdpath.Base(path), IsDir: isDir, Size: size}
+	x.checkLimit(limit)
+}
+
+// remove drops path and everything under it
+func (x *searchIndex) remove(path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.gen++
+	for p := range x.nodes {
+		if utils.IsSubPath(path, p) {
+			delete(x.nodes, p)
+		}
+	}
+}
+
+// move moves, or copies with keep, src and everything under it to dst
+func (x *searchIndex) move(src, dst string, keep bool, limit int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.gen++
+	if x.nodes == nil {
+		return
+	}
+	moved := make(map[string]model.SearchNode)
+	for p, node := range x.nodes {
+		if !utils.IsSubPath(src, p) {
+			continue
+		}
+		if !keep {
+			delete(x.nodes, p)
+		}
+		p = dst + strings.TrimPrefix(p, src)
+		node.Parent, node.Name = stdpath.Dir(p), stdpath.Base(p)
+		moved[p] = node
+	}
+	for p, node := range moved {
+		x.nodes[p] = node
+	}
+	x.checkLimit(limit)
+}
+
+func (x *searchIndex) checkLimit(limit int) {
+	if limit > 0 && len(x.nodes) > limit {
+		x.nodes, x.overflow = nil, true
+	}
+}
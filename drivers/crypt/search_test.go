@@ -0,0 +1,125 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func searchPaths(t *testing.T, d *Crypt, parent, keywords string, scope int) string {
+	t.Helper()
+	nodes, err := d.Search(context.Background(), parent, keywords, scope)
+	if err != nil {
+		t.Fatalf("failed to search %q in %s: %+v", keywords, parent, err)
+	}
+	var paths []string
+	for _, node := range nodes {
+		paths = append(paths, fmt.Sprintf("%s:%v:%d", stdpath.Join(node.Parent, node.Name), node.IsDir, node.Size))
+	}
+	return fmt.Sprint(paths)
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"search_index": true})
+	walked := newTestCrypt(t, remote, nil)
+	for _, dir := range []string{"/photos/2023", "/docs"} {
+		if err := op.MakeDir(ctx, d, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	putFile(t, d, "/photos/2023", "Beach.jpg", testData(10))
+	putFile(t, d, "/photos", "beach-notes.txt", testData(20))
+	putFile(t, d, "/docs", "report.txt", testData(30))
+
+	queries := []struct {
+		parent, keywords string
+		scope            int
+	}{
+		{"/", "beach", 0},
+		{"/", "beach", 2},
+		{"/", "o", 1},
+		{"/photos", "", 0},
+		{"/docs", "beach", 0},
+	}
+	for _, q := range queries {
+		want := searchPaths(t, walked, q.parent, q.keywords, q.scope)
+		if got := searchPaths(t, d, q.parent, q.keywords, q.scope); got != want {
+			t.Errorf("%+v: expect the index to find %s like a walk, got %s", q, want, got)
+		}
+	}
+	if got := searchPaths(t, d, "/", "beach", 0); got != "[/photos/2023/Beach.jpg:false:10 /photos/beach-notes.txt:false:20]" {
+		t.Errorf("unexpected results %s", got)
+	}
+
+	// a file the driver didn't write is only found after a rebuild
+	m.putFile("/"+d.cipher.EncryptFileName("beach.md"), make([]byte, d.cipher.EncryptedSize(5)))
+	if got := searchPaths(t, d, "/", "beach.md", 0); got != "[]" {
+		t.Errorf("expect searches to use the index, got %s", got)
+	}
+	if err := d.RebuildSearchIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchPaths(t, d, "/", "beach.md", 0); got != "[/beach.md:false:5]" {
+		t.Errorf("expect a rebuild to find the new file, got %s", got)
+	}
+
+	if err := op.Rename(ctx, d, "/photos/2023", "2024"); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Move(ctx, d, "/docs/report.txt", "/photos"); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Copy(ctx, d, "/photos/2024", "/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Remove(ctx, d, "/photos/beach-notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, d, "/docs", "beach-plan.txt", testData(40))
+	for _, q := range append(queries, struct {
+		parent, keywords string
+		scope            int
+	}{"/", "", 0}) {
+		want := searchPaths(t, walked, q.parent, q.keywords, q.scope)
+		if got := searchPaths(t, d, q.parent, q.keywords, q.scope); got != want {
+			t.Errorf("%+v: expect the index to follow the mutations, %s, got %s", q, want, got)
+		}
+	}
+}
+
+func TestSearchIndexLimit(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"search_index": true, "search_index_limit": 2})
+	for i := 0; i < 3; i++ {
+		putFile(t, d, "/", fmt.Sprintf("%d.txt", i), testData(i))
+	}
+	if got := searchPaths(t, d, "/", "txt", 0); got != "[/0.txt:false:0 /1.txt:false:1 /2.txt:false:2]" {
+		t.Errorf("expect a store over the limit to be walked, got %s", got)
+	}
+	if nodes, built, overflow := d.index.snapshot(); built || !overflow || len(nodes) != 0 {
+		t.Errorf("expect no index over the limit, got %d nodes", len(nodes))
+	}
+
+	if err := op.Remove(ctx, d, "/2.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RebuildSearchIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, built, _ := d.index.snapshot(); !built {
+		t.Errorf("expect a rebuild to index a store within the limit")
+	}
+	putFile(t, d, "/", "3.txt", testData(3))
+	if _, built, overflow := d.index.snapshot(); built || !overflow {
+		t.Errorf("expect the index to be dropped when it grows over the limit")
+	}
+	if got := searchPaths(t, d, "/", "txt", 0); got != "[/0.txt:false:0 /1.txt:false:1 /3.txt:false:3]" {
+		t.Errorf("unexpected results %s", got)
+	}
+}
@@ -0,0 +1,88 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alist-org/alist/v3/internal/fs"
+	"github.com/alist-org/alist/v3/internal/model"
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+)
+
+// selfTestName and selfTestData are round-tripped through the cipher by selfTest
+const (
+	selfTestName = "alist crypt self test.txt"
+	selfTestData = "the quick brown fox jumps over the lazy dog"
+)
+
+// selfTest checks that the cipher decrypts what it encrypts, and that it can decrypt
+// at least one of the objects already in the remote root, which a wrong password or salt can't
+func (d *Crypt) selfTest(ctx context.Context) error {
+	if name, err := d.cipher.DecryptFileName(d.cipher.EncryptFileName(selfTestName)); err != nil || name != selfTestName {
+		return fmt.Errorf("self test failed: file name doesn't survive encryption: %v", err)
+	}
+	if name, err := d.cipher.DecryptDirName(d.cipher.EncryptDirName(selfTestName)); err != nil || name != selfTestName {
+		return fmt.Errorf("self test failed: directory name doesn't survive encryption: %v", err)
+	}
+	encrypted, err := d.cipher.EncryptData(strings.NewReader(selfTestData))
+	if err != nil {
+		return fmt.Errorf("self test failed: %w", err)
+	}
+	ciphertext, err := io.ReadAll(encrypted)
+	if err != nil {
+		return fmt.Errorf("self test failed: %w", err)
+	}
+	decrypted, err := d.cipher.DecryptData(io.NopCloser(bytes.NewReader(ciphertext)))
+	if err != nil {
+		return fmt.Errorf("self test failed: %w", err)
+	}
+	defer decrypted.Close()
+	plaintext, err := io.ReadAll(decrypted)
+	if err != nil || string(plaintext) != selfTestData {
+		return fmt.Errorf("self test failed: content doesn't survive encryption: %v", err)
+	}
+
+	objs, err := fs.List(ctx, d.getPathForRemote("/", true), d.remoteListArgs())
+	if err != nil {
+		// an unreachable remote is reported by the health check
+		return nil
+	}
+	if err = checkDecryptable(d.cipher, objs); err != nil {
+		return fmt.Errorf("self test failed: %w in %s, check password, salt, kdf and filename encryption", err, d.RemotePath)
+	}
+	return nil
+}
+
+// checkDecryptable checks that c can decrypt at least one of objs, if there are any
+func checkDecryptable(c *rcCrypt.Cipher, objs []model.Obj) error {
+	total := 0
+	for _, obj := range objs {
+		if isReservedName(obj.GetName()) {
+			continue
+		}
+		total++
+		if obj.IsDir() {
+			if _, err := c.DecryptDirName(obj.GetName()); err == nil {
+				return nil
+			}
+			continue
+		}
+		encryptedName, suffix := contentSuffix(obj.GetName())
+		if _, err := c.DecryptFileName(encryptedName); err != nil {
+			continue
+		}
+		if suffix == plainSuffix {
+			return nil
+		}
+		if _, err := c.DecryptedSize(obj.GetSize()); err == nil {
+			return nil
+		}
+	}
+	if total > 0 {
+		return fmt.Errorf("none of the %d objects can be decrypted", total)
+	}
+	return nil
+}
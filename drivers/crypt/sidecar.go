@@ -0,0 +1,217 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	stdpath "path"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/driver"
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/net"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+	"github.com/alist-org/alist/v3/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// metaSidecarSuffix is appended to the encrypted name of an object to get the name of its metadata sidecar
+const metaSidecarSuffix = ".alist_meta"
+
+// getSidecarActualPath returns the remote actual path of the metadata sidecar of path
+func (d *Crypt) getSidecarActualPath(path string, isFolder bool) (string, error) {
+	remoteActualPath, err := d.getActualPathForRemote(path, isFolder)
+	if err != nil {
+		return "", err
+	}
+	return remoteActualPath + metaSidecarSuffix, nil
+}
+
+// GetMeta reads the metadata sidecar of the object at path. with ContentCheck, the metadata of a file
+// tells whether its content decrypts, even if it has no sidecar
+func (d *Crypt) GetMeta(ctx context.Context, path string, isFolder bool) (*ObjMeta, error) {
+	if err := d.resolve(ctx); err != nil {
+		return nil, err
+	}
+	sidecarPath, err := d.getSidecarActualPath(path, isFolder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert path to remote path: %w", err)
+	}
+	var meta ObjMeta
+	err = d.readEncryptedJson(ctx, sidecarPath, &meta)
+	if err != nil && !(errs.IsObjectNotFound(err) && d.ContentCheck && !isFolder) {
+		return nil, err
+	}
+	if d.ContentCheck && !isFolder {
+		if meta.ContentValid, err = d.contentValid(ctx, path); err != nil {
+			return nil, err
+		}
+	}
+	return &meta, nil
+}
+
+// SetMeta writes meta to the encrypted sidecar of the object at path, replacing any existing one
+func (d *Crypt) SetMeta(ctx context.Context, path string, isFolder bool, meta *ObjMeta) error {
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	if !d.MetaSidecar {
+		return errs.NotSupport
+	}
+	sidecarPath, err := d.getSidecarActualPath(path, isFolder)
+	if err != nil {
+		return fmt.Errorf("failed to convert path to remote path: %w", err)
+	}
+	if meta.SHA1 == "" && d.PlaintextHash || meta.Modified == nil && d.ZeroModified == zeroModifiedSidecar || meta.Metadata == nil && d.PreserveMetadata {
+		// the hash, the upload time and the metadata of the upload are kept by the driver, not set by the user
+		var old ObjMeta
+		if err = d.readEncryptedJson(ctx, sidecarPath, &old); err == nil {
+			if meta.SHA1 == "" {
+				meta.SHA1 = old.SHA1
+			}
+			if meta.Modified == nil {
+				meta.Modified = old.Modified
+			}
+			if meta.Metadata == nil {
+				meta.Metadata = old.Metadata
+			}
+		}
+	}
+	meta.ContentValid = nil
+	return d.writeEncryptedJson(ctx, sidecarPath, meta)
+}
+
+// storeUploadMeta keeps in the sidecar of the file at path what the upload of it tells, with the
+// metadata that is there already: sha1, the hash of its content, and modified, its modification
+// time, unless they are empty. with PreserveMetadata, metadata replaces the one of the previous
+// upload. it is best effort, the upload succeeded
+func (d *Crypt) storeUploadMeta(ctx context.Context, path, sha1 string, modified time.Time, metadata map[string]string) {
+	sidecarPath, err := d.getSidecarActualPath(path, false)
+	if err == nil {
+		var meta ObjMeta
+		if err = d.readEncryptedJson(ctx, sidecarPath, &meta); err == nil || errs.IsObjectNotFound(err) {
+			if sha1 != "" {
+				meta.SHA1 = sha1
+			}
+			if !modifiedMissing(modified) {
+				meta.Modified = &modified
+			}
+			if d.PreserveMetadata {
+				meta.Metadata = metadata
+			}
+			err = d.writeEncryptedJson(ctx, sidecarPath, &meta)
+		}
+	}
+	if err != nil {
+		log.Warnf("failed to store the sidecar of %s: %s", path, err)
+	}
+}
+
+// readEncryptedJson decodes the encrypted json file at remoteActualPath of the remote storage into v
+func (d *Crypt) readEncryptedJson(ctx context.Context, remoteActualPath string, v interface{}) error {
+	data, err := d.readRemoteFile(ctx, remoteActualPath)
+	if err != nil {
+		return err
+	}
+	plain, err := d.cipher.DecryptData(io.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		return fmt.Errorf("failed to DecryptData: %w", err)
+	}
+	defer plain.Close()
+	err = utils.Json.NewDecoder(plain).Decode(v)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", stdpath.Base(remoteActualPath), err)
+	}
+	return nil
+}
+
+// writeEncryptedJson writes v encrypted as json to remoteActualPath of the remote storage, replacing any existing file
+func (d *Crypt) writeEncryptedJson(ctx context.Context, remoteActualPath string, v interface{}) error {
+	data, err := utils.Json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	wrappedIn, err := d.cipher.EncryptData(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to EncryptData: %w", err)
+	}
+	d.sidecars.remove(remoteActualPath)
+	dir, name := stdpath.Split(remoteActualPath)
+	return op.Put(ctx, d.remoteStorage, dir, &model.FileStream{
+		Obj: &model.Object{
+			Name:     name,
+			Size:     d.cipher.EncryptedSize(int64(len(data))),
+			Modified: time.Now(),
+		},
+		ReadCloser: io.NopCloser(wrappedIn),
+		Mimetype:   "application/octet-stream",
+	}, nil)
+}
+
+// syncSidecar applies fn to the sidecar of obj if there is one, the object itself has been handled already.
+// failures are only logged because the sidecar is not essential for the object
+func (d *Crypt) syncSidecar(ctx context.Context, obj model.Obj, fn func(sidecarPath string) error) {
+	if !d.MetaSidecar && !d.PlaintextHash && d.ZeroModified != zeroModifiedSidecar && !d.PreserveMetadata {
+		return
+	}
+	sidecarPath, err := d.getSidecarActualPath(obj.GetPath(), obj.IsDir())
+	if err != nil {
+		return
+	}
+	if _, err = op.GetUnwrap(ctx, d.remoteStorage, sidecarPath); err != nil {
+		return
+	}
+	d.sidecars.remove(sidecarPath)
+	if err = fn(sidecarPath); err != nil {
+		log.Warnf("failed to update meta sidecar %s: %s", sidecarPath, err)
+	}
+}
+
+// readRemoteFile reads the whole file at remoteActualPath of the remote storage
+func (d *Crypt) readRemoteFile(ctx context.Context, remoteActualPath string) ([]byte, error) {
+	rc, err := d.openFile(ctx, d.remoteStorage, remoteActualPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// openFile opens the file at actualPath of storage for reading from the start
+func (d *Crypt) openFile(ctx context.Context, storage driver.Driver, actualPath string) (io.ReadCloser, error) {
+	link, _, err := op.Link(ctx, storage, actualPath, model.LinkArgs{})
+	if err != nil {
+		return nil, err
+	}
+	if link.RangeReadCloser.RangeReader != nil {
+		closers := link.RangeReadCloser.Closers
+		rc, err := link.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+		if err != nil {
+			if closers != nil {
+				_ = closers.Close()
+			}
+			return nil, err
+		}
+		return utils.NewReadCloser(rc, func() error {
+			err := rc.Close()
+			if closers != nil {
+				_ = closers.Close()
+			}
+			return err
+		}), nil
+	}
+	if link.ReadSeekCloser != nil {
+		return link.ReadSeekCloser, nil
+	}
+	if len(link.URL) > 0 {
+		response, err := net.RequestHttp("GET", d.remoteHeader(nil, link.Header), link.URL)
+		if err != nil {
+			return nil, err
+		}
+		return response.Body, nil
+	}
+	return nil, errs.NotSupport
+}
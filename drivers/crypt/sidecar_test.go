@@ -0,0 +1,117 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestMetaSidecar(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"meta_sidecar": true})
+	putFile(t, d, "/", "a.txt", testData(10))
+
+	err := d.SetMeta(ctx, "/a.txt", false, &ObjMeta{Tags: []string{"x", "y"}, Description: "desc"})
+	if err != nil {
+		t.Fatalf("failed to set meta: %+v", err)
+	}
+	sidecar := "/" + d.cipher.EncryptFileName("a.txt") + metaSidecarSuffix
+	if _, ok := m.read(sidecar); !ok {
+		t.Fatalf("expect sidecar %s on remote, got %v", sidecar, m.paths())
+	}
+	objs, err := op.List(ctx, d, "/", model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "a.txt" {
+		t.Errorf("expect only a.txt in list, got %d objs", len(objs))
+	}
+
+	if err = op.Rename(ctx, d, "/a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := d.GetMeta(ctx, "/b.txt", false)
+	if err != nil {
+		t.Fatalf("failed to get meta after rename: %+v", err)
+	}
+	if meta.Description != "desc" || len(meta.Tags) != 2 || meta.Tags[1] != "y" {
+		t.Errorf("unexpected meta: %+v", meta)
+	}
+
+	if err = op.Remove(ctx, d, "/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if paths := m.paths(); len(paths) != 1 {
+		t.Errorf("expect sidecar removed with its file, got %v", paths)
+	}
+}
+
+func TestShowReserved(t *testing.T) {
+	ctx := context.Background()
+	for _, show := range []bool{false, true} {
+		_, remote := newTestRemote(t, linkModeRange)
+		d := newTestCrypt(t, remote, map[string]interface{}{"meta_sidecar": true, "show_reserved": show})
+		putFile(t, d, "/", "a.txt", testData(10))
+		if err := d.SetMeta(ctx, "/a.txt", false, &ObjMeta{Description: "desc"}); err != nil {
+			t.Fatal(err)
+		}
+		objs, err := op.List(ctx, d, "/", model.ListArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := 1
+		if show {
+			expect = 2
+		}
+		if len(objs) != expect {
+			t.Errorf("show_reserved=%v: expect %d objs, got %d", show, expect, len(objs))
+		}
+		sidecar := "/" + d.cipher.EncryptFileName("a.txt") + metaSidecarSuffix
+		_, err = d.Get(ctx, sidecar)
+		if show && err != nil {
+			t.Errorf("expect revealed sidecar to be found, got %+v", err)
+		} else if !show && err == nil {
+			t.Errorf("expect hidden sidecar not to be found")
+		}
+	}
+}
+
+func TestReservedNamesRejected(t *testing.T) {
+	ctx := context.Background()
+	_, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	putFile(t, d, "/", "a.txt", testData(10))
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	root := &model.Object{Path: "/", IsFolder: true}
+	file := &model.Object{Path: "/a.txt", Name: "a.txt"}
+	for _, name := range []string{"notes" + metaSidecarSuffix, "b" + uploadingSuffix, "x" + trashDirName, "c.txt.1" + versionSuffix} {
+		if err := d.MakeDir(ctx, root, name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%s: expect MakeDir to refuse a reserved name, got %v", name, err)
+		}
+		if err := d.Rename(ctx, file, name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%s: expect Rename to refuse a reserved name, got %v", name, err)
+		}
+		err := d.Put(ctx, root, &model.FileStream{
+			Obj:        &model.Object{Name: name, Size: 10},
+			ReadCloser: io.NopCloser(bytes.NewReader(testData(10))),
+		}, func(int) {})
+		if !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%s: expect Put to refuse a reserved name, got %v", name, err)
+		}
+		if err = d.Copy(ctx, &model.Object{Path: "/" + name, Name: name}, &model.Object{Path: "/dir", IsFolder: true}); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%s: expect Copy to refuse a reserved name, got %v", name, err)
+		}
+	}
+	objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+	if err != nil || len(objs) != 2 {
+		t.Errorf("expect nothing to be created, got %d objs, %v", len(objs), err)
+	}
+}
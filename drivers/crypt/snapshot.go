@@ -0,0 +1,123 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+)
+
+// snapshotRemote is implemented by the remotes that keep point-in-time snapshots of their content,
+// snapshot is an id of the remote. the objects are those of the remote, with their actual paths
+type snapshotRemote interface {
+	ListSnapshot(ctx context.Context, snapshot string, dir model.Obj) ([]model.Obj, error)
+	LinkSnapshot(ctx context.Context, snapshot string, file model.Obj, args model.LinkArgs) (*model.Link, error)
+}
+
+// snapshotObject is an object of a snapshot of the remote, Link reads it from the snapshot
+type snapshotObject struct {
+	model.Obj
+	snapshot string
+	// remote is the object of the remote in the snapshot
+	remote model.Obj
+}
+
+func (o *snapshotObject) Unwrap() model.Obj {
+	return o.Obj
+}
+
+// snapshotOf returns the snapshot object among the wrappers of obj, or nil
+func snapshotOf(obj model.Obj) *snapshotObject {
+	for {
+		if s, ok := obj.(*snapshotObject); ok {
+			return s
+		}
+		unwrap, ok := obj.(model.ObjUnwrap)
+		if !ok {
+			return nil
+		}
+		obj = unwrap.Unwrap()
+	}
+}
+
+func (d *Crypt) snapshotRemote() (snapshotRemote, error) {
+	remote, ok := d.remoteStorage.(snapshotRemote)
+	if !ok {
+		return nil, fmt.Errorf("%w: the remote has no snapshots", errs.NotSupport)
+	}
+	return remote, nil
+}
+
+// ListSnapshot lists the directory at path as it is in the snapshot of the remote. the names and
+// sizes are decrypted with the cipher of the storage like the current ones, Link and DecryptTo
+// read the files listed from the snapshot. it returns errs.NotSupport if the remote has no snapshots
+func (d *Crypt) ListSnapshot(ctx context.Context, snapshot, path string) ([]model.Obj, error) {
+	if err := d.resolve(ctx); err != nil {
+		return nil, err
+	}
+	remote, err := d.snapshotRemote()
+	if err != nil {
+		return nil, err
+	}
+	path, _ = d.cleanPath(path)
+	dirActualPath, err := d.getActualPathForRemote(path, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert path to remote path: %w", err)
+	}
+	remoteObjs, err := remote.ListSnapshot(ctx, snapshot, &model.Object{
+		Name:     stdpath.Base(dirActualPath),
+		Path:     dirActualPath,
+		IsFolder: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var objs []model.Obj
+	for _, remoteObj := range remoteObjs {
+		name, ok := remoteObj.GetName(), true
+		if !isReservedName(name) {
+			name, ok = d.decryptRemoteName(remoteObj.GetName(), remoteObj.IsDir())
+			if !ok && remoteObj.IsDir() && d.plainDirName(path, remoteObj.GetName()) {
+				name, ok = remoteObj.GetName(), true
+			}
+		}
+		if !ok {
+			d.failures.names.Add(1)
+			continue
+		}
+		obj, err := d.decryptRemoteObj(ctx, stdpath.Join(path, name), remoteObj)
+		if err != nil {
+			// reserved objects, uploads in progress
+			continue
+		}
+		objs = append(objs, &snapshotObject{Obj: obj, snapshot: snapshot, remote: remoteObj})
+	}
+	model.SortFiles(objs, d.GetStorage().OrderBy, d.GetStorage().OrderDirection)
+	return objs, nil
+}
+
+// GetSnapshot gets the object at path as it is in the snapshot of the remote
+func (d *Crypt) GetSnapshot(ctx context.Context, snapshot, path string) (model.Obj, error) {
+	path, _ = d.cleanPath(path)
+	objs, err := d.ListSnapshot(ctx, snapshot, stdpath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if obj.GetName() == stdpath.Base(path) {
+			return obj, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s in snapshot %s", errs.ObjectNotFound, path, snapshot)
+}
+
+// snapshotLink asks the remote for a link of the file of a snapshot
+func (d *Crypt) snapshotLink(ctx context.Context, obj *snapshotObject, args model.LinkArgs) (*model.Link, error) {
+	remote, err := d.snapshotRemote()
+	if err != nil {
+		return nil, err
+	}
+	return remote.LinkSnapshot(ctx, obj.snapshot, obj.remote, args)
+}
@@ -0,0 +1,58 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	v1 := testData(1000)
+	putFile(t, d, "/dir", "a.txt", v1)
+	m.snapshot("v1")
+	v2 := testData(2000)[1000:]
+	putFile(t, d, "/dir", "a.txt", v2)
+	putFile(t, d, "/dir", "b.txt", testData(10))
+	m.snapshot("v2")
+
+	for snapshot, expect := range map[string][]byte{"v1": v1, "v2": v2} {
+		objs, err := d.ListSnapshot(ctx, snapshot, "/dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expectCount := map[string]int{"v1": 1, "v2": 2}[snapshot]; len(objs) != expectCount {
+			t.Fatalf("%s: expect %d decrypted files, got %d", snapshot, expectCount, len(objs))
+		}
+		file, err := d.GetSnapshot(ctx, snapshot, "/dir/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.GetPath() != "/dir/a.txt" || file.GetSize() != int64(len(expect)) {
+			t.Errorf("%s: expect a.txt of %d bytes, got %s of %d", snapshot, len(expect), file.GetPath(), file.GetSize())
+		}
+		var got bytes.Buffer
+		if err = d.DecryptTo(ctx, file, &got, http_range.Range{Length: -1}); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), expect) {
+			t.Errorf("%s: expect the content of the snapshot", snapshot)
+		}
+	}
+	if _, err := d.GetSnapshot(ctx, "v1", "/dir/b.txt"); !errs.IsObjectNotFound(err) {
+		t.Errorf("expect b.txt not to be in the first snapshot, got %v", err)
+	}
+	// the current content is read as before
+	if got := readRange(t, d, "/dir/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, v2) {
+		t.Errorf("expect the current content")
+	}
+}
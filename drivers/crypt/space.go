@@ -0,0 +1,34 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// spaceReporter is a remote that can tell its free space, the driver package has no interface for it
+type spaceReporter interface {
+	FreeSpace(ctx context.Context) (int64, error)
+}
+
+// checkFreeSpace refuses an upload of size bytes, as sent to the remote, that can't fit in its free space.
+// the space of a file it replaces isn't counted as free, remotes may keep it as an old version
+func (d *Crypt) checkFreeSpace(ctx context.Context, name string, size int64) error {
+	if !d.CheckFreeSpace || size < 0 {
+		return nil
+	}
+	remote, ok := d.remoteStorage.(spaceReporter)
+	if !ok {
+		return nil
+	}
+	free, err := remote.FreeSpace(ctx)
+	if err != nil {
+		log.Debugf("can't check the free space of the remote: %s", err)
+		return nil
+	}
+	if size > free {
+		return fmt.Errorf("%w: %s needs %d bytes, %d are free", ErrNoSpace, name, size, free)
+	}
+	return nil
+}
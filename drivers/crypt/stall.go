@@ -0,0 +1,80 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// openRemote opens a range of the remote file, reads of the range are aborted through ctx or Close
+type openRemote func(ctx context.Context) (io.ReadCloser, error)
+
+// openWithTimeout opens a range of the remote, failing with ErrRemoteStalled if it doesn't open
+// within RemoteReadTimeout or if a read of it is blocked that long. each range has its own timer,
+// so a long stream is fine as long as the remote keeps sending. the range is aborted with ctx too
+func (d *Crypt) openWithTimeout(ctx context.Context, open openRemote) (io.ReadCloser, error) {
+	timeout := time.Duration(d.RemoteReadTimeout) * time.Second
+	if timeout <= 0 {
+		return open(ctx)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(timeout, cancel)
+	rc, err := open(ctx)
+	if !timer.Stop() {
+		if err == nil {
+			_ = rc.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("%w: no response in %s", ErrRemoteStalled, timeout)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return newStallReader(rc, timeout, func() {
+		cancel()
+		_ = rc.Close()
+	}), nil
+}
+
+// stallReader fails a read that is blocked longer than timeout, abort has to unblock it.
+// the time between reads, when the consumer is busy or paused, doesn't count
+type stallReader struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	abort   func()
+	stalled atomic.Bool
+}
+
+func newStallReader(rc io.ReadCloser, timeout time.Duration, abort func()) *stallReader {
+	r := &stallReader{ReadCloser: rc, timeout: timeout, abort: abort}
+	r.timer = time.AfterFunc(timeout, func() {
+		r.stalled.Store(true)
+		abort()
+	})
+	r.timer.Stop()
+	return r
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	if r.stalled.Load() {
+		return 0, fmt.Errorf("%w: no data in %s", ErrRemoteStalled, r.timeout)
+	}
+	r.timer.Reset(r.timeout)
+	n, err := r.ReadCloser.Read(p)
+	r.timer.Stop()
+	if r.stalled.Load() {
+		return n, fmt.Errorf("%w: no data in %s", ErrRemoteStalled, r.timeout)
+	}
+	return n, err
+}
+
+func (r *stallReader) Close() error {
+	r.timer.Stop()
+	err := r.ReadCloser.Close()
+	r.abort()
+	return err
+}
@@ -0,0 +1,35 @@
+package crypt
+
+import (
+	"errors"
+	"net/textproto"
+
+	"github.com/alist-org/alist/v3/pkg/gowebdav"
+)
+
+// statusCoder is implemented by the errors of remotes that keep the HTTP status, e.g. the S3 request failures
+type statusCoder interface {
+	StatusCode() int
+}
+
+// httpStatus returns the HTTP status a remote error was answered with, 0 if the error doesn't keep it
+func httpStatus(err error) int {
+	var coder statusCoder
+	if errors.As(err, &coder) {
+		return coder.StatusCode()
+	}
+	var webdavErr gowebdav.StatusError
+	if errors.As(err, &webdavErr) {
+		return webdavErr.Status
+	}
+	return 0
+}
+
+// ftpCode returns the reply code of an error of an FTP remote, 0 for other errors
+func ftpCode(err error) int {
+	var ftpErr *textproto.Error
+	if errors.As(err, &ftpErr) {
+		return ftpErr.Code
+	}
+	return 0
+}
@@ -0,0 +1,113 @@
+package crypt
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// streamSlots holds a token for every decrypt stream open from Link, nil when MaxStreams is 0
+type streamSlots chan struct{}
+
+func newStreamSlots(max int) streamSlots {
+	if max <= 0 {
+		return nil
+	}
+	return make(streamSlots, max)
+}
+
+// acquireStream takes a slot for a new stream, waiting up to StreamQueueTimeout for one to be released.
+// the link may outlive the request it was made for, so the wait isn't bound to a context
+func (d *Crypt) acquireStream() (release func(), err error) {
+	slots := d.streams
+	if slots == nil {
+		return func() {}, nil
+	}
+	release = func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	timeout := time.Duration(d.StreamQueueTimeout) * time.Second
+	if timeout <= 0 {
+		return nil, fmt.Errorf("%w: %d streams are open", ErrTooManyStreams, cap(slots))
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: %d streams are open, none closed in %s", ErrTooManyStreams, cap(slots), timeout)
+	}
+}
+
+// slotReader releases the slot of its stream when it is closed, or once it is read to the end or fails
+type slotReader struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+	slots   *linkSlots
+}
+
+func (r *slotReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil {
+		r.releaseSlot()
+	}
+	return n, err
+}
+
+func (r *slotReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.releaseSlot()
+	return err
+}
+
+func (r *slotReader) releaseSlot() {
+	r.once.Do(func() {
+		r.release()
+		r.slots.forget(r)
+	})
+}
+
+// linkSlots are the slots held by the streams of a link. net.ServeHTTP doesn't close the readers of
+// RangeReader, and may stop reading them right before the end, only the Closers of the link are
+// closed once the request is served. linkSlots is one of them, it releases the slots still held
+type linkSlots struct {
+	mu      sync.Mutex
+	readers map[*slotReader]struct{}
+}
+
+func newLinkSlots() *linkSlots {
+	return &linkSlots{readers: make(map[*slotReader]struct{})}
+}
+
+// reader returns rc holding the slot release releases
+func (s *linkSlots) reader(rc io.ReadCloser, release func()) *slotReader {
+	r := &slotReader{ReadCloser: rc, release: release, slots: s}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readers[r] = struct{}{}
+	return r
+}
+
+func (s *linkSlots) forget(r *slotReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.readers, r)
+}
+
+// Close releases the slots of the streams of the link not released yet, the streams are left open
+func (s *linkSlots) Close() error {
+	s.mu.Lock()
+	readers := s.readers
+	s.readers = make(map[*slotReader]struct{})
+	s.mu.Unlock()
+	for r := range readers {
+		r.releaseSlot()
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package crypt
+
+import "github.com/alist-org/alist/v3/internal/model"
+
+// thumbnailsPassthrough is the Thumbnails option that shows the thumbnails of the remote
+const thumbnailsPassthrough = "passthrough"
+
+// remoteThumb returns the thumbnail of the remote object obj to show with Thumbnails. a remote makes
+// its thumbnails from what it stores, the ciphertext, they are only shown if the user says they work
+func (d *Crypt) remoteThumb(obj model.Obj) (string, bool) {
+	if d.Thumbnails != thumbnailsPassthrough {
+		return "", false
+	}
+	return model.GetThumb(obj)
+}
@@ -0,0 +1,32 @@
+package crypt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestThumbnails(t *testing.T) {
+	ctx := context.Background()
+	for _, lazy := range []bool{false, true} {
+		for policy, expect := range map[string]bool{"": false, "suppress": false, "passthrough": true} {
+			m, remote := newTestRemote(t, linkModeRange)
+			d := newTestCrypt(t, remote, map[string]interface{}{"thumbnails": policy, "lazy_decrypt": lazy})
+			putFile(t, d, "/", "a.jpg", testData(100))
+			m.thumbs = true
+			objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(objs) != 1 {
+				t.Fatalf("expect 1 object, got %d", len(objs))
+			}
+			thumb, ok := model.GetThumb(objs[0])
+			if ok != expect || expect && thumb != "thumb:/"+d.cipher.EncryptFileName("a.jpg") {
+				t.Errorf("lazy %v, %q: expect a thumbnail %v, got %q", lazy, policy, expect, thumb)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+	"strconv"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	log "github.com/sirupsen/logrus"
+)
+
+// trashDirName is the directory in the remote root that removed objects are moved to with Trash.
+// every removed object gets a directory in it, holding the object and its trashInfoName
+const (
+	trashDirName  = ".alist_trash"
+	trashInfoName = "info" + metaSidecarSuffix
+)
+
+// trashInfo is what is kept about a removed object to restore it
+type trashInfo struct {
+	TrashEntry
+	// RemoteName is the name of the object on the remote
+	RemoteName string `json:"remote_name"`
+}
+
+// getTrashActualPath returns the remote actual path of the trash, joined with elem
+func (d *Crypt) getTrashActualPath(elem ...string) (string, error) {
+	_, rootActualPath, err := op.GetStorageAndActualPath(d.remoteRoot)
+	if err != nil {
+		return "", err
+	}
+	return stdpath.Join(append([]string{rootActualPath, trashDirName}, elem...)...), nil
+}
+
+// trash moves the object at remoteActualPath into a new entry of the trash
+func (d *Crypt) trash(ctx context.Context, obj model.Obj, remoteActualPath string) error {
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+	entryPath, err := d.getTrashActualPath(id)
+	if err != nil {
+		return err
+	}
+	err = op.MakeDir(ctx, d.remoteStorage, entryPath)
+	if err != nil {
+		return fmt.Errorf("failed to create trash entry: %w", err)
+	}
+	info := trashInfo{
+		TrashEntry: TrashEntry{ID: id, Path: obj.GetPath(), IsDir: obj.IsDir(), Deleted: time.Now()},
+		RemoteName: stdpath.Base(remoteActualPath),
+	}
+	err = d.writeEncryptedJson(ctx, stdpath.Join(entryPath, trashInfoName), &info)
+	if err == nil {
+		err = op.Move(ctx, d.remoteStorage, remoteActualPath, entryPath)
+	}
+	if err != nil {
+		if err := op.Remove(ctx, d.remoteStorage, entryPath); err != nil {
+			log.Warnf("failed to remove trash entry %s: %s", entryPath, err)
+		}
+		return err
+	}
+	d.syncSidecar(ctx, obj, func(sidecarPath string) error {
+		return op.Move(ctx, d.remoteStorage, sidecarPath, entryPath)
+	})
+	if !obj.IsDir() {
+		d.syncVersions(ctx, remoteActualPath, func(versionPath string) error {
+			return op.Move(ctx, d.remoteStorage, versionPath, entryPath)
+		})
+	}
+	return nil
+}
+
+// ListTrash returns the objects in the trash, entries that can't be read are skipped
+func (d *Crypt) ListTrash(ctx context.Context) ([]TrashEntry, error) {
+	if err := d.resolve(ctx); err != nil {
+		return nil, err
+	}
+	trashPath, err := d.getTrashActualPath()
+	if err != nil {
+		return nil, err
+	}
+	objs, err := op.List(ctx, d.remoteStorage, trashPath, model.ListArgs{}, true)
+	if err != nil {
+		if errs.IsObjectNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var res []TrashEntry
+	for _, obj := range objs {
+		var info trashInfo
+		err = d.readEncryptedJson(ctx, stdpath.Join(trashPath, obj.GetName(), trashInfoName), &info)
+		if err != nil {
+			log.Warnf("failed to read trash entry %s: %s", obj.GetName(), err)
+			continue
+		}
+		info.ID = obj.GetName()
+		res = append(res, info.TrashEntry)
+	}
+	return res, nil
+}
+
+// RestoreTrash moves the object of the trash entry id back to where it was removed from,
+// it fails if an object has taken its place since
+func (d *Crypt) RestoreTrash(ctx context.Context, id string) error {
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	if id == "" || id != stdpath.Base(id) {
+		return fmt.Errorf("%w: trash entry %q", ErrInvalidName, id)
+	}
+	entryPath, err := d.getTrashActualPath(id)
+	if err != nil {
+		return err
+	}
+	var info trashInfo
+	err = d.readEncryptedJson(ctx, stdpath.Join(entryPath, trashInfoName), &info)
+	if err != nil {
+		return fmt.Errorf("failed to read trash entry %s: %w", id, err)
+	}
+	dstDirActualPath, err := d.getActualPathForRemote(stdpath.Dir(info.Path), true)
+	if err != nil {
+		return fmt.Errorf("failed to convert path to remote path: %w", err)
+	}
+	if _, err = op.GetUnwrap(ctx, d.remoteStorage, stdpath.Join(dstDirActualPath, info.RemoteName)); err == nil {
+		return fmt.Errorf("can't restore %s, it exists", info.Path)
+	}
+	err = op.MakeDir(ctx, d.remoteStorage, dstDirActualPath)
+	if err != nil {
+		return err
+	}
+	err = op.Move(ctx, d.remoteStorage, stdpath.Join(entryPath, info.RemoteName), dstDirActualPath)
+	if err != nil {
+		return err
+	}
+	// the restored object may be a whole tree, and its parents may have been made again
+	d.index.reset()
+	sidecarPath := stdpath.Join(entryPath, info.RemoteName+metaSidecarSuffix)
+	if _, err = op.GetUnwrap(ctx, d.remoteStorage, sidecarPath); err == nil {
+		if err = op.Move(ctx, d.remoteStorage, sidecarPath, dstDirActualPath); err != nil {
+			log.Warnf("failed to restore meta sidecar %s: %s", sidecarPath, err)
+		}
+	}
+	if !info.IsDir {
+		d.syncVersions(ctx, stdpath.Join(entryPath, info.RemoteName), func(versionPath string) error {
+			return op.Move(ctx, d.remoteStorage, versionPath, dstDirActualPath)
+		})
+	}
+	return op.Remove(ctx, d.remoteStorage, entryPath)
+}
+
+// EmptyTrash permanently removes everything in the trash
+func (d *Crypt) EmptyTrash(ctx context.Context) error {
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	trashPath, err := d.getTrashActualPath()
+	if err != nil {
+		return err
+	}
+	return op.Remove(ctx, d.remoteStorage, trashPath)
+}
@@ -0,0 +1,71 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestTrash(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"trash": true})
+	a, b := testData(100), testData(200)
+	putFile(t, d, "/dir", "a.txt", a)
+	putFile(t, d, "/", "b.txt", b)
+
+	if err := op.Remove(ctx, d, "/dir/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Remove(ctx, d, "/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := op.List(ctx, d, "/", model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "dir" {
+		t.Errorf("expect only dir to be listed, got %+v", objs)
+	}
+	if _, err := op.Get(ctx, d, "/dir/a.txt"); err == nil {
+		t.Errorf("expect a.txt to be gone")
+	}
+
+	entries, err := d.ListTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 trash entries, got %+v", entries)
+	}
+	for _, entry := range entries {
+		if entry.Path == "/dir/a.txt" {
+			if err := d.RestoreTrash(ctx, entry.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if got := readRange(t, d, "/dir/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, a) {
+		t.Errorf("read mismatch of restored a.txt")
+	}
+	if entries, _ := d.ListTrash(ctx); len(entries) != 1 || entries[0].Path != "/b.txt" {
+		t.Errorf("expect b.txt to be left in the trash, got %+v", entries)
+	}
+
+	if err := d.EmptyTrash(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := d.ListTrash(ctx); len(entries) != 0 {
+		t.Errorf("expect an empty trash, got %+v", entries)
+	}
+	for _, p := range m.paths() {
+		if strings.HasPrefix(p, "/"+trashDirName) {
+			t.Errorf("expect the trash to be gone from the remote, got %s", p)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+// typeName names the type of an object in errors
+func typeName(isDir bool) string {
+	if isDir {
+		return "a directory"
+	}
+	return "a file"
+}
+
+// checkRemoteType fails with ErrTypeMismatch if the object at remoteActualPath is not of the type the
+// operation expects, e.g. a file replaced by a directory since it was listed. that a directory is
+// removed or written over instead of a file would be worse than the operation failing.
+// an object not found is left to the operation to report
+func (d *Crypt) checkRemoteType(ctx context.Context, path, remoteActualPath string, isDir bool) error {
+	remoteObj, err := op.Get(ctx, d.remoteStorage, remoteActualPath)
+	if err != nil || remoteObj.IsDir() == isDir {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is %s on the remote, expected %s", ErrTypeMismatch, path, typeName(remoteObj.IsDir()), typeName(isDir))
+}
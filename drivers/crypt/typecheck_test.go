@@ -0,0 +1,54 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+)
+
+func TestRemoteTypeMismatch(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	putFile(t, d, "/", "a.txt", testData(100))
+	file, err := op.Get(ctx, d, "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Get(ctx, "/a.txt/"); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("expect a file asked for as a directory to be refused, got %v", err)
+	}
+
+	// another client replaces the file by a directory of the same name
+	remoteFile := "/" + d.EncryptName("a.txt", false)
+	m.mu.Lock()
+	delete(m.nodes, remoteFile)
+	m.mu.Unlock()
+	m.putDir(remoteFile)
+	m.putFile(remoteFile+"/"+d.EncryptName("b.txt", false), testData(10))
+	op.ClearCache(d.remoteStorage, "/")
+
+	file = model.UnwrapObj(file)
+	if _, err = d.Link(ctx, file, model.LinkArgs{}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("link: expect ErrTypeMismatch, got %v", err)
+	}
+	if err = d.Remove(ctx, file); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("remove: expect ErrTypeMismatch, got %v", err)
+	}
+	if err = d.Rename(ctx, file, "c.txt"); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("rename: expect ErrTypeMismatch, got %v", err)
+	}
+	root, _ := d.Get(ctx, "/")
+	if err = d.Copy(ctx, file, root); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("copy: expect ErrTypeMismatch, got %v", err)
+	}
+	if err = putStream(d, "/", "a.txt", testData(100)); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("put: expect ErrTypeMismatch, got %v", err)
+	}
+	if _, ok := m.read(remoteFile + "/" + d.EncryptName("b.txt", false)); !ok {
+		t.Errorf("expect the directory to be kept, got %v", m.paths())
+	}
+}
@@ -1 +1,218 @@
 package crypt
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+)
+
+// ErrNameTooLong is returned when the encrypted name of an object is longer than MaxNameLength
+var ErrNameTooLong = errors.New("encrypted name is too long")
+
+// ErrInvalidName is returned when a new name is not a single path element, or is reserved
+var ErrInvalidName = errors.New("invalid name")
+
+// ErrNameCollision is returned when a name would be stored under a remote name that a case
+// insensitive remote can't tell from the remote name of another object
+var ErrNameCollision = errors.New("remote name collides with another one on a case insensitive remote")
+
+// ErrUnknownSize is returned for uploads of unknown size, unless UnknownSizeUpload is set
+var ErrUnknownSize = errors.New("the size of the upload is unknown and the remote needs it")
+
+// ErrNotVisible is returned by Put when the upload succeeded but the remote doesn't show it within ConfirmPutTimeout
+var ErrNotVisible = errors.New("uploaded, but not visible on the remote yet")
+
+// ErrNoSpace is returned by Put when the remote has less free space than the encrypted upload needs
+var ErrNoSpace = errors.New("not enough free space on the remote")
+
+// ErrTypeMismatch is returned when the remote has a directory where a file was expected, or the other way round
+var ErrTypeMismatch = errors.New("object type changed on the remote")
+
+// ErrTooManyStreams is returned by the readers of Link when MaxStreams streams are open
+var ErrTooManyStreams = errors.New("too many streams")
+
+// ErrRemoteStalled is returned when a read of the remote makes no progress for RemoteReadTimeout
+var ErrRemoteStalled = errors.New("remote read stalled")
+
+// NameDecoding is a remote name decrypted with one filename encoding, Error is set if it doesn't decrypt
+type NameDecoding struct {
+	Encoding string `json:"encoding"`
+	Name     string `json:"name,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// DecryptedName is a result of the decrypt_names method, Error is set if the name doesn't decrypt
+type DecryptedName struct {
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Credentials are a candidate password and salt for TryCredentials, not obscured
+type Credentials struct {
+	Password string `json:"password"`
+	Salt     string `json:"salt"`
+}
+
+// CredentialResult tells how many of the sampled remote names the candidate Index decrypted,
+// Match is set if it decrypted all of them
+type CredentialResult struct {
+	Index     int  `json:"index"`
+	Decrypted int  `json:"decrypted"`
+	Total     int  `json:"total"`
+	Match     bool `json:"match"`
+}
+
+// HealthStatus is the result of a health check on a Crypt storage
+type HealthStatus struct {
+	RemoteResolved bool   `json:"remote_resolved"`
+	CipherReady    bool   `json:"cipher_ready"`
+	RemoteListable bool   `json:"remote_listable"`
+	Error          string `json:"error,omitempty"`
+}
+
+func (s HealthStatus) Healthy() bool {
+	return s.RemoteResolved && s.CipherReady && s.RemoteListable
+}
+
+// Capabilities are the operations the remote storage of a Crypt storage supports
+type Capabilities struct {
+	// Range is false once the remote answered a ranged request with the whole file
+	Range       bool `json:"supports_range"`
+	Copy        bool `json:"supports_copy"`
+	Rename      bool `json:"supports_rename"`
+	BatchDelete bool `json:"supports_batch_delete"`
+	SetModtime  bool `json:"supports_set_modtime"`
+}
+
+// ObjMeta is the metadata of an object, persisted encrypted in a sidecar next to the object on the remote
+type ObjMeta struct {
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"`
+	// SHA1 is the hash of the plaintext content of a file, kept with PlaintextHash
+	SHA1 string `json:"sha1,omitempty"`
+	// Modified is the modification time of a file when it was uploaded, kept with ZeroModified sidecar
+	Modified *time.Time `json:"modified,omitempty"`
+	// Metadata is the metadata map a file was uploaded with, kept with PreserveMetadata
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// ContentValid tells whether the content of a file decrypts, with ContentCheck. it isn't persisted
+	ContentValid *bool `json:"content_valid,omitempty"`
+}
+
+// TrashEntry is an object that was removed to the trash
+type TrashEntry struct {
+	ID      string    `json:"id"`
+	Path    string    `json:"path"`
+	IsDir   bool      `json:"is_dir"`
+	Deleted time.Time `json:"deleted"`
+}
+
+// FileVersion is a previous version of a file kept with Versions, Modified is when it was replaced
+type FileVersion struct {
+	ID       string    `json:"id"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// ObjectCount is the number of files and directories in a Crypt storage
+type ObjectCount struct {
+	Files int `json:"files"`
+	Dirs  int `json:"dirs"`
+}
+
+// ManifestEntry is an object listed by Export. Error is set for a remote object that doesn't decrypt,
+// Path then ends with its remote name
+type ManifestEntry struct {
+	Path     string    `json:"path"`
+	IsDir    bool      `json:"is_dir"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// ImportResult counts the files handled by an import or by CopyTo
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+	// Failed is the number of files that failed to copy, they are listed by the *FilesError returned
+	Failed int `json:"failed"`
+}
+
+// ImportTask is the task of fs.CopyTaskManager an import through Other runs in
+type ImportTask struct {
+	ID uint64 `json:"id"`
+}
+
+// CopyProgress is the progress of a Copy or Move, in files and their decrypted bytes
+type CopyProgress struct {
+	Files      int   `json:"files"`
+	TotalFiles int   `json:"total_files"`
+	Bytes      int64 `json:"bytes"`
+	TotalBytes int64 `json:"total_bytes"`
+}
+
+// OrphanDir is a directory on the remote that holds nothing the storage can decrypt
+type OrphanDir struct {
+	// RemotePath is the full path of the directory, including the mount path of the remote storage
+	RemotePath string `json:"remote_path"`
+	// Foreign is set if the name of the directory doesn't decrypt
+	Foreign bool `json:"foreign"`
+}
+
+// DecryptFailures counts the decryption failures of a storage since it was initialized
+type DecryptFailures struct {
+	Names   int64 `json:"names"`
+	Sizes   int64 `json:"sizes"`
+	Content int64 `json:"content"`
+	// Collisions counts remote names hidden because another one decrypts to the same name
+	Collisions int64 `json:"collisions"`
+}
+
+type decryptFailureCounters struct {
+	names      atomic.Int64
+	sizes      atomic.Int64
+	content    atomic.Int64
+	collisions atomic.Int64
+}
+
+func (d *Crypt) DecryptFailures() DecryptFailures {
+	return DecryptFailures{
+		Names:      d.failures.names.Load(),
+		Sizes:      d.failures.sizes.Load(),
+		Content:    d.failures.content.Load(),
+		Collisions: d.failures.collisions.Load(),
+	}
+}
+
+// isDecryptError tells errors of undecryptable content from i/o errors
+func isDecryptError(err error) bool {
+	for _, decryptErr := range []error{
+		rcCrypt.ErrorEncryptedFileTooShort,
+		rcCrypt.ErrorEncryptedFileBadHeader,
+		rcCrypt.ErrorEncryptedBadMagic,
+		rcCrypt.ErrorEncryptedBadBlock,
+	} {
+		if errors.Is(err, decryptErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// failureCountingReader counts a content decryption failure found while reading, once per reader
+type failureCountingReader struct {
+	io.ReadCloser
+	d      *Crypt
+	failed bool
+}
+
+func (r *failureCountingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && !r.failed && isDecryptError(err) {
+		r.failed = true
+		r.d.failures.content.Add(1)
+	}
+	return n, err
+}
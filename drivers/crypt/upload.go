@@ -0,0 +1,103 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	stdpath "path"
+	"syscall"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	log "github.com/sirupsen/logrus"
+)
+
+// uploadingSuffix is appended to the encrypted name of a file while it is uploaded with AtomicPut
+const uploadingSuffix = ".alist_uploading"
+
+// commitUpload replaces the object named encryptedName in remote dir dirPath by the finished upload
+func (d *Crypt) commitUpload(ctx context.Context, dirPath, uploadName, encryptedName string) error {
+	dstPath := stdpath.Join(dirPath, encryptedName)
+	if _, err := op.GetUnwrap(ctx, d.remoteStorage, dstPath); err == nil {
+		if err = op.Remove(ctx, d.remoteStorage, dstPath); err != nil {
+			d.removeUpload(stdpath.Join(dirPath, uploadName))
+			return err
+		}
+	}
+	return op.Rename(ctx, d.remoteStorage, stdpath.Join(dirPath, uploadName), encryptedName)
+}
+
+// the polling of confirmPut starts at confirmMinDelay and doubles up to confirmMaxDelay
+const (
+	confirmMinDelay = 100 * time.Millisecond
+	confirmMaxDelay = 2 * time.Second
+)
+
+// confirmPut waits until the remote lists name in the remote dir dirPath, for eventually consistent remotes.
+// the listing is refreshed each time, it gives up after ConfirmPutTimeout or when ctx is done
+func (d *Crypt) confirmPut(ctx context.Context, dirPath, name string) error {
+	timeout := time.Duration(d.ConfirmPutTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	delay := confirmMinDelay
+	for {
+		objs, err := op.List(ctx, d.remoteStorage, dirPath, model.ListArgs{}, true)
+		if err == nil {
+			for _, obj := range objs {
+				if obj.GetName() == name {
+					return nil
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s not listed after %s", ErrNotVisible, stdpath.Join(dirPath, name), timeout)
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > confirmMaxDelay {
+			delay = confirmMaxDelay
+		}
+	}
+}
+
+// cleanupTimeout bounds the removal of a failed upload
+const cleanupTimeout = 30 * time.Second
+
+// removeUpload removes what was left by a failed upload, best effort.
+// it doesn't use the context of the upload, which may be the cause of the failure
+func (d *Crypt) removeUpload(uploadPath string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if err := op.Remove(ctx, d.remoteStorage, uploadPath); err != nil {
+		log.Warnf("failed to remove incomplete upload %s: %s", uploadPath, err)
+	}
+}
+
+// classifyPutError wraps the error of a remote upload with errs.QuotaExceeded if the remote ran out of space:
+// a local disk or quota that is full, HTTP 507 Insufficient Storage or the FTP replies 452 and 552
+func classifyPutError(err error) error {
+	if err == nil || errors.Is(err, errs.QuotaExceeded) {
+		return err
+	}
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) ||
+		httpStatus(err) == http.StatusInsufficientStorage || ftpCode(err) == 452 || ftpCode(err) == 552 {
+		return fmt.Errorf("%w: %w", errs.QuotaExceeded, err)
+	}
+	return err
+}
+
+// byteCounter counts the bytes read through it
+type byteCounter struct {
+	io.Reader
+	n int64
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,223 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/gowebdav"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func putStream(d *Crypt, dir, name string, data []byte) error {
+	return op.Put(context.Background(), d, dir, &model.FileStream{
+		Obj: &model.Object{
+			Name:     name,
+			Size:     int64(len(data)),
+			Modified: time.Now(),
+		},
+		ReadCloser: io.NopCloser(bytes.NewReader(data)),
+	}, nil)
+}
+
+func TestAtomicPut(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"atomic_put": true})
+	old := testData(100)
+	putFile(t, d, "/", "a.txt", old)
+
+	m.putFailAfter = 50
+	if err := putStream(d, "/", "a.txt", testData(1000)); err == nil {
+		t.Fatal("expect put to fail")
+	}
+	if paths := m.paths(); len(paths) != 2 {
+		t.Errorf("expect no upload leftovers, got %v", paths)
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, old) {
+		t.Errorf("expect the old content to survive a failed upload")
+	}
+	if err := putStream(d, "/", "b.txt", testData(1000)); err == nil {
+		t.Fatal("expect put to fail")
+	}
+	if _, ok := m.read("/" + d.cipher.EncryptFileName("b.txt")); ok {
+		t.Errorf("expect no partial object at the final path")
+	}
+
+	m.putFailAfter = 0
+	data := testData(1000)
+	putFile(t, d, "/", "a.txt", data)
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("expect overwritten content")
+	}
+	if paths := m.paths(); len(paths) != 2 {
+		t.Errorf("expect no upload leftovers, got %v", paths)
+	}
+}
+
+func TestPutCleanupOnCancel(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	m.putFailAfter = 50
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := op.Put(ctx, d, "/", &model.FileStream{
+		Obj:        &model.Object{Name: "a.txt", Size: 1000},
+		ReadCloser: io.NopCloser(bytes.NewReader(testData(1000))),
+	}, nil)
+	if err == nil {
+		t.Fatal("expect put to fail")
+	}
+	if paths := m.paths(); len(paths) != 1 {
+		t.Errorf("expect no leftover on the remote, got %v", paths)
+	}
+
+	m.putFailAfter = 0
+	putFile(t, d, "/", "a.txt", testData(1000))
+	if paths := m.paths(); len(paths) != 2 {
+		t.Errorf("expect the uploaded file to be kept, got %v", paths)
+	}
+}
+
+func TestPutQuotaExceeded(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	for _, remoteErr := range []error{
+		&os.PathError{Op: "Put", Path: "/a.txt", Err: gowebdav.StatusError{Status: http.StatusInsufficientStorage}},
+		&os.PathError{Op: "write", Path: "/a.txt", Err: syscall.ENOSPC},
+		fmt.Errorf("upload failed: %w", &textproto.Error{Code: 552, Msg: "Quota exceeded"}),
+	} {
+		m.putErr = remoteErr
+		err := putStream(d, "/", "a.txt", testData(10))
+		if !errors.Is(err, errs.QuotaExceeded) || !errors.Is(err, remoteErr) {
+			t.Errorf("expect a quota error wrapping the remote error, got %v", err)
+		}
+	}
+
+	for _, remoteErr := range []error{
+		errors.New("connection reset"),
+		// only the type of the error counts, not what it says
+		errors.New("upload failed: 403 storageQuotaExceeded"),
+		&os.PathError{Op: "Put", Path: "/a.txt", Err: gowebdav.StatusError{Status: http.StatusForbidden}},
+	} {
+		m.putErr = remoteErr
+		if err := putStream(d, "/", "a.txt", testData(10)); err == nil || errors.Is(err, errs.QuotaExceeded) {
+			t.Errorf("expect an unclassified error, got %v", err)
+		}
+	}
+}
+
+func TestPutUnknownSize(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"unknown_size_upload": true})
+	data := testData(150 * 1024)
+	put := func(d *Crypt) error {
+		return op.Put(context.Background(), d, "/", &model.FileStream{
+			Obj: &model.Object{
+				Name:     "live.ts",
+				Size:     -1,
+				Modified: time.Now(),
+			},
+			ReadCloser: io.NopCloser(bytes.NewReader(data)),
+		}, nil)
+	}
+	if err := put(d); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.putSizes[len(m.putSizes)-1]; got != -1 {
+		t.Errorf("expect the remote to get an unknown size, got %d", got)
+	}
+	obj, err := op.Get(context.Background(), d, "/live.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetSize() != int64(len(data)) {
+		t.Errorf("expect size %d, got %d", len(data), obj.GetSize())
+	}
+	if got := readRange(t, d, "/live.ts", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("read mismatch")
+	}
+
+	_, remote = newTestRemote(t, linkModeRange)
+	refusing := newTestCrypt(t, remote, nil)
+	if err := put(refusing); !errors.Is(err, ErrUnknownSize) {
+		t.Errorf("expect ErrUnknownSize, got %v", err)
+	}
+}
+
+func TestPutConfirm(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"confirm_put_timeout": 5})
+	m.hideFor = 500 * time.Millisecond
+	start := time.Now()
+	if err := putStream(d, "/", "a.txt", testData(10)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < m.hideFor {
+		t.Errorf("expect Put to wait for the file to show up, returned after %s", elapsed)
+	}
+	if _, err := op.Get(context.Background(), d, "/a.txt"); err != nil {
+		t.Errorf("expect the file to be visible once Put returns, got %v", err)
+	}
+
+	d.ConfirmPutTimeout = 1
+	m.hideFor = time.Minute
+	start = time.Now()
+	if err := putStream(d, "/", "b.txt", testData(10)); !errors.Is(err, ErrNotVisible) {
+		t.Errorf("expect ErrNotVisible, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expect Put to give up after the timeout, took %s", elapsed)
+	}
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"check_free_space": true})
+	m.freeSpace = 1000
+	if err := putStream(d, "/", "small.txt", testData(500)); err != nil {
+		t.Fatal(err)
+	}
+	// fits in plaintext, not once encrypted
+	err := putStream(d, "/", "large.txt", testData(990))
+	if !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("expect ErrNoSpace, got %v", err)
+	}
+	if len(m.putSizes) != 1 {
+		t.Errorf("expect the upload to be refused before it is sent, got sizes %v", m.putSizes)
+	}
+
+	m.freeSpace = 0
+	if err = putStream(d, "/", "large.txt", testData(990)); err != nil {
+		t.Errorf("expect no check when the remote can't tell its free space, got %v", err)
+	}
+	m.freeSpace = 10
+	unchecked := newTestCrypt(t, remote, nil)
+	if err = putStream(unchecked, "/", "other.txt", testData(990)); err != nil {
+		t.Errorf("expect no check when it's off, got %v", err)
+	}
+}
+
+func TestContentTypeHint(t *testing.T) {
+	m, remote := newTestRemote(t, linkModeRange)
+	hidden := newTestCrypt(t, remote, nil)
+	hinted := newTestCrypt(t, remote, map[string]interface{}{"content_type_hint": true})
+	for _, d := range []*Crypt{hidden, hinted} {
+		if err := putStream(d, "/", "photo.jpg", testData(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(m.putMimetypes) != 2 || m.putMimetypes[0] != "application/octet-stream" || m.putMimetypes[1] != "image/jpeg" {
+		t.Errorf("unexpected content types %v", m.putMimetypes)
+	}
+}
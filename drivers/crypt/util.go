@@ -1,22 +1,282 @@
 package crypt
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
 	"net/http"
 	stdpath "path"
-	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/fs"
 	"github.com/alist-org/alist/v3/internal/model"
 	"github.com/alist-org/alist/v3/internal/net"
 	"github.com/alist-org/alist/v3/internal/op"
 	"github.com/alist-org/alist/v3/pkg/http_range"
+	"github.com/alist-org/alist/v3/pkg/utils"
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/scrypt"
 )
 
 func RequestRangedHttp(r *http.Request, link *model.Link, offset, length int64) (*http.Response, error) {
+	return requestRangedHttp(context.Background(), r, link, offset, length)
+}
+
+// requestRangedHttp is RequestRangedHttp that is aborted when ctx is done
+func requestRangedHttp(ctx context.Context, r *http.Request, link *model.Link, offset, length int64) (*http.Response, error) {
 	header := net.ProcessHeader(http.Header{}, link.Header)
+	if header.Get("User-Agent") == "" && r != nil && r.UserAgent() != "" {
+		header.Set("User-Agent", r.UserAgent())
+	}
 	header = http_range.ApplyRangeToHttpHeader(http_range.Range{Start: offset, Length: length}, header)
+	// ranges of a compressed body are meaningless for decryption
+	header.Set("Accept-Encoding", "identity")
+
+	return net.RequestHttpWithContext(ctx, "GET", header, link.URL)
+}
+
+const (
+	kdfStandard = "standard"
+	kdfHardened = "hardened"
+)
+
+// newCipher builds the cipher described by a, password and salt are obscured.
+// rclone derives the content key and the name keys together from both, a store can't change
+// the keys of its names alone, only copy everything to a store with new credentials
+func newCipher(a *Addition, password, salt string) (*rcCrypt.Cipher, error) {
+	if a.Kdf == kdfHardened {
+		var err error
+		password, err = hardenPassword(password, salt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	encoding := a.FileNameEncoding
+	if encoding == "" {
+		encoding = "base32"
+	}
+	config := configmap.Simple{
+		"password":                  password,
+		"password2":                 salt,
+		"filename_encryption":       a.FileNameEnc,
+		"directory_name_encryption": a.DirNameEnc,
+		"filename_encoding":         encoding,
+		"suffix":                    a.EncryptedSuffix,
+		"pass_bad_blocks":           "",
+	}
+	return rcCrypt.NewCipher(config)
+}
+
+// hardenedKeysSize bounds the keys kept by hardenedKeys
+const hardenedKeysSize = 64
+
+// hardenedKeys keeps the keys hardenPassword derived by a hash of the password and salt, scrypt at
+// that cost takes 128 MB and a good part of a second, and runs for every cipher built and every
+// credential tried. deriving holds the derivations to one at a time
+var hardenedKeys = struct {
+	mu       sync.Mutex
+	deriving sync.Mutex
+	keys     map[[sha256.Size]byte]string
+}{keys: make(map[[sha256.Size]byte]string)}
+
+// hardenPassword stretches the password with scrypt at 8 times the cost rclone uses,
+// the result is fed to rclone's own key derivation
+func hardenPassword(password, salt string) (string, error) {
+	plainPassword, err := obscure.Reveal(password)
+	if err != nil {
+		return "", err
+	}
+	plainSalt, err := obscure.Reveal(salt)
+	if err != nil {
+		return "", err
+	}
+	id := sha256.Sum256([]byte(strconv.Quote(plainPassword) + strconv.Quote(plainSalt)))
+	key, ok := hardenedKey(id)
+	if !ok {
+		hardenedKeys.deriving.Lock()
+		defer hardenedKeys.deriving.Unlock()
+		// derived while waiting
+		if key, ok = hardenedKey(id); !ok {
+			derived, err := scrypt.Key([]byte(plainPassword), []byte("alist-crypt-hardened"+plainSalt), 1<<17, 8, 1, 32)
+			if err != nil {
+				return "", err
+			}
+			key = base64.RawStdEncoding.EncodeToString(derived)
+			hardenedKeys.mu.Lock()
+			if len(hardenedKeys.keys) >= hardenedKeysSize {
+				// no order to keep, any one makes room
+				for id := range hardenedKeys.keys {
+					delete(hardenedKeys.keys, id)
+					break
+				}
+			}
+			hardenedKeys.keys[id] = key
+			hardenedKeys.mu.Unlock()
+		}
+	}
+	return obscure.Obscure(key)
+}
+
+func hardenedKey(id [sha256.Size]byte) (string, bool) {
+	hardenedKeys.mu.Lock()
+	defer hardenedKeys.mu.Unlock()
+	key, ok := hardenedKeys.keys[id]
+	return key, ok
+}
+
+// checkKdf refuses to apply a different kdf to a store that already has data,
+// stores created before the kdf option was added used the standard one
+func (d *Crypt) checkKdf(ctx context.Context) error {
+	kdf, applied := d.Kdf, d.KdfApplied
+	if kdf == "" {
+		kdf = kdfStandard
+	}
+	if applied == "" {
+		applied = kdfStandard
+	}
+	if kdf != applied {
+		objs, err := fs.List(ctx, d.getPathForRemote("/", true), d.remoteListArgs())
+		if err != nil && !errs.IsObjectNotFound(err) {
+			// data the other kdf can't read may be there
+			return fmt.Errorf("can't change kdf from %s to %s, failed to check that the store is empty: %w", applied, kdf, err)
+		}
+		if len(objs) > 0 {
+			return fmt.Errorf("can't change kdf from %s to %s, the store is not empty", applied, kdf)
+		}
+	}
+	d.KdfApplied = kdf
+	return nil
+}
+
+// remoteHeader adds the configured User-Agent to the header of a remote link,
+// unless the link or the client request already has one
+func (d *Crypt) remoteHeader(r *http.Request, header http.Header) http.Header {
+	if d.UserAgent == "" || header.Get("User-Agent") != "" || (r != nil && r.UserAgent() != "") {
+		return header
+	}
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("User-Agent", d.UserAgent)
+	return header
+}
+
+// linkHeader returns the header of the remote link for a link to the decrypted file. the length
+// headers of the remote describe the encrypted file, they are dropped, the server of the link
+// sets the length of what it sends for each request
+func linkHeader(header http.Header) http.Header {
+	if header.Get("Content-Length") == "" && header.Get("Content-Range") == "" {
+		return header
+	}
+	header = header.Clone()
+	header.Del("Content-Length")
+	header.Del("Content-Range")
+	return header
+}
 
-	return net.RequestHttp("GET", header, link.URL)
+// decodeRangedHttpBody handles a remote that compressed the body in spite of Accept-Encoding: identity.
+// the range would apply to the compressed bytes, so the whole body is decoded and the range is cut out of it.
+// a partial body is requested again whole, with ctx and the User-Agent of r like the first request
+func decodeRangedHttpBody(ctx context.Context, r *http.Request, response *http.Response, link *model.Link, offset, length int64) (io.ReadCloser, error) {
+	encoding := strings.ToLower(response.Header.Get("Content-Encoding"))
+	if encoding != "gzip" && encoding != "x-gzip" {
+		_ = response.Body.Close()
+		return nil, fmt.Errorf("remote storage responded with unsupported Content-Encoding: %s", encoding)
+	}
+	log.Warnf("remote http server compressed the response, expect low perfromace!")
+	if response.StatusCode == http.StatusPartialContent {
+		_ = response.Body.Close()
+		var err error
+		response, err = requestRangedHttp(ctx, r, link, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	gz, err := gzip.NewReader(response.Body)
+	if err != nil {
+		_ = response.Body.Close()
+		return nil, err
+	}
+	return getRangedReader(utils.NewReadCloser(gz, response.Body.Close), offset, length)
+}
+
+// getRangedReader skips to offset of a reader that starts at 0, length -1 reads to the end
+func getRangedReader(readCloser io.ReadCloser, offset, length int64) (io.ReadCloser, error) {
+	if length >= 0 {
+		return net.GetRangedHttpReader(readCloser, offset, length)
+	}
+	if _, err := io.CopyN(io.Discard, readCloser, offset); err != nil {
+		return nil, err
+	}
+	return readCloser, nil
+}
+
+// rangedBody returns the requested range of the body of a 206 response, checking its Content-Range.
+// some remotes answer 206 but ignore the range, bytes before offset are skipped then, a body that
+// starts after offset, or whose start is unknown while it is longer than asked, is an error
+func rangedBody(response *http.Response, offset, length int64) (io.ReadCloser, error) {
+	start, ok := contentRangeStart(response.Header.Get("Content-Range"))
+	if !ok {
+		if length >= 0 && response.ContentLength > length {
+			_ = response.Body.Close()
+			return nil, fmt.Errorf("remote storage returned %d bytes without Content-Range for a range of %d bytes at %d",
+				response.ContentLength, length, offset)
+		}
+		return response.Body, nil
+	}
+	if start > offset {
+		_ = response.Body.Close()
+		return nil, fmt.Errorf("remote storage returned bytes from %d for a range from %d", start, offset)
+	}
+	if start < offset {
+		log.Warnf("remote http server returned bytes from %d for a range from %d, skipping to the range", start, offset)
+	}
+	if start == offset && (length < 0 || response.ContentLength >= 0 && response.ContentLength <= length) {
+		return response.Body, nil
+	}
+	return getRangedReader(response.Body, offset-start, length)
+}
+
+// contentRangeStart returns the first byte of a Content-Range header like "bytes 0-99/1000"
+func contentRangeStart(contentRange string) (int64, bool) {
+	spec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	return start, err == nil
+}
+
+// decodeOtherData converts the loosely typed data of an Other request into v
+func decodeOtherData(data interface{}, v interface{}) error {
+	b, err := utils.Json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return utils.Json.Unmarshal(b, v)
+}
+
+// cleanPath cleans path the way op does, so that every form of a path resolves to the same remote path.
+// dirHint is set when a trailing slash says path is a directory, unless IgnoreTrailingSlash
+func (d *Crypt) cleanPath(path string) (clean string, dirHint bool) {
+	dirHint = !d.IgnoreTrailingSlash && len(path) > 1 && strings.HasSuffix(path, "/")
+	return utils.FixAndCleanPath(path), dirHint
 }
 
 // will give the best guessing based on the path
@@ -33,23 +293,189 @@ func guessPath(path string) (isFolder, secondTry bool) {
 	return false, true
 }
 
+// getPathForRemote maps path of the storage to the remote, this is the layout of a store:
+// every directory segment is encrypted on its own with EncryptDirName, which leaves it as is unless
+// directory_name_encryption is on, the last segment of a file with EncryptFileName, and the result is
+// joined to remoteRoot. reserved names and plaintext directories of mixed stores are kept literally,
+// plainSuffix is added by the callers that know. paths are separated by / on both sides whatever the OS,
+// like everywhere in op. a remote using another separator internally converts at its own boundary,
+// the paths of its objects are only handed back to it
 func (d *Crypt) getPathForRemote(path string, isFolder bool) (remoteFullPath string) {
+	path = utils.FixAndCleanPath(path)
 	if isFolder && !strings.HasSuffix(path, "/") {
 		path = path + "/"
 	}
-	dir, fileName := filepath.Split(path)
+	dir, fileName := stdpath.Split(path)
 
-	remoteDir := d.cipher.EncryptDirName(dir)
+	remoteDir := d.encryptDirPath(dir)
 	remoteFileName := ""
-	if len(strings.TrimSpace(fileName)) > 0 {
+	if isReservedName(fileName) {
+		// reserved files are stored under their literal name
+		remoteFileName = fileName
+	} else if len(strings.TrimSpace(fileName)) > 0 {
 		remoteFileName = d.cipher.EncryptFileName(fileName)
 	}
-	return stdpath.Join(d.RemotePath, remoteDir, remoteFileName)
+	return stdpath.Join(d.remoteRoot, remoteDir, remoteFileName)
 
 }
 
+// statSizes replaces the files the remote listed without a size by the result of a stat,
+// at most StatSizeLimit files per listing and StatSizeConcurrency stats at once
+func (d *Crypt) statSizes(ctx context.Context, remoteDir string, objs []model.Obj) []model.Obj {
+	var unsized []int
+	for i, obj := range objs {
+		if !obj.IsDir() && obj.GetSize() <= 0 && !isReservedName(obj.GetName()) {
+			unsized = append(unsized, i)
+		}
+	}
+	if len(unsized) == 0 {
+		return objs
+	}
+	if d.StatSizeLimit > 0 && len(unsized) > d.StatSizeLimit {
+		log.Warnf("%d files in %s listed without size, only the first %d are resolved", len(unsized), remoteDir, d.StatSizeLimit)
+		unsized = unsized[:d.StatSizeLimit]
+	}
+	// objs may be cached by the remote, don't modify it in place
+	objs = append([]model.Obj(nil), objs...)
+	sem := make(chan struct{}, d.StatSizeConcurrency)
+	var wg sync.WaitGroup
+	for _, i := range unsized {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			obj, err := fs.Get(ctx, stdpath.Join(remoteDir, objs[i].GetName()), d.remoteGetArgs())
+			if err != nil {
+				log.Debugf("failed to stat %s: %s", objs[i].GetName(), err)
+				return
+			}
+			objs[i] = obj
+		}(i)
+	}
+	wg.Wait()
+	return objs
+}
+
+// remoteSorted reports whether the remote already lists in the order configured for the storage
+func (d *Crypt) remoteSorted() bool {
+	remote, storage := d.remoteStorage.GetStorage(), d.GetStorage()
+	return d.remoteStorage.Config().LocalSort && remote.OrderBy == storage.OrderBy && remote.OrderDirection == storage.OrderDirection
+}
+
+// checkNameLength checks the name remoteName stores name under on the remote against MaxNameLength
+func (d *Crypt) checkNameLength(name, remoteName string) error {
+	if d.MaxNameLength > 0 && len(remoteName) > d.MaxNameLength {
+		return fmt.Errorf("%w: %s is %d bytes once encrypted, the limit is %d", ErrNameTooLong, name, len(remoteName), d.MaxNameLength)
+	}
+	return nil
+}
+
 // actual path is used for internal only. any link for user should come from remoteFullPath
 func (d *Crypt) getActualPathForRemote(path string, isFolder bool) (string, error) {
 	_, remoteActualPath, err := op.GetStorageAndActualPath(d.getPathForRemote(path, isFolder))
 	return remoteActualPath, err
 }
+
+// StoragesBackedBy returns the Crypt storages whose remote_path resolves to the storage mounted at mountPath,
+// the way Init resolves it, sorted by mount path
+func StoragesBackedBy(mountPath string) []*Crypt {
+	mountPath = utils.FixAndCleanPath(mountPath)
+	var res []*Crypt
+	for _, storage := range op.GetAllStorages() {
+		d, ok := storage.(*Crypt)
+		if !ok {
+			continue
+		}
+		remote, err := fs.GetStorage(d.RemotePath, &fs.GetStoragesArgs{})
+		if err != nil {
+			continue
+		}
+		if remote.GetStorage().MountPath == mountPath {
+			res = append(res, d)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].MountPath < res[j].MountPath
+	})
+	return res
+}
+
+const healthCheckTimeout = 10 * time.Second
+
+// HealthCheck checks that the remote storage can be resolved, the cipher is initialized,
+// and the root of the remote can be listed within healthCheckTimeout. it is served to admins by
+// /api/admin/storage/crypt/health_check
+func (d *Crypt) HealthCheck(ctx context.Context) HealthStatus {
+	var status HealthStatus
+	if _, err := fs.GetStorage(d.RemotePath, &fs.GetStoragesArgs{}); err != nil {
+		status.Error = fmt.Sprintf("can't find remote storage: %s", err)
+		return status
+	}
+	status.RemoteResolved = true
+	if err := d.resolve(ctx); err != nil {
+		status.Error = fmt.Sprintf("cipher is not initialized: %s", err)
+		return status
+	}
+	status.CipherReady = true
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if _, err := fs.List(ctx, d.getPathForRemote("/", true), d.remoteListArgs()); err != nil {
+		status.Error = fmt.Sprintf("failed to list remote: %s", err)
+		return status
+	}
+	status.RemoteListable = true
+	return status
+}
+
+// reservedSuffixes are the suffixes of the internal files the driver keeps next to user files on the remote
+var reservedSuffixes = []string{metaSidecarSuffix, uploadingSuffix, trashDirName, versionSuffix}
+
+func isReservedName(name string) bool {
+	return reservedSuffix(name) != ""
+}
+
+// reservedSuffix returns the reserved suffix name ends with, or "" for a user file
+func reservedSuffix(name string) string {
+	for _, suffix := range reservedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// checkNewName fails for the name of a new object ending with a reserved suffix, it would be taken
+// for an internal file, hidden from listings and not reachable by its path
+func checkNewName(name string) error {
+	if suffix := reservedSuffix(name); suffix != "" {
+		return fmt.Errorf("%w: %q, the names ending with %s are reserved", ErrInvalidName, name, suffix)
+	}
+	return nil
+}
+
+// reservedObj presents a reserved file under its literal name
+func (d *Crypt) reservedObj(remoteObj model.Obj) *model.Object {
+	size, err := d.cipher.DecryptedSize(remoteObj.GetSize())
+	if err != nil {
+		size = remoteObj.GetSize()
+	}
+	return &model.Object{
+		ID:       remoteObj.GetID(),
+		Name:     remoteObj.GetName(),
+		Size:     size,
+		Modified: remoteObj.ModTime(),
+		IsFolder: remoteObj.IsDir(),
+	}
+}
+
+// uploadMimetype is the content type an upload is sent to the remote with. it hides the type of the
+// plaintext unless ContentTypeHint is set
+func (d *Crypt) uploadMimetype(stream model.FileStreamer) string {
+	if !d.ContentTypeHint {
+		return "application/octet-stream"
+	}
+	return utils.GetMimeType(stream.GetName())
+}
@@ -0,0 +1,57 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+// ErrContentCorrupt is returned by VerifyContent when a file doesn't decrypt as a whole
+var ErrContentCorrupt = errors.New("content doesn't authenticate")
+
+// VerifyContent decrypts the whole file at path and discards the plaintext, checking the MAC of
+// every block and that the decrypted size is the one the remote size tells. a file that fails
+// either returns ErrContentCorrupt. files stored without encryption have no MAC to check
+func (d *Crypt) VerifyContent(ctx context.Context, path string) error {
+	file, err := d.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if file.IsDir() {
+		return errs.NotFile
+	}
+	if isPlainObj(file) {
+		return fmt.Errorf("%w: %s is not encrypted", errs.NotSupport, path)
+	}
+	link, size, err := d.sizedLink(ctx, file, model.LinkArgs{})
+	if err != nil {
+		return err
+	}
+	defer link.RangeReadCloser.Closers.Close()
+	rc, err := link.RangeReadCloser.RangeReader(http_range.Range{Length: -1})
+	if err != nil {
+		return d.verifyError(path, err)
+	}
+	defer rc.Close()
+	n, err := io.Copy(io.Discard, rc)
+	if err != nil {
+		return d.verifyError(path, err)
+	}
+	if n != size {
+		return fmt.Errorf("%w: %s decrypted to %d bytes, expected %d", ErrContentCorrupt, path, n, size)
+	}
+	return nil
+}
+
+// verifyError tells a file that doesn't decrypt from a failure to read it
+func (d *Crypt) verifyError(path string, err error) error {
+	if isDecryptError(err) {
+		return fmt.Errorf("%w: %s: %v", ErrContentCorrupt, path, err)
+	}
+	return err
+}
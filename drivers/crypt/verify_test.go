@@ -0,0 +1,30 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVerifyContent(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, nil)
+	for _, name := range []string{"valid.bin", "tampered.bin", "truncated.bin"} {
+		putFile(t, d, "/", name, testData(200*1024))
+	}
+	m.mu.Lock()
+	m.nodes["/"+d.cipher.EncryptFileName("tampered.bin")].data[100*1024] ^= 1
+	truncated := m.nodes["/"+d.cipher.EncryptFileName("truncated.bin")]
+	truncated.data = truncated.data[:len(truncated.data)-100]
+	m.mu.Unlock()
+
+	if err := d.VerifyContent(ctx, "/valid.bin"); err != nil {
+		t.Errorf("expect the valid file to verify, got %v", err)
+	}
+	for _, p := range []string{"/tampered.bin", "/truncated.bin"} {
+		if err := d.VerifyContent(ctx, p); !errors.Is(err, ErrContentCorrupt) {
+			t.Errorf("%s: expect ErrContentCorrupt, got %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/errs"
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	log "github.com/sirupsen/logrus"
+)
+
+// versionSuffix ends the names of the previous versions of a file kept with Versions.
+// a version is the remote object of the file renamed to <remote name>.<id>.alist_version,
+// next to the file, the id is the time it was replaced
+const versionSuffix = ".alist_version"
+
+// versionName returns the remote name of the version id of the file stored as remoteName
+func versionName(remoteName, id string) string {
+	return remoteName + "." + id + versionSuffix
+}
+
+// parseVersionName splits the remote name of a version, ok is false for other names
+func parseVersionName(name string) (remoteName, id string, ok bool) {
+	name, ok = strings.CutSuffix(name, versionSuffix)
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndex(name, ".")
+	if i <= 0 {
+		return "", "", false
+	}
+	return name[:i], name[i+1:], true
+}
+
+// renamedVersionName is the remote name the version called name takes once its file is renamed to newRemoteName
+func renamedVersionName(name, newRemoteName string) string {
+	remoteName, id, _ := parseVersionName(name)
+	_, suffix := contentSuffix(remoteName)
+	encryptedName, _ := contentSuffix(newRemoteName)
+	return versionName(encryptedName+suffix, id)
+}
+
+// keepVersion renames the file at remoteActualPath to a new version of it, and returns the remote
+// actual path of the version. the caller prunes the versions once it is done
+func (d *Crypt) keepVersion(ctx context.Context, remoteActualPath string) (string, error) {
+	d.applyFormats(formatVersions)
+	name := versionName(stdpath.Base(remoteActualPath), strconv.FormatInt(time.Now().UnixNano(), 36))
+	if err := op.Rename(ctx, d.remoteStorage, remoteActualPath, name); err != nil {
+		return "", fmt.Errorf("failed to keep the previous version: %w", err)
+	}
+	return stdpath.Join(stdpath.Dir(remoteActualPath), name), nil
+}
+
+// keepOldVersion keeps old, the file an upload replaces, as a version. it returns the remote actual
+// path of the version and the one old had
+func (d *Crypt) keepOldVersion(ctx context.Context, old model.Obj) (string, string, error) {
+	remoteActualPath, err := d.getObjActualPathForRemote(old)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to convert path to remote path: %w", err)
+	}
+	versionPath, err := d.keepVersion(ctx, remoteActualPath)
+	return versionPath, remoteActualPath, err
+}
+
+// dropOldVersion puts back the version kept by keepOldVersion, when the upload failed
+func (d *Crypt) dropOldVersion(ctx context.Context, versionPath, remoteActualPath string) {
+	if err := op.Rename(ctx, d.remoteStorage, versionPath, stdpath.Base(remoteActualPath)); err != nil {
+		log.Warnf("failed to put back the previous version %s: %s", versionPath, err)
+	}
+}
+
+// pruneVersions removes the oldest versions of the file stored as remoteName, beyond Versions
+func (d *Crypt) pruneVersions(ctx context.Context, dirActualPath, remoteName string) {
+	versions, err := d.remoteVersions(ctx, dirActualPath, remoteName)
+	if err != nil {
+		log.Warnf("failed to list the versions of %s: %s", stdpath.Join(dirActualPath, remoteName), err)
+		return
+	}
+	for i := 0; i < len(versions)-d.Versions; i++ {
+		if err = op.Remove(ctx, d.remoteStorage, stdpath.Join(dirActualPath, versions[i].GetName())); err != nil {
+			log.Warnf("failed to remove version %s: %s", versions[i].GetName(), err)
+		}
+	}
+}
+
+// syncVersions applies fn to the versions of the file stored at remoteActualPath before it was handled,
+// so that they go with their file and a new file of the name doesn't take them. failures are only logged
+func (d *Crypt) syncVersions(ctx context.Context, remoteActualPath string, fn func(versionPath string) error) {
+	if !d.formatApplied(formatVersions) {
+		return
+	}
+	dirActualPath := stdpath.Dir(remoteActualPath)
+	versions, err := d.remoteVersions(ctx, dirActualPath, stdpath.Base(remoteActualPath))
+	if err != nil {
+		log.Warnf("failed to list the versions of %s: %s", remoteActualPath, err)
+		return
+	}
+	for _, version := range versions {
+		versionPath := stdpath.Join(dirActualPath, version.GetName())
+		if err = fn(versionPath); err != nil {
+			log.Warnf("failed to update version %s: %s", versionPath, err)
+		}
+	}
+}
+
+// remoteVersions returns the remote objects of the versions of the file stored as one of remoteNames
+// in the remote directory dirActualPath, oldest first
+func (d *Crypt) remoteVersions(ctx context.Context, dirActualPath string, remoteNames ...string) ([]model.Obj, error) {
+	objs, err := op.List(ctx, d.remoteStorage, dirActualPath, model.ListArgs{}, true)
+	if err != nil {
+		return nil, err
+	}
+	var versions []model.Obj
+	for _, obj := range objs {
+		remoteName, _, ok := parseVersionName(obj.GetName())
+		if !ok || obj.IsDir() {
+			continue
+		}
+		if encryptedName, suffix := contentSuffix(remoteName); suffix != plainSuffix {
+			// the name of a compressed file changes with its size, of a file named after its content
+			// with its content, their versions go by the encrypted name
+			remoteName = encryptedName
+		}
+		for _, name := range remoteNames {
+			if encryptedName, suffix := contentSuffix(name); suffix != plainSuffix {
+				name = encryptedName
+			}
+			if remoteName == name {
+				versions = append(versions, obj)
+				break
+			}
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versionTime(versions[i].GetName()) < versionTime(versions[j].GetName())
+	})
+	return versions, nil
+}
+
+func versionTime(name string) int64 {
+	_, id, _ := parseVersionName(name)
+	t, _ := strconv.ParseInt(id, 36, 64)
+	return t
+}
+
+// versionRemoteNames are the names the file at path may be stored under on the remote
+func (d *Crypt) versionRemoteNames(path string) []string {
+	name := stdpath.Base(path)
+	encryptedName := d.cipher.EncryptFileName(name)
+	return []string{encryptedName, encryptedName + plainSuffix, name + clearSuffix}
+}
+
+// ListVersions returns the previous versions kept of the file at path, oldest first
+func (d *Crypt) ListVersions(ctx context.Context, path string) ([]FileVersion, error) {
+	if err := d.resolve(ctx); err != nil {
+		return nil, err
+	}
+	path, _ = d.cleanPath(path)
+	dirActualPath, err := d.getActualPathForRemote(stdpath.Dir(path), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert path to remote path: %w", err)
+	}
+	objs, err := d.remoteVersions(ctx, dirActualPath, d.versionRemoteNames(path)...)
+	if err != nil {
+		if errs.IsObjectNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	res := make([]FileVersion, 0, len(objs))
+	for _, obj := range objs {
+		remoteName, id, _ := parseVersionName(obj.GetName())
+		size := obj.GetSize()
+		if _, plainSize, compressed := parseCompressedName(remoteName); compressed {
+			size = plainSize
+		} else if !strings.HasSuffix(remoteName, plainSuffix) && !strings.HasSuffix(remoteName, clearSuffix) {
+			if decryptedSize, err := d.cipher.DecryptedSize(size); err == nil {
+				size = decryptedSize
+			}
+		}
+		res = append(res, FileVersion{ID: id, Size: size, Modified: time.Unix(0, versionTime(obj.GetName()))})
+	}
+	return res, nil
+}
+
+// RestoreVersion makes the version id of the file at path its current content. the current content
+// is kept as a version in turn, with Versions, or removed
+func (d *Crypt) RestoreVersion(ctx context.Context, path, id string) error {
+	if err := d.resolve(ctx); err != nil {
+		return err
+	}
+	if id == "" || strings.ContainsAny(id, "./") {
+		return fmt.Errorf("%w: version %q", ErrInvalidName, id)
+	}
+	path, _ = d.cleanPath(path)
+	dirActualPath, err := d.getActualPathForRemote(stdpath.Dir(path), true)
+	if err != nil {
+		return fmt.Errorf("failed to convert path to remote path: %w", err)
+	}
+	objs, err := d.remoteVersions(ctx, dirActualPath, d.versionRemoteNames(path)...)
+	if err != nil {
+		return err
+	}
+	var version model.Obj
+	for _, obj := range objs {
+		if _, objID, _ := parseVersionName(obj.GetName()); objID == id {
+			version = obj
+		}
+	}
+	if version == nil {
+		return fmt.Errorf("%w: version %s of %s", errs.ObjectNotFound, id, path)
+	}
+	if current, err := d.Get(ctx, path); err == nil {
+		if current.IsDir() {
+			return fmt.Errorf("%w: %s is a directory", ErrTypeMismatch, path)
+		}
+		currentActualPath, err := d.getObjActualPathForRemote(current)
+		if err != nil {
+			return fmt.Errorf("failed to convert path to remote path: %w", err)
+		}
+		if d.Versions > 0 {
+			_, err = d.keepVersion(ctx, currentActualPath)
+			defer d.pruneVersions(ctx, dirActualPath, stdpath.Base(currentActualPath))
+		} else {
+			err = op.Remove(ctx, d.remoteStorage, currentActualPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	remoteName, _, _ := parseVersionName(version.GetName())
+	if format := remoteNameFormat(remoteName); format != "" {
+		// the version may only have been listed as one
+		d.applyFormats(format)
+	}
+	return op.Rename(ctx, d.remoteStorage, stdpath.Join(dirActualPath, version.GetName()), remoteName)
+}
@@ -0,0 +1,150 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestVersions(t *testing.T) {
+	ctx := context.Background()
+	for _, atomicPut := range []bool{false, true} {
+		_, remote := newTestRemote(t, linkModeRange)
+		d := newTestCrypt(t, remote, map[string]interface{}{"versions": 2, "atomic_put": atomicPut})
+		contents := [][]byte{testData(100), testData(200), testData(300), testData(400)}
+		for _, data := range contents {
+			putFile(t, d, "/", "a.txt", data)
+			// version ids are times
+			time.Sleep(time.Millisecond)
+		}
+
+		objs, err := op.List(ctx, d, "/", model.ListArgs{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objs) != 1 || objs[0].GetName() != "a.txt" {
+			t.Errorf("atomic_put %v: expect the versions to be hidden, got %d objects", atomicPut, len(objs))
+		}
+		if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, contents[3]) {
+			t.Errorf("atomic_put %v: expect the last upload to be the content", atomicPut)
+		}
+		versions, err := d.ListVersions(ctx, "/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the oldest is pruned
+		if len(versions) != 2 || versions[0].Size != 200 || versions[1].Size != 300 {
+			t.Fatalf("atomic_put %v: expect the 2 previous versions, got %+v", atomicPut, versions)
+		}
+
+		if err = d.RestoreVersion(ctx, "/a.txt", versions[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, contents[1]) {
+			t.Errorf("atomic_put %v: expect the restored version to be the content", atomicPut)
+		}
+		if versions, _ = d.ListVersions(ctx, "/a.txt"); len(versions) != 2 || versions[0].Size != 300 || versions[1].Size != 400 {
+			t.Errorf("atomic_put %v: expect the replaced content to be kept as a version, got %+v", atomicPut, versions)
+		}
+		if err = d.RestoreVersion(ctx, "/a.txt", "nope"); err == nil {
+			t.Errorf("atomic_put %v: expect an unknown version to fail", atomicPut)
+		}
+	}
+}
+
+func TestVersionsFailedUpload(t *testing.T) {
+	ctx := context.Background()
+	m, remote := newTestRemote(t, linkModeRange)
+	d := newTestCrypt(t, remote, map[string]interface{}{"versions": 1})
+	data := testData(100)
+	putFile(t, d, "/", "a.txt", data)
+	m.putFailAfter = 10
+	err := op.Put(ctx, d, "/", &model.FileStream{
+		Obj:        &model.Object{Name: "a.txt", Size: 1000, Modified: time.Now()},
+		ReadCloser: io.NopCloser(bytes.NewReader(testData(1000))),
+	}, nil)
+	if err == nil {
+		t.Fatal("expect the upload to fail")
+	}
+	if got := readRange(t, d, "/a.txt", http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+		t.Errorf("expect the previous content to be put back")
+	}
+	if versions, _ := d.ListVersions(ctx, "/a.txt"); len(versions) != 0 {
+		t.Errorf("expect no version of a failed upload, got %+v", versions)
+	}
+}
+
+// the versions of a file go with it, a new file of its name starts without history
+func TestVersionsFollowFile(t *testing.T) {
+	ctx := context.Background()
+	for _, trash := range []bool{false, true} {
+		_, remote := newTestRemote(t, linkModeRange)
+		d := newTestCrypt(t, remote, map[string]interface{}{"versions": 2, "trash": trash})
+		if err := op.MakeDir(ctx, d, "/dir"); err != nil {
+			t.Fatal(err)
+		}
+		putVersions := func(name string) {
+			for _, data := range [][]byte{testData(100), testData(200)} {
+				putFile(t, d, "/", name, data)
+				time.Sleep(time.Millisecond)
+			}
+		}
+		countVersions := func(path string) int {
+			versions, err := d.ListVersions(ctx, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return len(versions)
+		}
+
+		putVersions("a.txt")
+		if err := op.Remove(ctx, d, "/a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		putFile(t, d, "/", "a.txt", testData(300))
+		if n := countVersions("/a.txt"); n != 0 {
+			t.Errorf("trash %v: expect a recreated file not to inherit the versions of the removed one, got %d", trash, n)
+		}
+		if trash {
+			entries, err := d.ListTrash(ctx)
+			if err != nil || len(entries) != 1 {
+				t.Fatalf("trash %v: expect a trash entry, got %v, %v", trash, entries, err)
+			}
+			if err = op.Remove(ctx, d, "/a.txt"); err != nil {
+				t.Fatal(err)
+			}
+			if err = d.RestoreTrash(ctx, entries[0].ID); err != nil {
+				t.Fatal(err)
+			}
+			if n := countVersions("/a.txt"); n != 1 {
+				t.Errorf("trash %v: expect the versions to be restored with the file, got %d", trash, n)
+			}
+		}
+
+		putVersions("b.txt")
+		if err := op.Rename(ctx, d, "/b.txt", "c.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if n := countVersions("/c.txt"); n != 1 {
+			t.Errorf("trash %v: expect the versions to be renamed with the file, got %d", trash, n)
+		}
+		if n := countVersions("/b.txt"); n != 0 {
+			t.Errorf("trash %v: expect no versions left under the old name, got %d", trash, n)
+		}
+		if err := op.Move(ctx, d, "/c.txt", "/dir"); err != nil {
+			t.Fatal(err)
+		}
+		if n := countVersions("/dir/c.txt"); n != 1 {
+			t.Errorf("trash %v: expect the versions to be moved with the file, got %d", trash, n)
+		}
+		if n := countVersions("/c.txt"); n != 0 {
+			t.Errorf("trash %v: expect no versions left in the old directory, got %d", trash, n)
+		}
+	}
+}
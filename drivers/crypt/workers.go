@@ -0,0 +1,115 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/alist-org/alist/v3/internal/driver"
+)
+
+// FileError is a file that CopyTo or Import failed to copy
+type FileError struct {
+	Path string `json:"path"`
+	Err  error  `json:"-"`
+}
+
+// FilesError is returned by CopyTo and Import when files failed to copy, the others were copied
+type FilesError struct {
+	Files []FileError
+}
+
+func (e *FilesError) Error() string {
+	return fmt.Sprintf("%d files failed to copy, the first %s: %v", len(e.Files), e.Files[0].Path, e.Files[0].Err)
+}
+
+func (e *FilesError) Unwrap() []error {
+	errs := make([]error, len(e.Files))
+	for i, f := range e.Files {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// copyWorkers is the number of files CopyTo and Import copy at once. with MaxStreams, each copy of
+// a file of the storage takes a stream, the copies don't take more than there are
+func (d *Crypt) copyWorkers() int {
+	workers := d.MigrationWorkers
+	if d.MaxStreams > 0 && workers > d.MaxStreams {
+		workers = d.MaxStreams
+	}
+	if workers < 1 {
+		return 1
+	}
+	return workers
+}
+
+// runCopyJobs copies the files of jobs with copyFile, workers at once, and counts them in res. a file
+// that fails doesn't stop the others, the failures are returned together as a *FilesError. no file
+// is started once ctx is done
+func runCopyJobs(ctx context.Context, workers int, jobs []copyJob, res *ImportResult, copyFile func(ctx context.Context, job copyJob) (skipped bool, err error)) error {
+	var mu sync.Mutex
+	var failed []FileError
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+loop:
+	for _, job := range jobs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(job copyJob) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			skipped, err := copyFile(ctx, job)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				res.Failed++
+				failed = append(failed, FileError{Path: job.srcPath, Err: err})
+			case skipped:
+				res.Skipped++
+			default:
+				res.Imported++
+			}
+		}(job)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		sort.Slice(failed, func(i, j int) bool { return failed[i].Path < failed[j].Path })
+		return &FilesError{Files: failed}
+	}
+	return nil
+}
+
+// copyProgress is the progress of the bytes of the files copied at once
+type copyProgress struct {
+	mu sync.Mutex
+	p  *driver.Progress
+}
+
+func (p *copyProgress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.p.Write(b)
+}
+
+// add counts n bytes done without reporting them, for the files skipped
+func (p *copyProgress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.p.Done += n
+}
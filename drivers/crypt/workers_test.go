@@ -0,0 +1,81 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/http_range"
+)
+
+func TestCopyToWorkers(t *testing.T) {
+	ctx := context.Background()
+	srcFS, srcRemote := newTestRemote(t, linkModeRange)
+	m, dstRemote := newTestRemote(t, linkModeRange)
+	src := newTestCrypt(t, srcRemote, map[string]interface{}{"migration_workers": 3})
+	dst := newTestCrypt(t, dstRemote, map[string]interface{}{"password": "new password", "salt": "new salt"})
+	if err := op.MakeDir(ctx, src, "/docs"); err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("%d.bin", i)
+		files[name] = testData(1000 * (i + 1))
+		putFile(t, src, "/docs", name, files[name])
+	}
+	srcFS.mu.Lock()
+	srcFS.nodes["/"+src.EncryptName("docs", true)+"/"+src.EncryptName("5.bin", false)].data[0] ^= 1
+	srcFS.mu.Unlock()
+	m.putDelay = 20 * time.Millisecond
+
+	var progress []int
+	res, err := src.CopyTo(ctx, "/docs", dst, "/moved", func(p int) { progress = append(progress, p) })
+	var filesErr *FilesError
+	if !errors.As(err, &filesErr) || len(filesErr.Files) != 1 || filesErr.Files[0].Path != "/docs/5.bin" {
+		t.Fatalf("expect the corrupt file to be reported alone, got %v", err)
+	}
+	if res != (ImportResult{Imported: 7, Failed: 1}) {
+		t.Errorf("got %+v", res)
+	}
+	if m.putsMaxActive < 2 || m.putsMaxActive > 3 {
+		t.Errorf("expect 2 to 3 files copied at once, got %d", m.putsMaxActive)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] < progress[i-1] {
+			t.Errorf("expect the progress to grow, got %v", progress)
+			break
+		}
+	}
+	for name, data := range files {
+		if name == "5.bin" {
+			continue
+		}
+		if got := readRange(t, dst, "/moved/"+name, http_range.Range{Length: -1}); !bytes.Equal(got, data) {
+			t.Errorf("read mismatch of %s", name)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = src.CopyTo(cancelled, "/docs", dst, "/again", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expect a cancelled copy to stop, got %v", err)
+	}
+}
+
+func TestCopyWorkers(t *testing.T) {
+	for _, c := range []struct{ workers, maxStreams, want int }{
+		{0, 0, 1},
+		{4, 0, 4},
+		{4, 2, 2},
+		{1, 2, 1},
+	} {
+		d := &Crypt{Addition: Addition{MigrationWorkers: c.workers, MaxStreams: c.maxStreams}}
+		if got := d.copyWorkers(); got != c.want {
+			t.Errorf("%d workers, %d streams: expect %d, got %d", c.workers, c.maxStreams, c.want, got)
+		}
+	}
+}
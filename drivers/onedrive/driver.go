@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"path"
+	"strings"
 
 	"github.com/alist-org/alist/v3/drivers/base"
 	"github.com/alist-org/alist/v3/internal/driver"
@@ -32,6 +34,10 @@ func (d *Onedrive) Init(ctx context.Context) error {
 	if d.ChunkSize < 1 {
 		d.ChunkSize = 5
 	}
+	// the urls are built from the hosts of the region
+	if _, ok := onedriveHostMap[d.Region]; !ok {
+		return fmt.Errorf("unknown region: %s", d.Region)
+	}
 	return d.refreshToken()
 }
 
@@ -62,6 +68,30 @@ func (d *Onedrive) Link(ctx context.Context, file model.Obj, args model.LinkArgs
 	}, nil
 }
 
+// GetByID gets the item id, with the path List gives it. items out of the root folder aren't found
+func (d *Onedrive) GetByID(ctx context.Context, id string) (model.Obj, error) {
+	var f File
+	_, err := d.Request(d.GetItemUrl(id)+"?$select=id,name,size,lastModifiedDateTime,file,parentReference", http.MethodGet, nil, &f)
+	if err != nil {
+		return nil, err
+	}
+	// the root has no parent path, items of other drives have another one
+	parent, ok := strings.CutPrefix(f.ParentReference.Path, "/drive/root:")
+	if !ok {
+		return nil, errs.ObjectNotFound
+	}
+	if unescaped, err := url.PathUnescape(parent); err == nil {
+		parent = unescaped
+	}
+	p := utils.FixAndCleanPath(path.Join(parent, f.Name))
+	if !utils.IsSubPath(d.RootFolderPath, p) {
+		return nil, errs.ObjectNotFound
+	}
+	obj := fileToObj(f, "")
+	obj.Path = p
+	return obj, nil
+}
+
 func (d *Onedrive) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
 	url := d.GetMetaUrl(false, parentDir.GetPath()) + "/children"
 	data := base.Json{
@@ -158,3 +188,4 @@ func (d *Onedrive) Put(ctx context.Context, dstDir model.Obj, stream model.FileS
 }
 
 var _ driver.Driver = (*Onedrive)(nil)
+var _ driver.GetterByID = (*Onedrive)(nil)
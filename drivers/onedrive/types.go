@@ -39,6 +39,7 @@ type File struct {
 	} `json:"thumbnails"`
 	ParentReference struct {
 		DriveId string `json:"driveId"`
+		Path    string `json:"path"`
 	} `json:"parentReference"`
 }
 
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	stdpath "path"
 	"strconv"
 
@@ -41,7 +42,7 @@ var onedriveHostMap = map[string]Host{
 }
 
 func (d *Onedrive) GetMetaUrl(auth bool, path string) string {
-	host, _ := onedriveHostMap[d.Region]
+	host := onedriveHostMap[d.Region]
 	path = utils.EncodePath(path, true)
 	if auth {
 		return host.Oauth
@@ -61,6 +62,14 @@ func (d *Onedrive) GetMetaUrl(auth bool, path string) string {
 	}
 }
 
+func (d *Onedrive) GetItemUrl(id string) string {
+	host := onedriveHostMap[d.Region]
+	if d.IsSharepoint {
+		return fmt.Sprintf("%s/v1.0/sites/%s/drive/items/%s", host.Api, d.SiteId, url.PathEscape(id))
+	}
+	return fmt.Sprintf("%s/v1.0/me/drive/items/%s", host.Api, url.PathEscape(id))
+}
+
 func (d *Onedrive) refreshToken() error {
 	var err error
 	for i := 0; i < 3; i++ {
@@ -52,10 +52,17 @@ func (d *S3) Drop(ctx context.Context) error {
 }
 
 func (d *S3) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	var files []model.Obj
+	var err error
 	if d.ListObjectVersion == "v2" {
-		return d.listV2(dir.GetPath(), args)
+		files, err = d.listV2(dir.GetPath(), args)
+	} else {
+		files, err = d.listV1(dir.GetPath(), args)
 	}
-	return d.listV1(dir.GetPath(), args)
+	if err != nil || !d.ListUploads {
+		return files, err
+	}
+	return d.listUploads(dir.GetPath(), files)
 }
 
 func (d *S3) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
@@ -130,6 +137,9 @@ func (d *S3) Remove(ctx context.Context, obj model.Obj) error {
 	if obj.IsDir() {
 		return d.removeDir(ctx, obj.GetPath())
 	}
+	if upload, ok := model.UnwrapObj(obj).(*uploadObject); ok {
+		return d.abortUpload(obj.GetPath(), upload.uploadID)
+	}
 	return d.removeFile(obj.GetPath())
 }
 
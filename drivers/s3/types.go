@@ -1 +1,14 @@
 package s3
+
+import "github.com/alist-org/alist/v3/internal/model"
+
+// uploadObject is a multipart upload not completed yet, listed with ListUploads. drivers over
+// the storage, like Crypt, tell it from a complete file with IsUploading
+type uploadObject struct {
+	model.Object
+	uploadID string
+}
+
+func (o *uploadObject) IsUploading() bool {
+	return true
+}
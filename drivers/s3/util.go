@@ -247,3 +247,69 @@ func (d *S3) removeFile(src string) error {
 	_, err := d.client.DeleteObject(input)
 	return err
 }
+
+// listUploads adds to files the multipart uploads not completed yet under prefix, with ListUploads.
+// an upload of a key already listed replaces a complete file, which is the one listed.
+// the parts are not listed, an upload has no size, only the time it was started
+func (d *S3) listUploads(prefix string, files []model.Obj) ([]model.Obj, error) {
+	prefix = getKey(prefix, true)
+	uploads := make(map[string]*uploadObject)
+	var keyMarker, uploadIdMarker *string
+	for {
+		input := &s3.ListMultipartUploadsInput{
+			Bucket:         &d.Bucket,
+			Prefix:         &prefix,
+			Delimiter:      aws.String("/"),
+			KeyMarker:      keyMarker,
+			UploadIdMarker: uploadIdMarker,
+		}
+		listUploadsResult, err := d.client.ListMultipartUploads(input)
+		if err != nil {
+			return nil, err
+		}
+		addUploads(uploads, listUploadsResult.Uploads)
+		if !aws.BoolValue(listUploadsResult.IsTruncated) {
+			break
+		}
+		keyMarker, uploadIdMarker = listUploadsResult.NextKeyMarker, listUploadsResult.NextUploadIdMarker
+	}
+	return mergeUploads(files, uploads), nil
+}
+
+// addUploads keeps in uploads, by name, the last started of the multipart uploads of each key
+func addUploads(uploads map[string]*uploadObject, page []*s3.MultipartUpload) {
+	for _, upload := range page {
+		name := path.Base(aws.StringValue(upload.Key))
+		initiated := aws.TimeValue(upload.Initiated)
+		// of several uploads of a key, the last one started is the one that will complete
+		if u, ok := uploads[name]; ok && !u.Modified.Before(initiated) {
+			continue
+		}
+		uploads[name] = &uploadObject{Object: model.Object{
+			Name:     name,
+			Modified: initiated,
+		}, uploadID: aws.StringValue(upload.UploadId)}
+	}
+}
+
+// mergeUploads appends to files the uploads of the names not in files
+func mergeUploads(files []model.Obj, uploads map[string]*uploadObject) []model.Obj {
+	for _, file := range files {
+		delete(uploads, file.GetName())
+	}
+	for _, upload := range uploads {
+		files = append(files, upload)
+	}
+	return files
+}
+
+func (d *S3) abortUpload(src, uploadID string) error {
+	key := getKey(src, false)
+	input := &s3.AbortMultipartUploadInput{
+		Bucket:   &d.Bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	}
+	_, err := d.client.AbortMultipartUpload(input)
+	return err
+}
@@ -0,0 +1,38 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestMergeUploads(t *testing.T) {
+	started := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	uploads := make(map[string]*uploadObject)
+	addUploads(uploads, []*s3.MultipartUpload{
+		{Key: aws.String("dir/a.bin"), UploadId: aws.String("a1"), Initiated: aws.Time(started)},
+		{Key: aws.String("dir/a.bin"), UploadId: aws.String("a2"), Initiated: aws.Time(started.Add(time.Hour))},
+		{Key: aws.String("dir/b.bin"), UploadId: aws.String("b1"), Initiated: aws.Time(started)},
+	})
+	// the next page lists an older upload of a.bin
+	addUploads(uploads, []*s3.MultipartUpload{
+		{Key: aws.String("dir/a.bin"), UploadId: aws.String("a0"), Initiated: aws.Time(started.Add(-time.Hour))},
+	})
+	files := mergeUploads([]model.Obj{&model.Object{Name: "b.bin", Size: 10}}, uploads)
+	if len(files) != 2 {
+		t.Fatalf("expect the upload of a listed file to be left out, got %d files", len(files))
+	}
+	if files[0].GetSize() != 10 {
+		t.Errorf("expect the complete b.bin to be kept, got %+v", files[0])
+	}
+	upload, ok := files[1].(*uploadObject)
+	if !ok || upload.GetName() != "a.bin" || upload.uploadID != "a2" || !upload.ModTime().Equal(started.Add(time.Hour)) || upload.GetSize() != 0 {
+		t.Errorf("expect the last upload of a.bin started, got %+v", files[1])
+	}
+	if !upload.IsUploading() {
+		t.Error("expect the upload to be told from a complete file")
+	}
+}
@@ -47,6 +47,17 @@ type Getter interface {
 	Get(ctx context.Context, path string) (model.Obj, error)
 }
 
+type GetterByID interface {
+	// GetByID get file by its id, the obj has the path List gives it, joined with root path
+	GetByID(ctx context.Context, id string) (model.Obj, error)
+}
+
+type HeadSizer interface {
+	// HeadSize returns the size to answer a HEAD request for file, got with Get, without a link.
+	// an error makes the request answered from a link
+	HeadSize(ctx context.Context, file model.Obj) (int64, error)
+}
+
 //type Writer interface {
 //	Mkdir
 //	Move
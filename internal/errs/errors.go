@@ -17,6 +17,7 @@ var (
 	MetaNotFound     = errors.New("meta not found")
 	StorageNotFound  = errors.New("storage not found")
 	StreamIncomplete = errors.New("upload/download stream incomplete, possible network issue")
+	QuotaExceeded    = errors.New("storage quota exceeded")
 )
 
 // NewErr wrap constant error with an extra message
@@ -1,6 +1,7 @@
 package net
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"mime"
@@ -210,7 +211,12 @@ func ProcessHeader(origin, override http.Header) http.Header {
 
 // RequestHttp deal with Header properly then send the request
 func RequestHttp(httpMethod string, headerOverride http.Header, URL string) (*http.Response, error) {
-	req, err := http.NewRequest(httpMethod, URL, nil)
+	return RequestHttpWithContext(context.Background(), httpMethod, headerOverride, URL)
+}
+
+// RequestHttpWithContext is RequestHttp that is aborted when ctx is done
+func RequestHttpWithContext(ctx context.Context, httpMethod string, headerOverride http.Header, URL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, httpMethod, URL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -88,6 +88,13 @@ func ClearCache(storage driver.Driver, path string) {
 	listCache.Del(Key(storage, path))
 }
 
+// ClearLinkCache drops the cached link of path, for links that expired before their Expiration
+func ClearLinkCache(storage driver.Driver, path string, args model.LinkArgs) {
+	key := Key(storage, path)
+	linkCache.Del(key)
+	linkCache.Del(key + ":" + args.IP)
+}
+
 func Key(storage driver.Driver, path string) string {
 	return stdpath.Join(storage.GetStorage().MountPath, utils.FixAndCleanPath(path))
 }
@@ -505,7 +512,8 @@ func Put(ctx context.Context, storage driver.Driver, dstDirPath string, file *mo
 	tempPath := stdpath.Join(dstDirPath, tempName)
 	fi, err := GetUnwrap(ctx, storage, dstPath)
 	if err == nil {
-		if fi.GetSize() == 0 {
+		// a directory reports size 0 too, it's not an empty file to replace
+		if fi.GetSize() == 0 && !fi.IsDir() {
 			err = Remove(ctx, storage, dstPath)
 			if err != nil {
 				return errors.WithMessagef(err, "failed remove file that exist and have size 0")
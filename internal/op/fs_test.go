@@ -0,0 +1,61 @@
+package op_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alist-org/alist/v3/internal/model"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/pkg/utils"
+)
+
+// an upload named like a directory doesn't remove the directory, which has size 0 like an empty file
+func TestPutOverDirectory(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "x", "keep.txt"), []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "empty.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	addition, err := utils.Json.MarshalToString(map[string]string{"root_folder_path": root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := op.CreateStorage(ctx, model.Storage{Driver: "Local", MountPath: "/put_over_dir", Addition: addition})
+	if err != nil {
+		t.Fatalf("failed to create storage: %+v", err)
+	}
+	t.Cleanup(func() { _ = op.DeleteStorageById(ctx, id) })
+	storage, err := op.GetStorageByMountPath("/put_over_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(name string, data []byte) error {
+		return op.Put(ctx, storage, "/", &model.FileStream{
+			Obj:        &model.Object{Name: name, Size: int64(len(data)), Modified: time.Now()},
+			ReadCloser: io.NopCloser(bytes.NewReader(data)),
+		}, nil)
+	}
+
+	_ = put("x", []byte("file"))
+	if data, err := os.ReadFile(filepath.Join(root, "x", "keep.txt")); err != nil || string(data) != "keep" {
+		t.Errorf("expect the directory to be kept, got %q, %v", data, err)
+	}
+	// an empty file is still replaced
+	if err = put("empty.txt", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "empty.txt")); err != nil || string(data) != "content" {
+		t.Errorf("expect the empty file to be replaced, got %q, %v", data, err)
+	}
+}
@@ -4,6 +4,7 @@ package task
 import (
 	"context"
 	"runtime"
+	"sync"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -22,8 +23,10 @@ type Func[K comparable] func(task *Task[K]) error
 type Callback[K comparable] func(task *Task[K])
 
 type Task[K comparable] struct {
-	ID       K
-	Name     string
+	ID   K
+	Name string
+	// mu guards state, status, progress and Error, which the task sets while others read them
+	mu       sync.RWMutex
 	state    string // pending, running, finished, canceling, canceled, errored
 	status   string
 	progress int
@@ -38,26 +41,44 @@ type Task[K comparable] struct {
 }
 
 func (t *Task[K]) SetStatus(status string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.status = status
 }
 
 func (t *Task[K]) SetProgress(percentage int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.progress = percentage
 }
 
-func (t Task[K]) GetProgress() int {
+func (t *Task[K]) GetProgress() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.progress
 }
 
-func (t Task[K]) GetState() string {
+func (t *Task[K]) GetState() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.state
 }
 
-func (t Task[K]) GetStatus() string {
+func (t *Task[K]) setState(state string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state = state
+}
+
+func (t *Task[K]) GetStatus() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.status
 }
 
-func (t Task[K]) GetErrMsg() string {
+func (t *Task[K]) GetErrMsg() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	if t.Error == nil {
 		return ""
 	}
@@ -71,28 +92,34 @@ func getCurrentGoroutineStack() string {
 }
 
 func (t *Task[K]) run() {
-	t.state = RUNNING
+	t.setState(RUNNING)
 	defer func() {
 		if err := recover(); err != nil {
 			log.Errorf("error [%s] while run task [%s],stack trace:\n%s", err, t.Name, getCurrentGoroutineStack())
+			t.mu.Lock()
 			t.Error = errors.Errorf("panic: %+v", err)
 			t.state = ERRORED
+			t.mu.Unlock()
 		}
 	}()
-	t.Error = t.Func(t)
-	if t.Error != nil {
-		log.Errorf("error [%+v] while run task [%s]", t.Error, t.Name)
+	err := t.Func(t)
+	if err != nil {
+		log.Errorf("error [%+v] while run task [%s]", err, t.Name)
 	}
+	t.mu.Lock()
+	t.Error = err
 	if errors.Is(t.Ctx.Err(), context.Canceled) {
 		t.state = CANCELED
-	} else if t.Error != nil {
+	} else if err != nil {
 		t.state = ERRORED
 	} else {
 		t.state = SUCCEEDED
-		t.SetProgress(100)
-		if t.callback != nil {
-			t.callback(t)
-		}
+		t.progress = 100
+	}
+	succeeded := t.state == SUCCEEDED
+	t.mu.Unlock()
+	if succeeded && t.callback != nil {
+		t.callback(t)
 	}
 }
 
@@ -101,10 +128,13 @@ func (t *Task[K]) retry() {
 }
 
 func (t *Task[K]) Done() bool {
-	return t.state == SUCCEEDED || t.state == CANCELED || t.state == ERRORED
+	state := t.GetState()
+	return state == SUCCEEDED || state == CANCELED || state == ERRORED
 }
 
 func (t *Task[K]) Cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if t.state == SUCCEEDED || t.state == CANCELED {
 		return
 	}
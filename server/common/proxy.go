@@ -95,6 +95,15 @@ func Proxy(w http.ResponseWriter, r *http.Request, link *model.Link, file model.
 		return nil
 	}
 }
+
+// ServeHead answers a HEAD request for file of the size without a link, no content is opened
+func ServeHead(w http.ResponseWriter, r *http.Request, file model.Obj, size int64) {
+	attachFileName(w, file)
+	net.ServeHTTP(w, r, file.GetName(), file.ModTime(), size, func(http_range.Range) (io.ReadCloser, error) {
+		return http.NoBody, nil
+	})
+}
+
 func attachFileName(w http.ResponseWriter, file model.Obj) {
 	fileName := file.GetName()
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fileName, url.PathEscape(fileName)))
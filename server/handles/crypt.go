@@ -0,0 +1,37 @@
+package handles
+
+import (
+	"strconv"
+
+	"github.com/alist-org/alist/v3/drivers/crypt"
+	"github.com/alist-org/alist/v3/internal/db"
+	"github.com/alist-org/alist/v3/internal/op"
+	"github.com/alist-org/alist/v3/server/common"
+	"github.com/gin-gonic/gin"
+)
+
+// CryptHealthCheck checks that the Crypt storage of the id can reach its remote and decrypt
+func CryptHealthCheck(c *gin.Context) {
+	idStr := c.Query("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	storage, err := db.GetStorageById(uint(id))
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	storageDriver, err := op.GetStorageByMountPath(storage.MountPath)
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	d, ok := storageDriver.(*crypt.Crypt)
+	if !ok {
+		common.ErrorStrResp(c, "storage is not a Crypt storage", 400)
+		return
+	}
+	common.SuccessResp(c, d.HealthCheck(c))
+}
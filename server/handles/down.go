@@ -3,6 +3,7 @@ package handles
 import (
 	"fmt"
 	"io"
+	"net/http"
 	stdpath "path"
 	"strings"
 
@@ -84,6 +85,9 @@ func Proxy(c *gin.Context) {
 				return
 			}
 		}
+		if c.Request.Method == http.MethodHead && serveHead(c, storage, rawPath) {
+			return
+		}
 		link, file, err := fs.Link(c, rawPath, model.LinkArgs{
 			Header:  c.Request.Header,
 			Type:    c.Query("type"),
@@ -113,6 +117,25 @@ func Proxy(c *gin.Context) {
 	}
 }
 
+// serveHead answers a HEAD request for a file of a storage that knows its size from Get, so that
+// no link is made. it returns false when the storage can't tell the size, a link is made then
+func serveHead(c *gin.Context, storage driver.Driver, rawPath string) bool {
+	sizer, ok := storage.(driver.HeadSizer)
+	if !ok {
+		return false
+	}
+	file, err := fs.Get(c, rawPath, &fs.GetArgs{})
+	if err != nil {
+		return false
+	}
+	size, err := sizer.HeadSize(c, file)
+	if err != nil {
+		return false
+	}
+	common.ServeHead(c.Writer, c.Request, file, size)
+	return true
+}
+
 // TODO need optimize
 // when can be proxy?
 // 1. text file
@@ -105,6 +105,7 @@ func admin(g *gin.RouterGroup) {
 	storage.POST("/enable", handles.EnableStorage)
 	storage.POST("/disable", handles.DisableStorage)
 	storage.POST("/load_all", handles.LoadAllStorages)
+	storage.GET("/crypt/health_check", handles.CryptHealthCheck)
 
 	driver := g.Group("/driver")
 	driver.GET("/list", handles.ListDriverInfo)